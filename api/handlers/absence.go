@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/itsHenry35/canteen-management-system/api/middlewares"
+	"github.com/itsHenry35/canteen-management-system/models"
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+// CreateAbsenceRequest 登记请假请求，日期格式为 YYYY-MM-DD
+type CreateAbsenceRequest struct {
+	StudentID  int    `json:"student_id"` // 学生或家长登记时忽略
+	StartDate  string `json:"start_date"`
+	EndDate    string `json:"end_date"`
+	Reason     string `json:"reason"`
+	ReportedBy string `json:"reported_by"` // 管理员登记时为 teacher 或 admin，默认为 admin
+}
+
+// parseAbsenceFilter 解析请假记录的查询条件
+func parseAbsenceFilter(r *http.Request) (models.AbsenceFilter, error) {
+	query := r.URL.Query()
+	filter := models.AbsenceFilter{Class: query.Get("class")}
+	filter.StudentID, _ = strconv.Atoi(query.Get("student_id"))
+	filter.Page, _ = strconv.Atoi(query.Get("page"))
+	filter.PageSize, _ = strconv.Atoi(query.Get("page_size"))
+	if filter.PageSize > 100 {
+		filter.PageSize = 100
+	}
+
+	// 解析日期范围
+	from, to, err := parseDateRange(query.Get("from"), query.Get("to"))
+	if err != nil {
+		return filter, err
+	}
+	if !from.IsZero() {
+		filter.From = from.Format("2006-01-02")
+	}
+	if !to.IsZero() {
+		filter.To = to.Format("2006-01-02")
+	}
+	return filter, nil
+}
+
+// GetAbsences 分页查询请假记录，可按学生、班级和日期范围筛选
+func GetAbsences(w http.ResponseWriter, r *http.Request) {
+	// 解析查询参数
+	filter, err := parseAbsenceFilter(r)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 查询记录
+	absences, total, err := models.GetAbsences(filter)
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "获取请假记录失败")
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, map[string]interface{}{
+		"total":    total,
+		"absences": absences,
+	})
+}
+
+// CreateAbsence 管理员登记请假，可以代班主任登记
+func CreateAbsence(w http.ResponseWriter, r *http.Request) {
+	// 解析请求
+	var req CreateAbsenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+	if req.ReportedBy == "" {
+		req.ReportedBy = models.AbsenceReporterAdmin
+	}
+	if req.ReportedBy != models.AbsenceReporterAdmin && req.ReportedBy != models.AbsenceReporterTeacher {
+		utils.ResponseError(w, http.StatusBadRequest, "登记人必须为 teacher 或 admin")
+		return
+	}
+
+	// 获取操作人
+	operatorname, ok := middlewares.GetFullnameFromContext(r)
+	if !ok {
+		operatorname = "系统管理员"
+	}
+
+	// 登记请假
+	absence, err := models.CreateAbsence(req.StudentID, req.StartDate, req.EndDate, req.Reason, req.ReportedBy, operatorname)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	recordAudit(r, models.AuditActionCreate, models.AuditTargetAbsence, strconv.Itoa(absence.ID), nil, absence)
+
+	// 返回响应
+	utils.ResponseOK(w, absence)
+}
+
+// DeleteAbsence 管理员取消请假
+func DeleteAbsence(w http.ResponseWriter, r *http.Request) {
+	// 解析路径参数
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "无效的请假记录ID")
+		return
+	}
+
+	// 获取操作人
+	operatorname, ok := middlewares.GetFullnameFromContext(r)
+	if !ok {
+		operatorname = "系统管理员"
+	}
+
+	// 取消请假
+	absence, err := models.DeleteAbsence(id, operatorname)
+	if err != nil {
+		utils.ResponseError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	recordAudit(r, models.AuditActionDelete, models.AuditTargetAbsence, strconv.Itoa(id), absence, nil)
+
+	// 返回响应
+	utils.ResponseOK(w, map[string]bool{"success": true})
+}
+
+// GetMyAbsences 学生或家长查看自己的请假记录
+func GetMyAbsences(w http.ResponseWriter, r *http.Request) {
+	// 从上下文获取学生ID
+	studentID, ok := middlewares.GetUserIDFromContext(r)
+	if !ok {
+		utils.ResponseError(w, http.StatusUnauthorized, "未授权")
+		return
+	}
+
+	// 解析查询参数，只能查看自己的记录
+	filter, err := parseAbsenceFilter(r)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.StudentID = studentID
+	filter.Class = ""
+
+	// 查询记录
+	absences, total, err := models.GetAbsences(filter)
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "获取请假记录失败")
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, map[string]interface{}{
+		"total":    total,
+		"absences": absences,
+	})
+}
+
+// CreateMyAbsence 学生或家长提前登记请假，开始日期不能早于明天
+// 当天的餐可能已经领取，当天请假需由管理员核实后登记，避免退还已领取的餐费
+func CreateMyAbsence(w http.ResponseWriter, r *http.Request) {
+	// 从上下文获取学生ID
+	studentID, ok := middlewares.GetUserIDFromContext(r)
+	if !ok {
+		utils.ResponseError(w, http.StatusUnauthorized, "未授权")
+		return
+	}
+
+	// 解析请求
+	var req CreateAbsenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+	if req.StartDate <= time.Now().Format("2006-01-02") {
+		utils.ResponseError(w, http.StatusBadRequest, "只能登记明天及以后的请假，当天请假请联系班主任")
+		return
+	}
+
+	// 学生本人登录时为"本人"，家长登录时为家长与学生的关系
+	relation, _ := middlewares.GetRelationFromContext(r)
+	reportedBy := models.AbsenceReporterParent
+	if relation == "本人" {
+		reportedBy = models.AbsenceReporterStudent
+	}
+
+	// 登记请假
+	absence, err := models.CreateAbsence(studentID, req.StartDate, req.EndDate, req.Reason, reportedBy, relation)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, absence)
+}
+
+// DeleteMyAbsence 学生或家长取消自己登记的、尚未开始的请假
+func DeleteMyAbsence(w http.ResponseWriter, r *http.Request) {
+	// 从上下文获取学生ID
+	studentID, ok := middlewares.GetUserIDFromContext(r)
+	if !ok {
+		utils.ResponseError(w, http.StatusUnauthorized, "未授权")
+		return
+	}
+
+	// 解析路径参数
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "无效的请假记录ID")
+		return
+	}
+
+	// 获取请假记录，不能取消其他学生的记录
+	absence, err := models.GetAbsenceByID(id)
+	if err != nil || absence.StudentID != studentID {
+		utils.ResponseError(w, http.StatusNotFound, "请假记录不存在")
+		return
+	}
+	if absence.ReportedBy != models.AbsenceReporterStudent && absence.ReportedBy != models.AbsenceReporterParent {
+		utils.ResponseError(w, http.StatusForbidden, "该请假由学校登记，请联系班主任取消")
+		return
+	}
+	if absence.StartDate <= time.Now().Format("2006-01-02") {
+		utils.ResponseError(w, http.StatusBadRequest, "请假已开始，不能取消")
+		return
+	}
+
+	// 取消请假，学生本人为"本人"，家长为与学生的关系
+	relation, _ := middlewares.GetRelationFromContext(r)
+	if _, err := models.DeleteAbsence(id, relation); err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "取消请假失败")
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, map[string]bool{"success": true})
+}
@@ -2,15 +2,18 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/itsHenry35/canteen-management-system/api/middlewares"
 	"github.com/itsHenry35/canteen-management-system/config"
 	"github.com/itsHenry35/canteen-management-system/models"
 	"github.com/itsHenry35/canteen-management-system/scheduler"
+	"github.com/itsHenry35/canteen-management-system/services/payment"
 	"github.com/itsHenry35/canteen-management-system/utils"
 )
 
@@ -33,10 +36,12 @@ type UpdateUserRequest struct {
 // UpdateSettingsRequest 更新设置请求
 type UpdateSettingsRequest struct {
 	DingTalk struct {
-		AppKey    string `json:"app_key"`
-		AppSecret string `json:"app_secret"`
-		AgentID   string `json:"agent_id"`
-		CorpID    string `json:"corp_id"`
+		AppKey         string `json:"app_key"`
+		AppSecret      string `json:"app_secret"`
+		AgentID        string `json:"agent_id"`
+		CorpID         string `json:"corp_id"`
+		CallbackToken  string `json:"callback_token"`
+		CallbackAESKey string `json:"callback_aes_key"`
 	} `json:"dingtalk"`
 	Website struct {
 		Name           string `json:"name"`
@@ -45,13 +50,54 @@ type UpdateSettingsRequest struct {
 		Domain         string `json:"domain"`
 	} `json:"website"`
 	Scheduler struct {
-		Enabled                bool   `json:"enabled"`
-		CleanupTime            string `json:"cleanup_time"`
-		ReminderBeforeEndHours int    `json:"reminder_before_end_hours"`
-		CleanupEnabled         bool   `json:"cleanup_enabled"`     // 新增
-		ReminderEnabled        bool   `json:"reminder_enabled"`    // 新增
-		AutoSelectEnabled      bool   `json:"auto_select_enabled"` // 新增
+		Enabled                 bool     `json:"enabled"`
+		CleanupTime             string   `json:"cleanup_time"`
+		ReminderBeforeEndHours  int      `json:"reminder_before_end_hours"`
+		ReminderOffsets         []string `json:"reminder_offsets"`
+		OpeningNotification     bool     `json:"opening_notification_enabled"`
+		CleanupEnabled          bool     `json:"cleanup_enabled"`     // 新增
+		ReminderEnabled         bool     `json:"reminder_enabled"`    // 新增
+		AutoSelectEnabled       bool     `json:"auto_select_enabled"` // 新增
+		RosterSyncEnabled       bool     `json:"roster_sync_enabled"`
+		RosterSyncTime          string   `json:"roster_sync_time"`
+		CatchUpEnabled          bool     `json:"catch_up_enabled"`
+		CatchUpGraceHours       int      `json:"catch_up_grace_hours"`
+		BackupEnabled           bool     `json:"backup_enabled"`
+		BackupTime              string   `json:"backup_time"`
+		BackupRetention         int      `json:"backup_retention"`
+		PurgeEnabled            bool     `json:"purge_enabled"`
+		PurgeTime               string   `json:"purge_time"`
+		MealRetentionDays       int      `json:"meal_retention_days"` // 为0时保持不变
+		ProductionReportEnabled bool     `json:"production_report_enabled"`
+		ProductionReportTime    string   `json:"production_report_time"`
+		NoShowAlertEnabled      bool     `json:"no_show_alert_enabled"`
+		NoShowAlertTime         string   `json:"no_show_alert_time"`
+		NoShowWindowDays        int      `json:"no_show_window_days"` // 为0时保持不变
+		NoShowThreshold         int      `json:"no_show_threshold"`   // 为0时保持不变
+		NoShowMinCount          int      `json:"no_show_min_count"`   // 为0时保持不变
+		StatementEnabled        bool     `json:"statement_enabled"`
+		StatementTime           string   `json:"statement_time"`
+		MealTemplateEnabled     bool     `json:"meal_template_enabled"`
+		MealTemplateTime        string   `json:"meal_template_time"`
+		MealTemplateWeeksAhead  int      `json:"meal_template_weeks_ahead"` // 为0时保持不变
 	} `json:"scheduler"`
+	Billing struct {
+		Enabled                  bool   `json:"enabled"`
+		ChargeOn                 string `json:"charge_on"` // 为空时保持不变
+		BlockInsufficientBalance bool   `json:"block_insufficient_balance"`
+	} `json:"billing"`
+	Payment struct {
+		Enabled                  bool   `json:"enabled"`
+		Gateway                  string `json:"gateway"`                    // 为空时保持不变
+		MockSecret               string `json:"mock_secret"`                // 为空时保持不变
+		MinAmount                int    `json:"min_amount"`                 // 为0时保持不变
+		MaxAmount                int    `json:"max_amount"`                 // 为0时保持不变
+		OrderExpireMinutes       int    `json:"order_expire_minutes"`       // 为0时保持不变
+		ReconcileIntervalMinutes int    `json:"reconcile_interval_minutes"` // 为0时保持不变，最大59
+	} `json:"payment"`
+	Calendar struct {
+		SkipWeekends bool `json:"skip_weekends"`
+	} `json:"calendar"`
 }
 
 // NotifyUnselectedStudentsRequest 提醒未选餐学生请求
@@ -59,6 +105,12 @@ type NotifyUnselectedStudentsRequest struct {
 	MealID int `json:"meal_id"`
 }
 
+// RunSchedulerJobRequest 手动触发定时任务请求
+type RunSchedulerJobRequest struct {
+	Job    string `json:"job"`               // cleanup、reminder、opening、auto_select、roster_sync、backup、purge、production_report、no_show_alert、monthly_statement、payment_reconcile 或 meal_template
+	MealID int    `json:"meal_id,omitempty"` // reminder 和 auto_select 需要指定
+}
+
 // GetAllUsers 获取所有用户
 func GetAllUsers(w http.ResponseWriter, r *http.Request) {
 	// 解析查询参数
@@ -124,6 +176,7 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 		utils.ResponseError(w, http.StatusInternalServerError, "failed to create user")
 		return
 	}
+	recordAudit(r, models.AuditActionCreate, models.AuditTargetUser, strconv.Itoa(user.ID), nil, user)
 
 	// 返回响应
 	utils.ResponseOK(w, user)
@@ -154,6 +207,7 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 更新用户信息
+	before := *user
 	needUpdate := false
 	if req.FullName != "" {
 		user.FullName = req.FullName
@@ -180,6 +234,14 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// 记录审计日志，密码只记录是否修改
+	if needUpdate || req.Password != "" {
+		recordAudit(r, models.AuditActionUpdate, models.AuditTargetUser, strconv.Itoa(id), before, map[string]interface{}{
+			"user":             user,
+			"password_changed": req.Password != "",
+		})
+	}
+
 	// 返回响应
 	utils.ResponseOK(w, user)
 }
@@ -207,11 +269,19 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 获取用户信息，用于审计日志
+	user, err := models.GetUserByID(id)
+	if err != nil {
+		utils.ResponseError(w, http.StatusNotFound, "系统中未找到用户")
+		return
+	}
+
 	// 删除用户
 	if err := models.DeleteUser(id); err != nil {
 		utils.ResponseError(w, http.StatusInternalServerError, "failed to delete user")
 		return
 	}
+	recordAudit(r, models.AuditActionDelete, models.AuditTargetUser, strconv.Itoa(id), user, nil)
 
 	// 返回响应
 	utils.ResponseOK(w, map[string]bool{"success": true})
@@ -235,9 +305,76 @@ func UpdateSettings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 校验提醒时间
+	if err := models.ReminderOffsets(req.Scheduler.ReminderOffsets).Validate(); err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Scheduler.BackupRetention < 0 {
+		utils.ResponseError(w, http.StatusBadRequest, "备份保留数量不能为负数")
+		return
+	}
+	if req.Scheduler.MealRetentionDays < 0 {
+		utils.ResponseError(w, http.StatusBadRequest, "已归档餐食的保留天数不能为负数")
+		return
+	}
+	if req.Scheduler.NoShowWindowDays < 0 || req.Scheduler.NoShowMinCount < 0 {
+		utils.ResponseError(w, http.StatusBadRequest, "未取餐统计天数和次数不能为负数")
+		return
+	}
+	if req.Scheduler.NoShowThreshold < 0 || req.Scheduler.NoShowThreshold > 100 {
+		utils.ResponseError(w, http.StatusBadRequest, "未取餐率阈值必须在0到100之间")
+		return
+	}
+	if req.Billing.ChargeOn != "" && req.Billing.ChargeOn != models.ChargeOnSelection && req.Billing.ChargeOn != models.ChargeOnCollection {
+		utils.ResponseError(w, http.StatusBadRequest, "扣费时机必须为 selection 或 collection")
+		return
+	}
+	if req.Payment.Gateway != "" {
+		if _, err := payment.Available(req.Payment.Gateway); err != nil {
+			utils.ResponseError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.Payment.Enabled && req.Payment.Gateway == "" {
+		// 启用在线充值时必须有可用的支付网关
+		if _, err := payment.Available(config.Get().Payment.Gateway); err != nil {
+			utils.ResponseError(w, http.StatusBadRequest, "启用在线充值前请先配置支付网关："+err.Error())
+			return
+		}
+	}
+	if req.Payment.MinAmount < 0 || req.Payment.MaxAmount < 0 || req.Payment.OrderExpireMinutes < 0 {
+		utils.ResponseError(w, http.StatusBadRequest, "充值金额和订单有效期不能为负数")
+		return
+	}
+	if req.Payment.ReconcileIntervalMinutes < 0 || req.Payment.ReconcileIntervalMinutes > 59 {
+		utils.ResponseError(w, http.StatusBadRequest, "对账间隔必须在1到59分钟之间")
+		return
+	}
+	if req.Scheduler.MealTemplateWeeksAhead < 0 || req.Scheduler.MealTemplateWeeksAhead > models.MaxMealTemplateWeeks {
+		utils.ResponseError(w, http.StatusBadRequest, fmt.Sprintf("提前生成的周数必须在1到%d之间", models.MaxMealTemplateWeeks))
+		return
+	}
+
 	// 获取配置
 	cfg := config.Get()
 
+	// 校验充值金额范围，未设置的值按当前配置计算
+	minAmount, maxAmount := cfg.Payment.MinAmount, cfg.Payment.MaxAmount
+	if req.Payment.MinAmount > 0 {
+		minAmount = req.Payment.MinAmount
+	}
+	if req.Payment.MaxAmount > 0 {
+		maxAmount = req.Payment.MaxAmount
+	}
+	if minAmount > maxAmount {
+		utils.ResponseError(w, http.StatusBadRequest, "单笔充值最小金额不能大于最大金额")
+		return
+	}
+
+	// 记录修改前的设置，用于审计日志
+	before := auditSettings(cfg)
+
 	// 记录原有的调度器状态
 	oldSchedulerEnabled := cfg.Scheduler.Enabled
 	oldCleanupEnabled := cfg.Scheduler.CleanupEnabled
@@ -245,12 +382,34 @@ func UpdateSettings(w http.ResponseWriter, r *http.Request) {
 	oldAutoSelectEnabled := cfg.Scheduler.AutoSelectEnabled
 	oldCleanupTime := cfg.Scheduler.CleanupTime
 	oldReminderBeforeEndHours := cfg.Scheduler.ReminderBeforeEndHours
+	oldRosterSyncEnabled := cfg.Scheduler.RosterSyncEnabled
+	oldRosterSyncTime := cfg.Scheduler.RosterSyncTime
+	oldReminderOffsets := strings.Join(cfg.Scheduler.ReminderOffsets, ",")
+	oldOpeningNotification := cfg.Scheduler.OpeningNotification
+	oldBackupEnabled := cfg.Scheduler.BackupEnabled
+	oldBackupTime := cfg.Scheduler.BackupTime
+	oldBackupRetention := cfg.Scheduler.BackupRetention
+	oldPurgeEnabled := cfg.Scheduler.PurgeEnabled
+	oldPurgeTime := cfg.Scheduler.PurgeTime
+	oldMealRetentionDays := cfg.Scheduler.MealRetentionDays
+	oldProductionReportEnabled := cfg.Scheduler.ProductionReportEnabled
+	oldProductionReportTime := cfg.Scheduler.ProductionReportTime
+	oldNoShowAlertEnabled := cfg.Scheduler.NoShowAlertEnabled
+	oldNoShowAlertTime := cfg.Scheduler.NoShowAlertTime
+	oldStatementEnabled := cfg.Scheduler.StatementEnabled
+	oldStatementTime := cfg.Scheduler.StatementTime
+	oldMealTemplateEnabled := cfg.Scheduler.MealTemplateEnabled
+	oldMealTemplateTime := cfg.Scheduler.MealTemplateTime
+	oldPaymentEnabled := cfg.Payment.Enabled
+	oldReconcileIntervalMinutes := cfg.Payment.ReconcileIntervalMinutes
 
 	// 更新钉钉设置
 	cfg.DingTalk.AppKey = req.DingTalk.AppKey
 	cfg.DingTalk.AppSecret = req.DingTalk.AppSecret
 	cfg.DingTalk.AgentID = req.DingTalk.AgentID
 	cfg.DingTalk.CorpID = req.DingTalk.CorpID
+	cfg.DingTalk.CallbackToken = req.DingTalk.CallbackToken
+	cfg.DingTalk.CallbackAESKey = req.DingTalk.CallbackAESKey
 	// 更新网站设置
 	cfg.Website.Name = req.Website.Name
 	cfg.Website.ICPBeian = req.Website.ICPBeian
@@ -263,12 +422,91 @@ func UpdateSettings(w http.ResponseWriter, r *http.Request) {
 	cfg.Scheduler.AutoSelectEnabled = req.Scheduler.AutoSelectEnabled
 	cfg.Scheduler.CleanupTime = req.Scheduler.CleanupTime
 	cfg.Scheduler.ReminderBeforeEndHours = req.Scheduler.ReminderBeforeEndHours
+	if req.Scheduler.ReminderOffsets != nil {
+		cfg.Scheduler.ReminderOffsets = req.Scheduler.ReminderOffsets
+	}
+	cfg.Scheduler.OpeningNotification = req.Scheduler.OpeningNotification
+	cfg.Scheduler.RosterSyncEnabled = req.Scheduler.RosterSyncEnabled
+	if req.Scheduler.RosterSyncTime != "" {
+		cfg.Scheduler.RosterSyncTime = req.Scheduler.RosterSyncTime
+	}
+	cfg.Scheduler.CatchUpEnabled = req.Scheduler.CatchUpEnabled
+	cfg.Scheduler.CatchUpGraceHours = req.Scheduler.CatchUpGraceHours
+	cfg.Scheduler.BackupEnabled = req.Scheduler.BackupEnabled
+	if req.Scheduler.BackupTime != "" {
+		cfg.Scheduler.BackupTime = req.Scheduler.BackupTime
+	}
+	cfg.Scheduler.BackupRetention = req.Scheduler.BackupRetention
+	cfg.Scheduler.PurgeEnabled = req.Scheduler.PurgeEnabled
+	if req.Scheduler.PurgeTime != "" {
+		cfg.Scheduler.PurgeTime = req.Scheduler.PurgeTime
+	}
+	if req.Scheduler.MealRetentionDays > 0 {
+		cfg.Scheduler.MealRetentionDays = req.Scheduler.MealRetentionDays
+	}
+	cfg.Scheduler.ProductionReportEnabled = req.Scheduler.ProductionReportEnabled
+	if req.Scheduler.ProductionReportTime != "" {
+		cfg.Scheduler.ProductionReportTime = req.Scheduler.ProductionReportTime
+	}
+	cfg.Scheduler.NoShowAlertEnabled = req.Scheduler.NoShowAlertEnabled
+	if req.Scheduler.NoShowAlertTime != "" {
+		cfg.Scheduler.NoShowAlertTime = req.Scheduler.NoShowAlertTime
+	}
+	if req.Scheduler.NoShowWindowDays > 0 {
+		cfg.Scheduler.NoShowWindowDays = req.Scheduler.NoShowWindowDays
+	}
+	if req.Scheduler.NoShowThreshold > 0 {
+		cfg.Scheduler.NoShowThreshold = req.Scheduler.NoShowThreshold
+	}
+	if req.Scheduler.NoShowMinCount > 0 {
+		cfg.Scheduler.NoShowMinCount = req.Scheduler.NoShowMinCount
+	}
+	cfg.Scheduler.StatementEnabled = req.Scheduler.StatementEnabled
+	if req.Scheduler.StatementTime != "" {
+		cfg.Scheduler.StatementTime = req.Scheduler.StatementTime
+	}
+	cfg.Scheduler.MealTemplateEnabled = req.Scheduler.MealTemplateEnabled
+	if req.Scheduler.MealTemplateTime != "" {
+		cfg.Scheduler.MealTemplateTime = req.Scheduler.MealTemplateTime
+	}
+	if req.Scheduler.MealTemplateWeeksAhead > 0 {
+		cfg.Scheduler.MealTemplateWeeksAhead = req.Scheduler.MealTemplateWeeksAhead
+	}
+	// 更新扣费设置
+	cfg.Billing.Enabled = req.Billing.Enabled
+	if req.Billing.ChargeOn != "" {
+		cfg.Billing.ChargeOn = req.Billing.ChargeOn
+	}
+	cfg.Billing.BlockInsufficientBalance = req.Billing.BlockInsufficientBalance
+	// 更新在线充值设置
+	cfg.Payment.Enabled = req.Payment.Enabled
+	if req.Payment.Gateway != "" {
+		cfg.Payment.Gateway = req.Payment.Gateway
+	}
+	if req.Payment.MockSecret != "" {
+		cfg.Payment.MockSecret = req.Payment.MockSecret
+	}
+	if req.Payment.MinAmount > 0 {
+		cfg.Payment.MinAmount = req.Payment.MinAmount
+	}
+	if req.Payment.MaxAmount > 0 {
+		cfg.Payment.MaxAmount = req.Payment.MaxAmount
+	}
+	if req.Payment.OrderExpireMinutes > 0 {
+		cfg.Payment.OrderExpireMinutes = req.Payment.OrderExpireMinutes
+	}
+	if req.Payment.ReconcileIntervalMinutes > 0 {
+		cfg.Payment.ReconcileIntervalMinutes = req.Payment.ReconcileIntervalMinutes
+	}
+	// 更新校历设置
+	cfg.Calendar.SkipWeekends = req.Calendar.SkipWeekends
 
 	// 保存配置
 	if err := config.Save(); err != nil {
 		utils.ResponseError(w, http.StatusInternalServerError, "failed to save settings")
 		return
 	}
+	recordAudit(r, models.AuditActionUpdate, models.AuditTargetSettings, "", before, auditSettings(cfg))
 
 	// 检查调度器设置是否有变更，如果有则重载定时任务
 	schedulerChanged := oldSchedulerEnabled != cfg.Scheduler.Enabled ||
@@ -276,7 +514,27 @@ func UpdateSettings(w http.ResponseWriter, r *http.Request) {
 		oldReminderEnabled != cfg.Scheduler.ReminderEnabled ||
 		oldAutoSelectEnabled != cfg.Scheduler.AutoSelectEnabled ||
 		oldCleanupTime != cfg.Scheduler.CleanupTime ||
-		oldReminderBeforeEndHours != cfg.Scheduler.ReminderBeforeEndHours
+		oldReminderBeforeEndHours != cfg.Scheduler.ReminderBeforeEndHours ||
+		oldRosterSyncEnabled != cfg.Scheduler.RosterSyncEnabled ||
+		oldRosterSyncTime != cfg.Scheduler.RosterSyncTime ||
+		oldReminderOffsets != strings.Join(cfg.Scheduler.ReminderOffsets, ",") ||
+		oldOpeningNotification != cfg.Scheduler.OpeningNotification ||
+		oldBackupEnabled != cfg.Scheduler.BackupEnabled ||
+		oldBackupTime != cfg.Scheduler.BackupTime ||
+		oldBackupRetention != cfg.Scheduler.BackupRetention ||
+		oldPurgeEnabled != cfg.Scheduler.PurgeEnabled ||
+		oldPurgeTime != cfg.Scheduler.PurgeTime ||
+		oldMealRetentionDays != cfg.Scheduler.MealRetentionDays ||
+		oldProductionReportEnabled != cfg.Scheduler.ProductionReportEnabled ||
+		oldProductionReportTime != cfg.Scheduler.ProductionReportTime ||
+		oldNoShowAlertEnabled != cfg.Scheduler.NoShowAlertEnabled ||
+		oldNoShowAlertTime != cfg.Scheduler.NoShowAlertTime ||
+		oldStatementEnabled != cfg.Scheduler.StatementEnabled ||
+		oldStatementTime != cfg.Scheduler.StatementTime ||
+		oldMealTemplateEnabled != cfg.Scheduler.MealTemplateEnabled ||
+		oldMealTemplateTime != cfg.Scheduler.MealTemplateTime ||
+		oldPaymentEnabled != cfg.Payment.Enabled ||
+		oldReconcileIntervalMinutes != cfg.Payment.ReconcileIntervalMinutes
 
 	if schedulerChanged {
 		if err := scheduler.ReloadTasks(); err != nil {
@@ -299,3 +557,60 @@ func GetSchedulerLogs(w http.ResponseWriter, _ *http.Request) {
 		"logs": logs,
 	})
 }
+
+// GetScheduledJobs 获取已计划的定时任务
+func GetScheduledJobs(w http.ResponseWriter, _ *http.Request) {
+	// 返回响应
+	utils.ResponseOK(w, scheduler.GetUpcomingJobs())
+}
+
+// GetJobRuns 分页获取定时任务运行记录
+func GetJobRuns(w http.ResponseWriter, r *http.Request) {
+	// 解析查询参数
+	query := r.URL.Query()
+	filter := models.JobRunFilter{
+		JobKey: query.Get("job"),
+		Status: query.Get("status"),
+		Source: query.Get("source"),
+	}
+	filter.MealID, _ = strconv.Atoi(query.Get("meal_id"))
+	filter.Page, _ = strconv.Atoi(query.Get("page"))
+	filter.PageSize, _ = strconv.Atoi(query.Get("page_size"))
+	if filter.PageSize > 100 {
+		filter.PageSize = 100
+	}
+
+	// 查询记录
+	runs, total, err := models.GetJobRuns(filter)
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "获取运行记录失败")
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, map[string]interface{}{
+		"total": total,
+		"runs":  runs,
+	})
+}
+
+// RunSchedulerJob 立即执行一次定时任务
+func RunSchedulerJob(w http.ResponseWriter, r *http.Request) {
+	// 解析请求
+	var req RunSchedulerJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "无效的请求")
+		return
+	}
+
+	// 执行任务
+	run, err := scheduler.RunJob(req.Job, req.MealID)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	recordAudit(r, models.AuditActionRun, models.AuditTargetJob, req.Job, nil, run)
+
+	// 返回运行记录
+	utils.ResponseOK(w, run)
+}
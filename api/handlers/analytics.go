@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/itsHenry35/canteen-management-system/config"
+	"github.com/itsHenry35/canteen-management-system/models"
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+// CreateClassTeacherRequest 添加班主任请求
+type CreateClassTeacherRequest struct {
+	Class      string `json:"class"`
+	FullName   string `json:"full_name"`
+	DingTalkID string `json:"dingtalk_id"`
+}
+
+// GetNoShowAnalytics 统计选餐后未取餐的情况
+// 默认统计截至昨天的最近30天，threshold 和 min_count 默认使用系统设置中的未取餐提醒条件
+func GetNoShowAnalytics(w http.ResponseWriter, r *http.Request) {
+	cfg := config.Get()
+
+	// 解析查询参数
+	query := r.URL.Query()
+	filter := models.NoShowFilter{
+		From:      query.Get("from"),
+		To:        query.Get("to"),
+		Class:     query.Get("class"),
+		Threshold: cfg.Scheduler.NoShowThreshold,
+		MinCount:  cfg.Scheduler.NoShowMinCount,
+	}
+	if filter.To == "" {
+		filter.To = time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	}
+	if filter.From == "" {
+		to, err := time.ParseInLocation("2006-01-02", filter.To, time.Local)
+		if err != nil {
+			utils.ResponseError(w, http.StatusBadRequest, "无效的结束日期")
+			return
+		}
+		filter.From = to.AddDate(0, 0, -29).Format("2006-01-02")
+	}
+	if v := query.Get("meal_id"); v != "" {
+		mealID, err := strconv.Atoi(v)
+		if err != nil {
+			utils.ResponseError(w, http.StatusBadRequest, "无效的餐ID")
+			return
+		}
+		filter.MealID = mealID
+	}
+	if v := query.Get("threshold"); v != "" {
+		threshold, err := strconv.Atoi(v)
+		if err != nil || threshold < 0 || threshold > 100 {
+			utils.ResponseError(w, http.StatusBadRequest, "threshold 必须为0到100之间的整数")
+			return
+		}
+		filter.Threshold = threshold
+	}
+	if v := query.Get("min_count"); v != "" {
+		minCount, err := strconv.Atoi(v)
+		if err != nil || minCount < 0 {
+			utils.ResponseError(w, http.StatusBadRequest, "min_count 必须为非负整数")
+			return
+		}
+		filter.MinCount = minCount
+	}
+
+	// 统计
+	report, err := models.BuildNoShowReport(filter)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, report)
+}
+
+// GetClassTeachers 获取班主任列表，可按班级筛选
+func GetClassTeachers(w http.ResponseWriter, r *http.Request) {
+	// 获取班主任
+	teachers, err := models.GetClassTeachers(r.URL.Query().Get("class"))
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "获取班主任失败")
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, teachers)
+}
+
+// CreateClassTeacher 添加班主任
+func CreateClassTeacher(w http.ResponseWriter, r *http.Request) {
+	// 解析请求
+	var req CreateClassTeacherRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+
+	// 添加班主任
+	teacher, err := models.CreateClassTeacher(req.Class, req.FullName, req.DingTalkID)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	recordAudit(r, models.AuditActionCreate, models.AuditTargetTeacher, strconv.Itoa(teacher.ID), nil, teacher)
+
+	// 返回响应
+	utils.ResponseOK(w, teacher)
+}
+
+// DeleteClassTeacher 删除班主任
+func DeleteClassTeacher(w http.ResponseWriter, r *http.Request) {
+	// 解析路径参数
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "无效的班主任ID")
+		return
+	}
+
+	// 获取班主任，用于审计日志
+	teacher, err := models.GetClassTeacherByID(id)
+	if err != nil {
+		utils.ResponseError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	// 删除班主任
+	if err := models.DeleteClassTeacher(id); err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "删除班主任失败")
+		return
+	}
+	recordAudit(r, models.AuditActionDelete, models.AuditTargetTeacher, strconv.Itoa(id), teacher, nil)
+
+	// 返回响应
+	utils.ResponseOK(w, map[string]bool{"success": true})
+}
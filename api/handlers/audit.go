@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/itsHenry35/canteen-management-system/api/middlewares"
+	"github.com/itsHenry35/canteen-management-system/config"
+	"github.com/itsHenry35/canteen-management-system/models"
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+// recordAudit 记录管理操作的审计日志，操作人和IP取自请求；写入失败只记录日志，不影响请求结果
+// before 和 after 为 nil 时不记录对应的数据
+func recordAudit(r *http.Request, action, targetType, targetID string, before, after interface{}) {
+	entry := &models.AuditLog{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IP:         utils.ClientIP(r),
+	}
+
+	// 操作人
+	entry.ActorID, _ = middlewares.GetUserIDFromContext(r)
+	if role, ok := middlewares.GetRoleFromContext(r); ok {
+		entry.ActorRole = string(role)
+	}
+	entry.ActorName, _ = middlewares.GetFullnameFromContext(r)
+
+	if err := models.CreateAuditLog(entry, before, after); err != nil {
+		log.Printf("记录审计日志失败（%s %s %s）: %v", action, targetType, targetID, err)
+	}
+}
+
+// auditSettings 返回可在系统设置中修改的配置，用于审计日志；密钥类字段只记录是否已设置
+func auditSettings(cfg *config.Config) map[string]interface{} {
+	dingTalk := cfg.DingTalk
+	dingTalk.AppSecret = maskSecret(dingTalk.AppSecret)
+	dingTalk.CallbackToken = maskSecret(dingTalk.CallbackToken)
+	dingTalk.CallbackAESKey = maskSecret(dingTalk.CallbackAESKey)
+	payment := cfg.Payment
+	payment.MockSecret = maskSecret(payment.MockSecret)
+
+	return map[string]interface{}{
+		"dingtalk":  dingTalk,
+		"website":   cfg.Website,
+		"scheduler": cfg.Scheduler,
+		"billing":   cfg.Billing,
+		"payment":   payment,
+		"calendar":  cfg.Calendar,
+	}
+}
+
+// maskSecret 隐藏密钥内容
+func maskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "******"
+}
+
+// GetAuditLogs 分页查询审计日志
+func GetAuditLogs(w http.ResponseWriter, r *http.Request) {
+	// 解析查询参数
+	query := r.URL.Query()
+	filter := models.AuditLogFilter{
+		Action:     query.Get("action"),
+		TargetType: query.Get("target_type"),
+		TargetID:   query.Get("target_id"),
+		Keyword:    query.Get("keyword"),
+	}
+	filter.ActorID, _ = strconv.Atoi(query.Get("actor_id"))
+	filter.Page, _ = strconv.Atoi(query.Get("page"))
+	filter.PageSize, _ = strconv.Atoi(query.Get("page_size"))
+	if filter.PageSize > 100 {
+		filter.PageSize = 100
+	}
+
+	// 解析日期范围
+	var err error
+	filter.From, filter.To, err = parseDateRange(query.Get("from"), query.Get("to"))
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 查询记录
+	logs, total, err := models.GetAuditLogs(filter)
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "获取审计日志失败")
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, map[string]interface{}{
+		"total": total,
+		"logs":  logs,
+	})
+}
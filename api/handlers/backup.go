@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/itsHenry35/canteen-management-system/models"
+	"github.com/itsHenry35/canteen-management-system/services"
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+// CreateBackup 立即在线备份数据库和餐食图片
+func CreateBackup(w http.ResponseWriter, r *http.Request) {
+	// 创建备份
+	backup, err := services.CreateBackup(services.BackupSourceManual)
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "备份失败: "+err.Error())
+		return
+	}
+	recordAudit(r, models.AuditActionCreate, models.AuditTargetBackup, backup.Name, nil, backup)
+
+	// 返回响应
+	utils.ResponseOK(w, backup)
+}
+
+// GetBackups 获取备份列表
+func GetBackups(w http.ResponseWriter, _ *http.Request) {
+	// 获取备份列表
+	backups, err := services.ListBackups()
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "获取备份列表失败")
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, backups)
+}
+
+// DownloadBackup 下载备份文件
+func DownloadBackup(w http.ResponseWriter, r *http.Request) {
+	// 获取备份路径
+	name := mux.Vars(r)["name"]
+	archivePath, err := services.GetBackupPath(name)
+	if err != nil {
+		utils.ResponseError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	// 返回文件
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeFile(w, r, archivePath)
+}
+
+// DeleteBackup 删除备份文件
+func DeleteBackup(w http.ResponseWriter, r *http.Request) {
+	// 删除备份
+	name := mux.Vars(r)["name"]
+	if err := services.DeleteBackup(name); err != nil {
+		if errors.Is(err, services.ErrBackupNotFound) {
+			utils.ResponseError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		utils.ResponseError(w, http.StatusInternalServerError, "删除备份失败")
+		return
+	}
+	recordAudit(r, models.AuditActionDelete, models.AuditTargetBackup, name, nil, nil)
+
+	// 返回响应
+	utils.ResponseOK(w, map[string]interface{}{
+		"message": "备份已删除",
+	})
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/itsHenry35/canteen-management-system/api/middlewares"
+	"github.com/itsHenry35/canteen-management-system/models"
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+// CreateCalendarEventRequest 添加校历事件请求，日期格式为 YYYY-MM-DD
+type CreateCalendarEventRequest struct {
+	Type      string `json:"type"` // holiday, workday, term
+	Name      string `json:"name"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+}
+
+// GetCalendarEvents 获取校历事件，可按日期范围和类型筛选
+func GetCalendarEvents(w http.ResponseWriter, r *http.Request) {
+	// 解析查询参数
+	query := r.URL.Query()
+	eventType := query.Get("type")
+	if eventType != "" && !models.IsValidCalendarEventType(eventType) {
+		utils.ResponseError(w, http.StatusBadRequest, "无效的校历事件类型")
+		return
+	}
+	from, to, err := parseDateRange(query.Get("from"), query.Get("to"))
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var fromDate, toDate string
+	if !from.IsZero() {
+		fromDate = from.Format("2006-01-02")
+	}
+	if !to.IsZero() {
+		toDate = to.Format("2006-01-02")
+	}
+
+	// 查询事件
+	events, err := models.GetCalendarEvents(fromDate, toDate, eventType)
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "获取校历失败")
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, events)
+}
+
+// GetCalendarDays 列出日期范围内每一天是否供餐，默认为今天起30天
+func GetCalendarDays(w http.ResponseWriter, r *http.Request) {
+	// 解析查询参数
+	query := r.URL.Query()
+	from := query.Get("from")
+	if from == "" {
+		from = time.Now().Format("2006-01-02")
+	}
+	to := query.Get("to")
+	if to == "" {
+		start, err := time.ParseInLocation("2006-01-02", from, time.Local)
+		if err != nil {
+			utils.ResponseError(w, http.StatusBadRequest, "无效的开始日期")
+			return
+		}
+		to = start.AddDate(0, 0, 29).Format("2006-01-02")
+	}
+
+	// 逐日判断
+	days, err := models.GetCalendarDays(from, to)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, days)
+}
+
+// CreateCalendarEvent 添加节假日、调休上班日或学期
+func CreateCalendarEvent(w http.ResponseWriter, r *http.Request) {
+	// 解析请求
+	var req CreateCalendarEventRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+
+	// 获取操作人
+	operatorname, ok := middlewares.GetFullnameFromContext(r)
+	if !ok {
+		operatorname = "系统管理员"
+	}
+
+	// 添加事件
+	event, err := models.CreateCalendarEvent(req.Type, req.Name, req.StartDate, req.EndDate, operatorname)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	recordAudit(r, models.AuditActionCreate, models.AuditTargetCalendar, strconv.Itoa(event.ID), nil, event)
+
+	// 返回响应
+	utils.ResponseOK(w, event)
+}
+
+// DeleteCalendarEvent 删除校历事件
+func DeleteCalendarEvent(w http.ResponseWriter, r *http.Request) {
+	// 解析路径参数
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "无效的校历事件ID")
+		return
+	}
+
+	// 获取操作人
+	operatorname, ok := middlewares.GetFullnameFromContext(r)
+	if !ok {
+		operatorname = "系统管理员"
+	}
+
+	// 删除事件
+	event, err := models.DeleteCalendarEvent(id, operatorname)
+	if err != nil {
+		utils.ResponseError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	recordAudit(r, models.AuditActionDelete, models.AuditTargetCalendar, strconv.Itoa(id), event, nil)
+
+	// 返回响应
+	utils.ResponseOK(w, map[string]bool{"success": true})
+}
+
+// ImportCalendar 从 iCalendar（.ics）文件导入校历，dry_run=true 时只校验不写入
+// 表单字段 type 指定所有事件的类型，为空时按事件名称推断
+func ImportCalendar(w http.ResponseWriter, r *http.Request) {
+	// 解析上传的文件
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportFileSize+1<<20)
+	if err := r.ParseMultipartForm(maxImportFileSize); err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "请上传不超过10MB的 iCalendar 文件")
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "请上传 iCalendar 文件")
+		return
+	}
+	defer file.Close()
+
+	// 读取事件
+	events, err := utils.ReadICalEvents(file)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(events) > maxImportRows {
+		utils.ResponseError(w, http.StatusBadRequest, "文件中的事件过多，最多"+strconv.Itoa(maxImportRows)+"个")
+		return
+	}
+	dryRun := isDryRun(r)
+
+	// 获取操作人
+	operatorname, ok := middlewares.GetFullnameFromContext(r)
+	if !ok {
+		operatorname = "系统管理员"
+	}
+
+	// 校验并导入
+	report, err := models.ImportCalendarEvents(events, r.FormValue("type"), dryRun, operatorname)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "导入校历失败: "+err.Error())
+		return
+	}
+	if !dryRun && report.Imported > 0 {
+		recordAudit(r, models.AuditActionImport, models.AuditTargetCalendar, "", nil, map[string]int{
+			"total":    report.Total,
+			"imported": report.Imported,
+			"failed":   report.Failed,
+		})
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, report)
+}
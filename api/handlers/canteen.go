@@ -61,6 +61,12 @@ func ScanStudentQRCode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 校历中今天不供餐时不能取餐
+	if serving, reason := models.IsServingDay(time.Now().Format("2006-01-02")); !serving {
+		utils.ResponseError(w, http.StatusBadRequest, "今天不供餐（"+reason+"）")
+		return
+	}
+
 	// 获取学生信息
 	student, err := models.GetStudentByID(studentID)
 	if err != nil {
@@ -103,13 +109,10 @@ func ScanStudentQRCode(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// 如果餐食类型匹配且学生今天未取餐，则记录取餐
+	// 如果餐食类型匹配且学生今天未取餐，则记录取餐并更新学生的最后取餐日期
 	if selection != nil && selection.MealType == mealType && !resp.HasCollected {
-		// 更新学生的最后取餐日期
-		now := time.Now()
-		student.LastMealCollectionDate = &now
-
-		if err := models.UpdateStudent(student); err != nil {
+		operator, _ := middlewares.GetFullnameFromContext(r)
+		if _, err := models.RecordMealCollection(student, selection, operator, time.Now()); err != nil {
 			utils.ResponseError(w, http.StatusInternalServerError, "更新学生取餐记录失败")
 			return
 		}
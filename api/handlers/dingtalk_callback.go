@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/itsHenry35/canteen-management-system/config"
+	"github.com/itsHenry35/canteen-management-system/services"
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+// DingTalkCallbackRequest 钉钉事件订阅推送的请求体
+type DingTalkCallbackRequest struct {
+	Encrypt string `json:"encrypt"`
+}
+
+// DingTalkCallback 接收钉钉事件订阅推送
+// 校验签名并解密事件，事件加入后台处理队列后立即应答，重复推送的事件只处理一次
+func DingTalkCallback(w http.ResponseWriter, r *http.Request) {
+	// 创建加解密器
+	cfg := config.Get()
+	crypto, err := utils.NewDingTalkCallbackCrypto(cfg.DingTalk.CallbackToken, cfg.DingTalk.CallbackAESKey, cfg.DingTalk.AppKey)
+	if err != nil {
+		utils.ResponseError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	// 解析请求
+	var req DingTalkCallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+
+	// 校验签名并解密
+	query := r.URL.Query()
+	plaintext, err := crypto.DecryptMessage(query.Get("msg_signature"), query.Get("timestamp"), query.Get("nonce"), req.Encrypt)
+	if err != nil {
+		utils.ResponseError(w, http.StatusForbidden, "事件校验失败: "+err.Error())
+		return
+	}
+
+	// 解析事件
+	event, err := services.ParseDingTalkEvent(plaintext)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 加入后台处理队列，队列已满时不应答，钉钉会重试推送
+	if err := services.EnqueueDingTalkEvent(event); err != nil {
+		utils.ResponseError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	// 返回加密的 success
+	resp, err := crypto.EncryptMessage("success")
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "加密响应失败")
+		return
+	}
+	utils.JSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/itsHenry35/canteen-management-system/config"
+	"github.com/itsHenry35/canteen-management-system/database"
+	"github.com/itsHenry35/canteen-management-system/models"
+	"github.com/itsHenry35/canteen-management-system/services"
+	"github.com/itsHenry35/canteen-management-system/utils"
+	"github.com/itsHenry35/canteen-management-system/utils/dingtalkfake"
+)
+
+const (
+	testCallbackToken  = "callback-token"
+	testCallbackAESKey = "abcdefghijklmnopqrstuvwxyz0123456789ABCDEFG"
+)
+
+// TestMain 在临时目录中创建配置文件和 SQLite 数据库，测试结束后删除
+func TestMain(m *testing.M) {
+	os.Exit(runWithTempSystem(m))
+}
+
+func runWithTempSystem(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "canteen-handlers-test")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chdir(dir); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	// 写入测试配置
+	cfg := map[string]interface{}{
+		"database": map[string]string{"driver": "sqlite", "path": filepath.Join(dir, "canteen.db")},
+		"dingtalk": map[string]string{
+			"app_key":          "key",
+			"app_secret":       "secret",
+			"callback_token":   testCallbackToken,
+			"callback_aes_key": testCallbackAESKey,
+		},
+	}
+	data, _ := json.Marshal(cfg)
+	if err := os.WriteFile("config.json", data, 0644); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if err := config.Load(); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	// 初始化数据库
+	if err := database.Initialize(); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer database.Close()
+
+	return m.Run()
+}
+
+// postCallback 以钉钉推送的格式发送事件，返回响应
+func postCallback(t *testing.T, event map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	crypto, err := utils.NewDingTalkCallbackCrypto(testCallbackToken, testCallbackAESKey, "key")
+	if err != nil {
+		t.Fatalf("create crypto: %v", err)
+	}
+	req, err := dingtalkfake.NewCallbackRequest("/api/dingtalk/callback", crypto, event)
+	if err != nil {
+		t.Fatalf("create request: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	DingTalkCallback(rec, req)
+	return rec
+}
+
+// callbackAcked 检查响应是否为加密的 success，钉钉只有收到 success 才不会重试推送
+func callbackAcked(t *testing.T, rec *httptest.ResponseRecorder) bool {
+	t.Helper()
+
+	var resp utils.DingTalkCallbackResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Encrypt == "" {
+		return false
+	}
+	crypto, _ := utils.NewDingTalkCallbackCrypto(testCallbackToken, testCallbackAESKey, "key")
+	plaintext, err := crypto.DecryptMessage(resp.MsgSignature, resp.TimeStamp, resp.Nonce, resp.Encrypt)
+	return err == nil && plaintext == "success"
+}
+
+func TestDingTalkCallback(t *testing.T) {
+	fake := dingtalkfake.NewServer()
+	defer fake.Close()
+	utils.SetDingTalkClient(fake.Client())
+	defer utils.SetDingTalkClient(nil)
+
+	fake.AddDepartment(dingtalkfake.Department{ID: 10, ParentID: 0, Name: "七年级", Type: "grade"})
+	fake.AddDepartment(dingtalkfake.Department{ID: 101, ParentID: 10, Name: "1班", Type: "class"})
+	fake.AddStudent(dingtalkfake.Student{ClassID: 101, UserID: "s1", Name: "张三"})
+	fake.AddRelation(dingtalkfake.Relation{ClassID: 101, GuardianUserID: "p1", StudentUserID: "s1", RelationName: "父亲"})
+
+	// 回调地址校验直接应答
+	if rec := postCallback(t, map[string]interface{}{"EventType": "check_url"}); !callbackAcked(t, rec) {
+		t.Fatalf("check_url response = %s", rec.Body.String())
+	}
+
+	// 事件加入队列后立即应答，在后台处理
+	event := map[string]interface{}{"EventType": "edu_user_insert", "UserId": []string{"s1"}, "DeptId": []int{101}, "TimeStamp": "1"}
+	if rec := postCallback(t, event); !callbackAcked(t, rec) {
+		t.Fatalf("event response = %s", rec.Body.String())
+	}
+	services.WaitDingTalkEvents()
+	student, err := models.GetStudentByDingTalkID("s1")
+	if err != nil || student.Class != "七年级1班" {
+		t.Fatalf("student after event = %+v, %v", student, err)
+	}
+	if parents, err := models.GetParentsByStudentID(student.ID); err != nil || len(parents) != 1 || parents[0] != "p1" {
+		t.Errorf("parents after event = %v, %v", parents, err)
+	}
+
+	// 钉钉重复推送的事件应答后不再处理
+	members := fake.Requests("/topapi/edu/user/list")
+	if rec := postCallback(t, event); !callbackAcked(t, rec) {
+		t.Fatalf("duplicate event response = %s", rec.Body.String())
+	}
+	services.WaitDingTalkEvents()
+	if got := fake.Requests("/topapi/edu/user/list"); got != members {
+		t.Errorf("member requests for duplicate event = %d, want %d", got, members)
+	}
+
+	// 已知班级的事件不再遍历部门树，部门事件刷新班级缓存
+	walks := fake.Requests("/topapi/edu/dept/list")
+	event["TimeStamp"] = "2"
+	if rec := postCallback(t, event); !callbackAcked(t, rec) {
+		t.Fatalf("repeated event response = %s", rec.Body.String())
+	}
+	services.WaitDingTalkEvents()
+	if got := fake.Requests("/topapi/edu/dept/list"); got != walks {
+		t.Errorf("department requests for known class = %d, want %d", got, walks)
+	}
+	fake.AddDepartment(dingtalkfake.Department{ID: 102, ParentID: 10, Name: "2班", Type: "class"})
+	fake.AddStudent(dingtalkfake.Student{ClassID: 102, UserID: "s2", Name: "李四"})
+	if rec := postCallback(t, map[string]interface{}{"EventType": "edu_dept_insert", "DeptId": []int{102}}); !callbackAcked(t, rec) {
+		t.Fatalf("dept event response = %s", rec.Body.String())
+	}
+	services.WaitDingTalkEvents()
+	if student, err := models.GetStudentByDingTalkID("s2"); err != nil || student.Class != "七年级2班" {
+		t.Errorf("student in new class = %+v, %v", student, err)
+	}
+}
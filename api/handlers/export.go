@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/itsHenry35/canteen-management-system/models"
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+// 导出工作表名称
+const (
+	exportSheetDetails = "选餐明细"
+	exportSheetClasses = "班级汇总"
+	exportSheetOptions = "选项汇总"
+)
+
+// selectionSourceLabels 选餐来源的显示名称
+var selectionSourceLabels = map[string]string{
+	models.SelectionSourceStudent:   "学生",
+	models.SelectionSourceParent:    "家长",
+	models.SelectionSourceAdmin:     "管理员",
+	models.SelectionSourceScheduler: "自动选餐",
+	models.SelectionSourceImport:    "导入",
+}
+
+// mealTypeLabel 返回餐食类型的显示名称，为空表示未选餐
+func mealTypeLabel(mealType models.MealType) string {
+	if mealType == "" {
+		return "未选餐"
+	}
+	return string(mealType) + "餐"
+}
+
+// ExportMealSelections 导出餐的选餐和取餐情况，支持按班级和取餐日期筛选
+// format=xlsx（默认）时包含明细、班级汇总和选项汇总三个工作表；format=csv 时通过 sheet=details|classes|options 选择工作表
+func ExportMealSelections(w http.ResponseWriter, r *http.Request) {
+	// 解析路径参数
+	mealID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "无效的餐ID")
+		return
+	}
+	if _, err := models.GetMealByID(mealID); err != nil {
+		utils.ResponseError(w, http.StatusNotFound, "未找到餐")
+		return
+	}
+
+	// 解析查询参数
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = "xlsx"
+	}
+	if format != "xlsx" && format != "csv" {
+		utils.ResponseError(w, http.StatusBadRequest, "导出格式必须为 xlsx 或 csv")
+		return
+	}
+	filter := models.MealExportFilter{
+		Class: query.Get("class"),
+		Date:  query.Get("date"),
+	}
+
+	// 汇总数据
+	export, err := models.BuildMealExport(mealID, filter)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sheets := []utils.TableSheet{
+		buildExportDetailsSheet(export),
+		buildExportClassesSheet(export),
+		buildExportOptionsSheet(export),
+	}
+
+	// 文件名
+	filename := fmt.Sprintf("meal-%d", mealID)
+	if filter.Date != "" {
+		filename += "-" + strings.ReplaceAll(filter.Date, "-", "")
+	}
+
+	// CSV 只能包含一个工作表
+	if format == "csv" {
+		sheet := sheets[0]
+		switch query.Get("sheet") {
+		case "", "details":
+		case "classes":
+			sheet = sheets[1]
+			filename += "-classes"
+		case "options":
+			sheet = sheets[2]
+			filename += "-options"
+		default:
+			utils.ResponseError(w, http.StatusBadRequest, "sheet 必须为 details、classes 或 options")
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".csv"))
+		if err := utils.WriteCSV(w, sheet); err != nil {
+			utils.LogError(fmt.Sprintf("导出选餐失败: %v", err))
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".xlsx"))
+	if err := utils.WriteXLSX(w, sheets); err != nil {
+		utils.LogError(fmt.Sprintf("导出选餐失败: %v", err))
+	}
+}
+
+// buildExportDetailsSheet 每名学生一行的选餐明细
+func buildExportDetailsSheet(export *models.MealExport) utils.TableSheet {
+	rows := [][]interface{}{
+		{"班级", "姓名", "学生ID", "用户名", "选餐", "操作人", "来源", "更新时间", "取餐状态", "取餐日期", "最近取餐时间"},
+	}
+	for _, row := range export.Rows {
+		record := []interface{}{row.Student.Class, row.Student.FullName, row.Student.ID, row.Student.Username}
+
+		// 选餐
+		if row.Selection != nil {
+			record = append(record,
+				mealTypeLabel(row.Selection.MealType),
+				row.Selection.Operator,
+				selectionSourceLabels[row.Selection.Source],
+				row.Selection.UpdatedAt.Local().Format("2006-01-02 15:04:05"),
+			)
+		} else {
+			record = append(record, mealTypeLabel(""), "", "", "")
+		}
+
+		// 取餐
+		status := "未取餐"
+		if row.Collected() {
+			status = "已取餐"
+			if export.Filter.Date == "" {
+				status = fmt.Sprintf("已取餐（%d天）", len(row.CollectedDates))
+			}
+		} else if row.Selection == nil {
+			status = ""
+		}
+		collectedAt := ""
+		if row.CollectedAt != nil {
+			collectedAt = row.CollectedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		record = append(record, status, strings.Join(row.CollectedDates, ", "), collectedAt)
+
+		rows = append(rows, record)
+	}
+	return utils.TableSheet{Name: exportSheetDetails, Rows: rows}
+}
+
+// buildExportClassesSheet 按班级汇总，最后一行为合计
+func buildExportClassesSheet(export *models.MealExport) utils.TableSheet {
+	rows := [][]interface{}{
+		{"班级", "学生数", "A餐", "B餐", "未选餐", "已取餐", "已选未取"},
+	}
+	var total models.MealExportClassSummary
+	for _, summary := range export.Classes {
+		rows = append(rows, []interface{}{
+			summary.Class, summary.Students, summary.TypeA, summary.TypeB, summary.Unselected, summary.Collected, summary.NotCollected,
+		})
+		total.Students += summary.Students
+		total.TypeA += summary.TypeA
+		total.TypeB += summary.TypeB
+		total.Unselected += summary.Unselected
+		total.Collected += summary.Collected
+		total.NotCollected += summary.NotCollected
+	}
+	rows = append(rows, []interface{}{
+		"合计", total.Students, total.TypeA, total.TypeB, total.Unselected, total.Collected, total.NotCollected,
+	})
+	return utils.TableSheet{Name: exportSheetClasses, Rows: rows}
+}
+
+// buildExportOptionsSheet 按选项汇总
+func buildExportOptionsSheet(export *models.MealExport) utils.TableSheet {
+	rows := [][]interface{}{
+		{"选项", "人数", "已取餐", "已选未取"},
+	}
+	for _, option := range export.Options {
+		rows = append(rows, []interface{}{mealTypeLabel(option.MealType), option.Students, option.Collected, option.NotCollected})
+	}
+	return utils.TableSheet{Name: exportSheetOptions, Rows: rows}
+}
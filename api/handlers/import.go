@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/itsHenry35/canteen-management-system/api/middlewares"
+	"github.com/itsHenry35/canteen-management-system/models"
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+const (
+	maxImportFileSize = 10 << 20 // 导入文件大小上限（10MB）
+	maxImportRows     = 5000     // 导入文件的数据行数上限
+)
+
+// 导入文件的列名，不区分大小写
+var (
+	importNameColumns       = []string{"姓名", "name", "full_name"}
+	importClassColumns      = []string{"班级", "class"}
+	importDingTalkIDColumns = []string{"钉钉ID", "钉钉 ID", "dingtalk_id", "dingtalk id"}
+	importUsernameColumns   = []string{"用户名", "username"}
+	importStudentIDColumns  = []string{"学生ID", "学生 ID", "student_id", "student id"}
+	importOptionColumns     = []string{"选餐", "餐食", "option", "meal_type"}
+)
+
+// readImportTable 读取上传的导入文件（表单字段 file），返回表头和数据行，数据行的行号从2开始
+func readImportTable(w http.ResponseWriter, r *http.Request) ([]string, [][]string, error) {
+	// 解析上传的文件
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportFileSize+1<<20)
+	if err := r.ParseMultipartForm(maxImportFileSize); err != nil {
+		return nil, nil, errors.New("请上传不超过10MB的 CSV 或 XLSX 文件")
+	}
+	file, fileHeader, err := r.FormFile("file")
+	if err != nil {
+		return nil, nil, errors.New("请上传 CSV 或 XLSX 文件")
+	}
+	defer file.Close()
+
+	// 读取表格
+	rows, err := utils.ReadTable(fileHeader.Filename, file)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rows) == 0 || utils.IsEmptyRow(rows[0]) {
+		return nil, nil, errors.New("文件第一行必须为表头")
+	}
+	if len(rows)-1 > maxImportRows {
+		return nil, nil, fmt.Errorf("每次最多导入%d行", maxImportRows)
+	}
+
+	return rows[0], rows[1:], nil
+}
+
+// isDryRun 判断是否为预览模式，可通过查询参数或表单字段 dry_run=true 指定
+func isDryRun(r *http.Request) bool {
+	return r.URL.Query().Get("dry_run") == "true" || r.FormValue("dry_run") == "true"
+}
+
+// ImportStudents 从 CSV 或 XLSX 文件批量导入学生，dry_run=true 时只校验不写入
+func ImportStudents(w http.ResponseWriter, r *http.Request) {
+	// 读取上传的文件
+	header, data, err := readImportTable(w, r)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	dryRun := isDryRun(r)
+
+	// 查找列
+	nameCol := utils.TableColumn(header, importNameColumns...)
+	classCol := utils.TableColumn(header, importClassColumns...)
+	dingTalkIDCol := utils.TableColumn(header, importDingTalkIDColumns...)
+	usernameCol := utils.TableColumn(header, importUsernameColumns...)
+	if nameCol < 0 || classCol < 0 {
+		utils.ResponseError(w, http.StatusBadRequest, "表头必须包含“姓名”和“班级”列")
+		return
+	}
+
+	// 转换为导入行，跳过空行
+	var rows []*models.StudentImportRow
+	for i, record := range data {
+		if utils.IsEmptyRow(record) {
+			continue
+		}
+		rows = append(rows, &models.StudentImportRow{
+			Row:        i + 2,
+			FullName:   utils.TableCell(record, nameCol),
+			Class:      utils.TableCell(record, classCol),
+			DingTalkID: utils.TableCell(record, dingTalkIDCol),
+			Username:   utils.TableCell(record, usernameCol),
+		})
+	}
+
+	// 校验并导入
+	report, err := models.ImportStudents(rows, dryRun)
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "导入学生失败: "+err.Error())
+		return
+	}
+	if !dryRun && report.Imported > 0 {
+		recordAudit(r, models.AuditActionImport, models.AuditTargetStudent, "", nil, map[string]int{
+			"total":    report.Total,
+			"imported": report.Imported,
+			"failed":   report.Failed,
+		})
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, report)
+}
+
+// ImportSelections 从 CSV 或 XLSX 文件为指定的餐批量导入选餐，dry_run=true 时只校验不写入
+func ImportSelections(w http.ResponseWriter, r *http.Request) {
+	// 读取上传的文件
+	header, data, err := readImportTable(w, r)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	dryRun := isDryRun(r)
+
+	// 解析路径参数
+	mealID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "无效的餐ID")
+		return
+	}
+	if _, err := models.GetMealByID(mealID); err != nil {
+		utils.ResponseError(w, http.StatusNotFound, "未找到餐")
+		return
+	}
+
+	// 查找列
+	studentIDCol := utils.TableColumn(header, importStudentIDColumns...)
+	usernameCol := utils.TableColumn(header, importUsernameColumns...)
+	dingTalkIDCol := utils.TableColumn(header, importDingTalkIDColumns...)
+	nameCol := utils.TableColumn(header, importNameColumns...)
+	classCol := utils.TableColumn(header, importClassColumns...)
+	optionCol := utils.TableColumn(header, importOptionColumns...)
+	if optionCol < 0 {
+		utils.ResponseError(w, http.StatusBadRequest, "表头必须包含“选餐”列")
+		return
+	}
+	if studentIDCol < 0 && usernameCol < 0 && dingTalkIDCol < 0 && (nameCol < 0 || classCol < 0) {
+		utils.ResponseError(w, http.StatusBadRequest, "表头必须包含“学生ID”“用户名”“钉钉ID”之一，或同时包含“姓名”和“班级”")
+		return
+	}
+
+	// 转换为导入行，跳过空行
+	var rows []*models.SelectionImportRow
+	for i, record := range data {
+		if utils.IsEmptyRow(record) {
+			continue
+		}
+		rows = append(rows, &models.SelectionImportRow{
+			Row:        i + 2,
+			StudentID:  utils.TableCell(record, studentIDCol),
+			Username:   utils.TableCell(record, usernameCol),
+			DingTalkID: utils.TableCell(record, dingTalkIDCol),
+			FullName:   utils.TableCell(record, nameCol),
+			Class:      utils.TableCell(record, classCol),
+			Option:     utils.TableCell(record, optionCol),
+		})
+	}
+
+	// 获取管理员姓名
+	operatorname, ok := middlewares.GetFullnameFromContext(r)
+	if !ok {
+		operatorname = "系统管理员"
+	}
+
+	// 校验并导入
+	report, err := models.ImportSelections(mealID, rows, dryRun, operatorname)
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "导入选餐失败: "+err.Error())
+		return
+	}
+	if !dryRun && report.Imported > 0 {
+		recordAudit(r, models.AuditActionImport, models.AuditTargetSelection, strconv.Itoa(mealID), nil, map[string]int{
+			"total":    report.Total,
+			"imported": report.Imported,
+			"failed":   report.Failed,
+		})
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, report)
+}
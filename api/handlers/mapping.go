@@ -2,22 +2,30 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
 
+	"github.com/gorilla/mux"
+	"github.com/itsHenry35/canteen-management-system/models"
 	"github.com/itsHenry35/canteen-management-system/services"
 	"github.com/itsHenry35/canteen-management-system/utils"
 )
 
-// RebuildParentStudentMapping 重建家长-学生映射关系
-func RebuildParentStudentMapping(w http.ResponseWriter, _ *http.Request) {
+// RebuildParentStudentMapping 同步家长-学生映射关系，dry_run=true 时仅预览差异
+func RebuildParentStudentMapping(w http.ResponseWriter, r *http.Request) {
 	// 检查是否已经在重建中
 	if services.IsRebuildingMapping() {
 		utils.ResponseError(w, http.StatusConflict, "家长-学生映射关系重建任务已在进行中，请等待完成")
 		return
 	}
 
+	// 是否仅预览差异
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	recordAudit(r, models.AuditActionSync, models.AuditTargetMapping, "", nil, map[string]bool{"dry_run": dryRun})
+
 	// 启动一个 goroutine 来异步执行重建操作
 	go func() {
-		err := services.RebuildParentStudentMapping()
+		_, err := services.RebuildParentStudentMapping(dryRun)
 		if err != nil {
 			// 记录错误日志
 			utils.LogError("重建家长-学生映射失败: " + err.Error())
@@ -25,8 +33,13 @@ func RebuildParentStudentMapping(w http.ResponseWriter, _ *http.Request) {
 	}()
 
 	// 立即返回成功响应，表示任务已启动
+	message := "家长-学生映射关系重建任务已启动"
+	if dryRun {
+		message = "家长-学生映射关系差异预览任务已启动"
+	}
 	utils.ResponseOK(w, map[string]interface{}{
-		"message": "家长-学生映射关系重建任务已启动",
+		"message": message,
+		"dry_run": dryRun,
 	})
 }
 
@@ -43,3 +56,37 @@ func GetMappingLogs(w http.ResponseWriter, _ *http.Request) {
 	// 返回响应
 	utils.ResponseOK(w, response)
 }
+
+// GetMappingSyncReports 获取最近的映射同步报告
+func GetMappingSyncReports(w http.ResponseWriter, _ *http.Request) {
+	// 获取最近50条报告
+	reports, err := models.GetMappingSyncReports(50)
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "获取同步报告失败")
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, reports)
+}
+
+// GetMappingSyncReport 获取映射同步报告的差异明细
+func GetMappingSyncReport(w http.ResponseWriter, r *http.Request) {
+	// 解析路径参数
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "无效的报告ID")
+		return
+	}
+
+	// 获取报告
+	report, err := models.GetMappingSyncReportByID(id)
+	if err != nil {
+		utils.ResponseError(w, http.StatusNotFound, "未找到同步报告")
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, report)
+}
@@ -2,7 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -11,29 +11,35 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/itsHenry35/canteen-management-system/api/middlewares"
+	"github.com/itsHenry35/canteen-management-system/config"
 	"github.com/itsHenry35/canteen-management-system/models"
-	"github.com/itsHenry35/canteen-management-system/scheduler"
 	"github.com/itsHenry35/canteen-management-system/utils"
 )
 
 // CreateMealRequest 创建餐请求
 type CreateMealRequest struct {
-	Name               string    `json:"name"`                 // 餐名
-	SelectionStartTime time.Time `json:"selection_start_time"` // 选餐开始时间
-	SelectionEndTime   time.Time `json:"selection_end_time"`   // 选餐结束时间
-	EffectiveStartDate time.Time `json:"effective_start_date"` // 领餐开始生效日期
-	EffectiveEndDate   time.Time `json:"effective_end_date"`   // 领餐结束生效日期
-	Image              string    `json:"image"`                // Base64编码的图片
+	Name               string                 `json:"name"`                       // 餐名
+	SelectionStartTime time.Time              `json:"selection_start_time"`       // 选餐开始时间
+	SelectionEndTime   time.Time              `json:"selection_end_time"`         // 选餐结束时间
+	EffectiveStartDate time.Time              `json:"effective_start_date"`       // 领餐开始生效日期
+	EffectiveEndDate   time.Time              `json:"effective_end_date"`         // 领餐结束生效日期
+	Image              string                 `json:"image"`                      // Base64编码的图片
+	ReminderOffsets    models.ReminderOffsets `json:"reminder_offsets,omitempty"` // 选餐截止前的提醒时间（可选），为空时使用系统设置
+	PriceA             int                    `json:"price_a"`                    // A餐每份价格（分）
+	PriceB             int                    `json:"price_b"`                    // B餐每份价格（分）
 }
 
 // UpdateMealRequest 更新餐请求
 type UpdateMealRequest struct {
-	Name               string    `json:"name,omitempty"`       // 餐名（可选）
-	SelectionStartTime time.Time `json:"selection_start_time"` // 选餐开始时间
-	SelectionEndTime   time.Time `json:"selection_end_time"`   // 选餐结束时间
-	EffectiveStartDate time.Time `json:"effective_start_date"` // 领餐开始生效日期
-	EffectiveEndDate   time.Time `json:"effective_end_date"`   // 领餐结束生效日期
-	Image              string    `json:"image,omitempty"`      // Base64编码的图片（可选）
+	Name               string                  `json:"name,omitempty"`             // 餐名（可选）
+	SelectionStartTime time.Time               `json:"selection_start_time"`       // 选餐开始时间
+	SelectionEndTime   time.Time               `json:"selection_end_time"`         // 选餐结束时间
+	EffectiveStartDate time.Time               `json:"effective_start_date"`       // 领餐开始生效日期
+	EffectiveEndDate   time.Time               `json:"effective_end_date"`         // 领餐结束生效日期
+	Image              string                  `json:"image,omitempty"`            // Base64编码的图片（可选）
+	ReminderOffsets    *models.ReminderOffsets `json:"reminder_offsets,omitempty"` // 选餐截止前的提醒时间（可选），传空数组表示使用系统设置
+	PriceA             *int                    `json:"price_a,omitempty"`          // A餐每份价格（分，可选）
+	PriceB             *int                    `json:"price_b,omitempty"`          // B餐每份价格（分，可选）
 }
 
 // MealSelectionRequest 选餐请求
@@ -50,7 +56,14 @@ type BatchMealSelectionRequest struct {
 }
 
 // GetAllMeals 获取所有餐
-func GetAllMeals(w http.ResponseWriter, _ *http.Request) {
+func GetAllMeals(w http.ResponseWriter, r *http.Request) {
+	// archived=true 时获取已归档的餐，可用 from、to（YYYY-MM-DD）限定领餐日期范围
+	query := r.URL.Query()
+	if query.Get("archived") == "true" {
+		getArchivedMeals(w, query.Get("from"), query.Get("to"))
+		return
+	}
+
 	// 获取餐列表
 	meals, err := models.GetAllMeals()
 	if err != nil {
@@ -62,6 +75,45 @@ func GetAllMeals(w http.ResponseWriter, _ *http.Request) {
 	utils.ResponseOK(w, meals)
 }
 
+// getArchivedMeals 获取领餐日期与 [from, to] 重叠的已归档餐，日期为空时不限制
+func getArchivedMeals(w http.ResponseWriter, fromStr, toStr string) {
+	// 解析日期
+	from, to, err := parseDateRange(fromStr, toStr)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 获取已归档的餐
+	meals, err := models.GetArchivedMeals(from, to)
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "获取已归档餐列表失败")
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, meals)
+}
+
+// parseDateRange 解析 YYYY-MM-DD 格式的开始和结束日期，结束时间为结束日期当天的最后时刻，日期为空时返回零值
+func parseDateRange(fromStr, toStr string) (time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+	if fromStr != "" {
+		if from, err = time.ParseInLocation("2006-01-02", fromStr, time.Local); err != nil {
+			return from, to, errors.New("无效的开始日期")
+		}
+	}
+	if toStr != "" {
+		if to, err = time.ParseInLocation("2006-01-02", toStr, time.Local); err != nil {
+			return from, to, errors.New("无效的结束日期")
+		}
+		// 包含结束日期当天
+		to = to.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return from, to, nil
+}
+
 // GetMeal 获取餐信息
 func GetMeal(w http.ResponseWriter, r *http.Request) {
 	// 解析路径参数
@@ -111,17 +163,12 @@ func CreateMeal(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 创建餐
-	meal, err := models.CreateMeal(req.Name, req.SelectionStartTime, req.SelectionEndTime, req.EffectiveStartDate, req.EffectiveEndDate, imgPath)
+	meal, err := models.CreateMeal(req.Name, req.SelectionStartTime, req.SelectionEndTime, req.EffectiveStartDate, req.EffectiveEndDate, imgPath, req.ReminderOffsets, req.PriceA, req.PriceB)
 	if err != nil {
 		utils.ResponseError(w, http.StatusInternalServerError, "创建餐失败: "+err.Error())
 		return
 	}
-
-	// 更新自动选餐任务
-	if err := scheduler.CheckAndUpdateTasks(); err != nil {
-		log.Printf("更新自动选餐任务失败: %v", err)
-		// 不要因为更新任务失败而中断请求
-	}
+	recordAudit(r, models.AuditActionCreate, models.AuditTargetMeal, strconv.Itoa(meal.ID), nil, meal)
 
 	// 返回响应
 	utils.ResponseOK(w, meal)
@@ -152,6 +199,7 @@ func UpdateMeal(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 更新餐的基本信息
+	before := *meal
 	meal.SelectionStartTime = req.SelectionStartTime
 	meal.SelectionEndTime = req.SelectionEndTime
 	meal.EffectiveStartDate = req.EffectiveStartDate
@@ -191,24 +239,32 @@ func UpdateMeal(w http.ResponseWriter, r *http.Request) {
 	if req.Name != "" {
 		meal.Name = req.Name
 	}
+	if req.ReminderOffsets != nil {
+		meal.ReminderOffsets = *req.ReminderOffsets
+	}
+	if req.PriceA != nil {
+		meal.PriceA = *req.PriceA
+	}
+	if req.PriceB != nil {
+		meal.PriceB = *req.PriceB
+	}
 
 	// 更新餐
-	if err := models.UpdateMeal(meal); err != nil {
+	operatorname, ok := middlewares.GetFullnameFromContext(r)
+	if !ok {
+		operatorname = "系统管理员"
+	}
+	if err := models.UpdateMeal(meal, operatorname); err != nil {
 		utils.ResponseError(w, http.StatusInternalServerError, "更新餐失败: "+err.Error())
 		return
 	}
-
-	// 更新自动选餐任务
-	if err := scheduler.CheckAndUpdateTasks(); err != nil {
-		log.Printf("更新自动选餐任务失败: %v", err)
-		// 不要因为更新任务失败而中断请求
-	}
+	recordAudit(r, models.AuditActionUpdate, models.AuditTargetMeal, strconv.Itoa(id), before, meal)
 
 	// 返回响应
 	utils.ResponseOK(w, meal)
 }
 
-// DeleteMeal 删除餐
+// DeleteMeal 彻底删除餐及其选餐记录和图片
 func DeleteMeal(w http.ResponseWriter, r *http.Request) {
 	// 解析路径参数
 	vars := mux.Vars(r)
@@ -218,23 +274,29 @@ func DeleteMeal(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 删除餐
-	if err := models.DeleteMeal(id); err != nil {
-		utils.ResponseError(w, http.StatusInternalServerError, "删除餐失败")
+	// 获取餐信息，用于审计日志
+	meal, err := models.GetMealByID(id)
+	if err != nil {
+		utils.ResponseError(w, http.StatusNotFound, "未找到餐")
 		return
 	}
 
-	// 更新自动选餐任务
-	if err := scheduler.CheckAndUpdateTasks(); err != nil {
-		log.Printf("更新自动选餐任务失败: %v", err)
-		// 不要因为更新任务失败而中断请求
+	// 删除餐
+	operatorname, ok := middlewares.GetFullnameFromContext(r)
+	if !ok {
+		operatorname = "系统管理员"
 	}
+	if err := models.DeleteMeal(id, operatorname); err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "删除餐失败")
+		return
+	}
+	recordAudit(r, models.AuditActionDelete, models.AuditTargetMeal, strconv.Itoa(id), meal, nil)
 
 	// 返回响应
 	utils.ResponseOK(w, map[string]bool{"success": true})
 }
 
-// GetMealSelections 获取餐的选餐情况
+// GetMealSelections 获取餐的选餐情况，整个领餐时间都请假的未选餐学生单独列出
 func GetMealSelections(w http.ResponseWriter, r *http.Request) {
 	// 解析路径参数
 	vars := mux.Vars(r)
@@ -277,10 +339,23 @@ func GetMealSelections(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// 创建未选餐学生ID列表
+	// 获取整个领餐时间都请假的学生
+	absentStudentIDs, err := models.GetFullyAbsentStudentIDs(id)
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "获取请假记录失败")
+		return
+	}
+
+	// 创建未选餐和请假学生ID列表
 	var unselectedStudentIDs []int
+	var absentIDs []int
 	for _, student := range allStudents {
-		if !selectedStudentIDs[student.ID] {
+		if selectedStudentIDs[student.ID] {
+			continue
+		}
+		if absentStudentIDs[student.ID] {
+			absentIDs = append(absentIDs, student.ID)
+		} else {
 			unselectedStudentIDs = append(unselectedStudentIDs, student.ID)
 		}
 	}
@@ -290,6 +365,7 @@ func GetMealSelections(w http.ResponseWriter, r *http.Request) {
 		"a":          typeAStudentIDs,
 		"b":          typeBStudentIDs,
 		"unselected": unselectedStudentIDs,
+		"absent":     absentIDs,
 	})
 }
 
@@ -315,14 +391,18 @@ func StudentSelectMeal(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 获取学生关系
+	// 获取学生关系，学生本人登录时为"本人"，家长登录时为家长与学生的关系
 	relation, ok := middlewares.GetRelationFromContext(r)
 	if !ok {
 		relation = ""
 	}
+	source := models.SelectionSourceStudent
+	if relation != "" && relation != "本人" {
+		source = models.SelectionSourceParent
+	}
 
 	// 创建选餐记录
-	_, err := models.CreateMealSelection(studentID, req.MealID, req.MealType, true, relation)
+	_, err := models.CreateMealSelection(studentID, req.MealID, req.MealType, true, relation, source)
 	if err != nil {
 		utils.ResponseError(w, http.StatusInternalServerError, "选餐失败: "+err.Error())
 		return
@@ -357,11 +437,16 @@ func BatchSelectMeals(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 批量选餐
-	count, err := models.BatchSelectMeals(req.StudentIDs, req.MealID, req.MealType, operatorname)
+	count, err := models.BatchSelectMeals(req.StudentIDs, req.MealID, req.MealType, operatorname, models.SelectionSourceAdmin)
 	if err != nil {
 		utils.ResponseError(w, http.StatusInternalServerError, "批量选餐失败: "+err.Error())
 		return
 	}
+	recordAudit(r, models.AuditActionBatch, models.AuditTargetSelection, strconv.Itoa(req.MealID), nil, map[string]interface{}{
+		"student_ids": req.StudentIDs,
+		"meal_type":   req.MealType,
+		"count":       count,
+	})
 
 	// 返回响应
 	utils.ResponseOK(w, map[string]interface{}{
@@ -421,26 +506,19 @@ func ImportSelection(w http.ResponseWriter, r *http.Request) {
 		// 使用验证过的学生ID
 		studentID = student.ID
 	} else {
-		// 使用钉钉ID查找学生
-		student, err := models.GetStudentByDingTalkID(req.ID)
+		// 使用钉钉ID查找学生，也可以是家长的钉钉ID
+		student, _, err := models.FindStudentByDingTalkIDOrParent(req.ID)
 		if err != nil {
-			// 如果学生未找到，可能是家长的钉钉ID，尝试查找关联学生
-			parents, err := models.GetStudentsByParentID(req.ID)
-			if err != nil || len(parents) == 0 {
-				utils.ResponseError(w, http.StatusNotFound, "未找到与该钉钉ID关联的学生")
-				return
-			}
-
-			// 使用第一个关联学生的ID
-			student, err := models.GetStudentByDingTalkID(parents[0].StudentID)
-			if err != nil {
-				utils.ResponseError(w, http.StatusNotFound, "未找到学生")
-				return
-			}
-			studentID = student.ID
-		} else {
-			studentID = student.ID
+			utils.ResponseError(w, http.StatusNotFound, err.Error())
+			return
 		}
+		studentID = student.ID
+	}
+
+	// 记录原有的选餐，用于审计日志
+	var before interface{}
+	if existing, err := models.GetMealSelectionByStudentAndMeal(studentID, req.MealID); err == nil && existing != nil {
+		before = existing
 	}
 
 	// 创建选餐记录
@@ -448,11 +526,12 @@ func ImportSelection(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		operatorname = "系统管理员"
 	}
-	_, err = models.CreateMealSelection(studentID, req.MealID, req.MealType, false, operatorname)
+	selection, err := models.CreateMealSelection(studentID, req.MealID, req.MealType, false, operatorname, models.SelectionSourceImport)
 	if err != nil {
 		utils.ResponseError(w, http.StatusInternalServerError, "选餐失败: "+err.Error())
 		return
 	}
+	recordAudit(r, models.AuditActionImport, models.AuditTargetSelection, strconv.Itoa(req.MealID), before, selection)
 
 	// 返回响应
 	utils.ResponseOK(w, map[string]interface{}{
@@ -461,17 +540,64 @@ func ImportSelection(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// CleanupExpiredMeals 清理过期的餐
-func CleanupExpiredMeals(w http.ResponseWriter, _ *http.Request) {
-	// 清理过期的餐
-	err := models.CleanupExpiredMeals()
+// GetSelectionHistory 按学生或餐查询选餐变更历史
+func GetSelectionHistory(w http.ResponseWriter, r *http.Request) {
+	// 解析查询参数，至少需要学生ID或餐ID之一
+	query := r.URL.Query()
+	studentID, _ := strconv.Atoi(query.Get("student_id"))
+	mealID, _ := strconv.Atoi(query.Get("meal_id"))
+	if studentID <= 0 && mealID <= 0 {
+		utils.ResponseError(w, http.StatusBadRequest, "请指定学生ID或餐ID")
+		return
+	}
+
+	// 查询变更历史
+	history, err := models.GetMealSelectionHistory(studentID, mealID)
 	if err != nil {
-		utils.ResponseError(w, http.StatusInternalServerError, "清理过期餐失败")
+		utils.ResponseError(w, http.StatusInternalServerError, "获取选餐变更历史失败")
 		return
 	}
 
 	// 返回响应
-	utils.ResponseOK(w, map[string]bool{"success": true})
+	utils.ResponseOK(w, history)
+}
+
+// CleanupExpiredMeals 归档过期的餐
+func CleanupExpiredMeals(w http.ResponseWriter, r *http.Request) {
+	// 归档过期的餐
+	count, err := models.ArchiveExpiredMeals()
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "归档过期餐失败")
+		return
+	}
+	recordAudit(r, models.AuditActionArchive, models.AuditTargetMeal, "", nil, map[string]int{"count": count})
+
+	// 返回响应
+	utils.ResponseOK(w, map[string]interface{}{
+		"success": true,
+		"count":   count,
+	})
+}
+
+// PurgeArchivedMeals 彻底删除超过保留期限的已归档餐
+func PurgeArchivedMeals(w http.ResponseWriter, r *http.Request) {
+	// 按系统设置的保留天数删除
+	retentionDays := config.Get().Scheduler.MealRetentionDays
+	count, err := models.PurgeArchivedMeals(retentionDays)
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "彻底删除已归档餐失败: "+err.Error())
+		return
+	}
+	recordAudit(r, models.AuditActionPurge, models.AuditTargetMeal, "", nil, map[string]int{
+		"retention_days": retentionDays,
+		"count":          count,
+	})
+
+	// 返回响应
+	utils.ResponseOK(w, map[string]interface{}{
+		"success": true,
+		"count":   count,
+	})
 }
 
 // NotifyUnselectedStudents 手动提醒未选餐学生
@@ -484,7 +610,7 @@ func NotifyUnselectedStudents(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 调用模型层的通知函数
-	err := models.NotifyUnselectedStudentsByMealId(req.MealID)
+	_, err := models.NotifyUnselectedStudentsByMealId(req.MealID)
 	if err != nil {
 		utils.ResponseError(w, http.StatusBadRequest, err.Error())
 		return
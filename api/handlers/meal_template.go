@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/itsHenry35/canteen-management-system/config"
+	"github.com/itsHenry35/canteen-management-system/models"
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+// MealTemplateRequest 创建或更新餐模板请求
+type MealTemplateRequest struct {
+	Name            string                 `json:"name"`                       // 餐名
+	Image           string                 `json:"image"`                      // Base64编码的默认图片，更新时为空表示保留原图片
+	ReminderOffsets models.ReminderOffsets `json:"reminder_offsets,omitempty"` // 选餐截止前的提醒时间（可选），为空时使用系统设置
+	PriceA          int                    `json:"price_a"`                    // A餐每份价格（分）
+	PriceB          int                    `json:"price_b"`                    // B餐每份价格（分）
+	Recurrence      models.MealRecurrence  `json:"recurrence"`                 // 重复规则
+	StartDate       string                 `json:"start_date"`                 // 从该日期所在的周开始生成，为空时为今天
+	EndDate         string                 `json:"end_date"`                   // 领餐开始日期晚于该日期的周不再生成（可选）
+	Enabled         *bool                  `json:"enabled,omitempty"`          // 是否由定时任务自动生成，创建时默认启用，更新时为空表示保持不变
+}
+
+// parseMealTemplateID 解析路径中的模板ID
+func parseMealTemplateID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "无效的餐模板ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// saveMealTemplateImage 保存模板的默认图片，返回图片地址
+func saveMealTemplateImage(image string) (string, error) {
+	imgPath, err := utils.SaveBase64Image(image, "./data/images", "meal_template", time.Now().Unix())
+	if err != nil || imgPath == "" {
+		return "", err
+	}
+	return filepath.Join("/static/images", imgPath), nil
+}
+
+// parseMealTemplateWeeks 解析提前的周数，为空时使用系统设置
+func parseMealTemplateWeeks(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("weeks")
+	if value == "" {
+		return config.Get().Scheduler.MealTemplateWeeksAhead, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// GetMealTemplates 获取所有餐模板
+func GetMealTemplates(w http.ResponseWriter, _ *http.Request) {
+	templates, err := models.GetMealTemplates()
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "获取餐模板失败")
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, templates)
+}
+
+// GetMealTemplate 获取餐模板
+func GetMealTemplate(w http.ResponseWriter, r *http.Request) {
+	// 解析路径参数
+	id, ok := parseMealTemplateID(w, r)
+	if !ok {
+		return
+	}
+
+	// 获取模板
+	template, err := models.GetMealTemplateByID(id)
+	if err != nil {
+		utils.ResponseError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, template)
+}
+
+// CreateMealTemplate 创建餐模板
+func CreateMealTemplate(w http.ResponseWriter, r *http.Request) {
+	// 解析请求
+	var req MealTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "无效的请求")
+		return
+	}
+
+	template := &models.MealTemplate{
+		Name:            req.Name,
+		ReminderOffsets: req.ReminderOffsets,
+		PriceA:          req.PriceA,
+		PriceB:          req.PriceB,
+		Recurrence:      req.Recurrence,
+		StartDate:       req.StartDate,
+		EndDate:         req.EndDate,
+		Enabled:         req.Enabled == nil || *req.Enabled,
+	}
+	if template.StartDate == "" {
+		template.StartDate = time.Now().Format("2006-01-02")
+	}
+
+	// 保存图片
+	imgPath, err := saveMealTemplateImage(req.Image)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "保存图片失败: "+err.Error())
+		return
+	}
+	template.ImagePath = imgPath
+
+	// 创建模板
+	if err := models.CreateMealTemplate(template); err != nil {
+		models.RemoveMealTemplateImage(imgPath)
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	recordAudit(r, models.AuditActionCreate, models.AuditTargetMealTemplate, strconv.Itoa(template.ID), nil, template)
+
+	// 返回响应
+	utils.ResponseOK(w, template)
+}
+
+// UpdateMealTemplate 更新餐模板，已生成的餐不受影响
+func UpdateMealTemplate(w http.ResponseWriter, r *http.Request) {
+	// 解析路径参数
+	id, ok := parseMealTemplateID(w, r)
+	if !ok {
+		return
+	}
+
+	// 获取模板
+	template, err := models.GetMealTemplateByID(id)
+	if err != nil {
+		utils.ResponseError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	// 解析请求
+	var req MealTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "无效的请求")
+		return
+	}
+
+	// 更新模板
+	before := *template
+	template.Name = req.Name
+	template.ReminderOffsets = req.ReminderOffsets
+	template.PriceA = req.PriceA
+	template.PriceB = req.PriceB
+	template.Recurrence = req.Recurrence
+	if req.StartDate != "" {
+		template.StartDate = req.StartDate
+	}
+	template.EndDate = req.EndDate
+	if req.Enabled != nil {
+		template.Enabled = *req.Enabled
+	}
+
+	// 如果提供了新图片，则保存新图片
+	if req.Image != "" {
+		imgPath, err := saveMealTemplateImage(req.Image)
+		if err != nil {
+			utils.ResponseError(w, http.StatusBadRequest, "保存图片失败: "+err.Error())
+			return
+		}
+		template.ImagePath = imgPath
+	}
+
+	if err := models.UpdateMealTemplate(template); err != nil {
+		if template.ImagePath != before.ImagePath {
+			models.RemoveMealTemplateImage(template.ImagePath)
+		}
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 删除旧图片
+	if template.ImagePath != before.ImagePath {
+		models.RemoveMealTemplateImage(before.ImagePath)
+	}
+	recordAudit(r, models.AuditActionUpdate, models.AuditTargetMealTemplate, strconv.Itoa(id), before, template)
+
+	// 返回响应
+	utils.ResponseOK(w, template)
+}
+
+// DeleteMealTemplate 删除餐模板，已生成的餐保留
+func DeleteMealTemplate(w http.ResponseWriter, r *http.Request) {
+	// 解析路径参数
+	id, ok := parseMealTemplateID(w, r)
+	if !ok {
+		return
+	}
+
+	// 删除模板
+	template, err := models.DeleteMealTemplate(id)
+	if err != nil {
+		utils.ResponseError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	recordAudit(r, models.AuditActionDelete, models.AuditTargetMealTemplate, strconv.Itoa(id), template, nil)
+
+	// 返回响应
+	utils.ResponseOK(w, map[string]bool{"success": true})
+}
+
+// PreviewMealTemplate 预览模板从本周起几周内每周的餐，不会生成
+func PreviewMealTemplate(w http.ResponseWriter, r *http.Request) {
+	// 解析参数
+	id, ok := parseMealTemplateID(w, r)
+	if !ok {
+		return
+	}
+	weeks, err := parseMealTemplateWeeks(r)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "无效的周数")
+		return
+	}
+
+	// 预览
+	occurrences, err := models.PreviewMealTemplate(id, weeks)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, occurrences)
+}
+
+// GenerateMealTemplate 立即按模板生成从本周起几周内尚未生成的餐
+func GenerateMealTemplate(w http.ResponseWriter, r *http.Request) {
+	// 解析参数
+	id, ok := parseMealTemplateID(w, r)
+	if !ok {
+		return
+	}
+	weeks, err := parseMealTemplateWeeks(r)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "无效的周数")
+		return
+	}
+
+	// 生成餐
+	occurrences, err := models.GenerateMealsFromTemplate(id, weeks)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	for _, occurrence := range occurrences {
+		if occurrence.Status == models.MealTemplateCreated {
+			recordAudit(r, models.AuditActionCreate, models.AuditTargetMeal, strconv.Itoa(occurrence.MealID), nil, occurrence)
+		}
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, occurrences)
+}
@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/itsHenry35/canteen-management-system/api/middlewares"
+	"github.com/itsHenry35/canteen-management-system/config"
+	"github.com/itsHenry35/canteen-management-system/models"
+	"github.com/itsHenry35/canteen-management-system/services"
+	"github.com/itsHenry35/canteen-management-system/services/payment"
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+// CreateTopUpOrderRequest 充值下单请求，金额单位为分
+type CreateTopUpOrderRequest struct {
+	Amount int `json:"amount"`
+}
+
+// MockPayRequest 模拟付款请求
+type MockPayRequest struct {
+	OrderNo string `json:"order_no"`
+	Result  string `json:"result"` // success, failure, delayed, lost
+	Delay   int    `json:"delay"`  // delayed 时延迟回调的秒数，默认30秒
+}
+
+// CreateTopUpOrder 学生或家长创建充值订单，返回付款页面地址
+func CreateTopUpOrder(w http.ResponseWriter, r *http.Request) {
+	// 从上下文获取学生ID
+	studentID, ok := middlewares.GetUserIDFromContext(r)
+	if !ok {
+		utils.ResponseError(w, http.StatusUnauthorized, "未授权")
+		return
+	}
+
+	// 解析请求
+	var req CreateTopUpOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+
+	// 学生本人登录时为"本人"，家长登录时为家长与学生的关系
+	relation, _ := middlewares.GetRelationFromContext(r)
+
+	// 下单
+	order, err := services.CreateTopUpOrder(studentID, req.Amount, relation)
+	if err != nil {
+		if errors.Is(err, services.ErrPaymentDisabled) {
+			utils.ResponseError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, order)
+}
+
+// GetMyPaymentOrders 学生或家长查看自己的充值订单
+func GetMyPaymentOrders(w http.ResponseWriter, r *http.Request) {
+	// 从上下文获取学生ID
+	studentID, ok := middlewares.GetUserIDFromContext(r)
+	if !ok {
+		utils.ResponseError(w, http.StatusUnauthorized, "未授权")
+		return
+	}
+
+	// 解析分页参数
+	query := r.URL.Query()
+	filter := models.PaymentOrderFilter{StudentID: studentID}
+	filter.Page, _ = strconv.Atoi(query.Get("page"))
+	filter.PageSize, _ = strconv.Atoi(query.Get("page_size"))
+	if filter.PageSize > 100 {
+		filter.PageSize = 100
+	}
+
+	// 查询订单
+	orders, total, err := models.GetPaymentOrders(filter)
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "获取充值订单失败")
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, map[string]interface{}{
+		"total":  total,
+		"orders": orders,
+	})
+}
+
+// GetMyPaymentOrder 学生或家长查询充值订单的状态，用于付款后轮询
+func GetMyPaymentOrder(w http.ResponseWriter, r *http.Request) {
+	// 从上下文获取学生ID
+	studentID, ok := middlewares.GetUserIDFromContext(r)
+	if !ok {
+		utils.ResponseError(w, http.StatusUnauthorized, "未授权")
+		return
+	}
+
+	// 查询订单，不能查看其他学生的订单
+	order, err := models.GetPaymentOrderByNo(mux.Vars(r)["order_no"])
+	if err != nil || order.StudentID != studentID {
+		utils.ResponseError(w, http.StatusNotFound, "订单不存在")
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, order)
+}
+
+// GetPaymentOrders 分页查询充值订单
+func GetPaymentOrders(w http.ResponseWriter, r *http.Request) {
+	// 解析查询参数
+	query := r.URL.Query()
+	filter := models.PaymentOrderFilter{Status: query.Get("status")}
+	if filter.Status != "" && !models.IsValidPaymentStatus(filter.Status) {
+		utils.ResponseError(w, http.StatusBadRequest, "无效的订单状态")
+		return
+	}
+	filter.StudentID, _ = strconv.Atoi(query.Get("student_id"))
+	filter.Page, _ = strconv.Atoi(query.Get("page"))
+	filter.PageSize, _ = strconv.Atoi(query.Get("page_size"))
+	if filter.PageSize > 100 {
+		filter.PageSize = 100
+	}
+
+	// 查询订单
+	orders, total, err := models.GetPaymentOrders(filter)
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "获取充值订单失败")
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, map[string]interface{}{
+		"total":  total,
+		"orders": orders,
+	})
+}
+
+// PaymentNotify 接收支付网关的异步回调，校验签名后更新订单并按网关要求应答
+func PaymentNotify(w http.ResponseWriter, r *http.Request) {
+	// 获取支付网关
+	gateway, err := payment.Available(mux.Vars(r)["gateway"])
+	if err != nil {
+		utils.ResponseError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	// 校验签名并解析支付结果
+	result, err := gateway.ParseNotify(r)
+	if err != nil {
+		utils.LogError(fmt.Sprintf("支付回调校验失败（%s）: %v", gateway.Name(), err))
+		gateway.AckNotify(w, err)
+		return
+	}
+
+	// 更新订单，失败时网关会重试回调
+	if _, err := services.ApplyPaymentResult(gateway.Name(), result); err != nil {
+		utils.LogError(fmt.Sprintf("处理订单 %s 的支付回调失败: %v", result.OrderNo, err))
+		gateway.AckNotify(w, err)
+		return
+	}
+
+	gateway.AckNotify(w, nil)
+}
+
+// mockGateway 当前配置使用模拟网关且启用了 payment.allow_mock 时返回模拟网关
+func mockGateway() (*payment.MockGateway, bool) {
+	cfg := config.Get().Payment
+	if !cfg.Enabled || cfg.Gateway != payment.MockName {
+		return nil, false
+	}
+	gateway, err := payment.Available(payment.MockName)
+	if err != nil {
+		return nil, false
+	}
+	mock, ok := gateway.(*payment.MockGateway)
+	return mock, ok
+}
+
+// MockPayPage 模拟网关的付款页面，可以选择支付成功、失败、延迟回调或丢失回调
+func MockPayPage(w http.ResponseWriter, r *http.Request) {
+	mock, ok := mockGateway()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	orderNo := r.URL.Query().Get("order_no")
+	request, result, ok := mock.Order(orderNo)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width"><title>模拟支付</title></head>
+<body style="font-family:sans-serif;max-width:480px;margin:40px auto">
+<h2>模拟支付</h2>
+<p>%s</p>
+<p>订单号：%s<br>金额：%s 元<br>状态：%s</p>
+<p>
+<button onclick="pay('success')">支付成功</button>
+<button onclick="pay('failure')">支付失败</button>
+<button onclick="pay('delayed')">支付成功（延迟回调）</button>
+<button onclick="pay('lost')">支付成功（不回调）</button>
+</p>
+<p id="message"></p>
+<script>
+function pay(result) {
+  fetch(location.pathname, {method: 'POST', headers: {'Content-Type': 'application/json'},
+    body: JSON.stringify({order_no: %q, result: result})})
+    .then(function (resp) { return resp.json(); })
+    .then(function (data) { document.getElementById('message').textContent = data.code === 200 ? data.data.message : data.message; });
+}
+</script>
+</body></html>`,
+		html.EscapeString(request.Subject), html.EscapeString(orderNo), models.FormatAmount(request.Amount),
+		html.EscapeString(result.Status), orderNo)
+}
+
+// MockPay 在模拟网关中付款，按选择的结果回调
+func MockPay(w http.ResponseWriter, r *http.Request) {
+	mock, ok := mockGateway()
+	if !ok {
+		utils.ResponseError(w, http.StatusNotFound, "未启用模拟支付网关")
+		return
+	}
+
+	// 解析请求
+	var req MockPayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+	delay := 30 * time.Second
+	if req.Delay > 0 {
+		delay = time.Duration(req.Delay) * time.Second
+	}
+
+	// 模拟付款
+	if err := mock.Simulate(req.OrderNo, req.Result, delay); err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, map[string]interface{}{
+		"success": true,
+		"message": "已模拟付款：" + req.Result,
+	})
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/models"
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+// productionReportTemplate 可打印的备餐报表
+var productionReportTemplate = template.Must(template.New("production").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>{{.Date}} 备餐报表</title>
+<style>
+body { font-family: "PingFang SC", "Microsoft YaHei", sans-serif; margin: 24px; color: #000; }
+h1 { font-size: 22px; margin: 0 0 4px; }
+.meta { color: #555; font-size: 13px; margin-bottom: 16px; }
+.totals { font-size: 18px; margin-bottom: 16px; }
+table { border-collapse: collapse; width: 100%; font-size: 14px; }
+th, td { border: 1px solid #333; padding: 6px 8px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+th { background: #eee; }
+tfoot td { font-weight: bold; }
+@media print {
+  body { margin: 0; }
+  th { background: none; }
+  tr { page-break-inside: avoid; }
+}
+</style>
+</head>
+<body>
+<h1>{{.Date}} 备餐报表</h1>
+{{if .Meal}}
+<div class="meta">{{.Meal.Name}} · 生成时间 {{.GeneratedAt.Format "2006-01-02 15:04:05"}}</div>
+<div class="totals">A餐 <strong>{{.Total.TypeA}}</strong> 份，B餐 <strong>{{.Total.TypeB}}</strong> 份，合计 <strong>{{.Total.Portions}}</strong> 份</div>
+<table>
+<thead><tr><th>班级</th><th>学生数</th><th>A餐</th><th>B餐</th><th>未选餐</th><th>请假</th><th>合计份数</th></tr></thead>
+<tbody>
+{{range .Classes}}<tr><td>{{.Class}}</td><td>{{.Students}}</td><td>{{.TypeA}}</td><td>{{.TypeB}}</td><td>{{.Unselected}}</td><td>{{.Absent}}</td><td>{{.Portions}}</td></tr>
+{{end}}</tbody>
+<tfoot><tr><td>合计</td><td>{{.Total.Students}}</td><td>{{.Total.TypeA}}</td><td>{{.Total.TypeB}}</td><td>{{.Total.Unselected}}</td><td>{{.Total.Absent}}</td><td>{{.Total.Portions}}</td></tr></tfoot>
+</table>
+{{else}}
+<div class="meta">生成时间 {{.GeneratedAt.Format "2006-01-02 15:04:05"}}</div>
+<p>{{if .NotServing}}当天不供餐（{{.NotServing}}）。{{else}}当天没有需要领餐的餐。{{end}}</p>
+{{end}}
+</body>
+</html>
+`))
+
+// GetProductionReport 获取某一天的备餐报表，date 默认为今天，format=html 时返回可打印的页面
+func GetProductionReport(w http.ResponseWriter, r *http.Request) {
+	// 解析查询参数
+	query := r.URL.Query()
+	date := query.Get("date")
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+	format := query.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "html" {
+		utils.ResponseError(w, http.StatusBadRequest, "格式必须为 json 或 html")
+		return
+	}
+
+	// 生成报表
+	report, err := models.BuildProductionReport(date)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if format == "json" {
+		utils.ResponseOK(w, report)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := productionReportTemplate.Execute(w, report); err != nil {
+		utils.LogError(fmt.Sprintf("生成备餐报表页面失败: %v", err))
+	}
+}
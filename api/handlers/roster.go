@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/itsHenry35/canteen-management-system/models"
+	"github.com/itsHenry35/canteen-management-system/services"
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+// SyncStudentRoster 从钉钉同步学生名单，dry_run=true 时仅预览差异
+func SyncStudentRoster(w http.ResponseWriter, r *http.Request) {
+	// 检查是否已经在同步中
+	if services.IsSyncingRoster() {
+		utils.ResponseError(w, http.StatusConflict, "学生名单同步已在进行中，请等待完成")
+		return
+	}
+
+	// 是否仅预览差异
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	recordAudit(r, models.AuditActionSync, models.AuditTargetRoster, "", nil, map[string]bool{"dry_run": dryRun})
+
+	// 启动一个 goroutine 来异步执行同步操作
+	go func() {
+		_, err := services.SyncStudentRoster(dryRun, services.RosterSyncSourceManual)
+		if err != nil {
+			// 记录错误日志
+			utils.LogError("同步学生名单失败: " + err.Error())
+		}
+	}()
+
+	// 立即返回成功响应，表示任务已启动
+	message := "学生名单同步任务已启动"
+	if dryRun {
+		message = "学生名单差异预览任务已启动"
+	}
+	utils.ResponseOK(w, map[string]interface{}{
+		"message": message,
+		"dry_run": dryRun,
+	})
+}
+
+// GetRosterSyncLogs 获取学生名单同步的日志
+func GetRosterSyncLogs(w http.ResponseWriter, _ *http.Request) {
+	// 获取所有日志
+	logs := services.GetRosterSyncLogs()
+
+	// 返回响应
+	utils.ResponseOK(w, map[string]interface{}{
+		"logs": logs,
+	})
+}
+
+// GetRosterSyncReports 获取最近的学生名单同步报告
+func GetRosterSyncReports(w http.ResponseWriter, _ *http.Request) {
+	// 获取最近50条报告
+	reports, err := models.GetRosterSyncReports(50)
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "获取同步报告失败")
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, reports)
+}
+
+// GetRosterSyncReport 获取学生名单同步报告的差异明细
+func GetRosterSyncReport(w http.ResponseWriter, r *http.Request) {
+	// 解析路径参数
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "无效的报告ID")
+		return
+	}
+
+	// 获取报告
+	report, err := models.GetRosterSyncReportByID(id)
+	if err != nil {
+		utils.ResponseError(w, http.StatusNotFound, "未找到同步报告")
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, report)
+}
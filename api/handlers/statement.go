@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/api/middlewares"
+	"github.com/itsHenry35/canteen-management-system/config"
+	"github.com/itsHenry35/canteen-management-system/models"
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+// walletTypeLabels 余额流水类型的显示名称
+var walletTypeLabels = map[string]string{
+	models.WalletTypeTopUp:      "充值",
+	models.WalletTypeCharge:     "扣费",
+	models.WalletTypeRefund:     "退款",
+	models.WalletTypeAdjustment: "调整",
+}
+
+// parseStatementQuery 解析账单的月份（默认本月）和格式（json 或 pdf）
+func parseStatementQuery(r *http.Request) (string, string, error) {
+	query := r.URL.Query()
+	month := query.Get("month")
+	if month == "" {
+		month = time.Now().Format("2006-01")
+	}
+	format := query.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "pdf" {
+		return "", "", fmt.Errorf("格式必须为 json 或 pdf")
+	}
+	return month, format, nil
+}
+
+// GetStudentStatement 获取学生某个月的账单，format=pdf 时下载 PDF 文件
+func GetStudentStatement(w http.ResponseWriter, r *http.Request) {
+	// 解析查询参数
+	month, format, err := parseStatementQuery(r)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	studentID, err := strconv.Atoi(r.URL.Query().Get("student_id"))
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "无效的学生ID")
+		return
+	}
+
+	// 生成账单
+	statement, err := models.BuildStatement(studentID, month)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeStatements(w, format, []*models.Statement{statement}, fmt.Sprintf("statement-%d-%s", studentID, month), statement)
+}
+
+// GetFamilyStatement 获取家长（钉钉ID）名下所有学生某个月的账单
+func GetFamilyStatement(w http.ResponseWriter, r *http.Request) {
+	// 解析查询参数
+	month, format, err := parseStatementQuery(r)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	parentID := strings.TrimSpace(r.URL.Query().Get("parent_id"))
+	if parentID == "" {
+		utils.ResponseError(w, http.StatusBadRequest, "家长钉钉ID不能为空")
+		return
+	}
+
+	// 生成账单
+	family, err := models.BuildFamilyStatement([]string{parentID}, month)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeStatements(w, format, family.Statements, "statement-family-"+month, family)
+}
+
+// GetMyStatement 学生或家长获取本人某个月的账单；家长登录时 scope=family 返回所有子女的合并账单
+func GetMyStatement(w http.ResponseWriter, r *http.Request) {
+	// 从上下文获取学生ID
+	studentID, ok := middlewares.GetUserIDFromContext(r)
+	if !ok {
+		utils.ResponseError(w, http.StatusUnauthorized, "未授权")
+		return
+	}
+
+	// 解析查询参数
+	month, format, err := parseStatementQuery(r)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 本人账单
+	scope := r.URL.Query().Get("scope")
+	if scope == "" || scope == "student" {
+		statement, err := models.BuildStatement(studentID, month)
+		if err != nil {
+			utils.ResponseError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeStatements(w, format, []*models.Statement{statement}, "statement-"+month, statement)
+		return
+	}
+	if scope != "family" {
+		utils.ResponseError(w, http.StatusBadRequest, "scope 必须为 student 或 family")
+		return
+	}
+
+	// 家庭账单只对家长开放，只包括登录的家长本人名下的学生
+	relation, _ := middlewares.GetRelationFromContext(r)
+	if relation == "" || relation == "本人" {
+		utils.ResponseError(w, http.StatusForbidden, "只有家长可以查看家庭账单")
+		return
+	}
+	parentID, _ := middlewares.GetParentIDFromContext(r)
+	if parentID == "" {
+		utils.ResponseError(w, http.StatusForbidden, "登录凭证缺少家长信息，请重新登录后查看家庭账单")
+		return
+	}
+	family, err := models.BuildFamilyStatement([]string{parentID}, month)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeStatements(w, format, family.Statements, "statement-family-"+month, family)
+}
+
+// writeStatements 按格式返回账单：json 返回 data，pdf 将账单依次写入一个文件
+func writeStatements(w http.ResponseWriter, format string, statements []*models.Statement, filename string, data interface{}) {
+	if format == "json" {
+		utils.ResponseOK(w, data)
+		return
+	}
+
+	// 构建文档
+	month := statements[0].Month
+	doc := utils.PDFDocument{
+		Title:  fmt.Sprintf("%s %s 餐费账单", config.Get().Website.Name, month),
+		Lines:  []string{"生成时间：" + time.Now().Format("2006-01-02 15:04:05") + "　金额单位：元"},
+		Footer: config.Get().Website.Name,
+	}
+	if len(statements) > 1 {
+		var mealTotal, closing int
+		for _, statement := range statements {
+			mealTotal += statement.MealTotal
+			closing += statement.ClosingBalance
+		}
+		doc.Lines = append(doc.Lines, fmt.Sprintf("共 %d 名学生，餐费合计 %s，月末余额合计 %s",
+			len(statements), models.FormatAmount(mealTotal), models.FormatAmount(closing)))
+	}
+	for _, statement := range statements {
+		doc.Sections = append(doc.Sections, statementSections(statement)...)
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".pdf"))
+	if err := utils.WritePDF(w, doc); err != nil {
+		utils.LogError(fmt.Sprintf("生成账单失败: %v", err))
+	}
+}
+
+// statementSections 一名学生的账单：每日明细和本月流水
+func statementSections(statement *models.Statement) []utils.PDFSection {
+	today := time.Now().Format("2006-01-02")
+
+	// 每日明细
+	days := utils.PDFSection{
+		Heading: fmt.Sprintf("%s（%s）", statement.Student.FullName, statement.Student.Class),
+		Columns: []utils.PDFColumn{
+			{Title: "日期", Width: 2}, {Title: "餐", Width: 3}, {Title: "选餐", Width: 1.5},
+			{Title: "单价", Width: 1.5, AlignRight: true}, {Title: "取餐", Width: 1.5},
+		},
+		Notes: []string{
+			fmt.Sprintf("选餐 %d 天，餐费合计 %s；已取餐 %d 天，合计 %s",
+				statement.SelectedDays, models.FormatAmount(statement.MealTotal),
+				statement.CollectedDays, models.FormatAmount(statement.CollectedTotal)),
+			fmt.Sprintf("月初余额 %s，本月充值 %s，扣费 %s，调整 %s，月末余额 %s",
+				models.FormatAmount(statement.OpeningBalance), models.FormatAmount(statement.TopUps),
+				models.FormatAmount(statement.Charges), models.FormatAmount(statement.Adjustments),
+				models.FormatAmount(statement.ClosingBalance)),
+		},
+	}
+	for _, day := range statement.Days {
+		status := "未取餐"
+		switch {
+		case day.Collected:
+			status = "已取餐"
+		case day.Absent:
+			status = "请假"
+		case day.MealType == "":
+			status = "-"
+		case day.Date >= today:
+			status = "待取餐"
+		}
+		days.Rows = append(days.Rows, []string{
+			day.Date, day.MealName, mealTypeLabel(day.MealType), models.FormatAmount(day.Price), status,
+		})
+	}
+	if len(statement.Days) == 0 {
+		days.Notes = append([]string{"本月没有领餐日"}, days.Notes...)
+	}
+
+	// 本月流水
+	if len(statement.Transactions) == 0 {
+		return []utils.PDFSection{days}
+	}
+	transactions := utils.PDFSection{
+		Heading: "余额流水",
+		Columns: []utils.PDFColumn{
+			{Title: "时间", Width: 2.5}, {Title: "类型", Width: 1}, {Title: "说明", Width: 3.5},
+			{Title: "金额", Width: 1.5, AlignRight: true}, {Title: "余额", Width: 1.5, AlignRight: true},
+		},
+	}
+	for _, entry := range statement.Transactions {
+		transactions.Rows = append(transactions.Rows, []string{
+			entry.CreatedAt.Local().Format("2006-01-02 15:04"), walletTypeLabels[entry.Type], entry.Note,
+			models.FormatAmount(entry.Amount), models.FormatAmount(entry.BalanceAfter),
+		})
+	}
+
+	return []utils.PDFSection{days, transactions}
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -26,9 +27,15 @@ type UpdateStudentRequest struct {
 }
 
 // GetAllStudents 获取所有学生
-func GetAllStudents(w http.ResponseWriter, _ *http.Request) {
-	// 获取学生列表
-	students, err := models.GetAllStudents()
+func GetAllStudents(w http.ResponseWriter, r *http.Request) {
+	// 获取学生列表，include_archived=true 时包括已归档的学生
+	var students []*models.Student
+	var err error
+	if r.URL.Query().Get("include_archived") == "true" {
+		students, err = models.GetStudentsIncludingArchived()
+	} else {
+		students, err = models.GetAllStudents()
+	}
 	if err != nil {
 		utils.ResponseError(w, http.StatusInternalServerError, "获取学生列表失败")
 		return
@@ -74,6 +81,7 @@ func CreateStudent(w http.ResponseWriter, r *http.Request) {
 		utils.ResponseError(w, http.StatusInternalServerError, "创建学生失败")
 		return
 	}
+	recordAudit(r, models.AuditActionCreate, models.AuditTargetStudent, strconv.Itoa(student.ID), nil, student)
 
 	// 返回响应
 	utils.ResponseOK(w, student)
@@ -104,6 +112,7 @@ func UpdateStudent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 更新学生信息
+	before := *student
 	if req.FullName != "" {
 		student.FullName = req.FullName
 	}
@@ -118,6 +127,7 @@ func UpdateStudent(w http.ResponseWriter, r *http.Request) {
 		utils.ResponseError(w, http.StatusInternalServerError, "更新学生失败")
 		return
 	}
+	recordAudit(r, models.AuditActionUpdate, models.AuditTargetStudent, strconv.Itoa(id), before, student)
 
 	// 返回响应
 	utils.ResponseOK(w, student)
@@ -133,11 +143,23 @@ func DeleteStudent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 获取学生信息，用于审计日志
+	student, err := models.GetStudentByID(id)
+	if err != nil {
+		utils.ResponseError(w, http.StatusNotFound, "未找到学生")
+		return
+	}
+
 	// 删除学生
 	if err := models.DeleteStudent(id); err != nil {
+		if errors.Is(err, models.ErrStudentHasWallet) {
+			utils.ResponseError(w, http.StatusConflict, err.Error())
+			return
+		}
 		utils.ResponseError(w, http.StatusInternalServerError, "删除学生失败")
 		return
 	}
+	recordAudit(r, models.AuditActionDelete, models.AuditTargetStudent, strconv.Itoa(id), student, nil)
 
 	// 返回响应
 	utils.ResponseOK(w, map[string]bool{"success": true})
@@ -202,7 +224,7 @@ func GetStudentMealSelections(w http.ResponseWriter, r *http.Request) {
 	// 处理已选餐记录
 	for _, selection := range selections {
 		meal := selection.Meal
-		if meal == nil {
+		if meal == nil || meal.ArchivedAt != nil { // 已归档的餐不再展示给学生
 			continue
 		}
 
@@ -219,6 +241,7 @@ func GetStudentMealSelections(w http.ResponseWriter, r *http.Request) {
 			"meal_id":              meal.ID,
 			"meal_type":            selection.MealType,
 			"operator":             selection.Operator,
+			"source":               selection.Source,
 			"updated_at":           selection.UpdatedAt,
 			"selectable":           selectable,
 			"id":                   meal.ID,
@@ -290,6 +313,29 @@ func GetStudentMealSelections(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// GetStudentSelectionHistory 学生查看自己的选餐变更历史，可按餐筛选
+func GetStudentSelectionHistory(w http.ResponseWriter, r *http.Request) {
+	// 从上下文获取学生ID
+	studentID, ok := middlewares.GetUserIDFromContext(r)
+	if !ok {
+		utils.ResponseError(w, http.StatusUnauthorized, "未授权")
+		return
+	}
+
+	// 解析餐ID
+	mealID, _ := strconv.Atoi(r.URL.Query().Get("meal_id"))
+
+	// 查询变更历史
+	history, err := models.GetMealSelectionHistory(studentID, mealID)
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "获取选餐变更历史失败")
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, history)
+}
+
 // GetStudentSelections 获取所有学生选餐统计
 func GetStudentSelections(w http.ResponseWriter, _ *http.Request) {
 	// 获取所有学生
@@ -318,9 +364,18 @@ func GetStudentSelections(w http.ResponseWriter, _ *http.Request) {
 			return
 		}
 
+		// 获取整个领餐时间都请假的学生
+		absentStudentIDs, err := models.GetFullyAbsentStudentIDs(meal.ID)
+		if err != nil {
+			utils.ResponseError(w, http.StatusInternalServerError, "获取请假记录失败")
+			return
+		}
+
 		// 统计该餐的选餐情况
 		var typeACount, typeBCount int
+		selectedStudentIDs := make(map[int]bool)
 		for _, selection := range selections {
+			selectedStudentIDs[selection.StudentID] = true
 			switch selection.MealType {
 			case models.MealTypeA:
 				typeACount++
@@ -329,6 +384,14 @@ func GetStudentSelections(w http.ResponseWriter, _ *http.Request) {
 			}
 		}
 
+		// 统计未选餐的请假学生，不计入未选餐人数
+		absentCount := 0
+		for _, student := range students {
+			if absentStudentIDs[student.ID] && !selectedStudentIDs[student.ID] {
+				absentCount++
+			}
+		}
+
 		// 构建该餐的选餐数据
 		mealData := map[string]interface{}{
 			"meal_id":          meal.ID,
@@ -341,7 +404,8 @@ func GetStudentSelections(w http.ResponseWriter, _ *http.Request) {
 			"total":            totalStudents,
 			"total_a":          typeACount,
 			"total_b":          typeBCount,
-			"total_unselected": totalStudents - len(selections),
+			"total_unselected": totalStudents - len(selections) - absentCount,
+			"total_absent":     absentCount,
 		}
 
 		selectionsData = append(selectionsData, mealData)
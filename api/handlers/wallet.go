@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/itsHenry35/canteen-management-system/api/middlewares"
+	"github.com/itsHenry35/canteen-management-system/models"
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+// CreateWalletTransactionRequest 手动记账请求，金额单位为分
+type CreateWalletTransactionRequest struct {
+	Type   string `json:"type"`   // top_up, charge, refund, adjustment
+	Amount int    `json:"amount"` // 充值、扣费和退款为正数，调整可正可负
+	Note   string `json:"note"`
+}
+
+// walletSummary 返回学生余额和分页的流水
+func walletSummary(filter models.WalletTransactionFilter) (map[string]interface{}, error) {
+	balance, err := models.GetWalletBalance(filter.StudentID)
+	if err != nil {
+		return nil, err
+	}
+	transactions, total, err := models.GetWalletTransactions(filter)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"student_id":   filter.StudentID,
+		"balance":      balance,
+		"total":        total,
+		"transactions": transactions,
+	}, nil
+}
+
+// GetStudentWallet 获取学生余额和分页的流水
+func GetStudentWallet(w http.ResponseWriter, r *http.Request) {
+	// 解析路径参数
+	studentID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "无效的学生ID")
+		return
+	}
+	if _, err := models.GetStudentByID(studentID); err != nil {
+		utils.ResponseError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	// 解析分页参数
+	filter := parseWalletPage(r, studentID)
+
+	// 获取余额和流水
+	summary, err := walletSummary(filter)
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "获取余额失败")
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, summary)
+}
+
+// CreateWalletTransaction 为学生手动记账（充值、扣费、退款或调整）
+func CreateWalletTransaction(w http.ResponseWriter, r *http.Request) {
+	// 解析路径参数
+	studentID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "无效的学生ID")
+		return
+	}
+
+	// 解析请求
+	var req CreateWalletTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+
+	// 获取操作人
+	operatorname, ok := middlewares.GetFullnameFromContext(r)
+	if !ok {
+		operatorname = "系统管理员"
+	}
+
+	// 记账
+	entry, err := models.CreateWalletTransaction(studentID, req.Type, req.Amount, req.Note, operatorname)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	recordAudit(r, models.AuditActionCreate, models.AuditTargetWallet, strconv.Itoa(studentID), nil, entry)
+
+	// 返回响应
+	utils.ResponseOK(w, entry)
+}
+
+// GetWalletTransactions 分页查询余额流水
+func GetWalletTransactions(w http.ResponseWriter, r *http.Request) {
+	// 解析查询参数
+	query := r.URL.Query()
+	filter := models.WalletTransactionFilter{Type: query.Get("type")}
+	if filter.Type != "" && !models.IsValidWalletType(filter.Type) {
+		utils.ResponseError(w, http.StatusBadRequest, "无效的流水类型")
+		return
+	}
+	filter.StudentID, _ = strconv.Atoi(query.Get("student_id"))
+	filter.MealID, _ = strconv.Atoi(query.Get("meal_id"))
+	filter.Page, _ = strconv.Atoi(query.Get("page"))
+	filter.PageSize, _ = strconv.Atoi(query.Get("page_size"))
+	if filter.PageSize > 100 {
+		filter.PageSize = 100
+	}
+
+	// 解析日期范围
+	var err error
+	filter.From, filter.To, err = parseDateRange(query.Get("from"), query.Get("to"))
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 查询记录
+	transactions, total, err := models.GetWalletTransactions(filter)
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "获取余额流水失败")
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, map[string]interface{}{
+		"total":        total,
+		"transactions": transactions,
+	})
+}
+
+// GetMyWallet 学生或家长查看自己的余额和流水
+func GetMyWallet(w http.ResponseWriter, r *http.Request) {
+	// 从上下文获取学生ID
+	studentID, ok := middlewares.GetUserIDFromContext(r)
+	if !ok {
+		utils.ResponseError(w, http.StatusUnauthorized, "未授权")
+		return
+	}
+
+	// 解析分页参数
+	filter := parseWalletPage(r, studentID)
+
+	// 获取余额和流水
+	summary, err := walletSummary(filter)
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, "获取余额失败")
+		return
+	}
+
+	// 返回响应
+	utils.ResponseOK(w, summary)
+}
+
+// parseWalletPage 解析学生流水的分页参数，每页最多100条
+func parseWalletPage(r *http.Request, studentID int) models.WalletTransactionFilter {
+	query := r.URL.Query()
+	filter := models.WalletTransactionFilter{StudentID: studentID}
+	filter.Page, _ = strconv.Atoi(query.Get("page"))
+	filter.PageSize, _ = strconv.Atoi(query.Get("page_size"))
+	if filter.PageSize > 100 {
+		filter.PageSize = 100
+	}
+	return filter
+}
@@ -19,6 +19,7 @@ const (
 	UsernameKey ContextKey = "username"
 	RoleKey     ContextKey = "role"
 	RelationKey ContextKey = "relation"
+	ParentIDKey ContextKey = "parent_id"
 )
 
 // AuthMiddleware 身份验证中间件
@@ -58,6 +59,7 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		ctx = context.WithValue(ctx, UsernameKey, claims.Username)
 		ctx = context.WithValue(ctx, RoleKey, claims.Role)
 		ctx = context.WithValue(ctx, RelationKey, claims.Relation)
+		ctx = context.WithValue(ctx, ParentIDKey, claims.ParentID)
 
 		// 调用下一个处理程序
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -113,6 +115,12 @@ func GetRelationFromContext(r *http.Request) (string, bool) {
 	return relation, ok
 }
 
+// GetParentIDFromContext 从上下文获取登录家长的钉钉ID，学生本人和管理员登录时为空
+func GetParentIDFromContext(r *http.Request) (string, bool) {
+	parentID, ok := r.Context().Value(ParentIDKey).(string)
+	return parentID, ok
+}
+
 // GetFullnameFromContext 从上下文获取用户全名
 func GetFullnameFromContext(r *http.Request) (string, bool) {
 	userID, ok := GetUserIDFromContext(r)
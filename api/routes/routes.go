@@ -9,6 +9,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/itsHenry35/canteen-management-system/api/handlers"
 	"github.com/itsHenry35/canteen-management-system/api/middlewares"
+	"github.com/itsHenry35/canteen-management-system/config"
 	"github.com/itsHenry35/canteen-management-system/services"
 )
 
@@ -37,8 +38,18 @@ func SetupRouter(staticFS fs.FS) *mux.Router {
 	// 公开API路由
 	api.HandleFunc("/login", handlers.Login).Methods("POST")
 	api.HandleFunc("/dingtalk/login", handlers.DingTalkLogin).Methods("POST")
+	api.HandleFunc("/dingtalk/callback", handlers.DingTalkCallback).Methods("POST")
 	api.HandleFunc("/website_info", handlers.GetWebsiteInfo).Methods("GET")
 
+	// 支付网关回调
+	api.HandleFunc("/payment/notify/{gateway}", handlers.PaymentNotify).Methods("POST")
+
+	// 模拟付款页面，只在开发环境中启用 payment.allow_mock 时注册
+	if config.Get().Payment.AllowMock {
+		api.HandleFunc("/payment/mock/pay", handlers.MockPayPage).Methods("GET")
+		api.HandleFunc("/payment/mock/pay", handlers.MockPay).Methods("POST")
+	}
+
 	// 需要身份验证的API路由
 	secured := api.PathPrefix("").Subrouter()
 	secured.Use(middlewares.AuthMiddleware)
@@ -57,11 +68,34 @@ func SetupRouter(staticFS fs.FS) *mux.Router {
 	// 学生管理
 	adminAPI.HandleFunc("/students", handlers.GetAllStudents).Methods("GET")
 	adminAPI.HandleFunc("/students", handlers.CreateStudent).Methods("POST")
+	adminAPI.HandleFunc("/students/import", handlers.ImportStudents).Methods("POST")
 	adminAPI.HandleFunc("/students/{id:[0-9]+}", handlers.GetStudent).Methods("GET")
 	adminAPI.HandleFunc("/students/{id:[0-9]+}", handlers.UpdateStudent).Methods("PUT")
 	adminAPI.HandleFunc("/students/{id:[0-9]+}", handlers.DeleteStudent).Methods("DELETE")
 	adminAPI.HandleFunc("/students/{id:[0-9]+}/qrcode-data", handlers.GetStudentQRCodeData).Methods("GET")
 
+	// 余额
+	adminAPI.HandleFunc("/students/{id:[0-9]+}/wallet", handlers.GetStudentWallet).Methods("GET")
+	adminAPI.HandleFunc("/students/{id:[0-9]+}/wallet/transactions", handlers.CreateWalletTransaction).Methods("POST")
+	adminAPI.HandleFunc("/wallet/transactions", handlers.GetWalletTransactions).Methods("GET")
+	adminAPI.HandleFunc("/payment/orders", handlers.GetPaymentOrders).Methods("GET")
+
+	// 请假
+	adminAPI.HandleFunc("/absences", handlers.GetAbsences).Methods("GET")
+	adminAPI.HandleFunc("/absences", handlers.CreateAbsence).Methods("POST")
+	adminAPI.HandleFunc("/absences/{id:[0-9]+}", handlers.DeleteAbsence).Methods("DELETE")
+
+	// 校历
+	adminAPI.HandleFunc("/calendar/events", handlers.GetCalendarEvents).Methods("GET")
+	adminAPI.HandleFunc("/calendar/events", handlers.CreateCalendarEvent).Methods("POST")
+	adminAPI.HandleFunc("/calendar/events/{id:[0-9]+}", handlers.DeleteCalendarEvent).Methods("DELETE")
+	adminAPI.HandleFunc("/calendar/import", handlers.ImportCalendar).Methods("POST")
+	adminAPI.HandleFunc("/calendar/days", handlers.GetCalendarDays).Methods("GET")
+
+	// 账单
+	adminAPI.HandleFunc("/statements", handlers.GetStudentStatement).Methods("GET")
+	adminAPI.HandleFunc("/statements/family", handlers.GetFamilyStatement).Methods("GET")
+
 	// 餐管理
 	adminAPI.HandleFunc("/meals", handlers.GetAllMeals).Methods("GET")
 	adminAPI.HandleFunc("/meals", handlers.CreateMeal).Methods("POST")
@@ -69,13 +103,24 @@ func SetupRouter(staticFS fs.FS) *mux.Router {
 	adminAPI.HandleFunc("/meals/{id:[0-9]+}", handlers.UpdateMeal).Methods("PUT")
 	adminAPI.HandleFunc("/meals/{id:[0-9]+}", handlers.DeleteMeal).Methods("DELETE")
 	adminAPI.HandleFunc("/meals/{id:[0-9]+}/selections", handlers.GetMealSelections).Methods("GET")
+	adminAPI.HandleFunc("/meals/{id:[0-9]+}/selections/import", handlers.ImportSelections).Methods("POST")
+	adminAPI.HandleFunc("/meals/{id:[0-9]+}/export", handlers.ExportMealSelections).Methods("GET")
 	adminAPI.HandleFunc("/meals/cleanup", handlers.CleanupExpiredMeals).Methods("POST")
+	adminAPI.HandleFunc("/meals/purge", handlers.PurgeArchivedMeals).Methods("POST")
+	adminAPI.HandleFunc("/meal-templates", handlers.GetMealTemplates).Methods("GET")
+	adminAPI.HandleFunc("/meal-templates", handlers.CreateMealTemplate).Methods("POST")
+	adminAPI.HandleFunc("/meal-templates/{id:[0-9]+}", handlers.GetMealTemplate).Methods("GET")
+	adminAPI.HandleFunc("/meal-templates/{id:[0-9]+}", handlers.UpdateMealTemplate).Methods("PUT")
+	adminAPI.HandleFunc("/meal-templates/{id:[0-9]+}", handlers.DeleteMealTemplate).Methods("DELETE")
+	adminAPI.HandleFunc("/meal-templates/{id:[0-9]+}/preview", handlers.PreviewMealTemplate).Methods("GET")
+	adminAPI.HandleFunc("/meal-templates/{id:[0-9]+}/generate", handlers.GenerateMealTemplate).Methods("POST")
 
 	// 选餐管理
 	adminAPI.HandleFunc("/selections", handlers.GetStudentSelections).Methods("GET")
 	adminAPI.HandleFunc("/selections/batch", handlers.BatchSelectMeals).Methods("POST")
 	adminAPI.HandleFunc("/notify/unselected", handlers.NotifyUnselectedStudents).Methods("POST")
 	adminAPI.HandleFunc("/selections/import", handlers.ImportSelection).Methods("POST")
+	adminAPI.HandleFunc("/selections/history", handlers.GetSelectionHistory).Methods("GET")
 
 	// 系统设置
 	adminAPI.HandleFunc("/settings", handlers.GetSettings).Methods("GET")
@@ -83,11 +128,41 @@ func SetupRouter(staticFS fs.FS) *mux.Router {
 
 	// 定时任务日志
 	adminAPI.HandleFunc("/scheduler/logs", handlers.GetSchedulerLogs).Methods("GET")
+	adminAPI.HandleFunc("/scheduler/jobs", handlers.GetScheduledJobs).Methods("GET")
+	adminAPI.HandleFunc("/scheduler/runs", handlers.GetJobRuns).Methods("GET")
+	adminAPI.HandleFunc("/scheduler/run", handlers.RunSchedulerJob).Methods("POST")
+
+	// 备份
+	adminAPI.HandleFunc("/backups", handlers.GetBackups).Methods("GET")
+	adminAPI.HandleFunc("/backups", handlers.CreateBackup).Methods("POST")
+	adminAPI.HandleFunc("/backups/{name}/download", handlers.DownloadBackup).Methods("GET")
+	adminAPI.HandleFunc("/backups/{name}", handlers.DeleteBackup).Methods("DELETE")
+
+	// 审计日志
+	adminAPI.HandleFunc("/audit-logs", handlers.GetAuditLogs).Methods("GET")
+
+	// 报表和统计
+	adminAPI.HandleFunc("/reports/production", handlers.GetProductionReport).Methods("GET")
+	adminAPI.HandleFunc("/analytics/no-show", handlers.GetNoShowAnalytics).Methods("GET")
+
+	// 班主任
+	adminAPI.HandleFunc("/class-teachers", handlers.GetClassTeachers).Methods("GET")
+	adminAPI.HandleFunc("/class-teachers", handlers.CreateClassTeacher).Methods("POST")
+	adminAPI.HandleFunc("/class-teachers/{id:[0-9]+}", handlers.DeleteClassTeacher).Methods("DELETE")
 
 	// 危险API
 	adminAPI.HandleFunc("/rebuild-mapping", handlers.RebuildParentStudentMapping).Methods("POST")
 	// 重建映射日志的API
 	adminAPI.HandleFunc("/rebuild-mapping/logs", handlers.GetMappingLogs).Methods("GET")
+	// 映射同步报告
+	adminAPI.HandleFunc("/rebuild-mapping/reports", handlers.GetMappingSyncReports).Methods("GET")
+	adminAPI.HandleFunc("/rebuild-mapping/reports/{id:[0-9]+}", handlers.GetMappingSyncReport).Methods("GET")
+
+	// 学生名单同步
+	adminAPI.HandleFunc("/roster/sync", handlers.SyncStudentRoster).Methods("POST")
+	adminAPI.HandleFunc("/roster/sync/logs", handlers.GetRosterSyncLogs).Methods("GET")
+	adminAPI.HandleFunc("/roster/sync/reports", handlers.GetRosterSyncReports).Methods("GET")
+	adminAPI.HandleFunc("/roster/sync/reports/{id:[0-9]+}", handlers.GetRosterSyncReport).Methods("GET")
 
 	// 食堂工作人员API路由
 	canteenAPI := secured.PathPrefix("/canteen").Subrouter()
@@ -96,6 +171,9 @@ func SetupRouter(staticFS fs.FS) *mux.Router {
 	// 扫码取餐
 	canteenAPI.HandleFunc("/scan", handlers.ScanStudentQRCode).Methods("POST")
 
+	// 备餐报表
+	canteenAPI.HandleFunc("/reports/production", handlers.GetProductionReport).Methods("GET")
+
 	// 学生API路由
 	studentAPI := secured.PathPrefix("/student").Subrouter()
 	studentAPI.Use(middlewares.RoleMiddleware(services.RoleStudent))
@@ -103,6 +181,21 @@ func SetupRouter(staticFS fs.FS) *mux.Router {
 	// 选餐
 	studentAPI.HandleFunc("/selection", handlers.GetStudentMealSelections).Methods("GET")
 	studentAPI.HandleFunc("/selection", handlers.StudentSelectMeal).Methods("POST")
+	studentAPI.HandleFunc("/selection/history", handlers.GetStudentSelectionHistory).Methods("GET")
+
+	// 请假
+	studentAPI.HandleFunc("/absences", handlers.GetMyAbsences).Methods("GET")
+	studentAPI.HandleFunc("/absences", handlers.CreateMyAbsence).Methods("POST")
+	studentAPI.HandleFunc("/absences/{id:[0-9]+}", handlers.DeleteMyAbsence).Methods("DELETE")
+
+	// 余额
+	studentAPI.HandleFunc("/wallet", handlers.GetMyWallet).Methods("GET")
+	studentAPI.HandleFunc("/statement", handlers.GetMyStatement).Methods("GET")
+
+	// 在线充值
+	studentAPI.HandleFunc("/payment/orders", handlers.CreateTopUpOrder).Methods("POST")
+	studentAPI.HandleFunc("/payment/orders", handlers.GetMyPaymentOrders).Methods("GET")
+	studentAPI.HandleFunc("/payment/orders/{order_no}", handlers.GetMyPaymentOrder).Methods("GET")
 
 	// 静态文件服务
 	rootStaticFiles := []string{
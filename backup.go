@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/itsHenry35/canteen-management-system/config"
+	"github.com/itsHenry35/canteen-management-system/database"
+	"github.com/itsHenry35/canteen-management-system/services"
+)
+
+const backupUsage = `用法:
+  canteen-management-system backup create           在线备份数据库和餐食图片到备份目录
+  canteen-management-system backup list             列出备份目录中的备份
+  canteen-management-system backup verify <file>    检查备份文件是否可用于恢复`
+
+const restoreUsage = `用法:
+  canteen-management-system restore <file>          从备份文件恢复数据库和餐食图片（需先停止服务）`
+
+// runBackupCommand 执行 backup 子命令，返回进程退出码
+func runBackupCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, backupUsage)
+		return 2
+	}
+
+	// 加载配置
+	if err := config.Load(); err != nil {
+		fmt.Fprintf(os.Stderr, "加载配置失败: %v\n", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "create":
+		// 打开数据库
+		if err := database.Open(); err != nil {
+			fmt.Fprintf(os.Stderr, "打开数据库失败: %v\n", err)
+			return 1
+		}
+		defer database.Close()
+
+		backup, err := services.CreateBackup(services.BackupSourceCLI)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "备份失败: %v\n", err)
+			return 1
+		}
+		fmt.Printf("备份完成: %s（%d 字节，%d 张图片）\n", backup.Name, backup.Size, backup.ImageCount)
+
+	case "list":
+		backups, err := services.ListBackups()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "获取备份列表失败: %v\n", err)
+			return 1
+		}
+		for _, backup := range backups {
+			source := backup.Source
+			if !backup.Valid {
+				source = "无效"
+			}
+			fmt.Printf("%-45s %s  %-9s %12d 字节\n",
+				backup.Name, backup.CreatedAt.Local().Format("2006-01-02 15:04:05"), source, backup.Size)
+		}
+		fmt.Printf("共 %d 个备份，目录: %s\n", len(backups), config.Get().Backup.Dir)
+
+	case "verify":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, backupUsage)
+			return 2
+		}
+		manifest, err := services.ValidateBackup(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "备份文件无效: %v\n", err)
+			return 1
+		}
+		fmt.Printf("备份文件有效: 创建于 %s，数据库版本 %d，%d 张图片\n",
+			manifest.CreatedAt.Local().Format("2006-01-02 15:04:05"), manifest.SchemaVersion, manifest.ImageCount)
+
+	default:
+		fmt.Fprintln(os.Stderr, backupUsage)
+		return 2
+	}
+
+	return 0
+}
+
+// runRestoreCommand 执行 restore 子命令，返回进程退出码
+func runRestoreCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, restoreUsage)
+		return 2
+	}
+
+	// 加载配置
+	if err := config.Load(); err != nil {
+		fmt.Fprintf(os.Stderr, "加载配置失败: %v\n", err)
+		return 1
+	}
+
+	// 检查并恢复备份
+	manifest, previous, err := services.RestoreBackup(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "恢复失败: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("恢复完成: 备份创建于 %s，数据库版本 %d，%d 张图片\n",
+		manifest.CreatedAt.Local().Format("2006-01-02 15:04:05"), manifest.SchemaVersion, manifest.ImageCount)
+	if previous != "" {
+		fmt.Printf("原数据库已保留为 %s\n", previous)
+	}
+	fmt.Println("启动服务时会自动执行未执行的数据库迁移")
+
+	return 0
+}
@@ -2,7 +2,9 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"sync"
 )
@@ -15,17 +17,26 @@ var (
 // Config 应用配置结构
 type Config struct {
 	Server struct {
-		Port int    `json:"port"`
-		Host string `json:"host"`
+		Port           int      `json:"port"`
+		Host           string   `json:"host"`
+		TrustedProxies []string `json:"trusted_proxies"` // 可信的反向代理地址（IP 或 CIDR），只有来自这些地址的请求才使用 X-Real-IP 和 X-Forwarded-For
 	} `json:"server"`
 	Database struct {
-		Path string `json:"path"`
+		Driver string `json:"driver"` // 数据库类型：sqlite 或 postgres
+		Path   string `json:"path"`   // SQLite 数据库文件路径
+		DSN    string `json:"dsn"`    // PostgreSQL 的连接字符串
 	} `json:"database"`
+	Backup struct {
+		Dir string `json:"dir"` // 备份文件保存目录
+	} `json:"backup"`
 	DingTalk struct {
-		AppKey    string `json:"app_key"`
-		AppSecret string `json:"app_secret"`
-		AgentID   string `json:"agent_id"`
-		CorpID    string `json:"corp_id"`
+		AppKey         string `json:"app_key"`
+		AppSecret      string `json:"app_secret"`
+		AgentID        string `json:"agent_id"`
+		CorpID         string `json:"corp_id"`
+		BaseURL        string `json:"base_url"`         // 钉钉接口地址，留空使用官方地址
+		CallbackToken  string `json:"callback_token"`   // 事件订阅的签名 Token
+		CallbackAESKey string `json:"callback_aes_key"` // 事件订阅的加密 aes_key（43位）
 	} `json:"dingtalk"`
 	Security struct {
 		JWTSecret     string `json:"jwt_secret"`     // JWT 密钥
@@ -38,13 +49,55 @@ type Config struct {
 		Domain         string `json:"domain"`           // 网站域名，用于通知链接
 	} `json:"website"`
 	Scheduler struct {
-		Enabled                bool   `json:"enabled"`                   // 总开关
-		CleanupTime            string `json:"cleanup_time"`              // 清理过期餐食的时间（格式：HH:MM）
-		ReminderBeforeEndHours int    `json:"reminder_before_end_hours"` // 选餐截止前多少小时发送提醒
-		CleanupEnabled         bool   `json:"cleanup_enabled"`           // 是否启用清理过期餐食任务
-		ReminderEnabled        bool   `json:"reminder_enabled"`          // 是否启用选餐提醒任务
-		AutoSelectEnabled      bool   `json:"auto_select_enabled"`       // 是否启用自动选餐任务
+		Enabled                 bool     `json:"enabled"`                      // 总开关
+		CleanupTime             string   `json:"cleanup_time"`                 // 归档过期餐食的时间（格式：HH:MM）
+		ReminderBeforeEndHours  int      `json:"reminder_before_end_hours"`    // 选餐截止前多少小时发送提醒（未设置 reminder_offsets 时使用）
+		ReminderOffsets         []string `json:"reminder_offsets"`             // 选餐截止前发送提醒的时间列表，如 ["24h", "6h", "1h"]，可被餐单独设置覆盖
+		OpeningNotification     bool     `json:"opening_notification_enabled"` // 是否在选餐开始时发送通知
+		CleanupEnabled          bool     `json:"cleanup_enabled"`              // 是否启用归档过期餐食任务
+		ReminderEnabled         bool     `json:"reminder_enabled"`             // 是否启用选餐提醒任务
+		AutoSelectEnabled       bool     `json:"auto_select_enabled"`          // 是否启用自动选餐任务
+		RosterSyncEnabled       bool     `json:"roster_sync_enabled"`          // 是否启用学生名单同步任务
+		RosterSyncTime          string   `json:"roster_sync_time"`             // 同步学生名单的时间（格式：HH:MM）
+		CatchUpEnabled          bool     `json:"catch_up_enabled"`             // 启动时是否补执行停机期间错过的任务
+		CatchUpGraceHours       int      `json:"catch_up_grace_hours"`         // 补执行宽限期（小时），超过的任务不再补执行，0 表示不限制
+		BackupEnabled           bool     `json:"backup_enabled"`               // 是否启用定时备份任务
+		BackupTime              string   `json:"backup_time"`                  // 定时备份的时间（格式：HH:MM）
+		BackupRetention         int      `json:"backup_retention"`             // 保留最近多少个定时备份，0 表示全部保留
+		PurgeEnabled            bool     `json:"purge_enabled"`                // 是否启用彻底删除已归档餐食任务
+		PurgeTime               string   `json:"purge_time"`                   // 彻底删除已归档餐食的时间（格式：HH:MM）
+		MealRetentionDays       int      `json:"meal_retention_days"`          // 已归档餐食在领餐结束后保留的天数，超过后才可彻底删除
+		ProductionReportEnabled bool     `json:"production_report_enabled"`    // 是否每天向食堂工作人员发送备餐报表
+		ProductionReportTime    string   `json:"production_report_time"`       // 发送备餐报表的时间（格式：HH:MM）
+		NoShowAlertEnabled      bool     `json:"no_show_alert_enabled"`        // 是否向班主任发送经常未取餐学生的提醒
+		NoShowAlertTime         string   `json:"no_show_alert_time"`           // 发送未取餐提醒的时间（格式：HH:MM）
+		NoShowWindowDays        int      `json:"no_show_window_days"`          // 统计最近多少天的未取餐情况，同一学生在此期间只提醒一次
+		NoShowThreshold         int      `json:"no_show_threshold"`            // 未取餐率达到该百分比的学生视为经常未取餐
+		NoShowMinCount          int      `json:"no_show_min_count"`            // 未取餐次数至少为该值才提醒
+		StatementEnabled        bool     `json:"statement_enabled"`            // 是否每月1日向学生和家长推送上个月的餐费账单
+		StatementTime           string   `json:"statement_time"`               // 推送账单的时间（格式：HH:MM）
+		MealTemplateEnabled     bool     `json:"meal_template_enabled"`        // 是否按餐模板自动生成未来几周的餐
+		MealTemplateTime        string   `json:"meal_template_time"`           // 按餐模板生成餐的时间（格式：HH:MM）
+		MealTemplateWeeksAhead  int      `json:"meal_template_weeks_ahead"`    // 提前生成多少周的餐
 	} `json:"scheduler"`
+	Billing struct {
+		Enabled                  bool   `json:"enabled"`                    // 是否启用扣费
+		ChargeOn                 string `json:"charge_on"`                  // 扣费时机：selection（选餐时按领餐天数扣费）或 collection（每次取餐时扣费）
+		BlockInsufficientBalance bool   `json:"block_insufficient_balance"` // 余额不足时是否禁止学生和家长选餐
+	} `json:"billing"`
+	Payment struct {
+		Enabled                  bool   `json:"enabled"`                    // 是否启用在线充值
+		Gateway                  string `json:"gateway"`                    // 支付网关，启用在线充值时必须配置
+		AllowMock                bool   `json:"allow_mock"`                 // 是否允许使用模拟网关 mock，只能在开发环境中启用
+		MockSecret               string `json:"mock_secret"`                // 模拟网关的回调签名密钥，留空时由 JWT 密钥派生
+		MinAmount                int    `json:"min_amount"`                 // 单笔充值最小金额（分）
+		MaxAmount                int    `json:"max_amount"`                 // 单笔充值最大金额（分）
+		OrderExpireMinutes       int    `json:"order_expire_minutes"`       // 充值订单未支付多少分钟后关闭
+		ReconcileIntervalMinutes int    `json:"reconcile_interval_minutes"` // 对账任务的执行间隔（分钟）
+	} `json:"payment"`
+	Calendar struct {
+		SkipWeekends bool `json:"skip_weekends"` // 周末是否不供餐（校历中的调休上班日除外）
+	} `json:"calendar"`
 }
 
 // Load 加载配置文件
@@ -56,19 +109,55 @@ func Load() error {
 		// 默认配置
 		config.Server.Port = 8080
 		config.Server.Host = "localhost"
+		config.Database.Driver = "sqlite"
 		config.Database.Path = "./data/canteen.db"
+		config.Backup.Dir = "./data/backups"
+		config.DingTalk.BaseURL = "https://oapi.dingtalk.com"                        // 默认钉钉接口地址
 		config.Security.JWTSecret = "default-jwt-secret-please-change-in-production" // 默认JWT密钥
 		config.Security.EncryptionKey = "default-encryption-key-needs-change"        // 默认加密密钥
-		config.Website.Name = "食堂饭卡管理系统"                                               // 默认网站名称
+		config.Website.Name = "食堂饭卡管理系统"                                             // 默认网站名称
 		config.Website.ICPBeian = ""                                                 // 默认空ICP备案信息
 		config.Website.PublicSecBeian = ""                                           // 默认空公安部备案信息
 		config.Website.Domain = ""                                                   // 默认域名
 		config.Scheduler.Enabled = false                                             // 默认关闭定时任务
-		config.Scheduler.CleanupTime = "02:00"                                       // 默认凌晨2点清理过期餐食
+		config.Scheduler.CleanupTime = "02:00"                                       // 默认凌晨2点归档过期餐食
 		config.Scheduler.ReminderBeforeEndHours = 6                                  // 默认选餐截止前6小时发送提醒
-		config.Scheduler.CleanupEnabled = true                                       // 默认启用清理过期餐食任务
+		config.Scheduler.CleanupEnabled = true                                       // 默认启用归档过期餐食任务
 		config.Scheduler.ReminderEnabled = true                                      // 默认启用选餐提醒任务
+		config.Scheduler.ReminderOffsets = []string{}                                // 默认只在截止前 reminder_before_end_hours 小时提醒一次
+		config.Scheduler.OpeningNotification = false                                 // 默认不发送选餐开始通知
 		config.Scheduler.AutoSelectEnabled = false                                   // 默认关闭自动选餐任务
+		config.Scheduler.RosterSyncEnabled = false                                   // 默认关闭学生名单同步任务
+		config.Scheduler.RosterSyncTime = "03:00"                                    // 默认凌晨3点同步学生名单
+		config.Scheduler.CatchUpEnabled = true                                       // 默认启用补执行错过的任务
+		config.Scheduler.CatchUpGraceHours = 24                                      // 默认只补执行24小时内错过的任务
+		config.Scheduler.BackupEnabled = false                                       // 默认关闭定时备份任务
+		config.Scheduler.BackupTime = "04:00"                                        // 默认凌晨4点备份
+		config.Scheduler.BackupRetention = 7                                         // 默认保留最近7个定时备份
+		config.Scheduler.PurgeEnabled = false                                        // 默认不彻底删除已归档餐食
+		config.Scheduler.PurgeTime = "05:00"                                         // 默认凌晨5点彻底删除
+		config.Scheduler.MealRetentionDays = 730                                     // 默认保留已归档餐食两年
+		config.Scheduler.ProductionReportEnabled = false                             // 默认不发送备餐报表
+		config.Scheduler.ProductionReportTime = "06:30"                              // 默认早上6点半发送备餐报表
+		config.Scheduler.NoShowAlertEnabled = false                                  // 默认不发送未取餐提醒
+		config.Scheduler.NoShowAlertTime = "18:00"                                   // 默认晚上6点发送未取餐提醒
+		config.Scheduler.NoShowWindowDays = 14                                       // 默认统计最近14天
+		config.Scheduler.NoShowThreshold = 50                                        // 默认未取餐率达到50%视为经常未取餐
+		config.Scheduler.NoShowMinCount = 3                                          // 默认至少3次未取餐才提醒
+		config.Scheduler.StatementEnabled = false                                    // 默认不推送账单
+		config.Scheduler.StatementTime = "09:00"                                     // 默认每月1日早上9点推送账单
+		config.Scheduler.MealTemplateEnabled = false                                 // 默认不按餐模板生成餐
+		config.Scheduler.MealTemplateTime = "01:00"                                  // 默认凌晨1点生成餐
+		config.Scheduler.MealTemplateWeeksAhead = 2                                  // 默认提前生成两周的餐
+		config.Billing.Enabled = false                                               // 默认不扣费
+		config.Billing.ChargeOn = "collection"                                       // 默认取餐时扣费
+		config.Payment.Enabled = false                                               // 默认不启用在线充值
+		config.Payment.Gateway = ""                                                  // 默认不配置支付网关
+		config.Payment.MinAmount = 100                                               // 默认单笔最少充值1元
+		config.Payment.MaxAmount = 100000                                            // 默认单笔最多充值1000元
+		config.Payment.OrderExpireMinutes = 30                                       // 默认30分钟未支付关闭订单
+		config.Payment.ReconcileIntervalMinutes = 10                                 // 默认每10分钟对账一次
+		config.Calendar.SkipWeekends = false                                         // 默认周末照常供餐
 
 		// 检查配置文件是否存在
 		if _, statErr := os.Stat("config.json"); os.IsNotExist(statErr) {
@@ -98,11 +187,59 @@ func Load() error {
 				return
 			}
 		}
+
+		// 检查启动时必须满足的配置
+		if err == nil {
+			err = validate(config)
+		}
 	})
 
 	return err
 }
 
+// IsDevelopment 是否为开发环境（环境变量 CANTEEN_ENV=development）
+func IsDevelopment() bool {
+	return os.Getenv("CANTEEN_ENV") == "development"
+}
+
+// validate 检查启动时必须满足的配置
+func validate(c *Config) error {
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, err := ParseTrustedProxy(proxy); err != nil {
+			return err
+		}
+	}
+	// 模拟网关可以不付款直接入账，只能在开发环境中使用
+	if c.Payment.AllowMock && !IsDevelopment() {
+		return errors.New("payment.allow_mock 只能在开发环境（CANTEEN_ENV=development）中启用")
+	}
+	if c.Payment.Enabled {
+		if c.Payment.Gateway == "" {
+			return errors.New("启用在线充值时必须配置支付网关 payment.gateway")
+		}
+		if c.Payment.Gateway == "mock" && !c.Payment.AllowMock {
+			return errors.New("模拟网关 mock 只能在开发环境中启用 payment.allow_mock 后使用")
+		}
+	}
+	return nil
+}
+
+// ParseTrustedProxy 解析可信代理地址，单个 IP 视为只包含该地址的网段
+func ParseTrustedProxy(proxy string) (*net.IPNet, error) {
+	if _, network, err := net.ParseCIDR(proxy); err == nil {
+		return network, nil
+	}
+	ip := net.ParseIP(proxy)
+	if ip == nil {
+		return nil, fmt.Errorf("server.trusted_proxies 中的地址 %q 无效", proxy)
+	}
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
 // Get 获取配置实例
 func Get() *Config {
 	if config == nil {
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+)
+
+// BackupTo 使用 VACUUM INTO 将当前 SQLite 数据库在线备份到 destPath
+// 备份是一致的快照，备份期间其他连接仍可读写；destPath 不能已存在
+func BackupTo(destPath string) error {
+	if db.dialect != DialectSQLite {
+		return fmt.Errorf("online backup only supports sqlite, use the database's own tools for %s", db.dialect)
+	}
+
+	if _, err := os.Stat(destPath); err == nil {
+		return fmt.Errorf("backup file already exists: %s", destPath)
+	}
+
+	if _, err := db.Exec("VACUUM INTO ?", destPath); err != nil {
+		return fmt.Errorf("failed to backup database: %v", err)
+	}
+
+	return nil
+}
+
+// ValidateSQLiteFile 以只读方式检查 SQLite 数据库文件的完整性，返回其迁移版本
+// 文件的迁移版本不能高于当前程序支持的最新版本；引入迁移之前的旧数据库版本为0
+func ValidateSQLiteFile(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+
+	conn, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return 0, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer conn.Close()
+	file := &DB{DB: conn, dialect: DialectSQLite}
+
+	// 完整性检查
+	var result string
+	if err := file.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return 0, fmt.Errorf("not a valid sqlite database: %v", err)
+	}
+	if result != "ok" {
+		return 0, fmt.Errorf("database integrity check failed: %s", result)
+	}
+
+	// 必须包含系统的数据表
+	for _, table := range []string{"users", "students", "meals", "meal_selections"} {
+		exists, err := file.tableExists(table)
+		if err != nil {
+			return 0, err
+		}
+		if !exists {
+			return 0, fmt.Errorf("database is missing table %s", table)
+		}
+	}
+
+	// 检查迁移版本
+	hasMigrations, err := file.tableExists("schema_migrations")
+	if err != nil || !hasMigrations {
+		return 0, err
+	}
+	version, err := file.CurrentVersion()
+	if err != nil {
+		return 0, err
+	}
+	migrations, err := LoadMigrations(DialectSQLite)
+	if err != nil {
+		return 0, err
+	}
+	if version > len(migrations) {
+		return 0, fmt.Errorf("database version %d is newer than the latest supported version %d", version, len(migrations))
+	}
+
+	return version, nil
+}
@@ -0,0 +1,182 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect 数据库方言
+type Dialect string
+
+const (
+	DialectSQLite   Dialect = "sqlite"
+	DialectPostgres Dialect = "postgres"
+)
+
+// ParseDialect 解析配置中的数据库类型，为空时使用 SQLite
+func ParseDialect(driver string) (Dialect, error) {
+	switch strings.ToLower(strings.TrimSpace(driver)) {
+	case "", "sqlite", "sqlite3":
+		return DialectSQLite, nil
+	case "postgres", "postgresql":
+		return DialectPostgres, nil
+	default:
+		return "", fmt.Errorf("unsupported database driver: %s", driver)
+	}
+}
+
+// Rebind 将查询中的 ? 占位符转换为当前方言的占位符（PostgreSQL 使用 $1、$2…），字符串字面量中的 ? 不受影响
+func (d Dialect) Rebind(query string) string {
+	if d != DialectPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	inString := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inString = !inString
+			b.WriteRune(r)
+		case r == '?' && !inString:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// InsertIgnore 将 INSERT 语句改写为遇到唯一约束冲突时忽略的形式
+func (d Dialect) InsertIgnore(insert string) string {
+	return insert + " ON CONFLICT DO NOTHING"
+}
+
+// DB 带方言的数据库连接，查询前自动转换占位符
+type DB struct {
+	*sql.DB
+	dialect Dialect
+}
+
+// Dialect 返回数据库方言
+func (db *DB) Dialect() Dialect {
+	return db.dialect
+}
+
+// Exec 执行语句
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.Exec(db.dialect.Rebind(query), args...)
+}
+
+// Query 执行查询
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.Query(db.dialect.Rebind(query), args...)
+}
+
+// QueryRow 执行单行查询
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRow(db.dialect.Rebind(query), args...)
+}
+
+// Begin 开始事务
+func (db *DB) Begin() (*Tx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, dialect: db.dialect}, nil
+}
+
+// InsertID 执行 INSERT 语句并返回新记录的 id
+func (db *DB) InsertID(query string, args ...interface{}) (int64, error) {
+	return insertID(db.dialect, db.DB.Exec, db.DB.QueryRow, query, args...)
+}
+
+// Tx 带方言的事务
+type Tx struct {
+	*sql.Tx
+	dialect Dialect
+}
+
+// Dialect 返回数据库方言
+func (tx *Tx) Dialect() Dialect {
+	return tx.dialect
+}
+
+// Exec 执行语句
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(tx.dialect.Rebind(query), args...)
+}
+
+// Query 执行查询
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.dialect.Rebind(query), args...)
+}
+
+// QueryRow 执行单行查询
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRow(tx.dialect.Rebind(query), args...)
+}
+
+// InsertID 执行 INSERT 语句并返回新记录的 id
+func (tx *Tx) InsertID(query string, args ...interface{}) (int64, error) {
+	return insertID(tx.dialect, tx.Tx.Exec, tx.Tx.QueryRow, query, args...)
+}
+
+// Conn 数据库连接或事务，数据访问可以在两者上执行
+type Conn interface {
+	Dialect() Dialect
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	InsertID(query string, args ...interface{}) (int64, error)
+}
+
+// WithTx 在事务中执行 fn，fn 返回错误时回滚；conn 已是事务时直接在该事务中执行，由外层提交或回滚
+func WithTx(conn Conn, fn func(tx *Tx) error) error {
+	switch c := conn.(type) {
+	case *Tx:
+		return fn(c)
+	case *DB:
+		// 开始事务
+		tx, err := c.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		// 提交事务
+		return tx.Commit()
+	}
+	return fmt.Errorf("unsupported database connection: %T", conn)
+}
+
+// insertID PostgreSQL 不支持 LastInsertId，改用 RETURNING id
+func insertID(
+	dialect Dialect,
+	exec func(string, ...interface{}) (sql.Result, error),
+	queryRow func(string, ...interface{}) *sql.Row,
+	query string, args ...interface{},
+) (int64, error) {
+	if dialect == DialectPostgres {
+		var id int64
+		err := queryRow(dialect.Rebind(query)+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
@@ -0,0 +1,309 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 迁移文件按方言放在 migrations/<方言>/ 下，命名为 <版本号>_<名称>.up.sql，如 0002_add_meal_notes.up.sql
+// 版本号从1开始连续递增，各方言的迁移版本需保持一致
+//
+//go:embed migrations
+var migrationFS embed.FS
+
+// Migration 数据库迁移
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// MigrationStatus 迁移的执行状态
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"` // 未执行时为空
+}
+
+// execer 可执行 SQL 的数据库连接或事务
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// LoadMigrations 读取指定方言的嵌入迁移文件，按版本号排序
+func LoadMigrations(dialect Dialect) ([]*Migration, error) {
+	dir := path.Join("migrations", string(dialect))
+	entries, err := fs.ReadDir(migrationFS, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %v", err)
+	}
+
+	var migrations []*Migration
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(fileName, ".up.sql") {
+			continue
+		}
+
+		// 解析版本号和名称
+		versionPart, name, found := strings.Cut(strings.TrimSuffix(fileName, ".up.sql"), "_")
+		version, err := strconv.Atoi(versionPart)
+		if !found || err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration file name: %s", fileName)
+		}
+
+		content, err := migrationFS.ReadFile(path.Join(dir, fileName))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %v", fileName, err)
+		}
+
+		migrations = append(migrations, &Migration{Version: version, Name: name, SQL: string(content)})
+	}
+
+	// 按版本号排序并检查是否连续
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be consecutive from 1, missing version %d", i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Migrate 执行所有未执行的迁移
+func Migrate() error {
+	return db.MigrateTo(0)
+}
+
+// MigrateTo 将当前数据库迁移到指定版本
+func MigrateTo(version int) error {
+	return db.MigrateTo(version)
+}
+
+// GetMigrationStatus 获取当前数据库所有迁移的执行状态
+func GetMigrationStatus() ([]*MigrationStatus, error) {
+	return db.MigrationStatus()
+}
+
+// CurrentVersion 获取当前数据库的迁移版本
+func CurrentVersion() (int, error) {
+	return db.CurrentVersion()
+}
+
+// MigrateTo 执行迁移直到指定版本（含），version 为0时迁移到最新版本
+// 每个迁移在单独的事务中执行，失败时回滚该迁移并停止
+func (db *DB) MigrateTo(version int) error {
+	migrations, err := LoadMigrations(db.dialect)
+	if err != nil {
+		return err
+	}
+
+	// 检查目标版本
+	latest := len(migrations)
+	if version == 0 {
+		version = latest
+	}
+	if version < 0 || version > latest {
+		return fmt.Errorf("unknown migration version %d, latest is %d", version, latest)
+	}
+
+	// 获取当前版本
+	if err := db.ensureMigrationTable(); err != nil {
+		return err
+	}
+	current, err := db.CurrentVersion()
+	if err != nil {
+		return err
+	}
+	if version < current {
+		return fmt.Errorf("database is already at version %d, rolling back to %d is not supported", current, version)
+	}
+
+	// 旧版本的 SQLite 数据库没有迁移记录，但已有数据表
+	legacy := false
+	if current == 0 && db.dialect == DialectSQLite {
+		if legacy, err = db.tableExists("users"); err != nil {
+			return err
+		}
+	}
+
+	// 依次执行迁移
+	for _, migration := range migrations[current:version] {
+		if err := db.applyMigration(migration, legacy && migration.Version == 1); err != nil {
+			return fmt.Errorf("migration %04d_%s failed: %v", migration.Version, migration.Name, err)
+		}
+		log.Printf("已执行数据库迁移 %04d_%s", migration.Version, migration.Name)
+	}
+
+	return nil
+}
+
+// applyMigration 在事务中执行迁移并记录版本
+func (db *DB) applyMigration(migration *Migration, legacy bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 执行迁移（迁移文件按方言编写，不转换占位符）
+	if _, err := tx.Tx.Exec(migration.SQL); err != nil {
+		return err
+	}
+
+	// 初始迁移使用 CREATE TABLE IF NOT EXISTS，不会修改旧数据库中已存在的表，需补充引入迁移前新增的列
+	if legacy {
+		if err := upgradeLegacySchema(tx); err != nil {
+			return err
+		}
+	}
+
+	// 记录版本
+	_, err = tx.Exec(
+		"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		migration.Version, migration.Name, time.Now().UTC(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// upgradeLegacySchema 为引入迁移之前创建的 SQLite 数据库补充新增的列
+func upgradeLegacySchema(tx execer) error {
+	if err := addColumnIfNotExists(tx, "students", "archived", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists(tx, "job_runs", "scheduled_at", "TIMESTAMP"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists(tx, "meals", "reminder_offsets", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// MigrationStatus 获取所有迁移的执行状态
+func (db *DB) MigrationStatus() ([]*MigrationStatus, error) {
+	migrations, err := LoadMigrations(db.dialect)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.ensureMigrationTable(); err != nil {
+		return nil, err
+	}
+
+	// 查询已执行的迁移
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	appliedAt := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		appliedAt[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 合并结果
+	statuses := make([]*MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status := &MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if at, ok := appliedAt[migration.Version]; ok {
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// CurrentVersion 获取数据库当前的迁移版本，未执行过迁移时为0
+func (db *DB) CurrentVersion() (int, error) {
+	var version int
+	err := db.QueryRow("SELECT version FROM schema_migrations ORDER BY version DESC LIMIT 1").Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return version, err
+}
+
+// ensureMigrationTable 创建迁移记录表
+func (db *DB) ensureMigrationTable() error {
+	columnType := "TIMESTAMP"
+	switch db.dialect {
+	case DialectPostgres:
+		columnType = "TIMESTAMPTZ"
+	}
+
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    applied_at ` + columnType + ` NOT NULL
+)`)
+	return err
+}
+
+// tableExists 检查数据表是否存在
+func (db *DB) tableExists(table string) (bool, error) {
+	query := "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?"
+	switch db.dialect {
+	case DialectSQLite:
+		query = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	}
+
+	var count int
+	err := db.QueryRow(query, table).Scan(&count)
+	return count > 0, err
+}
+
+// addColumnIfNotExists 为已存在的表补充新增的列（CREATE TABLE IF NOT EXISTS 不会修改已存在的表）
+func addColumnIfNotExists(tx execer, table, column, definition string) error {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// 检查列是否已存在
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	// 添加列
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
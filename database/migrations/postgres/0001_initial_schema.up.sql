@@ -0,0 +1,101 @@
+-- 用户表
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    username TEXT UNIQUE NOT NULL,
+    password TEXT NOT NULL,
+    full_name TEXT NOT NULL,
+    role TEXT NOT NULL,
+    dingtalk_id TEXT
+);
+
+-- 学生表
+CREATE TABLE IF NOT EXISTS students (
+    id SERIAL PRIMARY KEY,
+    username TEXT UNIQUE NOT NULL,
+    full_name TEXT NOT NULL,
+    class TEXT NOT NULL,
+    dingtalk_id TEXT,
+    last_meal_collection_date TIMESTAMPTZ,
+    archived BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+-- 家长-学生关系表
+CREATE TABLE IF NOT EXISTS parent_student_relations (
+    id SERIAL PRIMARY KEY,
+    parent_id TEXT NOT NULL,
+    student_id TEXT NOT NULL,
+    relation TEXT NOT NULL,
+    UNIQUE(parent_id, student_id, relation)
+);
+
+-- 餐表
+CREATE TABLE IF NOT EXISTS meals (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    selection_start_time TIMESTAMPTZ NOT NULL,
+    selection_end_time TIMESTAMPTZ NOT NULL,
+    effective_start_date TIMESTAMPTZ NOT NULL,
+    effective_end_date TIMESTAMPTZ NOT NULL,
+    image_path TEXT NOT NULL,
+    reminder_offsets TEXT NOT NULL DEFAULT ''
+);
+
+-- 选餐记录表
+CREATE TABLE IF NOT EXISTS meal_selections (
+    id SERIAL PRIMARY KEY,
+    student_id INTEGER NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    meal_id INTEGER NOT NULL REFERENCES meals(id) ON DELETE CASCADE,
+    meal_type TEXT NOT NULL,
+    updated_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    operator TEXT NOT NULL,
+    UNIQUE(student_id, meal_id)
+);
+
+-- 家长-学生映射同步报告表
+CREATE TABLE IF NOT EXISTS mapping_sync_reports (
+    id SERIAL PRIMARY KEY,
+    started_at TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ,
+    dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+    status TEXT NOT NULL,
+    class_count INTEGER NOT NULL DEFAULT 0,
+    failed_class_count INTEGER NOT NULL DEFAULT 0,
+    added_count INTEGER NOT NULL DEFAULT 0,
+    removed_count INTEGER NOT NULL DEFAULT 0,
+    changed_count INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    details TEXT NOT NULL DEFAULT ''
+);
+
+-- 学生名单同步报告表
+CREATE TABLE IF NOT EXISTS roster_sync_reports (
+    id SERIAL PRIMARY KEY,
+    started_at TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ,
+    dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+    source TEXT NOT NULL DEFAULT 'manual',
+    status TEXT NOT NULL,
+    class_count INTEGER NOT NULL DEFAULT 0,
+    failed_class_count INTEGER NOT NULL DEFAULT 0,
+    created_count INTEGER NOT NULL DEFAULT 0,
+    updated_count INTEGER NOT NULL DEFAULT 0,
+    archived_count INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    details TEXT NOT NULL DEFAULT ''
+);
+
+-- 定时任务运行记录表
+CREATE TABLE IF NOT EXISTS job_runs (
+    id SERIAL PRIMARY KEY,
+    job_key TEXT NOT NULL,
+    meal_id INTEGER NOT NULL DEFAULT 0,
+    source TEXT NOT NULL DEFAULT 'schedule',
+    scheduled_at TIMESTAMPTZ,
+    started_at TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ,
+    status TEXT NOT NULL,
+    affected_count INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_runs_job_meal ON job_runs (job_key, meal_id);
@@ -0,0 +1,4 @@
+-- 餐归档时间，为空表示未归档；归档的餐及其选餐记录保留用于统计和结算
+ALTER TABLE meals ADD COLUMN archived_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_meals_archived_at ON meals (archived_at);
@@ -0,0 +1,17 @@
+-- 选餐记录来源：student、parent、admin、scheduler、import
+ALTER TABLE meal_selections ADD COLUMN source TEXT NOT NULL DEFAULT '';
+
+-- 选餐变更历史表，每次保存选餐时追加一条，只追加不修改
+CREATE TABLE IF NOT EXISTS meal_selection_history (
+    id SERIAL PRIMARY KEY,
+    student_id INTEGER NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    meal_id INTEGER NOT NULL REFERENCES meals(id) ON DELETE CASCADE,
+    previous_meal_type TEXT NOT NULL DEFAULT '',
+    new_meal_type TEXT NOT NULL,
+    operator TEXT NOT NULL DEFAULT '',
+    source TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_meal_selection_history_student_meal ON meal_selection_history (student_id, meal_id);
+CREATE INDEX IF NOT EXISTS idx_meal_selection_history_meal ON meal_selection_history (meal_id);
@@ -0,0 +1,28 @@
+-- 餐食价格（单位：分），每份的价格，0 表示免费
+ALTER TABLE meals ADD COLUMN price_a INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE meals ADD COLUMN price_b INTEGER NOT NULL DEFAULT 0;
+
+-- 学生余额（单位：分）
+CREATE TABLE IF NOT EXISTS student_wallets (
+    student_id INTEGER PRIMARY KEY REFERENCES students(id) ON DELETE CASCADE,
+    balance INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+-- 余额流水，只追加不修改；amount 为正数表示增加余额
+CREATE TABLE IF NOT EXISTS wallet_transactions (
+    id SERIAL PRIMARY KEY,
+    student_id INTEGER NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    amount INTEGER NOT NULL,
+    balance_after INTEGER NOT NULL,
+    meal_id INTEGER NOT NULL DEFAULT 0,
+    meal_type TEXT NOT NULL DEFAULT '',
+    service_date TEXT NOT NULL DEFAULT '',
+    note TEXT NOT NULL DEFAULT '',
+    operator TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_wallet_transactions_student ON wallet_transactions (student_id, id);
+CREATE INDEX IF NOT EXISTS idx_wallet_transactions_meal ON wallet_transactions (meal_id, student_id);
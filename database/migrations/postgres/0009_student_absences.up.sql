@@ -0,0 +1,14 @@
+-- 学生请假记录，请假期间不自动选餐、不提醒、不计入备餐份数和餐费；日期为服务器本地日期（YYYY-MM-DD，均含）
+CREATE TABLE IF NOT EXISTS student_absences (
+    id SERIAL PRIMARY KEY,
+    student_id INTEGER NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    start_date TEXT NOT NULL,
+    end_date TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    reported_by TEXT NOT NULL,
+    operator TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_student_absences_student ON student_absences (student_id, start_date);
+CREATE INDEX IF NOT EXISTS idx_student_absences_dates ON student_absences (start_date, end_date);
@@ -0,0 +1,13 @@
+-- 校历：节假日、调休上班日和学期，日期为服务器本地日期（YYYY-MM-DD，均含）；uid 为从 iCalendar 文件导入时的事件UID
+CREATE TABLE IF NOT EXISTS calendar_events (
+    id SERIAL PRIMARY KEY,
+    type TEXT NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    start_date TEXT NOT NULL,
+    end_date TEXT NOT NULL,
+    uid TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_calendar_events_dates ON calendar_events (start_date, end_date);
+CREATE INDEX IF NOT EXISTS idx_calendar_events_uid ON calendar_events (uid);
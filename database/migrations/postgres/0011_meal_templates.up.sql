@@ -0,0 +1,33 @@
+-- 餐模板：按重复规则定期生成餐；星期为1（周一）到7（周日），选餐时间相对于领餐所在的周，日期为服务器本地日期（YYYY-MM-DD）
+CREATE TABLE IF NOT EXISTS meal_templates (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    image_path TEXT NOT NULL DEFAULT '',
+    reminder_offsets TEXT NOT NULL DEFAULT '',
+    price_a INTEGER NOT NULL DEFAULT 0,
+    price_b INTEGER NOT NULL DEFAULT 0,
+    interval_weeks INTEGER NOT NULL DEFAULT 1,
+    serving_start_weekday INTEGER NOT NULL,
+    serving_end_weekday INTEGER NOT NULL,
+    selection_start_weeks_before INTEGER NOT NULL,
+    selection_start_weekday INTEGER NOT NULL,
+    selection_start_time TEXT NOT NULL,
+    selection_end_weeks_before INTEGER NOT NULL,
+    selection_end_weekday INTEGER NOT NULL,
+    selection_end_time TEXT NOT NULL,
+    start_date TEXT NOT NULL,
+    end_date TEXT NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+-- 餐模板已生成的餐，每个模板每周只生成一次；week_start 为领餐所在周的周一
+CREATE TABLE IF NOT EXISTS meal_template_meals (
+    id SERIAL PRIMARY KEY,
+    template_id INTEGER NOT NULL,
+    week_start TEXT NOT NULL,
+    meal_id INTEGER NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    UNIQUE(template_id, week_start)
+);
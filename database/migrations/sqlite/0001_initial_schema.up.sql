@@ -0,0 +1,103 @@
+-- 用户表
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT UNIQUE NOT NULL,
+    password TEXT NOT NULL,
+    full_name TEXT NOT NULL,
+    role TEXT NOT NULL,
+    dingtalk_id TEXT
+);
+
+-- 学生表
+CREATE TABLE IF NOT EXISTS students (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT UNIQUE NOT NULL,
+    full_name TEXT NOT NULL,
+    class TEXT NOT NULL,
+    dingtalk_id TEXT,
+    last_meal_collection_date TIMESTAMP,
+    archived INTEGER NOT NULL DEFAULT 0
+);
+
+
+-- 家长-学生关系表
+CREATE TABLE IF NOT EXISTS parent_student_relations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    parent_id TEXT NOT NULL,
+    student_id TEXT NOT NULL,
+    relation TEXT NOT NULL,
+    UNIQUE(parent_id, student_id, relation)
+);
+
+-- 餐表
+CREATE TABLE IF NOT EXISTS meals (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    selection_start_time TIMESTAMP NOT NULL,
+    selection_end_time TIMESTAMP NOT NULL,
+    effective_start_date TIMESTAMP NOT NULL,
+    effective_end_date TIMESTAMP NOT NULL,
+    image_path TEXT NOT NULL,
+    reminder_offsets TEXT NOT NULL DEFAULT ''
+);
+
+-- 选餐记录表
+CREATE TABLE IF NOT EXISTS meal_selections (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    student_id INTEGER NOT NULL,
+    meal_id INTEGER NOT NULL,
+    meal_type TEXT NOT NULL,
+    updated_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    operator TEXT NOT NULL,
+    FOREIGN KEY (student_id) REFERENCES students(id) ON DELETE CASCADE,
+    FOREIGN KEY (meal_id) REFERENCES meals(id) ON DELETE CASCADE,
+    UNIQUE(student_id, meal_id)
+);
+-- 家长-学生映射同步报告表
+CREATE TABLE IF NOT EXISTS mapping_sync_reports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP,
+    dry_run INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL,
+    class_count INTEGER NOT NULL DEFAULT 0,
+    failed_class_count INTEGER NOT NULL DEFAULT 0,
+    added_count INTEGER NOT NULL DEFAULT 0,
+    removed_count INTEGER NOT NULL DEFAULT 0,
+    changed_count INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    details TEXT NOT NULL DEFAULT ''
+);
+
+-- 学生名单同步报告表
+CREATE TABLE IF NOT EXISTS roster_sync_reports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP,
+    dry_run INTEGER NOT NULL DEFAULT 0,
+    source TEXT NOT NULL DEFAULT 'manual',
+    status TEXT NOT NULL,
+    class_count INTEGER NOT NULL DEFAULT 0,
+    failed_class_count INTEGER NOT NULL DEFAULT 0,
+    created_count INTEGER NOT NULL DEFAULT 0,
+    updated_count INTEGER NOT NULL DEFAULT 0,
+    archived_count INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    details TEXT NOT NULL DEFAULT ''
+);
+
+-- 定时任务运行记录表
+CREATE TABLE IF NOT EXISTS job_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    job_key TEXT NOT NULL,
+    meal_id INTEGER NOT NULL DEFAULT 0,
+    source TEXT NOT NULL DEFAULT 'schedule',
+    scheduled_at TIMESTAMP,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP,
+    status TEXT NOT NULL,
+    affected_count INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_runs_job_meal ON job_runs (job_key, meal_id);
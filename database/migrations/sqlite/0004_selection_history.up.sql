@@ -0,0 +1,19 @@
+-- 选餐记录来源：student、parent、admin、scheduler、import
+ALTER TABLE meal_selections ADD COLUMN source TEXT NOT NULL DEFAULT '';
+
+-- 选餐变更历史表，每次保存选餐时追加一条，只追加不修改
+CREATE TABLE IF NOT EXISTS meal_selection_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    student_id INTEGER NOT NULL,
+    meal_id INTEGER NOT NULL,
+    previous_meal_type TEXT NOT NULL DEFAULT '',
+    new_meal_type TEXT NOT NULL,
+    operator TEXT NOT NULL DEFAULT '',
+    source TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (student_id) REFERENCES students(id) ON DELETE CASCADE,
+    FOREIGN KEY (meal_id) REFERENCES meals(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_meal_selection_history_student_meal ON meal_selection_history (student_id, meal_id);
+CREATE INDEX IF NOT EXISTS idx_meal_selection_history_meal ON meal_selection_history (meal_id);
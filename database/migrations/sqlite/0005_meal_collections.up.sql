@@ -0,0 +1,15 @@
+-- 取餐记录表，扫码取餐时写入，每名学生每天最多一条；collection_date 为服务器本地日期（YYYY-MM-DD）
+CREATE TABLE IF NOT EXISTS meal_collections (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    student_id INTEGER NOT NULL,
+    meal_id INTEGER NOT NULL,
+    meal_type TEXT NOT NULL,
+    collection_date TEXT NOT NULL,
+    collected_at TIMESTAMP NOT NULL,
+    operator TEXT NOT NULL DEFAULT '',
+    FOREIGN KEY (student_id) REFERENCES students(id) ON DELETE CASCADE,
+    FOREIGN KEY (meal_id) REFERENCES meals(id) ON DELETE CASCADE,
+    UNIQUE(student_id, collection_date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_meal_collections_meal_date ON meal_collections (meal_id, collection_date);
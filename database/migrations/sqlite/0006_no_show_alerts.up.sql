@@ -0,0 +1,24 @@
+-- 班主任表，一个班级可以有多名班主任，用于发送未取餐提醒
+CREATE TABLE IF NOT EXISTS class_teachers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    class TEXT NOT NULL,
+    full_name TEXT NOT NULL,
+    dingtalk_id TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE(class, dingtalk_id)
+);
+
+-- 未取餐提醒记录，用于避免在统计周期内重复提醒
+CREATE TABLE IF NOT EXISTS no_show_alerts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    student_id INTEGER NOT NULL,
+    class TEXT NOT NULL,
+    window_start TEXT NOT NULL,
+    window_end TEXT NOT NULL,
+    expected INTEGER NOT NULL,
+    no_show INTEGER NOT NULL,
+    notified_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (student_id) REFERENCES students(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_no_show_alerts_student ON no_show_alerts (student_id, notified_at);
@@ -0,0 +1,20 @@
+-- 在线充值订单，支付成功后记入余额流水；金额单位为分
+CREATE TABLE IF NOT EXISTS payment_orders (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    order_no TEXT NOT NULL UNIQUE,
+    student_id INTEGER NOT NULL,
+    amount INTEGER NOT NULL,
+    gateway TEXT NOT NULL,
+    status TEXT NOT NULL,
+    trade_no TEXT NOT NULL DEFAULT '',
+    failure_reason TEXT NOT NULL DEFAULT '',
+    wallet_transaction_id INTEGER NOT NULL DEFAULT 0,
+    operator TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    paid_at TIMESTAMP,
+    FOREIGN KEY (student_id) REFERENCES students(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_orders_student ON payment_orders (student_id, id);
+CREATE INDEX IF NOT EXISTS idx_payment_orders_status ON payment_orders (status, created_at);
@@ -16,7 +16,9 @@ import (
 	"github.com/itsHenry35/canteen-management-system/api/routes"
 	"github.com/itsHenry35/canteen-management-system/config"
 	"github.com/itsHenry35/canteen-management-system/database"
+	"github.com/itsHenry35/canteen-management-system/models"
 	"github.com/itsHenry35/canteen-management-system/scheduler" // 导入新的scheduler包
+	"github.com/itsHenry35/canteen-management-system/services"
 )
 
 //go:embed all:static
@@ -32,6 +34,18 @@ func getStaticFS() (fs.FS, error) {
 }
 
 func main() {
+	// 子命令
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			os.Exit(runMigrateCommand(os.Args[2:]))
+		case "backup":
+			os.Exit(runBackupCommand(os.Args[2:]))
+		case "restore":
+			os.Exit(runRestoreCommand(os.Args[2:]))
+		}
+	}
+
 	// 加载配置
 	if err := config.Load(); err != nil {
 		log.Fatalf("Failed to load config: %v", err)
@@ -42,6 +56,11 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
+	// 加载校历
+	if err := models.LoadCalendar(); err != nil {
+		log.Printf("Failed to load calendar: %v", err)
+	}
+
 	// 初始化定时任务
 	if err := scheduler.Initialize(); err != nil {
 		log.Fatalf("Failed to initialize scheduler: %v", err)
@@ -85,6 +104,9 @@ func main() {
 	// 停止定时任务
 	scheduler.Stop()
 
+	// 等待已接收的钉钉事件处理完成
+	services.WaitDingTalkEvents()
+
 	// 关闭数据库连接
 	err = database.Close()
 	if err != nil {
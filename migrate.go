@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/itsHenry35/canteen-management-system/config"
+	"github.com/itsHenry35/canteen-management-system/database"
+)
+
+const migrateUsage = `用法:
+  canteen-management-system migrate status          查看数据库迁移状态
+  canteen-management-system migrate up [version]    迁移到指定版本，不指定时迁移到最新版本`
+
+// runMigrateCommand 执行 migrate 子命令，返回进程退出码
+func runMigrateCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	// 加载配置并打开数据库
+	if err := config.Load(); err != nil {
+		fmt.Fprintf(os.Stderr, "加载配置失败: %v\n", err)
+		return 1
+	}
+	if err := database.Open(); err != nil {
+		fmt.Fprintf(os.Stderr, "打开数据库失败: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+
+	switch args[0] {
+	case "status":
+		statuses, err := database.GetMigrationStatus()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "获取迁移状态失败: %v\n", err)
+			return 1
+		}
+		current := 0
+		for _, status := range statuses {
+			state := "未执行"
+			if status.AppliedAt != nil {
+				state = "已执行于 " + status.AppliedAt.Local().Format("2006-01-02 15:04:05")
+				current = status.Version
+			}
+			fmt.Printf("%04d  %-40s %s\n", status.Version, status.Name, state)
+		}
+		fmt.Printf("当前版本: %d，最新版本: %d\n", current, len(statuses))
+
+	case "up":
+		version := 0
+		if len(args) > 1 {
+			v, err := strconv.Atoi(args[1])
+			if err != nil || v <= 0 {
+				fmt.Fprintf(os.Stderr, "无效的版本号: %s\n", args[1])
+				return 2
+			}
+			version = v
+		}
+		if err := database.MigrateTo(version); err != nil {
+			fmt.Fprintf(os.Stderr, "迁移失败: %v\n", err)
+			return 1
+		}
+		current, err := database.CurrentVersion()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "获取当前版本失败: %v\n", err)
+			return 1
+		}
+		fmt.Printf("迁移完成，当前版本: %d\n", current)
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	return 0
+}
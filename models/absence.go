@@ -0,0 +1,263 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxAbsenceDays 一次请假的最大天数
+const maxAbsenceDays = 366
+
+// 请假登记人
+const (
+	AbsenceReporterStudent = "student" // 学生本人
+	AbsenceReporterParent  = "parent"  // 家长
+	AbsenceReporterTeacher = "teacher" // 班主任（由管理员代为登记）
+	AbsenceReporterAdmin   = "admin"   // 管理员
+)
+
+// Absence 学生请假记录，日期为服务器本地日期（YYYY-MM-DD，均含）
+// 请假的日期不自动选餐，不计入备餐份数、未取餐统计和按选餐扣费的天数；整个领餐时间都请假的学生不发送选餐通知和提醒
+type Absence struct {
+	ID          int       `json:"id"`
+	StudentID   int       `json:"student_id"`
+	StartDate   string    `json:"start_date"`
+	EndDate     string    `json:"end_date"`
+	Reason      string    `json:"reason"`
+	ReportedBy  string    `json:"reported_by"` // 登记人：student、parent、teacher 或 admin
+	Operator    string    `json:"operator"`    // 登记人姓名，学生和家长登录时为与学生的关系
+	CreatedAt   time.Time `json:"created_at"`
+	StudentName string    `json:"student_name,omitempty"`
+	Class       string    `json:"class,omitempty"`
+}
+
+// AbsenceFilter 请假记录查询条件，为空的条件不参与筛选
+type AbsenceFilter struct {
+	StudentID int
+	Class     string
+	From      string // 与 [From, To] 有重叠的请假（YYYY-MM-DD）
+	To        string
+	Page      int // 从1开始
+	PageSize  int
+}
+
+// absenceDays 学生ID -> 请假的日期集合
+type absenceDays map[int]map[string]bool
+
+// absent 学生在该日期是否请假
+func (days absenceDays) absent(studentID int, date string) bool {
+	return days[studentID][date]
+}
+
+// absentAll 学生在所有日期都请假时返回 true，dates 为空时返回 false
+func (days absenceDays) absentAll(studentID int, dates []string) bool {
+	if len(dates) == 0 || len(days[studentID]) == 0 {
+		return false
+	}
+	for _, date := range dates {
+		if !days[studentID][date] {
+			return false
+		}
+	}
+	return true
+}
+
+// presentDays 学生在 dates 中未请假的天数
+func (days absenceDays) presentDays(studentID int, dates []string) int {
+	count := 0
+	for _, date := range dates {
+		if !days[studentID][date] {
+			count++
+		}
+	}
+	return count
+}
+
+// IsValidAbsenceReporter 判断请假登记人是否有效
+func IsValidAbsenceReporter(reporter string) bool {
+	switch reporter {
+	case AbsenceReporterStudent, AbsenceReporterParent, AbsenceReporterTeacher, AbsenceReporterAdmin:
+		return true
+	}
+	return false
+}
+
+// CreateAbsence 登记请假，同一学生的请假时间不能重叠；按选餐扣费时退还请假日期已扣的餐费
+func CreateAbsence(studentID int, startDate, endDate, reason, reportedBy, operator string) (*Absence, error) {
+	// 验证参数
+	start, err := time.ParseInLocation(collectionDateLayout, startDate, time.Local)
+	if err != nil {
+		return nil, errors.New("无效的开始日期")
+	}
+	end, err := time.ParseInLocation(collectionDateLayout, endDate, time.Local)
+	if err != nil {
+		return nil, errors.New("无效的结束日期")
+	}
+	if start.After(end) {
+		return nil, errors.New("开始日期不能晚于结束日期")
+	}
+	if end.Sub(start) >= maxAbsenceDays*24*time.Hour {
+		return nil, fmt.Errorf("请假时间不能超过%d天", maxAbsenceDays)
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, errors.New("请假原因不能为空")
+	}
+	if !IsValidAbsenceReporter(reportedBy) {
+		return nil, errors.New("无效的登记人")
+	}
+	if _, err := GetStudentByID(studentID); err != nil {
+		return nil, err
+	}
+
+	absence := &Absence{
+		StudentID:  studentID,
+		StartDate:  startDate,
+		EndDate:    endDate,
+		Reason:     reason,
+		ReportedBy: reportedBy,
+		Operator:   operator,
+		CreatedAt:  time.Now(),
+	}
+	err = repos().InTx(func(r *Repositories) error {
+		// 检查是否与已有的请假重叠
+		count, err := r.Absences.CountOverlapping(studentID, startDate, endDate)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return errors.New("与已有的请假时间重叠")
+		}
+
+		// 插入记录
+		if err := r.Absences.Create(absence); err != nil {
+			return err
+		}
+
+		// 在同一事务中调整已扣的餐费
+		return adjustAbsenceCharges(r, absence, "请假", operator)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return absence, nil
+}
+
+// GetAbsenceByID 通过ID获取请假记录
+func GetAbsenceByID(id int) (*Absence, error) {
+	absence, err := repos().Absences.GetByID(id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, errors.New("请假记录不存在")
+	}
+	return absence, err
+}
+
+// GetAbsences 分页查询请假记录，按开始日期倒序，同时返回总数
+func GetAbsences(filter AbsenceFilter) ([]*Absence, int, error) {
+	return repos().Absences.List(filter)
+}
+
+// DeleteAbsence 取消请假；按选餐扣费时补扣请假日期的餐费，operator 为取消请假的人
+func DeleteAbsence(id int, operator string) (*Absence, error) {
+	absence, err := GetAbsenceByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = repos().InTx(func(r *Repositories) error {
+		if err := r.Absences.Delete(id); err != nil {
+			return err
+		}
+
+		// 在同一事务中调整已扣的餐费
+		return adjustAbsenceCharges(r, absence, "取消请假", operator)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return absence, nil
+}
+
+// getAbsenceDays 获取 [from, to]（YYYY-MM-DD）内的请假日期，studentID 为0时获取所有学生
+func getAbsenceDays(r *Repositories, studentID int, from, to string) (absenceDays, error) {
+	absences, err := r.Absences.ListBetween(studentID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	days := make(absenceDays)
+	for _, absence := range absences {
+		// 只保留 [from, to] 内的日期
+		startDate, endDate := absence.StartDate, absence.EndDate
+		if startDate < from {
+			startDate = from
+		}
+		if endDate > to {
+			endDate = to
+		}
+		day, err := time.ParseInLocation(collectionDateLayout, startDate, time.Local)
+		if err != nil {
+			continue
+		}
+		if days[absence.StudentID] == nil {
+			days[absence.StudentID] = make(map[string]bool)
+		}
+		for ; day.Format(collectionDateLayout) <= endDate; day = day.AddDate(0, 0, 1) {
+			days[absence.StudentID][day.Format(collectionDateLayout)] = true
+		}
+	}
+
+	return days, nil
+}
+
+// getMealAbsenceDays 获取餐的领餐时间（按校历 cal）内的请假日期，studentID 为0时获取所有学生
+func getMealAbsenceDays(r *Repositories, cal schoolCalendar, meal *Meal, studentID int) (absenceDays, error) {
+	dates := cal.servingDates(meal)
+	if len(dates) == 0 {
+		return absenceDays{}, nil
+	}
+	return getAbsenceDays(r, studentID, dates[0], dates[len(dates)-1])
+}
+
+// getFullyAbsentStudents 获取整个领餐时间都请假的学生ID
+func getFullyAbsentStudents(meal *Meal) (map[int]bool, error) {
+	cal := currentCalendar()
+	days, err := getMealAbsenceDays(repos(), cal, meal, 0)
+	if err != nil {
+		return nil, err
+	}
+	dates := cal.servingDates(meal)
+	absent := make(map[int]bool)
+	for studentID := range days {
+		if days.absentAll(studentID, dates) {
+			absent[studentID] = true
+		}
+	}
+	return absent, nil
+}
+
+// GetFullyAbsentStudentIDs 获取整个领餐时间都请假的学生ID，用于在选餐统计中与未选餐区分
+func GetFullyAbsentStudentIDs(mealID int) (map[int]bool, error) {
+	meal, err := GetMealByID(mealID)
+	if err != nil {
+		return nil, err
+	}
+	return getFullyAbsentStudents(meal)
+}
+
+// adjustAbsenceCharges 在登记或取消请假的事务中，按选餐扣费时重新计算请假期间各餐的费用，退还或补扣差额
+func adjustAbsenceCharges(r *Repositories, absence *Absence, adjustment, operator string) error {
+	start, err := time.ParseInLocation(collectionDateLayout, absence.StartDate, time.Local)
+	if err != nil {
+		return err
+	}
+	end, err := time.ParseInLocation(collectionDateLayout, absence.EndDate, time.Local)
+	if err != nil {
+		return err
+	}
+	return adjustSelectionCharges(r, currentCalendar(), start, end, absence.StudentID, adjustment, operator)
+}
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/itsHenry35/canteen-management-system/database"
+)
+
+// sqlAbsenceRepository 基于 SQL 数据库的请假记录数据访问
+type sqlAbsenceRepository struct {
+	db database.Conn
+}
+
+const absenceColumns = `a.id, a.student_id, a.start_date, a.end_date, a.reason, a.reported_by, a.operator, a.created_at,
+	COALESCE(s.full_name, ''), COALESCE(s.class, '')`
+
+// scanAbsence 读取一行请假记录
+func scanAbsence(row interface{ Scan(...interface{}) error }) (*Absence, error) {
+	var absence Absence
+	err := row.Scan(
+		&absence.ID, &absence.StudentID, &absence.StartDate, &absence.EndDate, &absence.Reason, &absence.ReportedBy,
+		&absence.Operator, &absence.CreatedAt, &absence.StudentName, &absence.Class,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &absence, nil
+}
+
+// queryAbsences 查询多条请假记录
+func (r *sqlAbsenceRepository) queryAbsences(query string, args ...interface{}) ([]*Absence, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	absences := []*Absence{}
+	for rows.Next() {
+		absence, err := scanAbsence(rows)
+		if err != nil {
+			return nil, err
+		}
+		absences = append(absences, absence)
+	}
+
+	return absences, rows.Err()
+}
+
+func (r *sqlAbsenceRepository) Create(absence *Absence) error {
+	id, err := r.db.InsertID(
+		`INSERT INTO student_absences (student_id, start_date, end_date, reason, reported_by, operator, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		absence.StudentID, absence.StartDate, absence.EndDate, absence.Reason, absence.ReportedBy, absence.Operator,
+		absence.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	absence.ID = int(id)
+	return nil
+}
+
+func (r *sqlAbsenceRepository) CountOverlapping(studentID int, from, to string) (int, error) {
+	var count int
+	err := r.db.QueryRow(
+		"SELECT COUNT(*) FROM student_absences WHERE student_id = ? AND start_date <= ? AND end_date >= ?",
+		studentID, to, from,
+	).Scan(&count)
+	return count, err
+}
+
+func (r *sqlAbsenceRepository) GetByID(id int) (*Absence, error) {
+	return scanAbsence(r.db.QueryRow(
+		"SELECT "+absenceColumns+" FROM student_absences a LEFT JOIN students s ON s.id = a.student_id WHERE a.id = ?",
+		id,
+	))
+}
+
+func (r *sqlAbsenceRepository) List(filter AbsenceFilter) ([]*Absence, int, error) {
+	// 构建查询条件
+	var conditions []string
+	var args []interface{}
+	if filter.StudentID != 0 {
+		conditions = append(conditions, "a.student_id = ?")
+		args = append(args, filter.StudentID)
+	}
+	if filter.Class != "" {
+		conditions = append(conditions, "s.class = ?")
+		args = append(args, filter.Class)
+	}
+	if filter.From != "" {
+		conditions = append(conditions, "a.end_date >= ?")
+		args = append(args, filter.From)
+	}
+	if filter.To != "" {
+		conditions = append(conditions, "a.start_date <= ?")
+		args = append(args, filter.To)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// 统计总数
+	var total int
+	err := r.db.QueryRow(
+		"SELECT COUNT(*) FROM student_absences a LEFT JOIN students s ON s.id = a.student_id "+where, args...,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// 分页参数
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = 20
+	}
+
+	// 查询记录
+	absences, err := r.queryAbsences(
+		"SELECT "+absenceColumns+" FROM student_absences a LEFT JOIN students s ON s.id = a.student_id "+where+
+			" ORDER BY a.start_date DESC, a.id DESC LIMIT ? OFFSET ?",
+		append(args, filter.PageSize, (filter.Page-1)*filter.PageSize)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return absences, total, nil
+}
+
+func (r *sqlAbsenceRepository) ListBetween(studentID int, from, to string) ([]*Absence, error) {
+	query := "SELECT " + absenceColumns + " FROM student_absences a LEFT JOIN students s ON s.id = a.student_id WHERE a.start_date <= ? AND a.end_date >= ?"
+	args := []interface{}{to, from}
+	if studentID != 0 {
+		query += " AND a.student_id = ?"
+		args = append(args, studentID)
+	}
+	return r.queryAbsences(query+" ORDER BY a.start_date, a.id", args...)
+}
+
+func (r *sqlAbsenceRepository) Delete(id int) error {
+	_, err := r.db.Exec("DELETE FROM student_absences WHERE id = ?", id)
+	return err
+}
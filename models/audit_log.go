@@ -0,0 +1,197 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/database"
+)
+
+// 审计操作
+const (
+	AuditActionCreate  = "create"  // 新增（包括创建备份）
+	AuditActionUpdate  = "update"  // 修改
+	AuditActionDelete  = "delete"  // 删除
+	AuditActionArchive = "archive" // 归档过期餐
+	AuditActionPurge   = "purge"   // 彻底删除已归档餐
+	AuditActionBatch   = "batch"   // 批量选餐
+	AuditActionImport  = "import"  // 导入选餐
+	AuditActionSync    = "sync"    // 重建映射、同步学生名单
+	AuditActionRun     = "run"     // 手动执行定时任务
+)
+
+// 审计对象类型
+const (
+	AuditTargetUser         = "user"
+	AuditTargetStudent      = "student"
+	AuditTargetMeal         = "meal"
+	AuditTargetSelection    = "selection"
+	AuditTargetSettings     = "settings"
+	AuditTargetMapping      = "mapping" // 家长-学生映射
+	AuditTargetRoster       = "roster"  // 学生名单
+	AuditTargetJob          = "job"     // 定时任务
+	AuditTargetBackup       = "backup"
+	AuditTargetTeacher      = "class_teacher" // 班主任
+	AuditTargetWallet       = "wallet"        // 学生余额，目标ID为学生ID
+	AuditTargetAbsence      = "absence"       // 学生请假
+	AuditTargetCalendar     = "calendar"      // 校历
+	AuditTargetMealTemplate = "meal_template" // 餐模板
+)
+
+// AuditLog 审计日志，只追加不修改
+type AuditLog struct {
+	ID         int             `json:"id"`
+	ActorID    int             `json:"actor_id"`         // 操作人ID，系统操作为0
+	ActorName  string          `json:"actor_name"`       // 操作人姓名
+	ActorRole  string          `json:"actor_role"`       // 操作人角色
+	Action     string          `json:"action"`           // 操作
+	TargetType string          `json:"target_type"`      // 对象类型
+	TargetID   string          `json:"target_id"`        // 对象ID，选餐为餐ID，备份为文件名，批量操作时可为空
+	Before     json.RawMessage `json:"before,omitempty"` // 修改前的数据
+	After      json.RawMessage `json:"after,omitempty"`  // 修改后的数据
+	IP         string          `json:"ip"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AuditLogFilter 审计日志查询条件，为空的条件不参与筛选
+type AuditLogFilter struct {
+	ActorID    int
+	Action     string
+	TargetType string
+	TargetID   string
+	Keyword    string    // 匹配操作人姓名或修改前后的数据
+	From       time.Time // 起始时间（含）
+	To         time.Time // 结束时间（含）
+	Page       int       // 从1开始
+	PageSize   int
+}
+
+// CreateAuditLog 写入审计日志，before 和 after 会序列化为 JSON，为 nil 时不记录
+func CreateAuditLog(entry *AuditLog, before, after interface{}) error {
+	// 获取数据库连接
+	db := database.GetDB()
+
+	// 序列化修改前后的数据
+	var err error
+	if entry.Before, err = marshalAuditData(before); err != nil {
+		return err
+	}
+	if entry.After, err = marshalAuditData(after); err != nil {
+		return err
+	}
+	entry.CreatedAt = time.Now()
+
+	// 插入记录
+	id, err := db.InsertID(
+		`INSERT INTO audit_logs (actor_id, actor_name, actor_role, action, target_type, target_id, before_data, after_data, ip, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.ActorID, entry.ActorName, entry.ActorRole, entry.Action, entry.TargetType, entry.TargetID,
+		string(entry.Before), string(entry.After), entry.IP, entry.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	entry.ID = int(id)
+
+	return nil
+}
+
+// marshalAuditData 序列化审计数据，nil 返回空
+func marshalAuditData(data interface{}) (json.RawMessage, error) {
+	if data == nil {
+		return nil, nil
+	}
+	return json.Marshal(data)
+}
+
+// GetAuditLogs 分页查询审计日志，按时间倒序，同时返回总数
+func GetAuditLogs(filter AuditLogFilter) ([]*AuditLog, int, error) {
+	// 获取数据库连接
+	db := database.GetDB()
+
+	// 构建查询条件
+	var conditions []string
+	var args []interface{}
+	if filter.ActorID != 0 {
+		conditions = append(conditions, "actor_id = ?")
+		args = append(args, filter.ActorID)
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.TargetType != "" {
+		conditions = append(conditions, "target_type = ?")
+		args = append(args, filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		conditions = append(conditions, "target_id = ?")
+		args = append(args, filter.TargetID)
+	}
+	if filter.Keyword != "" {
+		keyword := "%" + filter.Keyword + "%"
+		conditions = append(conditions, "(actor_name LIKE ? OR before_data LIKE ? OR after_data LIKE ?)")
+		args = append(args, keyword, keyword, keyword)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "created_at <= ?")
+		args = append(args, filter.To.UTC())
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// 统计总数
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM audit_logs "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	// 分页参数
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = 20
+	}
+
+	// 查询记录
+	rows, err := db.Query(
+		`SELECT id, actor_id, actor_name, actor_role, action, target_type, target_id, before_data, after_data, ip, created_at
+		FROM audit_logs `+where+` ORDER BY id DESC LIMIT ? OFFSET ?`,
+		append(args, filter.PageSize, (filter.Page-1)*filter.PageSize)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	// 处理结果
+	logs := []*AuditLog{}
+	for rows.Next() {
+		var entry AuditLog
+		var before, after string
+		err := rows.Scan(
+			&entry.ID, &entry.ActorID, &entry.ActorName, &entry.ActorRole, &entry.Action, &entry.TargetType, &entry.TargetID,
+			&before, &after, &entry.IP, &entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		if before != "" {
+			entry.Before = json.RawMessage(before)
+		}
+		if after != "" {
+			entry.After = json.RawMessage(after)
+		}
+		logs = append(logs, &entry)
+	}
+
+	return logs, total, rows.Err()
+}
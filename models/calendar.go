@@ -0,0 +1,407 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/config"
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+// maxCalendarDays 校历事件和按日查询的最大天数
+const maxCalendarDays = 366
+
+// 校历事件类型
+const (
+	CalendarEventHoliday = "holiday" // 节假日，不供餐
+	CalendarEventWorkday = "workday" // 调休上班日，周末不供餐时照常供餐
+	CalendarEventTerm    = "term"    // 学期，设置了学期时学期之外不供餐
+)
+
+// CalendarEvent 校历事件，日期为服务器本地日期（YYYY-MM-DD，均含）
+type CalendarEvent struct {
+	ID        int       `json:"id"`
+	Type      string    `json:"type"`
+	Name      string    `json:"name"`
+	StartDate string    `json:"start_date"`
+	EndDate   string    `json:"end_date"`
+	UID       string    `json:"uid,omitempty"` // 从 iCalendar 文件导入时的事件UID，重复导入时按UID更新
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CalendarDay 某一天是否供餐
+type CalendarDay struct {
+	Date    string `json:"date"`
+	Serving bool   `json:"serving"`
+	Reason  string `json:"reason,omitempty"` // 不供餐的原因，如节假日名称、周末、非学期时间
+}
+
+// CalendarImportRow 从 iCalendar 文件导入的一个事件
+type CalendarImportRow struct {
+	Row       int      `json:"row"` // 文件中的第几个事件，从1开始
+	UID       string   `json:"uid,omitempty"`
+	Name      string   `json:"name"`
+	Type      string   `json:"type,omitempty"`
+	StartDate string   `json:"start_date,omitempty"`
+	EndDate   string   `json:"end_date,omitempty"`
+	Status    string   `json:"status"`
+	Errors    []string `json:"errors,omitempty"`
+	EventID   int      `json:"event_id,omitempty"` // 写入后的事件ID
+	Updated   bool     `json:"updated,omitempty"`  // 按UID更新了已有的事件
+}
+
+// CalendarImportReport 校历导入报告
+type CalendarImportReport struct {
+	DryRun   bool                 `json:"dry_run"`
+	Total    int                  `json:"total"`    // 事件数
+	Valid    int                  `json:"valid"`    // 校验通过的事件数
+	Imported int                  `json:"imported"` // 写入的事件数（包括更新的），预览模式下为0
+	Failed   int                  `json:"failed"`   // 校验未通过的事件数
+	Rows     []*CalendarImportRow `json:"rows"`
+}
+
+// calendarCache 校历事件缓存，供餐日判断频繁且校历很少修改，修改后重新加载
+var calendarCache struct {
+	sync.RWMutex
+	loaded bool
+	events []*CalendarEvent
+}
+
+// IsValidCalendarEventType 判断校历事件类型是否有效
+func IsValidCalendarEventType(eventType string) bool {
+	switch eventType {
+	case CalendarEventHoliday, CalendarEventWorkday, CalendarEventTerm:
+		return true
+	}
+	return false
+}
+
+// LoadCalendar 从数据库加载校历事件到缓存
+func LoadCalendar() error {
+	events, err := GetCalendarEvents("", "", "")
+	if err != nil {
+		return err
+	}
+	calendarCache.Lock()
+	calendarCache.events = events
+	calendarCache.loaded = true
+	calendarCache.Unlock()
+	return nil
+}
+
+// calendarEvents 获取缓存的校历事件，未加载时先加载；加载失败时按没有校历处理
+func calendarEvents() []*CalendarEvent {
+	calendarCache.RLock()
+	loaded, events := calendarCache.loaded, calendarCache.events
+	calendarCache.RUnlock()
+	if loaded {
+		return events
+	}
+	if err := LoadCalendar(); err != nil {
+		log.Printf("加载校历失败: %v", err)
+		return nil
+	}
+	calendarCache.RLock()
+	defer calendarCache.RUnlock()
+	return calendarCache.events
+}
+
+// schoolCalendar 判断供餐日使用的校历事件，修改校历的事务中为尚未提交的校历
+type schoolCalendar []*CalendarEvent
+
+// currentCalendar 获取缓存的校历
+func currentCalendar() schoolCalendar {
+	return schoolCalendar(calendarEvents())
+}
+
+// IsServingDay 判断某一天（YYYY-MM-DD）是否供餐，不供餐时同时返回原因
+// 节假日不供餐；设置了学期时学期之外不供餐；启用 calendar.skip_weekends 时周末不供餐，调休上班日除外
+func IsServingDay(date string) (bool, string) {
+	return currentCalendar().isServingDay(date)
+}
+
+// isServingDay 按校历 cal 判断某一天是否供餐，规则同 IsServingDay
+func (cal schoolCalendar) isServingDay(date string) (bool, string) {
+	hasTerm, inTerm, workday := false, false, false
+	for _, event := range cal {
+		covers := event.StartDate <= date && event.EndDate >= date
+		switch event.Type {
+		case CalendarEventHoliday:
+			if covers {
+				if event.Name == "" {
+					return false, "节假日"
+				}
+				return false, event.Name
+			}
+		case CalendarEventTerm:
+			hasTerm = true
+			inTerm = inTerm || covers
+		case CalendarEventWorkday:
+			workday = workday || covers
+		}
+	}
+	if hasTerm && !inTerm {
+		return false, "非学期时间"
+	}
+
+	// 周末
+	if config.Get().Calendar.SkipWeekends && !workday {
+		day, err := time.ParseInLocation(collectionDateLayout, date, time.Local)
+		if err == nil && (day.Weekday() == time.Saturday || day.Weekday() == time.Sunday) {
+			return false, "周末"
+		}
+	}
+
+	return true, ""
+}
+
+// GetCalendarDays 列出 [from, to]（YYYY-MM-DD）内每一天是否供餐
+func GetCalendarDays(from, to string) ([]*CalendarDay, error) {
+	start, end, err := parseCalendarRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	var days []*CalendarDay
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		date := day.Format(collectionDateLayout)
+		serving, reason := IsServingDay(date)
+		days = append(days, &CalendarDay{Date: date, Serving: serving, Reason: reason})
+	}
+	return days, nil
+}
+
+// parseCalendarRange 解析并校验日期范围
+func parseCalendarRange(from, to string) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation(collectionDateLayout, from, time.Local)
+	if err != nil {
+		return start, start, errors.New("无效的开始日期")
+	}
+	end, err := time.ParseInLocation(collectionDateLayout, to, time.Local)
+	if err != nil {
+		return start, end, errors.New("无效的结束日期")
+	}
+	if start.After(end) {
+		return start, end, errors.New("开始日期不能晚于结束日期")
+	}
+	if end.Sub(start) >= maxCalendarDays*24*time.Hour {
+		return start, end, fmt.Errorf("日期范围不能超过%d天", maxCalendarDays)
+	}
+	return start, end, nil
+}
+
+// CreateCalendarEvent 添加校历事件；按选餐扣费时重新计算受影响的餐已扣的费用
+func CreateCalendarEvent(eventType, name, startDate, endDate, operator string) (*CalendarEvent, error) {
+	// 验证参数
+	if !IsValidCalendarEventType(eventType) {
+		return nil, errors.New("无效的校历事件类型")
+	}
+	start, end, err := parseCalendarRange(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	// 插入记录
+	event := &CalendarEvent{
+		Type:      eventType,
+		Name:      strings.TrimSpace(name),
+		StartDate: startDate,
+		EndDate:   endDate,
+		CreatedAt: time.Now(),
+	}
+	err = repos().InTx(func(r *Repositories) error {
+		if err := r.CalendarEvents.Create(event); err != nil {
+			return err
+		}
+
+		// 在同一事务中调整已扣的餐费
+		return calendarChanged(r, start, end, operator)
+	})
+	if err != nil {
+		return nil, err
+	}
+	reloadCalendar()
+
+	return event, nil
+}
+
+// GetCalendarEventByID 通过ID获取校历事件
+func GetCalendarEventByID(id int) (*CalendarEvent, error) {
+	event, err := repos().CalendarEvents.GetByID(id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, errors.New("校历事件不存在")
+	}
+	return event, err
+}
+
+// GetCalendarEvents 获取与 [from, to] 重叠的校历事件，按开始日期排序；为空的条件不参与筛选
+func GetCalendarEvents(from, to, eventType string) ([]*CalendarEvent, error) {
+	return repos().CalendarEvents.List(from, to, eventType)
+}
+
+// DeleteCalendarEvent 删除校历事件；按选餐扣费时重新计算受影响的餐已扣的费用
+func DeleteCalendarEvent(id int, operator string) (*CalendarEvent, error) {
+	event, err := GetCalendarEventByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	start, _ := time.ParseInLocation(collectionDateLayout, event.StartDate, time.Local)
+	end, _ := time.ParseInLocation(collectionDateLayout, event.EndDate, time.Local)
+	err = repos().InTx(func(r *Repositories) error {
+		if err := r.CalendarEvents.Delete(id); err != nil {
+			return err
+		}
+
+		// 在同一事务中调整已扣的餐费
+		return calendarChanged(r, start, end, operator)
+	})
+	if err != nil {
+		return nil, err
+	}
+	reloadCalendar()
+
+	return event, nil
+}
+
+// calendarEventType 推断导入事件的类型：名称或分类包含"班"（如"补班"、"上班"）时为调休上班日，包含"学期"时为学期，否则为节假日
+func calendarEventType(event *utils.ICalEvent) string {
+	text := event.Summary + " " + event.Category
+	switch {
+	case strings.Contains(text, "班") || strings.EqualFold(event.Category, CalendarEventWorkday):
+		return CalendarEventWorkday
+	case strings.Contains(text, "学期") || strings.EqualFold(event.Category, CalendarEventTerm):
+		return CalendarEventTerm
+	}
+	return CalendarEventHoliday
+}
+
+// ImportCalendarEvents 校验 iCalendar 文件中的事件并在单个事务中导入，dryRun 为 true 时只校验不写入
+// eventType 为空时按名称推断每个事件的类型；有UID且已导入过的事件会被更新
+func ImportCalendarEvents(events []*utils.ICalEvent, eventType string, dryRun bool, operator string) (*CalendarImportReport, error) {
+	if eventType != "" && !IsValidCalendarEventType(eventType) {
+		return nil, errors.New("无效的校历事件类型")
+	}
+	report := &CalendarImportReport{DryRun: dryRun, Total: len(events), Rows: []*CalendarImportRow{}}
+
+	// 校验每个事件
+	seen := make(map[string]bool)
+	for i, event := range events {
+		row := &CalendarImportRow{
+			Row:       i + 1,
+			UID:       event.UID,
+			Name:      event.Summary,
+			StartDate: event.StartDate,
+			EndDate:   event.EndDate,
+			Type:      eventType,
+		}
+		report.Rows = append(report.Rows, row)
+		if row.Type == "" {
+			row.Type = calendarEventType(event)
+		}
+		if event.Err != nil {
+			row.Errors = append(row.Errors, event.Err.Error())
+		} else if _, _, err := parseCalendarRange(event.StartDate, event.EndDate); err != nil {
+			row.Errors = append(row.Errors, err.Error())
+		}
+		if len(row.Errors) > 0 {
+			row.Status = ImportRowStatusInvalid
+			report.Failed++
+			continue
+		}
+		if event.UID != "" && seen[event.UID] {
+			row.Status = ImportRowStatusDuplicate
+			row.Errors = append(row.Errors, "与文件中前面的事件UID重复")
+			report.Failed++
+			continue
+		}
+		seen[event.UID] = true
+		row.Status = ImportRowStatusValid
+		report.Valid++
+	}
+	if dryRun || report.Valid == 0 {
+		return report, nil
+	}
+
+	// 在单个事务中写入事件并调整已扣的餐费，记录影响的日期范围
+	var from, to string
+	now := time.Now()
+	err := repos().InTx(func(r *Repositories) error {
+		for _, row := range report.Rows {
+			if row.Status != ImportRowStatusValid {
+				continue
+			}
+
+			// 已导入过的事件按UID更新
+			var existing *CalendarEvent
+			if row.UID != "" {
+				event, err := r.CalendarEvents.GetByUID(row.UID)
+				if err != nil && !errors.Is(err, ErrNotFound) {
+					return err
+				}
+				existing = event
+			}
+			if existing != nil {
+				from, to = widenDateRange(from, to, existing.StartDate, existing.EndDate)
+				existing.Type, existing.Name, existing.StartDate, existing.EndDate = row.Type, row.Name, row.StartDate, row.EndDate
+				if err := r.CalendarEvents.Update(existing); err != nil {
+					return err
+				}
+				row.EventID = existing.ID
+				row.Updated = true
+			} else {
+				event := &CalendarEvent{Type: row.Type, Name: row.Name, StartDate: row.StartDate, EndDate: row.EndDate, UID: row.UID, CreatedAt: now}
+				if err := r.CalendarEvents.Create(event); err != nil {
+					return err
+				}
+				row.EventID = event.ID
+			}
+			from, to = widenDateRange(from, to, row.StartDate, row.EndDate)
+			row.Status = ImportRowStatusImported
+			report.Imported++
+		}
+
+		start, _ := time.ParseInLocation(collectionDateLayout, from, time.Local)
+		end, _ := time.ParseInLocation(collectionDateLayout, to, time.Local)
+		return calendarChanged(r, start, end, operator)
+	})
+	if err != nil {
+		return nil, err
+	}
+	reloadCalendar()
+
+	return report, nil
+}
+
+// widenDateRange 扩大日期范围以包含 [start, end]
+func widenDateRange(from, to, start, end string) (string, string) {
+	if from == "" || start < from {
+		from = start
+	}
+	if to == "" || end > to {
+		to = end
+	}
+	return from, to
+}
+
+// calendarChanged 在修改校历的事务中，按选餐扣费时用修改后的校历重新计算 [from, to] 内各餐已扣的费用
+func calendarChanged(r *Repositories, from, to time.Time, operator string) error {
+	if !billingChargesOn(ChargeOnSelection) {
+		return nil
+	}
+	events, err := r.CalendarEvents.List("", "", "")
+	if err != nil {
+		return err
+	}
+	return adjustSelectionCharges(r, schoolCalendar(events), from, to, 0, "校历调整", operator)
+}
+
+// reloadCalendar 校历修改提交后重新加载缓存，失败只记录日志
+func reloadCalendar() {
+	if err := LoadCalendar(); err != nil {
+		utils.LogError(fmt.Sprintf("重新加载校历失败: %v", err))
+	}
+}
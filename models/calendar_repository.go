@@ -0,0 +1,103 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/itsHenry35/canteen-management-system/database"
+)
+
+// sqlCalendarEventRepository 基于 SQL 数据库的校历事件数据访问
+type sqlCalendarEventRepository struct {
+	db database.Conn
+}
+
+const calendarEventColumns = "id, type, name, start_date, end_date, uid, created_at"
+
+// scanCalendarEvent 读取一行校历事件
+func scanCalendarEvent(row interface{ Scan(...interface{}) error }) (*CalendarEvent, error) {
+	var event CalendarEvent
+	err := row.Scan(&event.ID, &event.Type, &event.Name, &event.StartDate, &event.EndDate, &event.UID, &event.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (r *sqlCalendarEventRepository) Create(event *CalendarEvent) error {
+	id, err := r.db.InsertID(
+		"INSERT INTO calendar_events (type, name, start_date, end_date, uid, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		event.Type, event.Name, event.StartDate, event.EndDate, event.UID, event.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	event.ID = int(id)
+	return nil
+}
+
+func (r *sqlCalendarEventRepository) GetByID(id int) (*CalendarEvent, error) {
+	return scanCalendarEvent(r.db.QueryRow("SELECT "+calendarEventColumns+" FROM calendar_events WHERE id = ?", id))
+}
+
+func (r *sqlCalendarEventRepository) GetByUID(uid string) (*CalendarEvent, error) {
+	return scanCalendarEvent(r.db.QueryRow("SELECT "+calendarEventColumns+" FROM calendar_events WHERE uid = ?", uid))
+}
+
+func (r *sqlCalendarEventRepository) List(from, to, eventType string) ([]*CalendarEvent, error) {
+	// 构建查询条件
+	var conditions []string
+	var args []interface{}
+	if from != "" {
+		conditions = append(conditions, "end_date >= ?")
+		args = append(args, from)
+	}
+	if to != "" {
+		conditions = append(conditions, "start_date <= ?")
+		args = append(args, to)
+	}
+	if eventType != "" {
+		conditions = append(conditions, "type = ?")
+		args = append(args, eventType)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// 查询记录
+	rows, err := r.db.Query("SELECT "+calendarEventColumns+" FROM calendar_events "+where+" ORDER BY start_date, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// 处理结果
+	events := []*CalendarEvent{}
+	for rows.Next() {
+		event, err := scanCalendarEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+func (r *sqlCalendarEventRepository) Update(event *CalendarEvent) error {
+	_, err := r.db.Exec(
+		"UPDATE calendar_events SET type = ?, name = ?, start_date = ?, end_date = ? WHERE id = ?",
+		event.Type, event.Name, event.StartDate, event.EndDate, event.ID,
+	)
+	return err
+}
+
+func (r *sqlCalendarEventRepository) Delete(id int) error {
+	_, err := r.db.Exec("DELETE FROM calendar_events WHERE id = ?", id)
+	return err
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/database"
+)
+
+// ClassTeacher 班主任，用于接收本班学生的未取餐提醒
+type ClassTeacher struct {
+	ID         int       `json:"id"`
+	Class      string    `json:"class"`
+	FullName   string    `json:"full_name"`
+	DingTalkID string    `json:"dingtalk_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// CreateClassTeacher 添加班主任，同一班级不能重复添加同一钉钉ID
+func CreateClassTeacher(class, fullName, dingTalkID string) (*ClassTeacher, error) {
+	// 验证参数
+	class = strings.TrimSpace(class)
+	fullName = strings.TrimSpace(fullName)
+	dingTalkID = strings.TrimSpace(dingTalkID)
+	if class == "" || fullName == "" || dingTalkID == "" {
+		return nil, errors.New("班级、姓名和钉钉ID不能为空")
+	}
+
+	// 获取数据库连接
+	db := database.GetDB()
+
+	// 检查是否重复
+	var existing int
+	err := db.QueryRow("SELECT id FROM class_teachers WHERE class = ? AND dingtalk_id = ?", class, dingTalkID).Scan(&existing)
+	if err == nil {
+		return nil, errors.New("该班级已添加此班主任")
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	// 插入记录
+	teacher := &ClassTeacher{Class: class, FullName: fullName, DingTalkID: dingTalkID, CreatedAt: time.Now()}
+	id, err := db.InsertID(
+		"INSERT INTO class_teachers (class, full_name, dingtalk_id, created_at) VALUES (?, ?, ?, ?)",
+		teacher.Class, teacher.FullName, teacher.DingTalkID, teacher.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	teacher.ID = int(id)
+
+	return teacher, nil
+}
+
+// GetClassTeacherByID 通过ID获取班主任
+func GetClassTeacherByID(id int) (*ClassTeacher, error) {
+	// 获取数据库连接
+	db := database.GetDB()
+
+	var teacher ClassTeacher
+	err := db.QueryRow("SELECT id, class, full_name, dingtalk_id, created_at FROM class_teachers WHERE id = ?", id).
+		Scan(&teacher.ID, &teacher.Class, &teacher.FullName, &teacher.DingTalkID, &teacher.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("班主任不存在")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &teacher, nil
+}
+
+// GetClassTeachers 获取班主任列表，class 为空时返回所有班级，按班级和ID排序
+func GetClassTeachers(class string) ([]*ClassTeacher, error) {
+	// 获取数据库连接
+	db := database.GetDB()
+
+	// 构建查询条件
+	query := "SELECT id, class, full_name, dingtalk_id, created_at FROM class_teachers"
+	var args []interface{}
+	if class != "" {
+		query += " WHERE class = ?"
+		args = append(args, class)
+	}
+	query += " ORDER BY class, id"
+
+	// 查询记录
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// 处理结果
+	teachers := []*ClassTeacher{}
+	for rows.Next() {
+		var teacher ClassTeacher
+		if err := rows.Scan(&teacher.ID, &teacher.Class, &teacher.FullName, &teacher.DingTalkID, &teacher.CreatedAt); err != nil {
+			return nil, err
+		}
+		teachers = append(teachers, &teacher)
+	}
+
+	return teachers, rows.Err()
+}
+
+// DeleteClassTeacher 删除班主任
+func DeleteClassTeacher(id int) error {
+	// 获取数据库连接
+	db := database.GetDB()
+
+	_, err := db.Exec("DELETE FROM class_teachers WHERE id = ?", id)
+	return err
+}
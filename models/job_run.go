@@ -0,0 +1,195 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/database"
+)
+
+// 任务运行状态
+const (
+	JobRunStatusRunning = "running" // 运行中
+	JobRunStatusSuccess = "success" // 成功
+	JobRunStatusFailed  = "failed"  // 失败
+)
+
+// 任务触发方式
+const (
+	JobRunSourceSchedule = "schedule" // 按计划执行
+	JobRunSourceManual   = "manual"   // 管理员手动触发
+	JobRunSourceCatchUp  = "catch_up" // 启动时补执行错过的任务
+)
+
+// JobRun 定时任务运行记录
+type JobRun struct {
+	ID            int        `json:"id"`
+	JobKey        string     `json:"job_key"`                // 任务名称，如 cleanup、reminder、auto_select
+	MealID        int        `json:"meal_id,omitempty"`      // 关联的餐ID，与餐无关的任务为0
+	Source        string     `json:"source"`                 // 触发方式
+	ScheduledAt   *time.Time `json:"scheduled_at,omitempty"` // 计划执行时间，手动触发时为空
+	StartedAt     time.Time  `json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+	Status        string     `json:"status"`          // 运行状态
+	AffectedCount int        `json:"affected_count"`  // 影响的记录数，如自动选餐的学生数
+	Error         string     `json:"error,omitempty"` // 失败原因
+}
+
+// JobRunFilter 运行记录查询条件，为空的条件不参与筛选
+type JobRunFilter struct {
+	JobKey   string
+	MealID   int
+	Status   string
+	Source   string
+	Page     int // 从1开始
+	PageSize int
+}
+
+// CreateJobRun 记录任务开始运行
+func CreateJobRun(jobKey string, mealID int, source string, scheduledAt *time.Time) (*JobRun, error) {
+	// 获取数据库连接
+	db := database.GetDB()
+
+	run := &JobRun{
+		JobKey:      jobKey,
+		MealID:      mealID,
+		Source:      source,
+		ScheduledAt: scheduledAt,
+		StartedAt:   time.Now(),
+		Status:      JobRunStatusRunning,
+	}
+
+	// 插入记录
+	id, err := db.InsertID(
+		"INSERT INTO job_runs (job_key, meal_id, source, scheduled_at, started_at, status, error) VALUES (?, ?, ?, ?, ?, ?, '')",
+		run.JobKey, run.MealID, run.Source, run.ScheduledAt, run.StartedAt, run.Status,
+	)
+	if err != nil {
+		return nil, err
+	}
+	run.ID = int(id)
+
+	return run, nil
+}
+
+// FinishJobRun 记录任务运行结果
+func FinishJobRun(run *JobRun, affectedCount int, runErr error) error {
+	// 获取数据库连接
+	db := database.GetDB()
+
+	// 记录结束时间与结果
+	now := time.Now()
+	run.FinishedAt = &now
+	run.AffectedCount = affectedCount
+	if runErr != nil {
+		run.Status = JobRunStatusFailed
+		run.Error = runErr.Error()
+	} else {
+		run.Status = JobRunStatusSuccess
+	}
+
+	// 更新记录
+	_, err := db.Exec(
+		"UPDATE job_runs SET finished_at = ?, status = ?, affected_count = ?, error = ? WHERE id = ?",
+		run.FinishedAt, run.Status, run.AffectedCount, run.Error, run.ID,
+	)
+
+	return err
+}
+
+// GetJobRuns 分页查询运行记录，按开始时间倒序，同时返回总数
+func GetJobRuns(filter JobRunFilter) ([]*JobRun, int, error) {
+	// 获取数据库连接
+	db := database.GetDB()
+
+	// 构建查询条件
+	var conditions []string
+	var args []interface{}
+	if filter.JobKey != "" {
+		conditions = append(conditions, "job_key = ?")
+		args = append(args, filter.JobKey)
+	}
+	if filter.MealID != 0 {
+		conditions = append(conditions, "meal_id = ?")
+		args = append(args, filter.MealID)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.Source != "" {
+		conditions = append(conditions, "source = ?")
+		args = append(args, filter.Source)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// 统计总数
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM job_runs "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	// 分页参数
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = 20
+	}
+
+	// 查询记录
+	rows, err := db.Query(
+		`SELECT id, job_key, meal_id, source, scheduled_at, started_at, finished_at, status, affected_count, error
+		FROM job_runs `+where+` ORDER BY id DESC LIMIT ? OFFSET ?`,
+		append(args, filter.PageSize, (filter.Page-1)*filter.PageSize)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	// 处理结果
+	runs := []*JobRun{}
+	for rows.Next() {
+		var run JobRun
+		var scheduledAt, finishedAt sql.NullTime
+		err := rows.Scan(
+			&run.ID, &run.JobKey, &run.MealID, &run.Source, &scheduledAt, &run.StartedAt, &finishedAt,
+			&run.Status, &run.AffectedCount, &run.Error,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		if scheduledAt.Valid {
+			run.ScheduledAt = &scheduledAt.Time
+		}
+		if finishedAt.Valid {
+			run.FinishedAt = &finishedAt.Time
+		}
+		runs = append(runs, &run)
+	}
+
+	return runs, total, rows.Err()
+}
+
+// HasJobRunSince 检查任务在指定时间之后是否运行过（不论成功与否）
+func HasJobRunSince(jobKey string, mealID int, since time.Time) (bool, error) {
+	// 获取数据库连接
+	db := database.GetDB()
+
+	// 查询记录
+	var count int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM job_runs WHERE job_key = ? AND meal_id = ? AND started_at >= ?",
+		jobKey, mealID, since,
+	).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
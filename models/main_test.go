@@ -0,0 +1,152 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/config"
+	"github.com/itsHenry35/canteen-management-system/database"
+)
+
+// TestMain 在临时目录中创建配置文件，测试结束后删除
+func TestMain(m *testing.M) {
+	os.Exit(runInTempDir(m))
+}
+
+func runInTempDir(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "canteen-models-test")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chdir(dir); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	// 写入测试配置
+	cfg := map[string]interface{}{
+		"database": map[string]string{"driver": "sqlite", "path": filepath.Join(dir, "canteen.db")},
+	}
+	data, _ := json.Marshal(cfg)
+	if err := os.WriteFile("config.json", data, 0644); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if err := config.Load(); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	return m.Run()
+}
+
+// newTestRepositories 在临时目录中创建 SQLite 数据库并设为模型使用的数据访问，测试结束时恢复
+func newTestRepositories(t *testing.T) *Repositories {
+	t.Helper()
+
+	db, err := database.Connect(database.DialectSQLite, filepath.Join(t.TempDir(), "canteen.db"))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := db.MigrateTo(0); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	r := NewSQLRepositories(db)
+	SetRepositories(r)
+	resetCalendarCache()
+	t.Cleanup(func() {
+		SetRepositories(nil)
+		resetCalendarCache()
+		db.Close()
+	})
+	return r
+}
+
+// resetCalendarCache 清空校历缓存，下次判断供餐日时从当前数据库加载
+func resetCalendarCache() {
+	calendarCache.Lock()
+	calendarCache.events, calendarCache.loaded = nil, false
+	calendarCache.Unlock()
+}
+
+// useBilling 修改扣费设置，测试结束时恢复
+func useBilling(t *testing.T, chargeOn string, blockInsufficientBalance bool) {
+	t.Helper()
+
+	billing := &config.Get().Billing
+	saved := *billing
+	billing.Enabled = true
+	billing.ChargeOn = chargeOn
+	billing.BlockInsufficientBalance = blockInsufficientBalance
+	t.Cleanup(func() { *billing = saved })
+}
+
+// testDay 返回今天之后第 offset 天的零点，offset 可为负数
+func testDay(offset int) time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, offset)
+}
+
+// newTestMeal 创建从 start 开始领餐 days 天的餐，A餐单价为 priceA 分，B餐单价为 priceB 分
+func newTestMeal(t *testing.T, r *Repositories, start time.Time, days, priceA, priceB int) *Meal {
+	t.Helper()
+
+	meal := &Meal{
+		Name:               "测试餐" + start.Format("0102"),
+		SelectionStartTime: start.AddDate(0, 0, -2),
+		SelectionEndTime:   start.Add(-time.Minute),
+		EffectiveStartDate: start,
+		EffectiveEndDate:   start.AddDate(0, 0, days).Add(-time.Second),
+		PriceA:             priceA,
+		PriceB:             priceB,
+	}
+	if err := r.Meals.Create(meal); err != nil {
+		t.Fatalf("create meal: %v", err)
+	}
+	return meal
+}
+
+// newTestStudent 创建学生并充值 balance 分
+func newTestStudent(t *testing.T, r *Repositories, fullName string, balance int) *Student {
+	t.Helper()
+
+	student, err := r.Students.Create(fullName, "一班", "")
+	if err != nil {
+		t.Fatalf("create student: %v", err)
+	}
+	if balance != 0 {
+		if err := r.Wallets.Post(&WalletTransaction{StudentID: student.ID, Type: WalletTypeTopUp, Amount: balance, Operator: "admin"}); err != nil {
+			t.Fatalf("top up: %v", err)
+		}
+	}
+	return student
+}
+
+// selectAndCharge 保存选餐并按当前校历记账
+func selectAndCharge(t *testing.T, r *Repositories, meal *Meal, studentID int, mealType MealType) *MealSelection {
+	t.Helper()
+
+	selection := &MealSelection{StudentID: studentID, MealID: meal.ID, MealType: mealType, Operator: "admin", Source: SelectionSourceAdmin}
+	if err := r.Selections.Save(selection); err != nil {
+		t.Fatalf("save selection: %v", err)
+	}
+	if err := postSelectionCharges(r, currentCalendar(), meal, []*MealSelection{selection}, ""); err != nil {
+		t.Fatalf("post selection charges: %v", err)
+	}
+	return selection
+}
+
+// wantBalance 检查学生的余额
+func wantBalance(t *testing.T, r *Repositories, studentID, want int) {
+	t.Helper()
+
+	if balance, err := r.Wallets.GetBalance(studentID); err != nil || balance != want {
+		t.Errorf("balance = %d, %v, want %d", balance, err, want)
+	}
+}
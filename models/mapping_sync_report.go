@@ -0,0 +1,169 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/database"
+)
+
+// 同步报告状态
+const (
+	SyncStatusRunning = "running" // 进行中
+	SyncStatusSuccess = "success" // 成功
+	SyncStatusFailed  = "failed"  // 失败，未做任何修改
+)
+
+// MappingSyncReport 家长-学生映射同步报告
+type MappingSyncReport struct {
+	ID               int                        `json:"id"`
+	StartedAt        time.Time                  `json:"started_at"`
+	FinishedAt       *time.Time                 `json:"finished_at,omitempty"`
+	DryRun           bool                       `json:"dry_run"`            // 是否仅预览差异
+	Status           string                     `json:"status"`             // 同步状态
+	ClassCount       int                        `json:"class_count"`        // 班级总数
+	FailedClassCount int                        `json:"failed_class_count"` // 获取失败的班级数
+	AddedCount       int                        `json:"added_count"`        // 新增关系数
+	RemovedCount     int                        `json:"removed_count"`      // 删除关系数
+	ChangedCount     int                        `json:"changed_count"`      // 变更关系数
+	Error            string                     `json:"error,omitempty"`    // 失败原因
+	Details          *ParentStudentRelationDiff `json:"details,omitempty"`  // 差异明细
+}
+
+// CreateMappingSyncReport 创建同步报告
+func CreateMappingSyncReport(dryRun bool) (*MappingSyncReport, error) {
+	// 获取数据库连接
+	db := database.GetDB()
+
+	report := &MappingSyncReport{
+		StartedAt: time.Now(),
+		DryRun:    dryRun,
+		Status:    SyncStatusRunning,
+	}
+
+	// 插入报告
+	id, err := db.InsertID(
+		"INSERT INTO mapping_sync_reports (started_at, dry_run, status, error, details) VALUES (?, ?, ?, '', '')",
+		report.StartedAt, report.DryRun, report.Status,
+	)
+	if err != nil {
+		return nil, err
+	}
+	report.ID = int(id)
+
+	return report, nil
+}
+
+// FinishMappingSyncReport 保存同步结果
+func FinishMappingSyncReport(report *MappingSyncReport) error {
+	// 获取数据库连接
+	db := database.GetDB()
+
+	// 记录结束时间
+	now := time.Now()
+	report.FinishedAt = &now
+
+	// 统计差异数量
+	details := ""
+	if report.Details != nil {
+		report.AddedCount = len(report.Details.Added)
+		report.RemovedCount = len(report.Details.Removed)
+		report.ChangedCount = len(report.Details.Changed)
+
+		data, err := json.Marshal(report.Details)
+		if err != nil {
+			return err
+		}
+		details = string(data)
+	}
+
+	// 更新报告
+	_, err := db.Exec(
+		`UPDATE mapping_sync_reports SET finished_at = ?, status = ?, class_count = ?, failed_class_count = ?,
+		added_count = ?, removed_count = ?, changed_count = ?, error = ?, details = ? WHERE id = ?`,
+		report.FinishedAt, report.Status, report.ClassCount, report.FailedClassCount,
+		report.AddedCount, report.RemovedCount, report.ChangedCount, report.Error, details, report.ID,
+	)
+
+	return err
+}
+
+// GetMappingSyncReports 获取最近的同步报告（不含差异明细）
+func GetMappingSyncReports(limit int) ([]*MappingSyncReport, error) {
+	// 获取数据库连接
+	db := database.GetDB()
+
+	// 查询报告
+	rows, err := db.Query(
+		`SELECT id, started_at, finished_at, dry_run, status, class_count, failed_class_count,
+		added_count, removed_count, changed_count, error
+		FROM mapping_sync_reports ORDER BY id DESC LIMIT ?`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// 处理结果
+	var reports []*MappingSyncReport
+	for rows.Next() {
+		var report MappingSyncReport
+		var finishedAt sql.NullTime
+		err := rows.Scan(
+			&report.ID, &report.StartedAt, &finishedAt, &report.DryRun, &report.Status, &report.ClassCount, &report.FailedClassCount,
+			&report.AddedCount, &report.RemovedCount, &report.ChangedCount, &report.Error,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if finishedAt.Valid {
+			report.FinishedAt = &finishedAt.Time
+		}
+		reports = append(reports, &report)
+	}
+
+	return reports, rows.Err()
+}
+
+// GetMappingSyncReportByID 获取同步报告及差异明细
+func GetMappingSyncReportByID(id int) (*MappingSyncReport, error) {
+	// 获取数据库连接
+	db := database.GetDB()
+
+	// 查询报告
+	var report MappingSyncReport
+	var finishedAt sql.NullTime
+	var details string
+	err := db.QueryRow(
+		`SELECT id, started_at, finished_at, dry_run, status, class_count, failed_class_count,
+		added_count, removed_count, changed_count, error, details
+		FROM mapping_sync_reports WHERE id = ?`,
+		id,
+	).Scan(
+		&report.ID, &report.StartedAt, &finishedAt, &report.DryRun, &report.Status, &report.ClassCount, &report.FailedClassCount,
+		&report.AddedCount, &report.RemovedCount, &report.ChangedCount, &report.Error, &details,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("同步报告不存在")
+		}
+		return nil, err
+	}
+
+	if finishedAt.Valid {
+		report.FinishedAt = &finishedAt.Time
+	}
+
+	// 解析差异明细
+	if details != "" {
+		report.Details = &ParentStudentRelationDiff{}
+		if err := json.Unmarshal([]byte(details), report.Details); err != nil {
+			return nil, err
+		}
+	}
+
+	return &report, nil
+}
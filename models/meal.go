@@ -1,288 +1,280 @@
 package models
 
 import (
-	"database/sql"
 	"errors"
 	"fmt"
 	"math/rand"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/itsHenry35/canteen-management-system/config"
-	"github.com/itsHenry35/canteen-management-system/database"
 	"github.com/itsHenry35/canteen-management-system/utils"
 )
 
 // Meal 餐模型
 type Meal struct {
-	ID                 int       `json:"id"`
-	Name               string    `json:"name"`                 // 餐名
-	SelectionStartTime time.Time `json:"selection_start_time"` // 选餐开始时间
-	SelectionEndTime   time.Time `json:"selection_end_time"`   // 选餐结束时间
-	EffectiveStartDate time.Time `json:"effective_start_date"` // 领餐开始生效日期
-	EffectiveEndDate   time.Time `json:"effective_end_date"`   // 领餐结束生效日期
-	ImagePath          string    `json:"image_path"`           // 餐的图片地址
+	ID                 int             `json:"id"`
+	Name               string          `json:"name"`                  // 餐名
+	SelectionStartTime time.Time       `json:"selection_start_time"`  // 选餐开始时间
+	SelectionEndTime   time.Time       `json:"selection_end_time"`    // 选餐结束时间
+	EffectiveStartDate time.Time       `json:"effective_start_date"`  // 领餐开始生效日期
+	EffectiveEndDate   time.Time       `json:"effective_end_date"`    // 领餐结束生效日期
+	ImagePath          string          `json:"image_path"`            // 餐的图片地址
+	ReminderOffsets    ReminderOffsets `json:"reminder_offsets"`      // 选餐截止前的提醒时间，为空时使用系统设置
+	PriceA             int             `json:"price_a"`               // A餐每份价格（分）
+	PriceB             int             `json:"price_b"`               // B餐每份价格（分）
+	ArchivedAt         *time.Time      `json:"archived_at,omitempty"` // 归档时间，未归档时为空
 }
 
 // CreateMeal 创建新餐
-func CreateMeal(name string, selectionStartTime, selectionEndTime, effectiveStartDate, effectiveEndDate time.Time, imagePath string) (*Meal, error) {
-	// 校验时间
-	if err := validateMealTimes(0, selectionStartTime, selectionEndTime, effectiveStartDate, effectiveEndDate); err != nil {
+func CreateMeal(name string, selectionStartTime, selectionEndTime, effectiveStartDate, effectiveEndDate time.Time, imagePath string, reminderOffsets ReminderOffsets, priceA, priceB int) (*Meal, error) {
+	meal, err := createMeal(repos(), name, selectionStartTime, selectionEndTime, effectiveStartDate, effectiveEndDate, imagePath, reminderOffsets, priceA, priceB)
+	if err != nil {
 		return nil, err
 	}
 
-	// 获取数据库连接
-	db := database.GetDB()
+	// 通知订阅者
+	publishMealEvent(MealEvent{Type: MealEventCreated, MealID: meal.ID, Meal: meal})
 
-	// 开始事务
-	tx, err := db.Begin()
-	if err != nil {
-		return nil, err
-	}
-	defer tx.Rollback()
+	// 返回创建的餐
+	return meal, nil
+}
 
-	// 插入餐数据
-	result, err := tx.Exec(
-		"INSERT INTO meals (name, selection_start_time, selection_end_time, effective_start_date, effective_end_date, image_path) VALUES (?, ?, ?, ?, ?, ?)",
-		name, selectionStartTime.UTC(), selectionEndTime.UTC(), effectiveStartDate.UTC(), effectiveEndDate.UTC(), imagePath,
-	)
-	if err != nil {
+// createMeal 通过 r 校验并插入餐，不通知订阅者；在事务中调用时由调用方在提交后通知
+func createMeal(r *Repositories, name string, selectionStartTime, selectionEndTime, effectiveStartDate, effectiveEndDate time.Time, imagePath string, reminderOffsets ReminderOffsets, priceA, priceB int) (*Meal, error) {
+	// 校验时间
+	if err := validateMealTimes(r, 0, selectionStartTime, selectionEndTime, effectiveStartDate, effectiveEndDate); err != nil {
 		return nil, err
 	}
-
-	// 获取插入的 ID
-	mealID, err := result.LastInsertId()
-	if err != nil {
+	if err := reminderOffsets.Validate(); err != nil {
 		return nil, err
 	}
-
-	// 提交事务
-	if err := tx.Commit(); err != nil {
-		return nil, err
+	if priceA < 0 || priceB < 0 {
+		return nil, errors.New("价格不能为负数")
 	}
 
-	// 返回创建的餐
-	return &Meal{
-		ID:                 int(mealID),
+	// 插入餐数据
+	meal := &Meal{
 		Name:               name,
 		SelectionStartTime: selectionStartTime,
 		SelectionEndTime:   selectionEndTime,
 		EffectiveStartDate: effectiveStartDate,
 		EffectiveEndDate:   effectiveEndDate,
 		ImagePath:          imagePath,
-	}, nil
+		ReminderOffsets:    reminderOffsets,
+		PriceA:             priceA,
+		PriceB:             priceB,
+	}
+	if err := r.Meals.Create(meal); err != nil {
+		return nil, err
+	}
+
+	return meal, nil
 }
 
-// GetMealByID 通过ID获取餐
-func GetMealByID(id int) (*Meal, error) {
-	// 获取数据库连接
-	db := database.GetDB()
-
-	// 查询餐
-	var meal Meal
-	err := db.QueryRow(
-		"SELECT id, name, selection_start_time, selection_end_time, effective_start_date, effective_end_date, image_path FROM meals WHERE id = ?",
-		id,
-	).Scan(
-		&meal.ID, &meal.Name, &meal.SelectionStartTime, &meal.SelectionEndTime, &meal.EffectiveStartDate, &meal.EffectiveEndDate, &meal.ImagePath,
-	)
+// Price 获取餐食类型的每份价格（分）
+func (meal *Meal) Price(mealType MealType) int {
+	switch mealType {
+	case MealTypeA:
+		return meal.PriceA
+	case MealTypeB:
+		return meal.PriceB
+	}
+	return 0
+}
 
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("餐不存在")
+// ServingDates 领餐时间内的每个供餐日（服务器本地日期，YYYY-MM-DD），跳过校历中不供餐的日期
+func (meal *Meal) ServingDates() []string {
+	return currentCalendar().servingDates(meal)
+}
+
+// servingDates 按校历 cal 列出餐的领餐日期
+func (cal schoolCalendar) servingDates(meal *Meal) []string {
+	start := meal.EffectiveStartDate.In(time.Local)
+	end := meal.EffectiveEndDate.In(time.Local).Format(collectionDateLayout)
+	var dates []string
+	for day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.Local); day.Format(collectionDateLayout) <= end; day = day.AddDate(0, 0, 1) {
+		if serving, _ := cal.isServingDay(day.Format(collectionDateLayout)); serving {
+			dates = append(dates, day.Format(collectionDateLayout))
 		}
-		return nil, err
 	}
+	return dates
+}
 
-	return &meal, nil
+// GetMealByID 通过ID获取餐
+func GetMealByID(id int) (*Meal, error) {
+	meal, err := repos().Meals.GetByID(id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, errors.New("餐不存在")
+	}
+	return meal, err
 }
 
-// GetAllMeals 获取所有餐
+// GetAllMeals 获取所有未归档的餐
 func GetAllMeals() ([]*Meal, error) {
-	// 获取数据库连接
-	db := database.GetDB()
+	return repos().Meals.List()
+}
 
-	// 查询所有餐
-	rows, err := db.Query(
-		"SELECT id, name, selection_start_time, selection_end_time, effective_start_date, effective_end_date, image_path FROM meals ORDER BY effective_start_date",
-	)
+// GetArchivedMeals 获取领餐时间与 [from, to] 重叠的已归档餐，零值表示不限制
+func GetArchivedMeals(from, to time.Time) ([]*Meal, error) {
+	return repos().Meals.ListArchived(from, to)
+}
+
+// getMealsServedBetween 获取领餐日期与 [from, to]（服务器本地日期，均含）重叠的餐，包括已归档的餐，按领餐开始时间排序
+func getMealsServedBetween(r *Repositories, from, to time.Time) ([]*Meal, error) {
+	// 未归档的餐
+	meals, err := r.Meals.List()
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	// 处理结果
-	var meals []*Meal
-	for rows.Next() {
-		var meal Meal
-		err := rows.Scan(
-			&meal.ID, &meal.Name, &meal.SelectionStartTime, &meal.SelectionEndTime, &meal.EffectiveStartDate, &meal.EffectiveEndDate, &meal.ImagePath,
-		)
-		if err != nil {
-			return nil, err
+	// 已归档的餐
+	archived, err := r.Meals.ListArchived(from, to.AddDate(0, 0, 1).Add(-time.Nanosecond))
+	if err != nil {
+		return nil, err
+	}
+	meals = append(archived, meals...)
+
+	// 按本地日期比较
+	start := from.Format(collectionDateLayout)
+	end := to.Format(collectionDateLayout)
+	var served []*Meal
+	for _, meal := range meals {
+		if meal.EffectiveStartDate.In(time.Local).Format(collectionDateLayout) <= end &&
+			meal.EffectiveEndDate.In(time.Local).Format(collectionDateLayout) >= start {
+			served = append(served, meal)
 		}
-		meals = append(meals, &meal)
 	}
+	sort.Slice(served, func(i, j int) bool {
+		return served[i].EffectiveStartDate.Before(served[j].EffectiveStartDate)
+	})
 
-	return meals, nil
+	return served, nil
 }
 
 // GetCurrentAndFutureMeals 获取当前与未来的餐
 func GetCurrentAndFutureMeals() ([]*Meal, []*Meal, error) {
-	// 获取数据库连接
-	db := database.GetDB()
+	return repos().Meals.ListSelectable(time.Now())
+}
 
-	// 查询当前可选餐
-	rows, err := db.Query(
-		"SELECT id, name, selection_start_time, selection_end_time, effective_start_date, effective_end_date, image_path FROM meals WHERE selection_start_time <= CURRENT_TIMESTAMP AND selection_end_time >= CURRENT_TIMESTAMP ORDER BY effective_start_date",
-	)
-	if err != nil {
-		return nil, nil, err
+// UpdateMeal 更新餐，按选餐扣费时在同一事务中按新的价格和领餐日期调整已扣的费用，操作人为 operator
+func UpdateMeal(meal *Meal, operator string) error {
+	// 已归档的餐不能修改
+	if meal.ArchivedAt != nil {
+		return errors.New("已归档的餐不能修改")
 	}
-	defer rows.Close()
-
-	// 处理结果
-	var currentMeals []*Meal
-	for rows.Next() {
-		var meal Meal
-		err := rows.Scan(
-			&meal.ID, &meal.Name, &meal.SelectionStartTime, &meal.SelectionEndTime, &meal.EffectiveStartDate, &meal.EffectiveEndDate, &meal.ImagePath,
-		)
-		if err != nil {
-			return nil, nil, err
-		}
-		currentMeals = append(currentMeals, &meal)
+	if err := meal.ReminderOffsets.Validate(); err != nil {
+		return err
 	}
-
-	// 查询未来可选餐
-	rows, err = db.Query(
-		"SELECT id, name, selection_start_time, selection_end_time, effective_start_date, effective_end_date, image_path FROM meals WHERE selection_start_time > CURRENT_TIMESTAMP ORDER BY effective_start_date",
-	)
-	if err != nil {
-		return nil, nil, err
+	if meal.PriceA < 0 || meal.PriceB < 0 {
+		return errors.New("价格不能为负数")
 	}
-	defer rows.Close()
 
-	// 处理结果
-	var futureMeals []*Meal
-	for rows.Next() {
-		var meal Meal
-		err := rows.Scan(
-			&meal.ID, &meal.Name, &meal.SelectionStartTime, &meal.SelectionEndTime, &meal.EffectiveStartDate, &meal.EffectiveEndDate, &meal.ImagePath,
-		)
-		if err != nil {
-			return nil, nil, err
+	err := repos().InTx(func(r *Repositories) error {
+		// 校验时间
+		if err := validateMealTimes(r, meal.ID, meal.SelectionStartTime, meal.SelectionEndTime, meal.EffectiveStartDate, meal.EffectiveEndDate); err != nil {
+			return err
 		}
-		futureMeals = append(futureMeals, &meal)
-	}
 
-	return currentMeals, futureMeals, nil
-}
-
-// UpdateMeal 更新餐
-func UpdateMeal(meal *Meal) error {
-	// 校验时间
-	if err := validateMealTimes(meal.ID, meal.SelectionStartTime, meal.SelectionEndTime, meal.EffectiveStartDate, meal.EffectiveEndDate); err != nil {
+		// 更新餐数据并调整餐费
+		if err := r.Meals.Update(meal); err != nil {
+			return err
+		}
+		return recostMealCharges(r, meal, operator)
+	})
+	if err != nil {
 		return err
 	}
 
-	// 获取数据库连接
-	db := database.GetDB()
-
-	// 更新餐数据
-	_, err := db.Exec(
-		"UPDATE meals SET name = ?, selection_start_time = ?, selection_end_time = ?, effective_start_date = ?, effective_end_date = ?, image_path = ? WHERE id = ?",
-		meal.Name, meal.SelectionStartTime.UTC(), meal.SelectionEndTime.UTC(), meal.EffectiveStartDate.UTC(), meal.EffectiveEndDate.UTC(), meal.ImagePath, meal.ID,
-	)
+	// 通知订阅者
+	publishMealEvent(MealEvent{Type: MealEventUpdated, MealID: meal.ID, Meal: meal})
 
-	return err
+	return nil
 }
 
-// DeleteMeal 删除餐及相关数据
-func DeleteMeal(id int) error {
-	// 获取数据库连接
-	db := database.GetDB()
-
-	// 开始事务
-	tx, err := db.Begin()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
+// DeleteMeal 彻底删除餐及相关数据，在同一事务中退还尚未领餐的餐费，操作人为 operator
+func DeleteMeal(id int, operator string) error {
 	// 获取餐信息（为了获取图片路径）
-	var imagePath string
-	err = tx.QueryRow("SELECT image_path FROM meals WHERE id = ?", id).Scan(&imagePath)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return errors.New("餐不存在")
-		}
-		return err
-	}
-
-	// 删除学生选餐记录
-	_, err = tx.Exec("DELETE FROM meal_selections WHERE meal_id = ?", id)
+	meal, err := GetMealByID(id)
 	if err != nil {
 		return err
 	}
 
-	// 删除餐记录
-	_, err = tx.Exec("DELETE FROM meals WHERE id = ?", id)
+	// 退还餐费并删除餐及学生选餐记录
+	err = repos().InTx(func(r *Repositories) error {
+		if err := refundDeletedMeal(r, meal, operator); err != nil {
+			return fmt.Errorf("退还餐费失败: %v", err)
+		}
+		return r.Meals.Delete(id)
+	})
 	if err != nil {
 		return err
 	}
 
-	// 提交事务
-	if err := tx.Commit(); err != nil {
-		return err
-	}
-
 	// 如果有图片，则删除图片文件
-	if imagePath != "" {
+	if meal.ImagePath != "" {
 		// 获取图片的物理路径
-		physicalPath := "." + imagePath // 将URL路径转换为文件系统路径
+		physicalPath := "." + meal.ImagePath // 将URL路径转换为文件系统路径
 		// 删除图片文件
 		os.Remove(physicalPath)
 	}
 
+	// 通知订阅者
+	publishMealEvent(MealEvent{Type: MealEventDeleted, MealID: id})
+
 	return nil
 }
 
-// CleanupExpiredMeals 清理过期的餐
-func CleanupExpiredMeals() error {
-	// 获取数据库连接
-	db := database.GetDB()
-
+// ArchiveExpiredMeals 归档领餐已结束的餐，返回归档的餐数
+// 归档的餐、选餐记录和图片都会保留，用于之后的统计和结算
+func ArchiveExpiredMeals() (int, error) {
 	// 查询已过期的餐
 	now := time.Now()
-	rows, err := db.Query("SELECT id FROM meals WHERE effective_end_date < ?", now)
+	expiredMeals, err := repos().Meals.ListEndedBefore(now)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	defer rows.Close()
 
-	// 处理结果
-	var expiredMealIDs []int
-	for rows.Next() {
-		var id int
-		if err := rows.Scan(&id); err != nil {
-			return err
+	// 归档过期的餐
+	for i, meal := range expiredMeals {
+		if err := repos().Meals.Archive(meal.ID, now); err != nil {
+			return i, err
 		}
-		expiredMealIDs = append(expiredMealIDs, id)
+		archivedAt := now
+		meal.ArchivedAt = &archivedAt
+
+		// 通知订阅者
+		publishMealEvent(MealEvent{Type: MealEventArchived, MealID: meal.ID, Meal: meal})
 	}
 
-	// 删除过期的餐
-	for _, id := range expiredMealIDs {
-		if err := DeleteMeal(id); err != nil {
-			return err
+	return len(expiredMeals), nil
+}
+
+// PurgeArchivedMeals 彻底删除领餐结束超过 retentionDays 天的已归档餐及其选餐记录和图片，返回删除的餐数
+func PurgeArchivedMeals(retentionDays int) (int, error) {
+	if retentionDays < 1 {
+		return 0, errors.New("已归档餐食的保留天数必须大于0")
+	}
+
+	// 查询超过保留期限的已归档餐
+	archivedMeals, err := repos().Meals.ListArchivedEndedBefore(time.Now().AddDate(0, 0, -retentionDays))
+	if err != nil {
+		return 0, err
+	}
+
+	// 彻底删除
+	for i, meal := range archivedMeals {
+		if err := DeleteMeal(meal.ID, "系统"); err != nil {
+			return i, err
 		}
 	}
 
-	return nil
+	return len(archivedMeals), nil
 }
 
 // validateMealTimes 校验餐的时间
-func validateMealTimes(mealID int, selectionStartTime, selectionEndTime, effectiveStartDate, effectiveEndDate time.Time) error {
+func validateMealTimes(r *Repositories, mealID int, selectionStartTime, selectionEndTime, effectiveStartDate, effectiveEndDate time.Time) error {
 	// 1. 所有开始时间应早于结束时间
 	if !selectionStartTime.Before(selectionEndTime) {
 		return errors.New("选餐开始时间必须早于选餐结束时间")
@@ -305,16 +297,7 @@ func validateMealTimes(mealID int, selectionStartTime, selectionEndTime, effecti
 	}
 
 	// 5. 领餐开始结束区间不能与其他餐重叠
-	db := database.GetDB()
-	var count int
-	err := db.QueryRow(
-		`SELECT COUNT(*) FROM meals 
-		WHERE id != ? AND 
-		((effective_start_date <= ? AND effective_end_date >= ?) OR 
-		(effective_start_date <= ? AND effective_end_date >= ?) OR 
-		(effective_start_date >= ? AND effective_end_date <= ?))`,
-		mealID, effectiveStartDate, effectiveStartDate, effectiveEndDate, effectiveEndDate, effectiveStartDate, effectiveEndDate,
-	).Scan(&count)
+	count, err := r.Meals.CountOverlapping(mealID, effectiveStartDate, effectiveEndDate)
 	if err != nil {
 		return err
 	}
@@ -322,36 +305,48 @@ func validateMealTimes(mealID int, selectionStartTime, selectionEndTime, effecti
 		return errors.New("领餐时间区间与其他餐重叠")
 	}
 
+	// 6. 领餐时间内至少有一个供餐日
+	span := &Meal{EffectiveStartDate: effectiveStartDate, EffectiveEndDate: effectiveEndDate}
+	if len(span.ServingDates()) == 0 {
+		return errors.New("领餐时间内没有供餐日，请检查校历中的节假日和学期设置")
+	}
+
 	return nil
 }
 
-// NotifyUnselectedStudentsByMealId 根据餐ID发送提醒给未选餐的学生
-func NotifyUnselectedStudentsByMealId(mealID int) error {
+// NotifyUnselectedStudentsByMealId 根据餐ID发送提醒给未选餐的学生（不包括整个领餐时间都请假的学生），返回提醒的学生数
+func NotifyUnselectedStudentsByMealId(mealID int) (int, error) {
 	// 验证餐ID是否存在
 	meal, err := GetMealByID(mealID)
 	if err != nil {
-		return fmt.Errorf("未找到指定的餐: %v", err)
+		return 0, fmt.Errorf("未找到指定的餐: %v", err)
 	}
 
 	// 验证选餐时间
 	now := time.Now()
 	if now.Before(meal.SelectionStartTime) {
-		return fmt.Errorf("选餐尚未开始，不能发送提醒")
+		return 0, fmt.Errorf("选餐尚未开始，不能发送提醒")
 	}
 	if now.After(meal.SelectionEndTime) {
-		return fmt.Errorf("选餐已结束，不能发送提醒")
+		return 0, fmt.Errorf("选餐已结束，不能发送提醒")
 	}
 
 	// 获取所有学生
 	allStudents, err := GetAllStudents()
 	if err != nil {
-		return fmt.Errorf("获取学生列表失败: %v", err)
+		return 0, fmt.Errorf("获取学生列表失败: %v", err)
 	}
 
 	// 获取该餐的选餐记录
 	selections, err := GetMealSelectionsByMeal(mealID)
 	if err != nil {
-		return fmt.Errorf("获取选餐记录失败: %v", err)
+		return 0, fmt.Errorf("获取选餐记录失败: %v", err)
+	}
+
+	// 获取整个领餐时间都请假的学生
+	absentStudentIDs, err := getFullyAbsentStudents(meal)
+	if err != nil {
+		return 0, fmt.Errorf("获取请假记录失败: %v", err)
 	}
 
 	// 创建已选餐学生ID的集合
@@ -360,39 +355,99 @@ func NotifyUnselectedStudentsByMealId(mealID int) error {
 		selectedStudentIDs[selection.StudentID] = true
 	}
 
-	// 找出未选餐的学生
+	// 找出未选餐的学生，不包括请假的学生
 	var unselectedStudents []*Student
 	for _, student := range allStudents {
-		if !selectedStudentIDs[student.ID] {
+		if !selectedStudentIDs[student.ID] && !absentStudentIDs[student.ID] {
 			unselectedStudents = append(unselectedStudents, student)
 		}
 	}
 
 	// 如果没有未选餐的学生，直接返回
 	if len(unselectedStudents) == 0 {
-		return nil
+		return 0, nil
 	}
 
-	// 获取配置的域名
-	domain := config.Get().Website.Domain
-
 	// 构建钉钉通知消息
-	title := "选餐提醒"
-	markdown := fmt.Sprintf("## 选餐提醒\n\n# 亲爱的家长/同学，您尚未完成%s的选餐，请及时完成选餐。\n\n# 选餐截止时间为: %s",
-		meal.Name, meal.SelectionEndTime.Format("2006-01-02 15:04:05"))
+	card := utils.ActionCardMessage{
+		Title: "选餐提醒",
+		Markdown: fmt.Sprintf("## 选餐提醒\n\n# 亲爱的家长/同学，您尚未完成%s的选餐，请及时完成选餐。\n\n# 选餐截止时间为: %s",
+			meal.Name, meal.SelectionEndTime.Format("2006-01-02 15:04:05")),
+	}
+
+	// 发送通知
+	if err := notifyStudentsAndParents(unselectedStudents, card); err != nil {
+		return 0, fmt.Errorf("发送未选餐提醒失败: %v", err)
+	}
+
+	return len(unselectedStudents), nil
+}
+
+// NotifySelectionOpenedByMealId 在选餐开始时通知所有学生及家长（不包括整个领餐时间都请假的学生），返回通知的学生数
+func NotifySelectionOpenedByMealId(mealID int) (int, error) {
+	// 验证餐ID是否存在
+	meal, err := GetMealByID(mealID)
+	if err != nil {
+		return 0, fmt.Errorf("未找到指定的餐: %v", err)
+	}
+
+	// 验证选餐时间
+	now := time.Now()
+	if now.Before(meal.SelectionStartTime) {
+		return 0, fmt.Errorf("选餐尚未开始，不能发送通知")
+	}
+	if now.After(meal.SelectionEndTime) {
+		return 0, fmt.Errorf("选餐已结束，不能发送通知")
+	}
 
+	// 获取所有学生
+	allStudents, err := GetAllStudents()
+	if err != nil {
+		return 0, fmt.Errorf("获取学生列表失败: %v", err)
+	}
+
+	// 不通知整个领餐时间都请假的学生
+	absentStudentIDs, err := getFullyAbsentStudents(meal)
+	if err != nil {
+		return 0, fmt.Errorf("获取请假记录失败: %v", err)
+	}
+	var students []*Student
+	for _, student := range allStudents {
+		if !absentStudentIDs[student.ID] {
+			students = append(students, student)
+		}
+	}
+	if len(students) == 0 {
+		return 0, nil
+	}
+
+	// 构建钉钉通知消息
 	card := utils.ActionCardMessage{
-		Title:       title,
-		Markdown:    markdown,
-		SingleTitle: "查看详情",
-		SingleURL:   fmt.Sprintf("%s/dingtalk_auth", domain),
+		Title: "选餐开始",
+		Markdown: fmt.Sprintf("## 选餐开始\n\n# 亲爱的家长/同学，%s已开放选餐，请及时完成选餐。\n\n# 选餐截止时间为: %s",
+			meal.Name, meal.SelectionEndTime.Format("2006-01-02 15:04:05")),
 	}
 
+	// 发送通知
+	if err := notifyStudentsAndParents(students, card); err != nil {
+		return 0, fmt.Errorf("发送选餐开始通知失败: %v", err)
+	}
+
+	return len(students), nil
+}
+
+// notifyStudentsAndParents 向学生及其家长发送钉钉卡片消息，卡片链接指向钉钉登录页
+func notifyStudentsAndParents(students []*Student, card utils.ActionCardMessage) error {
+	// 获取配置的域名
+	domain := config.Get().Website.Domain
+	card.SingleTitle = "查看详情"
+	card.SingleURL = fmt.Sprintf("%s/dingtalk_auth", domain)
+
 	// 收集所有钉钉ID（学生和家长）
 	dingTalkIDs := make([]string, 0)
 
 	// 处理学生钉钉ID和家长钉钉ID
-	for _, student := range unselectedStudents {
+	for _, student := range students {
 		// 添加学生钉钉ID
 		if student.DingTalkID != "" && student.DingTalkID != "0" {
 			dingTalkIDs = append(dingTalkIDs, student.DingTalkID)
@@ -412,22 +467,24 @@ func NotifyUnselectedStudentsByMealId(mealID int) error {
 		}
 	}
 
-	// 如果有需要通知的人
-	if len(dingTalkIDs) > 0 {
-		// 发送通知
-		err := utils.SendDingTalkActionCard(dingTalkIDs, card)
-		if err != nil {
-			return fmt.Errorf("发送未选餐提醒失败: %v", err)
-		}
-	} else {
+	// 如果没有需要通知的人，只记录日志
+	if len(dingTalkIDs) == 0 {
 		utils.LogError("没有找到需要通知的学生或家长")
+		return nil
 	}
 
-	return nil
+	// 发送通知
+	return utils.SendDingTalkActionCard(dingTalkIDs, card)
 }
 
-// BatchSelectMealsRandomly 随机批量选餐（将未选餐学生随机分为A餐和B餐）
+// BatchSelectMealsRandomly 随机批量选餐（将未选餐学生随机分为A餐和B餐），整个领餐时间都请假的学生不选餐
 func BatchSelectMealsRandomly(mealID int) (int, error) {
+	// 获取整个领餐时间都请假的学生
+	absentStudentIDs, err := GetFullyAbsentStudentIDs(mealID)
+	if err != nil {
+		return 0, fmt.Errorf("获取请假记录失败: %v", err)
+	}
+
 	// 获取所有学生
 	allStudents, err := GetAllStudents()
 	if err != nil {
@@ -446,10 +503,10 @@ func BatchSelectMealsRandomly(mealID int) (int, error) {
 		selectedStudentIDs[selection.StudentID] = true
 	}
 
-	// 找出未选餐的学生
+	// 找出未选餐的学生，不包括请假的学生
 	var unselectedStudentIDs []int
 	for _, student := range allStudents {
-		if !selectedStudentIDs[student.ID] {
+		if !selectedStudentIDs[student.ID] && !absentStudentIDs[student.ID] {
 			unselectedStudentIDs = append(unselectedStudentIDs, student.ID)
 		}
 	}
@@ -470,13 +527,13 @@ func BatchSelectMealsRandomly(mealID int) (int, error) {
 	groupB := unselectedStudentIDs[midPoint:]
 
 	// 批量选A餐
-	countA, err := BatchSelectMeals(groupA, mealID, MealTypeA, "系统")
+	countA, err := BatchSelectMeals(groupA, mealID, MealTypeA, "系统", SelectionSourceScheduler)
 	if err != nil {
 		return 0, fmt.Errorf("为A组学生批量选餐失败: %v", err)
 	}
 
 	// 批量选B餐
-	countB, err := BatchSelectMeals(groupB, mealID, MealTypeB, "系统")
+	countB, err := BatchSelectMeals(groupB, mealID, MealTypeB, "系统", SelectionSourceScheduler)
 	if err != nil {
 		return countA, fmt.Errorf("为B组学生批量选餐失败: %v", err)
 	}
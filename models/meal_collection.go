@@ -0,0 +1,117 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/database"
+)
+
+// collectionDateLayout 取餐日期格式
+const collectionDateLayout = "2006-01-02"
+
+// MealCollection 取餐记录，每名学生每天最多一条
+type MealCollection struct {
+	ID             int       `json:"id"`
+	StudentID      int       `json:"student_id"`
+	MealID         int       `json:"meal_id"`
+	MealType       MealType  `json:"meal_type"`
+	CollectionDate string    `json:"collection_date"` // 取餐日期（服务器本地日期），如 2025-03-10
+	CollectedAt    time.Time `json:"collected_at"`
+	Operator       string    `json:"operator"` // 扫码的食堂工作人员
+}
+
+// RecordMealCollection 记录学生按选餐取餐，同时更新学生的最后取餐日期
+// 当天已有取餐记录时不重复记录，返回 false
+func RecordMealCollection(student *Student, selection *MealSelection, operator string, now time.Time) (bool, error) {
+	// 按取餐扣费时获取餐的价格
+	var meal *Meal
+	if billingChargesOn(ChargeOnCollection) {
+		var err error
+		if meal, err = GetMealByID(selection.MealID); err != nil {
+			return false, err
+		}
+	}
+
+	// 获取数据库连接
+	db := database.GetDB()
+
+	// 开始事务
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// 插入取餐记录，同一天已取餐时忽略
+	result, err := tx.Exec(
+		tx.Dialect().InsertIgnore(`INSERT INTO meal_collections (student_id, meal_id, meal_type, collection_date, collected_at, operator)
+		VALUES (?, ?, ?, ?, ?, ?)`),
+		student.ID, selection.MealID, selection.MealType, now.Format(collectionDateLayout), now.UTC(), operator,
+	)
+	if err != nil {
+		return false, err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return false, err
+	}
+
+	// 扣费，余额不足时允许为负，不影响取餐
+	if err := chargeCollection(newSQLRepositories(tx), meal, student.ID, selection.MealType, now.Format(collectionDateLayout), operator); err != nil {
+		return false, err
+	}
+
+	// 更新学生的最后取餐日期
+	if _, err := tx.Exec("UPDATE students SET last_meal_collection_date = ? WHERE id = ?", now, student.ID); err != nil {
+		return false, err
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	student.LastMealCollectionDate = &now
+	return true, nil
+}
+
+// GetMealCollections 获取餐的取餐记录，dates 不为空时只返回这些日期的记录
+func GetMealCollections(mealID int, dates ...string) ([]*MealCollection, error) {
+	// 获取数据库连接
+	db := database.GetDB()
+
+	// 构建查询条件
+	query := `SELECT id, student_id, meal_id, meal_type, collection_date, collected_at, operator
+		FROM meal_collections WHERE meal_id = ?`
+	args := []interface{}{mealID}
+	if len(dates) > 0 {
+		query += " AND collection_date IN (?" + strings.Repeat(", ?", len(dates)-1) + ")"
+		for _, date := range dates {
+			args = append(args, date)
+		}
+	}
+	query += " ORDER BY id"
+
+	// 查询记录
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// 处理结果
+	collections := []*MealCollection{}
+	for rows.Next() {
+		var collection MealCollection
+		err := rows.Scan(
+			&collection.ID, &collection.StudentID, &collection.MealID, &collection.MealType,
+			&collection.CollectionDate, &collection.CollectedAt, &collection.Operator,
+		)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, &collection)
+	}
+
+	return collections, rows.Err()
+}
@@ -0,0 +1,43 @@
+package models
+
+import "sync"
+
+// 餐生命周期事件类型
+const (
+	MealEventCreated  = "created"  // 餐已创建
+	MealEventUpdated  = "updated"  // 餐已更新
+	MealEventDeleted  = "deleted"  // 餐已删除
+	MealEventArchived = "archived" // 餐已归档
+)
+
+// MealEvent 餐生命周期事件
+type MealEvent struct {
+	Type   string
+	MealID int
+	Meal   *Meal // 删除事件中为 nil
+}
+
+// 事件订阅者
+var (
+	mealEventHandlers      []func(MealEvent)
+	mealEventHandlersMutex sync.RWMutex
+)
+
+// SubscribeMealEvents 订阅餐的创建、更新和删除事件，事件在数据提交后同步通知
+func SubscribeMealEvents(handler func(MealEvent)) {
+	mealEventHandlersMutex.Lock()
+	defer mealEventHandlersMutex.Unlock()
+	mealEventHandlers = append(mealEventHandlers, handler)
+}
+
+// publishMealEvent 通知所有订阅者
+func publishMealEvent(event MealEvent) {
+	mealEventHandlersMutex.RLock()
+	handlers := make([]func(MealEvent), len(mealEventHandlers))
+	copy(handlers, mealEventHandlers)
+	mealEventHandlersMutex.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
@@ -0,0 +1,175 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// MealExportFilter 选餐导出条件，为空的条件不参与筛选
+type MealExportFilter struct {
+	Class string
+	Date  string // 取餐日期（YYYY-MM-DD），指定时取餐状态只统计这一天
+}
+
+// MealExportRow 导出的一名学生
+type MealExportRow struct {
+	Student        *Student
+	Selection      *MealSelection // 未选餐时为空
+	CollectedDates []string       // 取餐日期
+	CollectedAt    *time.Time     // 最近一次取餐时间
+}
+
+// Collected 是否已取餐
+func (row *MealExportRow) Collected() bool {
+	return len(row.CollectedDates) > 0
+}
+
+// MealExportClassSummary 班级汇总
+type MealExportClassSummary struct {
+	Class        string
+	Students     int
+	TypeA        int
+	TypeB        int
+	Unselected   int
+	Collected    int // 已取餐人数
+	NotCollected int // 已选餐但未取餐的人数
+}
+
+// MealExportOptionTotal 选项汇总，MealType 为空表示未选餐
+type MealExportOptionTotal struct {
+	MealType     MealType
+	Students     int
+	Collected    int
+	NotCollected int
+}
+
+// MealExport 一个餐的选餐和取餐导出数据
+type MealExport struct {
+	Meal    *Meal
+	Filter  MealExportFilter
+	Rows    []*MealExportRow          // 按班级、姓名排序
+	Classes []*MealExportClassSummary // 按班级排序
+	Options []*MealExportOptionTotal  // A餐、B餐、未选餐
+}
+
+// BuildMealExport 汇总一个餐的选餐和取餐情况，包括在读学生和已归档但有选餐的学生
+func BuildMealExport(mealID int, filter MealExportFilter) (*MealExport, error) {
+	// 获取餐
+	meal, err := GetMealByID(mealID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 验证日期在领餐时间范围内
+	if filter.Date != "" {
+		date, err := time.ParseInLocation(collectionDateLayout, filter.Date, time.Local)
+		if err != nil {
+			return nil, errors.New("无效的日期")
+		}
+		start := meal.EffectiveStartDate.In(time.Local).Format(collectionDateLayout)
+		end := meal.EffectiveEndDate.In(time.Local).Format(collectionDateLayout)
+		if day := date.Format(collectionDateLayout); day < start || day > end {
+			return nil, errors.New("日期不在该餐的领餐时间范围内")
+		}
+	}
+
+	// 获取选餐记录
+	selections, err := repos().Selections.ListByMeal(mealID)
+	if err != nil {
+		return nil, err
+	}
+	selectionByStudent := make(map[int]*MealSelection)
+	for _, selection := range selections {
+		selectionByStudent[selection.StudentID] = selection
+	}
+
+	// 获取取餐记录
+	var dates []string
+	if filter.Date != "" {
+		dates = append(dates, filter.Date)
+	}
+	collections, err := GetMealCollections(mealID, dates...)
+	if err != nil {
+		return nil, err
+	}
+	collectionsByStudent := make(map[int][]*MealCollection)
+	for _, collection := range collections {
+		collectionsByStudent[collection.StudentID] = append(collectionsByStudent[collection.StudentID], collection)
+	}
+
+	// 获取学生，已归档的学生只在有选餐时导出
+	students, err := GetStudentsIncludingArchived()
+	if err != nil {
+		return nil, err
+	}
+
+	export := &MealExport{Meal: meal, Filter: filter}
+	classes := make(map[string]*MealExportClassSummary)
+	options := map[MealType]*MealExportOptionTotal{
+		MealTypeA: {MealType: MealTypeA},
+		MealTypeB: {MealType: MealTypeB},
+		"":        {},
+	}
+	for _, student := range students {
+		selection := selectionByStudent[student.ID]
+		if student.Archived && selection == nil {
+			continue
+		}
+		if filter.Class != "" && student.Class != filter.Class {
+			continue
+		}
+
+		// 学生明细
+		row := &MealExportRow{Student: student, Selection: selection}
+		for _, collection := range collectionsByStudent[student.ID] {
+			row.CollectedDates = append(row.CollectedDates, collection.CollectionDate)
+			collectedAt := collection.CollectedAt
+			row.CollectedAt = &collectedAt
+		}
+		export.Rows = append(export.Rows, row)
+
+		// 班级汇总
+		summary, ok := classes[student.Class]
+		if !ok {
+			summary = &MealExportClassSummary{Class: student.Class}
+			classes[student.Class] = summary
+		}
+		summary.Students++
+
+		// 选项汇总
+		var mealType MealType
+		if selection != nil {
+			mealType = selection.MealType
+		}
+		option := options[mealType]
+		option.Students++
+
+		switch {
+		case selection == nil:
+			summary.Unselected++
+		case selection.MealType == MealTypeA:
+			summary.TypeA++
+		case selection.MealType == MealTypeB:
+			summary.TypeB++
+		}
+		if row.Collected() {
+			summary.Collected++
+			option.Collected++
+		} else if selection != nil {
+			summary.NotCollected++
+			option.NotCollected++
+		}
+	}
+
+	// 班级按名称排序，学生已按班级和姓名排序
+	for _, summary := range classes {
+		export.Classes = append(export.Classes, summary)
+	}
+	sort.Slice(export.Classes, func(i, j int) bool {
+		return export.Classes[i].Class < export.Classes[j].Class
+	})
+	export.Options = []*MealExportOptionTotal{options[MealTypeA], options[MealTypeB], options[""]}
+
+	return export, nil
+}
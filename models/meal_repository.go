@@ -0,0 +1,194 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/database"
+)
+
+// sqlMealRepository 基于 SQL 数据库的餐数据访问
+type sqlMealRepository struct {
+	db database.Conn
+}
+
+const mealColumns = "id, name, selection_start_time, selection_end_time, effective_start_date, effective_end_date, image_path, reminder_offsets, price_a, price_b, archived_at"
+
+// scanMeal 读取一行餐数据
+func scanMeal(row interface{ Scan(...interface{}) error }) (*Meal, error) {
+	var meal Meal
+	var archivedAt sql.NullTime
+	err := row.Scan(
+		&meal.ID, &meal.Name, &meal.SelectionStartTime, &meal.SelectionEndTime,
+		&meal.EffectiveStartDate, &meal.EffectiveEndDate, &meal.ImagePath, &meal.ReminderOffsets,
+		&meal.PriceA, &meal.PriceB, &archivedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	if archivedAt.Valid {
+		meal.ArchivedAt = &archivedAt.Time
+	}
+
+	return &meal, nil
+}
+
+// queryMeals 查询多条餐数据
+func (r *sqlMealRepository) queryMeals(query string, args ...interface{}) ([]*Meal, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var meals []*Meal
+	for rows.Next() {
+		meal, err := scanMeal(rows)
+		if err != nil {
+			return nil, err
+		}
+		meals = append(meals, meal)
+	}
+
+	return meals, rows.Err()
+}
+
+func (r *sqlMealRepository) Create(meal *Meal) error {
+	// 插入餐数据，时间统一按 UTC 保存
+	id, err := r.db.InsertID(
+		"INSERT INTO meals (name, selection_start_time, selection_end_time, effective_start_date, effective_end_date, image_path, reminder_offsets, price_a, price_b) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		meal.Name, meal.SelectionStartTime.UTC(), meal.SelectionEndTime.UTC(), meal.EffectiveStartDate.UTC(), meal.EffectiveEndDate.UTC(), meal.ImagePath, meal.ReminderOffsets, meal.PriceA, meal.PriceB,
+	)
+	if err != nil {
+		return err
+	}
+
+	meal.ID = int(id)
+	return nil
+}
+
+func (r *sqlMealRepository) GetByID(id int) (*Meal, error) {
+	return scanMeal(r.db.QueryRow("SELECT "+mealColumns+" FROM meals WHERE id = ?", id))
+}
+
+func (r *sqlMealRepository) GetEffectiveAt(t time.Time) (*Meal, error) {
+	t = t.UTC()
+	return scanMeal(r.db.QueryRow(
+		"SELECT "+mealColumns+" FROM meals WHERE effective_start_date <= ? AND effective_end_date >= ? ORDER BY effective_start_date LIMIT 1",
+		t, t,
+	))
+}
+
+func (r *sqlMealRepository) List() ([]*Meal, error) {
+	return r.queryMeals("SELECT " + mealColumns + " FROM meals WHERE archived_at IS NULL ORDER BY effective_start_date")
+}
+
+func (r *sqlMealRepository) ListArchived(from, to time.Time) ([]*Meal, error) {
+	query := "SELECT " + mealColumns + " FROM meals WHERE archived_at IS NOT NULL"
+	var args []interface{}
+
+	// 领餐时间与 [from, to] 重叠，零值表示不限制
+	if !from.IsZero() {
+		query += " AND effective_end_date >= ?"
+		args = append(args, from.UTC())
+	}
+	if !to.IsZero() {
+		query += " AND effective_start_date <= ?"
+		args = append(args, to.UTC())
+	}
+
+	return r.queryMeals(query+" ORDER BY effective_start_date", args...)
+}
+
+func (r *sqlMealRepository) ListSelectable(now time.Time) ([]*Meal, []*Meal, error) {
+	now = now.UTC()
+
+	// 查询当前可选餐
+	current, err := r.queryMeals(
+		"SELECT "+mealColumns+" FROM meals WHERE archived_at IS NULL AND selection_start_time <= ? AND selection_end_time >= ? ORDER BY effective_start_date",
+		now, now,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 查询未来可选餐
+	future, err := r.queryMeals(
+		"SELECT "+mealColumns+" FROM meals WHERE archived_at IS NULL AND selection_start_time > ? ORDER BY effective_start_date",
+		now,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return current, future, nil
+}
+
+func (r *sqlMealRepository) ListEndedBefore(t time.Time) ([]*Meal, error) {
+	return r.queryMeals("SELECT "+mealColumns+" FROM meals WHERE archived_at IS NULL AND effective_end_date < ? ORDER BY effective_start_date", t.UTC())
+}
+
+func (r *sqlMealRepository) ListArchivedEndedBefore(t time.Time) ([]*Meal, error) {
+	return r.queryMeals("SELECT "+mealColumns+" FROM meals WHERE archived_at IS NOT NULL AND effective_end_date < ? ORDER BY effective_start_date", t.UTC())
+}
+
+func (r *sqlMealRepository) CountOverlapping(excludeID int, start, end time.Time) (int, error) {
+	start, end = start.UTC(), end.UTC()
+
+	var count int
+	err := r.db.QueryRow(
+		`SELECT COUNT(*) FROM meals
+		WHERE id != ? AND
+		((effective_start_date <= ? AND effective_end_date >= ?) OR
+		(effective_start_date <= ? AND effective_end_date >= ?) OR
+		(effective_start_date >= ? AND effective_end_date <= ?))`,
+		excludeID, start, start, end, end, start, end,
+	).Scan(&count)
+
+	return count, err
+}
+
+func (r *sqlMealRepository) Update(meal *Meal) error {
+	_, err := r.db.Exec(
+		"UPDATE meals SET name = ?, selection_start_time = ?, selection_end_time = ?, effective_start_date = ?, effective_end_date = ?, image_path = ?, reminder_offsets = ?, price_a = ?, price_b = ? WHERE id = ?",
+		meal.Name, meal.SelectionStartTime.UTC(), meal.SelectionEndTime.UTC(), meal.EffectiveStartDate.UTC(), meal.EffectiveEndDate.UTC(), meal.ImagePath, meal.ReminderOffsets, meal.PriceA, meal.PriceB, meal.ID,
+	)
+	return err
+}
+
+func (r *sqlMealRepository) Archive(id int, at time.Time) error {
+	_, err := r.db.Exec("UPDATE meals SET archived_at = ? WHERE id = ? AND archived_at IS NULL", at.UTC(), id)
+	return err
+}
+
+func (r *sqlMealRepository) Delete(id int) error {
+	return database.WithTx(r.db, func(tx *database.Tx) error {
+		return deleteMeal(tx, id)
+	})
+}
+
+// deleteMeal 在事务中删除餐及其选餐记录、变更历史、取餐记录和餐模板的生成记录
+func deleteMeal(tx *database.Tx, id int) error {
+	// 删除学生选餐记录、变更历史、取餐记录和餐模板的生成记录
+	if _, err := tx.Exec("DELETE FROM meal_selections WHERE meal_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM meal_selection_history WHERE meal_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM meal_collections WHERE meal_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM meal_template_meals WHERE meal_id = ?", id); err != nil {
+		return err
+	}
+
+	// 删除餐记录
+	_, err := tx.Exec("DELETE FROM meals WHERE id = ?", id)
+	return err
+}
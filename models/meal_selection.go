@@ -1,16 +1,23 @@
 package models
 
 import (
-	"database/sql"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/itsHenry35/canteen-management-system/config"
-	"github.com/itsHenry35/canteen-management-system/database"
 	"github.com/itsHenry35/canteen-management-system/utils"
 )
 
+// 选餐来源
+const (
+	SelectionSourceStudent   = "student"   // 学生本人
+	SelectionSourceParent    = "parent"    // 家长，操作人为家长与学生的关系
+	SelectionSourceAdmin     = "admin"     // 管理员批量选餐
+	SelectionSourceScheduler = "scheduler" // 定时任务自动选餐
+	SelectionSourceImport    = "import"    // 管理员导入
+)
+
 // MealSelection 学生选餐记录
 type MealSelection struct {
 	ID        int       `json:"id"`
@@ -19,20 +26,35 @@ type MealSelection struct {
 	MealType  MealType  `json:"meal_type"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Operator  string    `json:"operator"`
+	Source    string    `json:"source"` // 选餐来源，早于记录来源的选餐为空
 	Student   *Student  `json:"student,omitempty"`
 	Meal      *Meal     `json:"meal,omitempty"`
 }
 
-// CreateMealSelection 创建学生选餐记录
-func CreateMealSelection(studentID, mealID int, mealType MealType, validateMealTime bool, operator string) (*MealSelection, error) {
-	// 获取数据库连接
-	db := database.GetDB()
+// MealSelectionHistory 选餐变更历史，每次保存选餐时追加一条
+type MealSelectionHistory struct {
+	ID               int       `json:"id"`
+	StudentID        int       `json:"student_id"`
+	MealID           int       `json:"meal_id"`
+	PreviousMealType MealType  `json:"previous_meal_type"` // 原选餐，首次选餐时为空
+	NewMealType      MealType  `json:"new_meal_type"`
+	Operator         string    `json:"operator"`
+	Source           string    `json:"source"`
+	CreatedAt        time.Time `json:"created_at"`
+	StudentName      string    `json:"student_name,omitempty"`
+	MealName         string    `json:"meal_name,omitempty"`
+}
 
+// CreateMealSelection 创建学生选餐记录，source 为选餐来源
+func CreateMealSelection(studentID, mealID int, mealType MealType, validateMealTime bool, operator, source string) (*MealSelection, error) {
 	// 验证餐ID是否存在
 	meal, err := GetMealByID(mealID)
 	if err != nil {
 		return nil, err
 	}
+	if meal.ArchivedAt != nil {
+		return nil, errors.New("餐已归档，不能修改选餐")
+	}
 
 	// 验证学生ID是否存在
 	student, err := GetStudentByID(studentID)
@@ -49,86 +71,42 @@ func CreateMealSelection(studentID, mealID int, mealType MealType, validateMealT
 		}
 	}
 
-	// 开始事务
-	tx, err := db.Begin()
-	if err != nil {
-		return nil, err
-	}
-	defer tx.Rollback()
-
-	// 检查是否已经有选餐记录
-	var count int
-	err = tx.QueryRow("SELECT COUNT(*) FROM meal_selections WHERE student_id = ? AND meal_id = ?", studentID, mealID).Scan(&count)
-	if err != nil {
-		return nil, err
-	}
-
-	var result sql.Result
-	if count > 0 {
-		// 更新已有记录
-		result, err = tx.Exec(
-			"UPDATE meal_selections SET meal_type = ?, updated_time = CURRENT_TIMESTAMP, operator = ? WHERE student_id = ? AND meal_id = ?",
-			mealType, operator, studentID, mealID,
-		)
-	} else {
-		// 插入新记录
-		result, err = tx.Exec(
-			"INSERT INTO meal_selections (student_id, meal_id, meal_type, operator) VALUES (?, ?, ?, ?)",
-			studentID, mealID, mealType, operator,
-		)
-	}
-
-	if err != nil {
-		return nil, err
+	// 在单个事务中检查余额、新增或更新选餐记录并扣费
+	selection := &MealSelection{
+		StudentID: studentID,
+		MealID:    mealID,
+		MealType:  mealType,
+		Operator:  operator,
+		Source:    source,
 	}
-
-	// 如果是插入新记录，获取插入的ID
-	var selectionID int64
-	if count == 0 {
-		selectionID, err = result.LastInsertId()
-		if err != nil {
-			return nil, err
+	err = repos().InTx(func(r *Repositories) error {
+		// 学生或家长选餐时检查余额
+		if source == SelectionSourceStudent || source == SelectionSourceParent {
+			if err := checkSelectionBalance(r, studentID, meal, mealType); err != nil {
+				return err
+			}
 		}
-	} else {
-		// 如果是更新记录，获取现有记录的ID
-		err = tx.QueryRow("SELECT id FROM meal_selections WHERE student_id = ? AND meal_id = ?", studentID, mealID).Scan(&selectionID)
-		if err != nil {
-			return nil, err
+		if err := r.Selections.Save(selection); err != nil {
+			return err
 		}
-	}
-
-	// 提交事务
-	if err := tx.Commit(); err != nil {
+		return chargeSelections(r, meal, []*MealSelection{selection})
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	// 成功完成，返回选餐记录
-	return &MealSelection{
-		ID:        int(selectionID),
-		StudentID: studentID,
-		MealID:    mealID,
-		MealType:  mealType,
-		Student:   student,
-		Meal:      meal,
-	}, nil
+	selection.Student = student
+	selection.Meal = meal
+	return selection, nil
 }
 
 // GetMealSelectionByStudentAndMeal 根据学生ID和餐ID获取选餐记录
 func GetMealSelectionByStudentAndMeal(studentID, mealID int) (*MealSelection, error) {
-	// 获取数据库连接
-	db := database.GetDB()
-
 	// 查询选餐记录
-	var selection MealSelection
-	err := db.QueryRow(
-		"SELECT id, student_id, meal_id, meal_type, updated_time, operator FROM meal_selections WHERE student_id = ? AND meal_id = ?",
-		studentID, mealID,
-	).Scan(
-		&selection.ID, &selection.StudentID, &selection.MealID, &selection.MealType, &selection.UpdatedAt, &selection.Operator,
-	)
-
+	selection, err := repos().Selections.GetByStudentAndMeal(studentID, mealID)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, ErrNotFound) {
 			return nil, nil // 返回nil表示没有记录
 		}
 		return nil, err
@@ -146,35 +124,49 @@ func GetMealSelectionByStudentAndMeal(studentID, mealID int) (*MealSelection, er
 		selection.Meal = meal
 	}
 
-	return &selection, nil
+	return selection, nil
 }
 
-// GetMealSelectionsByStudent 获取学生的所有选餐记录
-func GetMealSelectionsByStudent(studentID int) ([]*MealSelection, error) {
-	// 获取数据库连接
-	db := database.GetDB()
-
-	// 查询学生的所有选餐记录
-	rows, err := db.Query(
-		"SELECT id, student_id, meal_id, meal_type, updated_time, operator FROM meal_selections WHERE student_id = ?",
-		studentID,
-	)
+// GetMealSelectionHistory 获取选餐变更历史，studentID 或 mealID 为0时不按该条件筛选
+func GetMealSelectionHistory(studentID, mealID int) ([]*MealSelectionHistory, error) {
+	// 查询变更历史
+	history, err := repos().Selections.ListHistory(studentID, mealID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	// 处理结果
-	var selections []*MealSelection
-	for rows.Next() {
-		var selection MealSelection
-		err := rows.Scan(
-			&selection.ID, &selection.StudentID, &selection.MealID, &selection.MealType, &selection.UpdatedAt, &selection.Operator,
-		)
-		if err != nil {
-			return nil, err
+	// 加载学生姓名和餐名称
+	students := make(map[int]*Student)
+	meals := make(map[int]*Meal)
+	for _, entry := range history {
+		student, ok := students[entry.StudentID]
+		if !ok {
+			student, _ = GetStudentByID(entry.StudentID)
+			students[entry.StudentID] = student
+		}
+		if student != nil {
+			entry.StudentName = student.FullName
+		}
+
+		meal, ok := meals[entry.MealID]
+		if !ok {
+			meal, _ = GetMealByID(entry.MealID)
+			meals[entry.MealID] = meal
+		}
+		if meal != nil {
+			entry.MealName = meal.Name
 		}
-		selections = append(selections, &selection)
+	}
+
+	return history, nil
+}
+
+// GetMealSelectionsByStudent 获取学生的所有选餐记录
+func GetMealSelectionsByStudent(studentID int) ([]*MealSelection, error) {
+	// 查询学生的所有选餐记录
+	selections, err := repos().Selections.ListByStudent(studentID)
+	if err != nil {
+		return nil, err
 	}
 
 	// 加载每个选餐记录的餐信息
@@ -190,31 +182,11 @@ func GetMealSelectionsByStudent(studentID int) ([]*MealSelection, error) {
 
 // GetMealSelectionsByMeal 获取餐的所有选餐记录
 func GetMealSelectionsByMeal(mealID int) ([]*MealSelection, error) {
-	// 获取数据库连接
-	db := database.GetDB()
-
 	// 查询餐的所有选餐记录
-	rows, err := db.Query(
-		"SELECT id, student_id, meal_id, meal_type FROM meal_selections WHERE meal_id = ?",
-		mealID,
-	)
+	selections, err := repos().Selections.ListByMeal(mealID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	// 处理结果
-	var selections []*MealSelection
-	for rows.Next() {
-		var selection MealSelection
-		err := rows.Scan(
-			&selection.ID, &selection.StudentID, &selection.MealID, &selection.MealType,
-		)
-		if err != nil {
-			return nil, err
-		}
-		selections = append(selections, &selection)
-	}
 
 	// 加载每个选餐记录的学生信息
 	for _, selection := range selections {
@@ -227,63 +199,42 @@ func GetMealSelectionsByMeal(mealID int) ([]*MealSelection, error) {
 	return selections, nil
 }
 
-// BatchSelectMeals 批量为学生选餐
-func BatchSelectMeals(studentIDs []int, mealID int, mealType MealType, operator string) (int, error) {
-	// 获取数据库连接
-	db := database.GetDB()
-
+// BatchSelectMeals 批量为学生选餐，source 为选餐来源
+func BatchSelectMeals(studentIDs []int, mealID int, mealType MealType, operator, source string) (int, error) {
 	// 验证餐ID是否存在
 	meal, err := GetMealByID(mealID)
 	if err != nil {
 		return 0, err
 	}
-
-	// 开始事务
-	tx, err := db.Begin()
-	if err != nil {
-		return 0, err
+	if meal.ArchivedAt != nil {
+		return 0, errors.New("餐已归档，不能修改选餐")
 	}
-	defer tx.Rollback()
 
-	// 计数器
-	var count int
-
-	// 处理每个学生
+	// 跳过不存在的学生
+	var selections []*MealSelection
 	for _, studentID := range studentIDs {
-		// 检查学生是否存在
-		_, err := GetStudentByID(studentID)
-		if err != nil {
-			continue // 跳过不存在的学生
-		}
-
-		// 检查是否已有选餐记录
-		var existCount int
-		err = tx.QueryRow("SELECT COUNT(*) FROM meal_selections WHERE student_id = ? AND meal_id = ?", studentID, mealID).Scan(&existCount)
-		if err != nil {
+		if _, err := GetStudentByID(studentID); err != nil {
 			continue
 		}
-
-		if existCount > 0 {
-			// 更新已有记录
-			_, err = tx.Exec(
-				"UPDATE meal_selections SET meal_type = ?, updated_time = CURRENT_TIMESTAMP, operator = ? WHERE student_id = ? AND meal_id = ?",
-				mealType, operator, studentID, mealID,
-			)
-		} else {
-			// 插入新记录
-			_, err = tx.Exec(
-				"INSERT INTO meal_selections (student_id, meal_id, meal_type, operator) VALUES (?, ?, ?, ?)",
-				studentID, mealID, mealType, operator,
-			)
-		}
-
-		if err == nil {
-			count++
-		}
+		selections = append(selections, &MealSelection{
+			StudentID: studentID,
+			MealID:    mealID,
+			MealType:  mealType,
+			Operator:  operator,
+			Source:    source,
+		})
 	}
 
-	// 提交事务
-	if err := tx.Commit(); err != nil {
+	// 在单个事务中保存并扣费
+	var count int
+	err = repos().InTx(func(r *Repositories) error {
+		var err error
+		if count, err = r.Selections.SaveAll(selections); err != nil {
+			return err
+		}
+		return chargeSelections(r, meal, selections)
+	})
+	if err != nil {
 		return 0, err
 	}
 
@@ -361,26 +312,15 @@ func BatchSelectMeals(studentIDs []int, mealID int, mealType MealType, operator
 
 // GetStudentCurrentSelection 获取学生当前日期的选餐
 func GetStudentCurrentSelection(studentID int) (*MealSelection, error) {
-	// 获取数据库连接
-	db := database.GetDB()
-
-	// 获取当前日期
-	now := time.Now()
-
 	// 查询当前时间有效的餐
-	var mealID int
-	err := db.QueryRow(
-		"SELECT id FROM meals WHERE effective_start_date <= ? AND effective_end_date >= ?",
-		now, now,
-	).Scan(&mealID)
-
+	meal, err := repos().Meals.GetEffectiveAt(time.Now())
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, ErrNotFound) {
 			return nil, nil // 返回nil表示今天没有有效的餐
 		}
 		return nil, err
 	}
 
 	// 查询学生对该餐的选餐记录
-	return GetMealSelectionByStudentAndMeal(studentID, mealID)
+	return GetMealSelectionByStudentAndMeal(studentID, meal.ID)
 }
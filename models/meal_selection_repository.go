@@ -0,0 +1,178 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/database"
+)
+
+// sqlMealSelectionRepository 基于 SQL 数据库的选餐记录数据访问
+type sqlMealSelectionRepository struct {
+	db database.Conn
+}
+
+const mealSelectionColumns = "id, student_id, meal_id, meal_type, updated_time, operator, source"
+
+// scanMealSelection 读取一行选餐记录
+func scanMealSelection(row interface{ Scan(...interface{}) error }) (*MealSelection, error) {
+	var selection MealSelection
+	var updatedAt sql.NullTime
+	err := row.Scan(
+		&selection.ID, &selection.StudentID, &selection.MealID, &selection.MealType, &updatedAt, &selection.Operator, &selection.Source,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	selection.UpdatedAt = updatedAt.Time
+	return &selection, nil
+}
+
+// querySelections 查询多条选餐记录
+func (r *sqlMealSelectionRepository) querySelections(query string, args ...interface{}) ([]*MealSelection, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var selections []*MealSelection
+	for rows.Next() {
+		selection, err := scanMealSelection(rows)
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+
+	return selections, rows.Err()
+}
+
+// saveSelection 在事务中按学生和餐新增或更新选餐记录，并追加一条变更历史
+func saveSelection(tx *database.Tx, selection *MealSelection) error {
+	// 检查是否已经有选餐记录
+	var id int64
+	var previous MealType
+	err := tx.QueryRow(
+		"SELECT id, meal_type FROM meal_selections WHERE student_id = ? AND meal_id = ?",
+		selection.StudentID, selection.MealID,
+	).Scan(&id, &previous)
+
+	switch {
+	case err == nil:
+		// 更新已有记录
+		_, err = tx.Exec(
+			"UPDATE meal_selections SET meal_type = ?, updated_time = CURRENT_TIMESTAMP, operator = ?, source = ? WHERE id = ?",
+			selection.MealType, selection.Operator, selection.Source, id,
+		)
+	case errors.Is(err, sql.ErrNoRows):
+		// 插入新记录
+		id, err = tx.InsertID(
+			"INSERT INTO meal_selections (student_id, meal_id, meal_type, operator, source) VALUES (?, ?, ?, ?, ?)",
+			selection.StudentID, selection.MealID, selection.MealType, selection.Operator, selection.Source,
+		)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 记录变更历史，新增时原选餐为空
+	_, err = tx.Exec(
+		`INSERT INTO meal_selection_history (student_id, meal_id, previous_meal_type, new_meal_type, operator, source, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		selection.StudentID, selection.MealID, previous, selection.MealType, selection.Operator, selection.Source, time.Now().UTC(),
+	)
+	if err != nil {
+		return err
+	}
+
+	selection.ID = int(id)
+	return nil
+}
+
+func (r *sqlMealSelectionRepository) Save(selection *MealSelection) error {
+	return r.saveInTx([]*MealSelection{selection})
+}
+
+func (r *sqlMealSelectionRepository) SaveAll(selections []*MealSelection) (int, error) {
+	if err := r.saveInTx(selections); err != nil {
+		return 0, err
+	}
+	return len(selections), nil
+}
+
+// saveInTx 在单个事务中保存所有选餐记录，任一失败时全部回滚
+func (r *sqlMealSelectionRepository) saveInTx(selections []*MealSelection) error {
+	return database.WithTx(r.db, func(tx *database.Tx) error {
+		for _, selection := range selections {
+			if err := saveSelection(tx, selection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *sqlMealSelectionRepository) GetByStudentAndMeal(studentID, mealID int) (*MealSelection, error) {
+	return scanMealSelection(r.db.QueryRow(
+		"SELECT "+mealSelectionColumns+" FROM meal_selections WHERE student_id = ? AND meal_id = ?",
+		studentID, mealID,
+	))
+}
+
+func (r *sqlMealSelectionRepository) ListByStudent(studentID int) ([]*MealSelection, error) {
+	return r.querySelections("SELECT "+mealSelectionColumns+" FROM meal_selections WHERE student_id = ? ORDER BY id", studentID)
+}
+
+func (r *sqlMealSelectionRepository) ListByMeal(mealID int) ([]*MealSelection, error) {
+	return r.querySelections("SELECT "+mealSelectionColumns+" FROM meal_selections WHERE meal_id = ? ORDER BY id", mealID)
+}
+
+func (r *sqlMealSelectionRepository) ListHistory(studentID, mealID int) ([]*MealSelectionHistory, error) {
+	// 构建查询条件
+	var conditions []string
+	var args []interface{}
+	if studentID != 0 {
+		conditions = append(conditions, "student_id = ?")
+		args = append(args, studentID)
+	}
+	if mealID != 0 {
+		conditions = append(conditions, "meal_id = ?")
+		args = append(args, mealID)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := r.db.Query(
+		`SELECT id, student_id, meal_id, previous_meal_type, new_meal_type, operator, source, created_at
+		FROM meal_selection_history `+where+` ORDER BY id DESC`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []*MealSelectionHistory{}
+	for rows.Next() {
+		var entry MealSelectionHistory
+		err := rows.Scan(
+			&entry.ID, &entry.StudentID, &entry.MealID, &entry.PreviousMealType, &entry.NewMealType,
+			&entry.Operator, &entry.Source, &entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, &entry)
+	}
+
+	return history, rows.Err()
+}
@@ -0,0 +1,447 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+// mealImageDir 餐和餐模板图片的保存目录，对应的访问地址为 /static/images
+const mealImageDir = "./data/images"
+
+// MaxMealTemplateWeeks 预览或生成餐时最多提前的周数
+const MaxMealTemplateWeeks = 12
+
+// 模板在某一周的生成状态
+const (
+	MealTemplatePlanned   = "planned"   // 将会生成（预览）
+	MealTemplateCreated   = "created"   // 本次已生成
+	MealTemplateGenerated = "generated" // 之前已生成过，不再重复生成
+	MealTemplateSkipped   = "skipped"   // 领餐日期均不供餐，跳过
+	MealTemplateFailed    = "failed"    // 生成失败，如与其他餐的领餐时间重叠
+)
+
+// RecurrenceMoment 相对于领餐所在周的时间，如上周四 18:00 为 {weeks_before: 1, weekday: 4, time: "18:00"}
+type RecurrenceMoment struct {
+	WeeksBefore int    `json:"weeks_before"` // 领餐所在周之前的第几周，0 表示同一周
+	Weekday     int    `json:"weekday"`      // 星期，1（周一）到7（周日）
+	Time        string `json:"time"`         // 时间（格式：HH:MM）
+}
+
+// MealRecurrence 餐模板的重复规则，如"每周一 00:00 到周四 18:00 选下周一到周五的餐"
+type MealRecurrence struct {
+	IntervalWeeks       int              `json:"interval_weeks"`        // 每几周生成一次，默认为1
+	ServingStartWeekday int              `json:"serving_start_weekday"` // 领餐开始的星期
+	ServingEndWeekday   int              `json:"serving_end_weekday"`   // 领餐结束的星期
+	SelectionStart      RecurrenceMoment `json:"selection_start"`       // 选餐开始时间
+	SelectionEnd        RecurrenceMoment `json:"selection_end"`         // 选餐结束时间
+}
+
+// MealTemplate 餐模板，定时任务按重复规则提前生成每周的餐
+type MealTemplate struct {
+	ID              int             `json:"id"`
+	Name            string          `json:"name"`             // 餐名，生成的餐名后附领餐日期
+	ImagePath       string          `json:"image_path"`       // 默认图片地址，生成餐时复制
+	ReminderOffsets ReminderOffsets `json:"reminder_offsets"` // 选餐截止前的提醒时间，为空时使用系统设置
+	PriceA          int             `json:"price_a"`          // A餐每份价格（分）
+	PriceB          int             `json:"price_b"`          // B餐每份价格（分）
+	Recurrence      MealRecurrence  `json:"recurrence"`
+	StartDate       string          `json:"start_date"` // 从该日期所在的周开始生成（YYYY-MM-DD）
+	EndDate         string          `json:"end_date"`   // 领餐开始日期晚于该日期的周不再生成，为空时不限制
+	Enabled         bool            `json:"enabled"`    // 是否由定时任务自动生成
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+}
+
+// MealTemplateOccurrence 模板在某一周要生成的餐
+type MealTemplateOccurrence struct {
+	TemplateID         int       `json:"template_id"`
+	TemplateName       string    `json:"template_name"`
+	WeekStart          string    `json:"week_start"` // 领餐所在周的周一
+	Name               string    `json:"name"`
+	SelectionStartTime time.Time `json:"selection_start_time"`
+	SelectionEndTime   time.Time `json:"selection_end_time"`
+	EffectiveStartDate time.Time `json:"effective_start_date"` // 第一个供餐日
+	EffectiveEndDate   time.Time `json:"effective_end_date"`   // 最后一个供餐日
+	Status             string    `json:"status"`
+	Reason             string    `json:"reason,omitempty"`  // 跳过或失败的原因
+	MealID             int       `json:"meal_id,omitempty"` // 生成的餐ID
+}
+
+// mealTemplateMutex 避免定时任务和手动生成同时为同一周生成餐
+var mealTemplateMutex sync.Mutex
+
+// weekStartOf 获取某一时间所在周的周一零点（服务器本地时间）
+func weekStartOf(t time.Time) time.Time {
+	t = t.In(time.Local)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// at 计算相对于 weekStart（领餐所在周的周一零点）的时间
+func (m RecurrenceMoment) at(weekStart time.Time) time.Time {
+	clock, _ := time.Parse("15:04", m.Time)
+	day := weekStart.AddDate(0, 0, m.Weekday-1-7*m.WeeksBefore)
+	return time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, time.Local)
+}
+
+// validate 校验相对时间
+func (m RecurrenceMoment) validate(label string) error {
+	if m.WeeksBefore < 0 || m.WeeksBefore > 4 {
+		return fmt.Errorf("%s必须在领餐所在周或之前4周内", label)
+	}
+	if m.Weekday < 1 || m.Weekday > 7 {
+		return fmt.Errorf("%s的星期必须为1到7", label)
+	}
+	if _, err := time.Parse("15:04", m.Time); err != nil {
+		return fmt.Errorf("%s的时间格式无效：%s，应为 HH:MM", label, m.Time)
+	}
+	return nil
+}
+
+// Validate 校验重复规则，间隔为0时设为1
+func (r *MealRecurrence) Validate() error {
+	if r.IntervalWeeks == 0 {
+		r.IntervalWeeks = 1
+	}
+	if r.IntervalWeeks < 1 || r.IntervalWeeks > 52 {
+		return errors.New("生成间隔必须为1到52周")
+	}
+	if r.ServingStartWeekday < 1 || r.ServingStartWeekday > 7 || r.ServingEndWeekday < 1 || r.ServingEndWeekday > 7 {
+		return errors.New("领餐的星期必须为1到7")
+	}
+	if r.ServingStartWeekday > r.ServingEndWeekday {
+		return errors.New("领餐开始的星期不能晚于结束的星期")
+	}
+	if err := r.SelectionStart.validate("选餐开始时间"); err != nil {
+		return err
+	}
+	if err := r.SelectionEnd.validate("选餐结束时间"); err != nil {
+		return err
+	}
+
+	// 按任意一周计算，选餐时间和领餐时间的先后与具体日期无关
+	weekStart := weekStartOf(time.Now())
+	if !r.SelectionStart.at(weekStart).Before(r.SelectionEnd.at(weekStart)) {
+		return errors.New("选餐开始时间必须早于选餐结束时间")
+	}
+	if !weekStart.AddDate(0, 0, r.ServingStartWeekday-1).After(r.SelectionEnd.at(weekStart)) {
+		return errors.New("领餐开始时间必须晚于选餐结束时间")
+	}
+	return nil
+}
+
+// validate 校验模板
+func (template *MealTemplate) validate() error {
+	template.Name = strings.TrimSpace(template.Name)
+	if template.Name == "" {
+		return errors.New("餐名不能为空")
+	}
+	if err := template.ReminderOffsets.Validate(); err != nil {
+		return err
+	}
+	if template.PriceA < 0 || template.PriceB < 0 {
+		return errors.New("价格不能为负数")
+	}
+	if err := template.Recurrence.Validate(); err != nil {
+		return err
+	}
+	if _, err := time.ParseInLocation(collectionDateLayout, template.StartDate, time.Local); err != nil {
+		return errors.New("无效的开始日期")
+	}
+	if template.EndDate != "" {
+		if _, err := time.ParseInLocation(collectionDateLayout, template.EndDate, time.Local); err != nil {
+			return errors.New("无效的结束日期")
+		}
+		if template.EndDate < template.StartDate {
+			return errors.New("结束日期不能早于开始日期")
+		}
+	}
+	return nil
+}
+
+// CreateMealTemplate 创建餐模板
+func CreateMealTemplate(template *MealTemplate) error {
+	if err := template.validate(); err != nil {
+		return err
+	}
+
+	// 插入记录
+	now := time.Now()
+	template.CreatedAt = now
+	template.UpdatedAt = now
+	return repos().MealTemplates.Create(template)
+}
+
+// GetMealTemplateByID 通过ID获取餐模板
+func GetMealTemplateByID(id int) (*MealTemplate, error) {
+	template, err := repos().MealTemplates.GetByID(id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, errors.New("餐模板不存在")
+	}
+	return template, err
+}
+
+// GetMealTemplates 获取所有餐模板
+func GetMealTemplates() ([]*MealTemplate, error) {
+	return repos().MealTemplates.List()
+}
+
+// UpdateMealTemplate 更新餐模板，已生成的餐不受影响
+func UpdateMealTemplate(template *MealTemplate) error {
+	if err := template.validate(); err != nil {
+		return err
+	}
+
+	// 更新记录
+	template.UpdatedAt = time.Now()
+	return repos().MealTemplates.Update(template)
+}
+
+// DeleteMealTemplate 删除餐模板及其图片，已生成的餐保留
+func DeleteMealTemplate(id int) (*MealTemplate, error) {
+	template, err := GetMealTemplateByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := repos().MealTemplates.Delete(id); err != nil {
+		return nil, err
+	}
+
+	// 删除图片文件
+	RemoveMealTemplateImage(template.ImagePath)
+
+	return template, nil
+}
+
+// RemoveMealTemplateImage 删除餐模板的图片文件
+func RemoveMealTemplateImage(imagePath string) {
+	if imagePath != "" {
+		os.Remove(filepath.Join(mealImageDir, filepath.Base(imagePath)))
+	}
+}
+
+// occurrence 计算模板在 weekStart 所在周的餐，不考虑校历
+func (template *MealTemplate) occurrence(weekStart time.Time) *MealTemplateOccurrence {
+	recurrence := template.Recurrence
+	servingStart := weekStart.AddDate(0, 0, recurrence.ServingStartWeekday-1)
+	servingEnd := weekStart.AddDate(0, 0, recurrence.ServingEndWeekday-1)
+	return &MealTemplateOccurrence{
+		TemplateID:         template.ID,
+		TemplateName:       template.Name,
+		WeekStart:          weekStart.Format(collectionDateLayout),
+		SelectionStartTime: recurrence.SelectionStart.at(weekStart),
+		SelectionEndTime:   recurrence.SelectionEnd.at(weekStart),
+		EffectiveStartDate: servingStart,
+		EffectiveEndDate:   servingEnd.AddDate(0, 0, 1).Add(-time.Second),
+	}
+}
+
+// planMealTemplate 列出模板从本周起 weeks 周内每周要生成的餐；不在模板日期范围内、不符合生成间隔或选餐已截止的周不列出
+// 领餐日期按校历去掉首尾不供餐的日期，全部不供餐时跳过该周
+func planMealTemplate(template *MealTemplate, weeks int, now time.Time) ([]*MealTemplateOccurrence, error) {
+	start, err := time.ParseInLocation(collectionDateLayout, template.StartDate, time.Local)
+	if err != nil {
+		return nil, errors.New("无效的开始日期")
+	}
+	anchor := weekStartOf(start)
+	interval := template.Recurrence.IntervalWeeks
+	if interval < 1 {
+		interval = 1
+	}
+
+	occurrences := []*MealTemplateOccurrence{}
+	for i := 0; i <= weeks; i++ {
+		weekStart := weekStartOf(now).AddDate(0, 0, 7*i)
+		if weekStart.Before(anchor) {
+			continue
+		}
+		if weeksSince := int(math.Round(weekStart.Sub(anchor).Hours()/24)) / 7; weeksSince%interval != 0 {
+			continue
+		}
+		occurrence := template.occurrence(weekStart)
+		if template.EndDate != "" && occurrence.EffectiveStartDate.Format(collectionDateLayout) > template.EndDate {
+			break
+		}
+		if !occurrence.SelectionEndTime.After(now) {
+			continue
+		}
+
+		// 已生成过的周
+		mealID, err := repos().MealTemplates.GetMealID(template.ID, occurrence.WeekStart)
+		if err == nil {
+			occurrence.Name = template.Name
+			occurrence.Status = MealTemplateGenerated
+			occurrence.MealID = mealID
+			occurrences = append(occurrences, occurrence)
+			continue
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+
+		// 按校历去掉首尾不供餐的日期
+		var first, last time.Time
+		reason := ""
+		for day := occurrence.EffectiveStartDate; day.Before(occurrence.EffectiveEndDate); day = day.AddDate(0, 0, 1) {
+			serving, dayReason := IsServingDay(day.Format(collectionDateLayout))
+			if !serving {
+				if reason == "" {
+					reason = dayReason
+				}
+				continue
+			}
+			if first.IsZero() {
+				first = day
+			}
+			last = day
+		}
+		if first.IsZero() {
+			occurrence.Name = template.Name
+			occurrence.Status = MealTemplateSkipped
+			occurrence.Reason = "领餐日期均不供餐（" + reason + "）"
+			occurrences = append(occurrences, occurrence)
+			continue
+		}
+		occurrence.EffectiveStartDate = first
+		occurrence.EffectiveEndDate = last.AddDate(0, 0, 1).Add(-time.Second)
+		occurrence.Name = fmt.Sprintf("%s %s-%s", template.Name, first.Format("01.02"), last.Format("01.02"))
+		occurrence.Status = MealTemplatePlanned
+		occurrences = append(occurrences, occurrence)
+	}
+
+	return occurrences, nil
+}
+
+// generateFromTemplate 按模板生成从本周起 weeks 周内尚未生成的餐
+func generateFromTemplate(template *MealTemplate, weeks int) ([]*MealTemplateOccurrence, error) {
+	occurrences, err := planMealTemplate(template, weeks, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, occurrence := range occurrences {
+		if occurrence.Status != MealTemplatePlanned {
+			continue
+		}
+		meal, err := createMealFromTemplate(template, occurrence)
+		if err != nil {
+			occurrence.Status = MealTemplateFailed
+			occurrence.Reason = err.Error()
+			continue
+		}
+		occurrence.Status = MealTemplateCreated
+		occurrence.MealID = meal.ID
+	}
+
+	return occurrences, nil
+}
+
+// createMealFromTemplate 在单个事务中创建模板在某一周的餐并记录，餐的时间按 validateMealTimes 校验
+func createMealFromTemplate(template *MealTemplate, occurrence *MealTemplateOccurrence) (*Meal, error) {
+	// 复制模板图片，避免删除或更换餐的图片时影响模板和其他餐
+	imagePath := ""
+	if template.ImagePath != "" {
+		fileName, err := utils.CopyImage(template.ImagePath, mealImageDir, fmt.Sprintf("meal_t%d", template.ID), strings.ReplaceAll(occurrence.WeekStart, "-", ""))
+		if err != nil {
+			return nil, fmt.Errorf("复制模板图片失败：%v", err)
+		}
+		imagePath = filepath.Join("/static/images", fileName)
+	}
+
+	// 在单个事务中创建餐并记录已生成的周，任一步失败时都不会留下餐
+	var meal *Meal
+	err := repos().InTx(func(r *Repositories) error {
+		var err error
+		meal, err = createMeal(r, occurrence.Name, occurrence.SelectionStartTime, occurrence.SelectionEndTime,
+			occurrence.EffectiveStartDate, occurrence.EffectiveEndDate, imagePath, template.ReminderOffsets, template.PriceA, template.PriceB)
+		if err != nil {
+			return err
+		}
+		if err := r.MealTemplates.AddMeal(template.ID, occurrence.WeekStart, meal.ID); err != nil {
+			utils.LogError(fmt.Sprintf("记录餐模板 %d 生成的餐失败（%s）: %v", template.ID, occurrence.WeekStart, err))
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		RemoveMealTemplateImage(imagePath)
+		return nil, err
+	}
+
+	// 提交后通知订阅者
+	publishMealEvent(MealEvent{Type: MealEventCreated, MealID: meal.ID, Meal: meal})
+
+	return meal, nil
+}
+
+// checkMealTemplateWeeks 校验提前的周数
+func checkMealTemplateWeeks(weeks int) error {
+	if weeks < 0 || weeks > MaxMealTemplateWeeks {
+		return fmt.Errorf("提前的周数必须为0到%d", MaxMealTemplateWeeks)
+	}
+	return nil
+}
+
+// PreviewMealTemplate 预览模板从本周起 weeks 周内每周的餐，不会生成
+func PreviewMealTemplate(id, weeks int) ([]*MealTemplateOccurrence, error) {
+	if err := checkMealTemplateWeeks(weeks); err != nil {
+		return nil, err
+	}
+	template, err := GetMealTemplateByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return planMealTemplate(template, weeks, time.Now())
+}
+
+// GenerateMealsFromTemplate 立即按模板生成从本周起 weeks 周内的餐，不受模板是否启用的限制
+func GenerateMealsFromTemplate(id, weeks int) ([]*MealTemplateOccurrence, error) {
+	if err := checkMealTemplateWeeks(weeks); err != nil {
+		return nil, err
+	}
+	template, err := GetMealTemplateByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	mealTemplateMutex.Lock()
+	defer mealTemplateMutex.Unlock()
+	return generateFromTemplate(template, weeks)
+}
+
+// GenerateMealsFromTemplates 按所有启用的模板生成从本周起 weeks 周内的餐，返回每个模板每周的结果
+func GenerateMealsFromTemplates(weeks int) ([]*MealTemplateOccurrence, error) {
+	if err := checkMealTemplateWeeks(weeks); err != nil {
+		return nil, err
+	}
+	templates, err := GetMealTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	mealTemplateMutex.Lock()
+	defer mealTemplateMutex.Unlock()
+
+	occurrences := []*MealTemplateOccurrence{}
+	for _, template := range templates {
+		if !template.Enabled {
+			continue
+		}
+		result, err := generateFromTemplate(template, weeks)
+		if err != nil {
+			return occurrences, fmt.Errorf("按餐模板 %s 生成餐失败：%v", template.Name, err)
+		}
+		occurrences = append(occurrences, result...)
+	}
+
+	return occurrences, nil
+}
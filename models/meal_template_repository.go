@@ -0,0 +1,132 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/database"
+)
+
+// sqlMealTemplateRepository 基于 SQL 数据库的餐模板数据访问
+type sqlMealTemplateRepository struct {
+	db database.Conn
+}
+
+const mealTemplateColumns = `id, name, image_path, reminder_offsets, price_a, price_b, interval_weeks,
+	serving_start_weekday, serving_end_weekday,
+	selection_start_weeks_before, selection_start_weekday, selection_start_time,
+	selection_end_weeks_before, selection_end_weekday, selection_end_time,
+	start_date, end_date, enabled, created_at, updated_at`
+
+// scanMealTemplate 读取一行餐模板
+func scanMealTemplate(row interface{ Scan(...interface{}) error }) (*MealTemplate, error) {
+	var template MealTemplate
+	recurrence := &template.Recurrence
+	err := row.Scan(
+		&template.ID, &template.Name, &template.ImagePath, &template.ReminderOffsets, &template.PriceA, &template.PriceB,
+		&recurrence.IntervalWeeks, &recurrence.ServingStartWeekday, &recurrence.ServingEndWeekday,
+		&recurrence.SelectionStart.WeeksBefore, &recurrence.SelectionStart.Weekday, &recurrence.SelectionStart.Time,
+		&recurrence.SelectionEnd.WeeksBefore, &recurrence.SelectionEnd.Weekday, &recurrence.SelectionEnd.Time,
+		&template.StartDate, &template.EndDate, &template.Enabled, &template.CreatedAt, &template.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &template, nil
+}
+
+func (r *sqlMealTemplateRepository) Create(template *MealTemplate) error {
+	recurrence := template.Recurrence
+	id, err := r.db.InsertID(
+		`INSERT INTO meal_templates (name, image_path, reminder_offsets, price_a, price_b, interval_weeks,
+		serving_start_weekday, serving_end_weekday,
+		selection_start_weeks_before, selection_start_weekday, selection_start_time,
+		selection_end_weeks_before, selection_end_weekday, selection_end_time,
+		start_date, end_date, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		template.Name, template.ImagePath, template.ReminderOffsets, template.PriceA, template.PriceB, recurrence.IntervalWeeks,
+		recurrence.ServingStartWeekday, recurrence.ServingEndWeekday,
+		recurrence.SelectionStart.WeeksBefore, recurrence.SelectionStart.Weekday, recurrence.SelectionStart.Time,
+		recurrence.SelectionEnd.WeeksBefore, recurrence.SelectionEnd.Weekday, recurrence.SelectionEnd.Time,
+		template.StartDate, template.EndDate, template.Enabled, template.CreatedAt.UTC(), template.UpdatedAt.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	template.ID = int(id)
+	return nil
+}
+
+func (r *sqlMealTemplateRepository) GetByID(id int) (*MealTemplate, error) {
+	return scanMealTemplate(r.db.QueryRow("SELECT "+mealTemplateColumns+" FROM meal_templates WHERE id = ?", id))
+}
+
+func (r *sqlMealTemplateRepository) List() ([]*MealTemplate, error) {
+	rows, err := r.db.Query("SELECT " + mealTemplateColumns + " FROM meal_templates ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// 处理结果
+	templates := []*MealTemplate{}
+	for rows.Next() {
+		template, err := scanMealTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+
+	return templates, rows.Err()
+}
+
+func (r *sqlMealTemplateRepository) Update(template *MealTemplate) error {
+	recurrence := template.Recurrence
+	_, err := r.db.Exec(
+		`UPDATE meal_templates SET name = ?, image_path = ?, reminder_offsets = ?, price_a = ?, price_b = ?, interval_weeks = ?,
+		serving_start_weekday = ?, serving_end_weekday = ?,
+		selection_start_weeks_before = ?, selection_start_weekday = ?, selection_start_time = ?,
+		selection_end_weeks_before = ?, selection_end_weekday = ?, selection_end_time = ?,
+		start_date = ?, end_date = ?, enabled = ?, updated_at = ? WHERE id = ?`,
+		template.Name, template.ImagePath, template.ReminderOffsets, template.PriceA, template.PriceB, recurrence.IntervalWeeks,
+		recurrence.ServingStartWeekday, recurrence.ServingEndWeekday,
+		recurrence.SelectionStart.WeeksBefore, recurrence.SelectionStart.Weekday, recurrence.SelectionStart.Time,
+		recurrence.SelectionEnd.WeeksBefore, recurrence.SelectionEnd.Weekday, recurrence.SelectionEnd.Time,
+		template.StartDate, template.EndDate, template.Enabled, template.UpdatedAt.UTC(), template.ID,
+	)
+	return err
+}
+
+func (r *sqlMealTemplateRepository) Delete(id int) error {
+	return database.WithTx(r.db, func(tx *database.Tx) error {
+		if _, err := tx.Exec("DELETE FROM meal_template_meals WHERE template_id = ?", id); err != nil {
+			return err
+		}
+		_, err := tx.Exec("DELETE FROM meal_templates WHERE id = ?", id)
+		return err
+	})
+}
+
+func (r *sqlMealTemplateRepository) GetMealID(templateID int, weekStart string) (int, error) {
+	var mealID int
+	err := r.db.QueryRow(
+		"SELECT meal_id FROM meal_template_meals WHERE template_id = ? AND week_start = ?", templateID, weekStart,
+	).Scan(&mealID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return mealID, err
+}
+
+func (r *sqlMealTemplateRepository) AddMeal(templateID int, weekStart string, mealID int) error {
+	_, err := r.db.Exec(
+		"INSERT INTO meal_template_meals (template_id, week_start, meal_id, created_at) VALUES (?, ?, ?, ?)",
+		templateID, weekStart, mealID, time.Now().UTC(),
+	)
+	return err
+}
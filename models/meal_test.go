@@ -0,0 +1,94 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdateMealRecostsSelectionCharges(t *testing.T) {
+	tests := []struct {
+		name     string
+		chargeOn string
+		update   func(meal *Meal)
+		wantNet  int
+		wantType string // 最后一条流水的类型，为空时表示没有新的流水
+	}{
+		{"price raised", ChargeOnSelection, func(meal *Meal) { meal.PriceA = 600 }, -1800, WalletTypeCharge},
+		{"price lowered", ChargeOnSelection, func(meal *Meal) { meal.PriceA = 400 }, -1200, WalletTypeRefund},
+		{"dates shortened", ChargeOnSelection, func(meal *Meal) { meal.EffectiveEndDate = meal.EffectiveEndDate.AddDate(0, 0, -1) }, -1000, WalletTypeRefund},
+		{"dates extended", ChargeOnSelection, func(meal *Meal) { meal.EffectiveEndDate = meal.EffectiveEndDate.AddDate(0, 0, 1) }, -2000, WalletTypeCharge},
+		{"other type price", ChargeOnSelection, func(meal *Meal) { meal.PriceB = 900 }, -1500, ""},
+		{"charged on collection", ChargeOnCollection, func(meal *Meal) { meal.PriceA = 600 }, -1500, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRepositories(t)
+			useBilling(t, ChargeOnSelection, false)
+			meal := newTestMeal(t, r, testDay(1), 3, 500, 700)
+			student := newTestStudent(t, r, "张三", 10000)
+			selectAndCharge(t, r, meal, student.ID, MealTypeA)
+			useBilling(t, tt.chargeOn, false)
+
+			tt.update(meal)
+			if err := UpdateMeal(meal, "admin"); err != nil {
+				t.Fatalf("update meal: %v", err)
+			}
+
+			if net, err := r.Wallets.SelectionChargeNet(student.ID, meal.ID); err != nil || net != tt.wantNet {
+				t.Errorf("selection charge net = %d, %v, want %d", net, err, tt.wantNet)
+			}
+			wantBalance(t, r, student.ID, 10000+tt.wantNet)
+			entries, _, err := r.Wallets.List(WalletTransactionFilter{StudentID: student.ID})
+			if err != nil {
+				t.Fatalf("list transactions: %v", err)
+			}
+			// 充值和选餐扣费之外的流水
+			switch {
+			case tt.wantType == "" && len(entries) != 2:
+				t.Errorf("transactions = %d, want no adjustment", len(entries))
+			case tt.wantType != "" && (len(entries) != 3 || entries[0].Type != tt.wantType || entries[0].Operator != "admin"):
+				t.Errorf("latest transaction = %+v, want %s by admin", entries[0], tt.wantType)
+			}
+		})
+	}
+}
+
+func TestDeleteMealRefundsSelectionCharges(t *testing.T) {
+	tests := []struct {
+		name        string
+		start       int  // 领餐开始日期相对今天的天数
+		days        int  // 领餐天数
+		purge       bool // 归档后由 PurgeArchivedMeals 删除
+		wantBalance int
+	}{
+		{"not started", 1, 3, false, 10000},
+		{"partly served", -2, 4, false, 10000 - 1000},
+		{"purged after serving", -6, 3, true, 10000 - 1500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRepositories(t)
+			useBilling(t, ChargeOnSelection, false)
+			meal := newTestMeal(t, r, testDay(tt.start), tt.days, 500, 700)
+			student := newTestStudent(t, r, "张三", 10000)
+			selectAndCharge(t, r, meal, student.ID, MealTypeA)
+			wantBalance(t, r, student.ID, 10000-500*tt.days)
+
+			if tt.purge {
+				if err := r.Meals.Archive(meal.ID, time.Now()); err != nil {
+					t.Fatalf("archive meal: %v", err)
+				}
+				if count, err := PurgeArchivedMeals(1); err != nil || count != 1 {
+					t.Fatalf("purge = %d, %v", count, err)
+				}
+			} else if err := DeleteMeal(meal.ID, "admin"); err != nil {
+				t.Fatalf("delete meal: %v", err)
+			}
+
+			if _, err := r.Meals.GetByID(meal.ID); err != ErrNotFound {
+				t.Errorf("get deleted meal: err = %v, want ErrNotFound", err)
+			}
+			wantBalance(t, r, student.ID, tt.wantBalance)
+		})
+	}
+}
@@ -0,0 +1,416 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/config"
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+// maxNoShowDays 未取餐统计的最大日期范围
+const maxNoShowDays = 366
+
+// weekdayNames 星期的显示名称
+var weekdayNames = [...]string{"周日", "周一", "周二", "周三", "周四", "周五", "周六"}
+
+// NoShowFilter 未取餐统计条件，为空的条件不参与筛选
+type NoShowFilter struct {
+	From      string // 起始日期（YYYY-MM-DD，含）
+	To        string // 结束日期（YYYY-MM-DD，含）
+	MealID    int
+	Class     string
+	Threshold int // 未取餐率达到该百分比的学生标记为经常未取餐
+	MinCount  int // 未取餐次数至少为该值才标记
+}
+
+// NoShowStat 一组选餐的取餐情况，每名学生每个供餐日计一次
+type NoShowStat struct {
+	Key       string  `json:"key"`             // 分组，如餐ID、A、班级、星期（1-7）、日期
+	Label     string  `json:"label,omitempty"` // 显示名称
+	Expected  int     `json:"expected"`        // 应取餐人次
+	Collected int     `json:"collected"`       // 已取餐人次
+	NoShow    int     `json:"no_show"`         // 未取餐人次
+	Rate      float64 `json:"rate"`            // 未取餐率（0-1）
+}
+
+// NoShowStudentStat 一名学生的取餐情况
+type NoShowStudentStat struct {
+	NoShowStat
+	StudentID   int      `json:"student_id"`
+	FullName    string   `json:"full_name"`
+	Class       string   `json:"class"`
+	Archived    bool     `json:"archived"`
+	NoShowDates []string `json:"no_show_dates"` // 未取餐的日期
+}
+
+// NoShowAlert 未取餐提醒记录，用于避免在统计周期内重复提醒
+type NoShowAlert struct {
+	ID          int
+	StudentID   int
+	Class       string
+	WindowStart string // 统计的起始日期（YYYY-MM-DD）
+	WindowEnd   string // 统计的结束日期（YYYY-MM-DD）
+	Expected    int
+	NoShow      int
+	NotifiedAt  time.Time
+}
+
+// NoShowReport 未取餐统计
+// 只统计有选餐的学生；某个餐在某天没有任何取餐记录时视为当天未供餐，不计入统计
+type NoShowReport struct {
+	From      string               `json:"from"`
+	To        string               `json:"to"`
+	Threshold int                  `json:"threshold"`
+	MinCount  int                  `json:"min_count"`
+	Overall   NoShowStat           `json:"overall"`
+	ByMeal    []*NoShowStat        `json:"by_meal"`    // 按领餐时间排序
+	ByOption  []*NoShowStat        `json:"by_option"`  // A餐、B餐
+	ByClass   []*NoShowStat        `json:"by_class"`   // 按班级排序
+	ByWeekday []*NoShowStat        `json:"by_weekday"` // 周一到周日
+	Trend     []*NoShowStat        `json:"trend"`      // 按日期排序
+	ByStudent []*NoShowStudentStat `json:"by_student"` // 按未取餐次数倒序
+	Chronic   []*NoShowStudentStat `json:"chronic"`    // 经常未取餐的学生
+}
+
+// BuildNoShowReport 对比选餐和取餐记录，统计 [From, To] 内的未取餐情况，请假当天未取餐不计入
+func BuildNoShowReport(filter NoShowFilter) (*NoShowReport, error) {
+	// 验证日期
+	from, err := time.ParseInLocation(collectionDateLayout, filter.From, time.Local)
+	if err != nil {
+		return nil, errors.New("无效的起始日期")
+	}
+	to, err := time.ParseInLocation(collectionDateLayout, filter.To, time.Local)
+	if err != nil {
+		return nil, errors.New("无效的结束日期")
+	}
+	if from.After(to) {
+		return nil, errors.New("起始日期不能晚于结束日期")
+	}
+	if to.Sub(from) >= maxNoShowDays*24*time.Hour {
+		return nil, fmt.Errorf("日期范围不能超过%d天", maxNoShowDays)
+	}
+
+	report := &NoShowReport{
+		From:      filter.From,
+		To:        filter.To,
+		Threshold: filter.Threshold,
+		MinCount:  filter.MinCount,
+		ByMeal:    []*NoShowStat{},
+		ByClass:   []*NoShowStat{},
+		Trend:     []*NoShowStat{},
+		ByStudent: []*NoShowStudentStat{},
+		Chronic:   []*NoShowStudentStat{},
+	}
+	for _, mealType := range []MealType{MealTypeA, MealTypeB} {
+		report.ByOption = append(report.ByOption, &NoShowStat{Key: string(mealType), Label: string(mealType) + "餐"})
+	}
+	for _, weekday := range []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday} {
+		key := strconv.Itoa(int(weekday))
+		if weekday == time.Sunday {
+			key = "7"
+		}
+		report.ByWeekday = append(report.ByWeekday, &NoShowStat{Key: key, Label: weekdayNames[weekday]})
+	}
+
+	// 获取日期范围内领餐的餐
+	meals, err := getMealsServedBetween(repos(), from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	// 获取学生，包括已归档的学生
+	students, err := GetStudentsIncludingArchived()
+	if err != nil {
+		return nil, err
+	}
+	studentByID := make(map[int]*Student)
+	for _, student := range students {
+		studentByID[student.ID] = student
+	}
+
+	// 获取请假记录，请假当天未取餐不计入统计
+	absent, err := getAbsenceDays(repos(), 0, filter.From, filter.To)
+	if err != nil {
+		return nil, err
+	}
+
+	classes := make(map[string]*NoShowStat)
+	trend := make(map[string]*NoShowStat)
+	byStudent := make(map[int]*NoShowStudentStat)
+	for _, meal := range meals {
+		if filter.MealID != 0 && meal.ID != filter.MealID {
+			continue
+		}
+
+		// 获取选餐和取餐记录
+		selections, err := repos().Selections.ListByMeal(meal.ID)
+		if err != nil {
+			return nil, err
+		}
+		collections, err := GetMealCollections(meal.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		// 有取餐记录的日期视为供餐日
+		collected := make(map[string]bool) // 学生ID + 日期
+		var servedDays []string
+		for _, collection := range collections {
+			if collection.CollectionDate < filter.From || collection.CollectionDate > filter.To {
+				continue
+			}
+			if _, ok := trend[collection.CollectionDate]; !ok {
+				trend[collection.CollectionDate] = &NoShowStat{Key: collection.CollectionDate}
+				servedDays = append(servedDays, collection.CollectionDate)
+			}
+			collected[strconv.Itoa(collection.StudentID)+"@"+collection.CollectionDate] = true
+		}
+		if len(servedDays) == 0 {
+			continue
+		}
+		sort.Strings(servedDays)
+
+		mealStat := &NoShowStat{Key: strconv.Itoa(meal.ID), Label: meal.Name}
+		for _, day := range servedDays {
+			date, _ := time.ParseInLocation(collectionDateLayout, day, time.Local)
+			weekdayStat := report.ByWeekday[(int(date.Weekday())+6)%7]
+
+			for _, selection := range selections {
+				student := studentByID[selection.StudentID]
+				if student == nil || (filter.Class != "" && student.Class != filter.Class) {
+					continue
+				}
+				hit := collected[strconv.Itoa(student.ID)+"@"+day]
+				if !hit && absent.absent(student.ID, day) {
+					continue
+				}
+
+				// 班级
+				classStat, ok := classes[student.Class]
+				if !ok {
+					classStat = &NoShowStat{Key: student.Class, Label: student.Class}
+					classes[student.Class] = classStat
+				}
+
+				// 学生
+				studentStat, ok := byStudent[student.ID]
+				if !ok {
+					studentStat = &NoShowStudentStat{
+						NoShowStat:  NoShowStat{Key: strconv.Itoa(student.ID), Label: student.FullName},
+						StudentID:   student.ID,
+						FullName:    student.FullName,
+						Class:       student.Class,
+						Archived:    student.Archived,
+						NoShowDates: []string{},
+					}
+					byStudent[student.ID] = studentStat
+				}
+				if !hit {
+					studentStat.NoShowDates = append(studentStat.NoShowDates, day)
+				}
+
+				stats := []*NoShowStat{&report.Overall, mealStat, classStat, weekdayStat, trend[day], &studentStat.NoShowStat}
+				switch selection.MealType {
+				case MealTypeA:
+					stats = append(stats, report.ByOption[0])
+				case MealTypeB:
+					stats = append(stats, report.ByOption[1])
+				}
+				for _, stat := range stats {
+					stat.add(hit)
+				}
+			}
+		}
+		report.ByMeal = append(report.ByMeal, mealStat)
+	}
+
+	// 整理结果
+	for _, stat := range classes {
+		report.ByClass = append(report.ByClass, stat)
+	}
+	sort.Slice(report.ByClass, func(i, j int) bool { return report.ByClass[i].Key < report.ByClass[j].Key })
+	for _, stat := range trend {
+		report.Trend = append(report.Trend, stat)
+	}
+	sort.Slice(report.Trend, func(i, j int) bool { return report.Trend[i].Key < report.Trend[j].Key })
+	for _, stat := range byStudent {
+		report.ByStudent = append(report.ByStudent, stat)
+	}
+	sort.Slice(report.ByStudent, func(i, j int) bool {
+		a, b := report.ByStudent[i], report.ByStudent[j]
+		if a.NoShow != b.NoShow {
+			return a.NoShow > b.NoShow
+		}
+		if a.Class != b.Class {
+			return a.Class < b.Class
+		}
+		return a.StudentID < b.StudentID
+	})
+
+	// 计算未取餐率并标记经常未取餐的学生
+	report.Overall.finish()
+	for _, stats := range [][]*NoShowStat{report.ByMeal, report.ByOption, report.ByClass, report.ByWeekday, report.Trend} {
+		for _, stat := range stats {
+			stat.finish()
+		}
+	}
+	for _, stat := range report.ByStudent {
+		stat.finish()
+		if stat.isChronic(filter.Threshold, filter.MinCount) {
+			report.Chronic = append(report.Chronic, stat)
+		}
+	}
+
+	return report, nil
+}
+
+// add 统计一次应取餐
+func (stat *NoShowStat) add(collected bool) {
+	stat.Expected++
+	if collected {
+		stat.Collected++
+	} else {
+		stat.NoShow++
+	}
+}
+
+// finish 计算未取餐率，保留四位小数
+func (stat *NoShowStat) finish() {
+	if stat.Expected > 0 {
+		stat.Rate = math.Round(float64(stat.NoShow)/float64(stat.Expected)*10000) / 10000
+	}
+}
+
+// isChronic 未取餐次数不少于 minCount 且未取餐率不低于 threshold% 时视为经常未取餐
+func (stat *NoShowStat) isChronic(threshold, minCount int) bool {
+	return stat.NoShow > 0 && stat.NoShow >= minCount && stat.NoShow*100 >= threshold*stat.Expected
+}
+
+// NotifyChronicNoShows 统计最近 windowDays 天（不含今天）的未取餐情况，将经常未取餐的在读学生发送给班主任
+// 统计周期内已提醒过的学生不再重复提醒；没有班主任的班级只记录日志。返回提醒的学生数
+func NotifyChronicNoShows(windowDays, threshold, minCount int) (int, error) {
+	if windowDays <= 0 {
+		return 0, errors.New("统计天数必须大于0")
+	}
+
+	// 统计周期
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, -1)
+	from := to.AddDate(0, 0, 1-windowDays)
+	report, err := BuildNoShowReport(NoShowFilter{
+		From:      from.Format(collectionDateLayout),
+		To:        to.Format(collectionDateLayout),
+		Threshold: threshold,
+		MinCount:  minCount,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// 获取统计周期内已提醒的学生
+	alerted, err := getRecentNoShowAlerts(now.AddDate(0, 0, -windowDays))
+	if err != nil {
+		return 0, fmt.Errorf("获取未取餐提醒记录失败: %v", err)
+	}
+
+	// 按班级分组
+	var classes []string
+	byClass := make(map[string][]*NoShowStudentStat)
+	for _, stat := range report.Chronic {
+		if stat.Archived || alerted[stat.StudentID] {
+			continue
+		}
+		if _, ok := byClass[stat.Class]; !ok {
+			classes = append(classes, stat.Class)
+		}
+		byClass[stat.Class] = append(byClass[stat.Class], stat)
+	}
+	if len(classes) == 0 {
+		return 0, nil
+	}
+
+	// 获取班主任
+	teachers, err := GetClassTeachers("")
+	if err != nil {
+		return 0, fmt.Errorf("获取班主任失败: %v", err)
+	}
+	teacherIDs := make(map[string][]string)
+	for _, teacher := range teachers {
+		teacherIDs[teacher.Class] = append(teacherIDs[teacher.Class], teacher.DingTalkID)
+	}
+
+	// 逐个班级发送
+	count := 0
+	var failed []string
+	for _, class := range classes {
+		if len(teacherIDs[class]) == 0 {
+			utils.LogError(fmt.Sprintf("%s没有设置班主任，未发送未取餐提醒", class))
+			continue
+		}
+
+		// 构建消息
+		var markdown strings.Builder
+		fmt.Fprintf(&markdown, "## %s未取餐提醒\n\n以下学生在 %s 至 %s 期间多次选餐后未取餐：\n\n", class, report.From, report.To)
+		for _, stat := range byClass[class] {
+			fmt.Fprintf(&markdown, "- %s：%d 天中有 %d 天未取餐（%.0f%%）\n", stat.FullName, stat.Expected, stat.NoShow, stat.Rate*100)
+		}
+		card := utils.ActionCardMessage{
+			Title:       "未取餐提醒",
+			Markdown:    markdown.String(),
+			SingleTitle: "查看详情",
+			SingleURL:   fmt.Sprintf("%s/dingtalk_auth", config.Get().Website.Domain),
+		}
+
+		// 发送通知
+		if err := utils.SendDingTalkActionCard(teacherIDs[class], card); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", class, err))
+			continue
+		}
+
+		// 记录已提醒的学生
+		for _, stat := range byClass[class] {
+			if err := createNoShowAlert(stat, report.From, report.To, now); err != nil {
+				utils.LogError(fmt.Sprintf("记录学生ID=%d的未取餐提醒失败: %v", stat.StudentID, err))
+			}
+		}
+		count += len(byClass[class])
+	}
+
+	if len(failed) > 0 {
+		return count, fmt.Errorf("部分班级发送失败: %s", strings.Join(failed, "; "))
+	}
+	return count, nil
+}
+
+// getRecentNoShowAlerts 获取 since 之后已提醒的学生ID
+func getRecentNoShowAlerts(since time.Time) (map[int]bool, error) {
+	studentIDs, err := repos().NoShowAlerts.ListStudentIDsSince(since)
+	if err != nil {
+		return nil, err
+	}
+
+	alerted := make(map[int]bool)
+	for _, studentID := range studentIDs {
+		alerted[studentID] = true
+	}
+	return alerted, nil
+}
+
+// createNoShowAlert 记录一次未取餐提醒
+func createNoShowAlert(stat *NoShowStudentStat, from, to string, notifiedAt time.Time) error {
+	return repos().NoShowAlerts.Create(&NoShowAlert{
+		StudentID:   stat.StudentID,
+		Class:       stat.Class,
+		WindowStart: from,
+		WindowEnd:   to,
+		Expected:    stat.Expected,
+		NoShow:      stat.NoShow,
+		NotifiedAt:  notifiedAt,
+	})
+}
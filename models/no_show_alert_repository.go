@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/database"
+)
+
+// sqlNoShowAlertRepository 基于 SQL 数据库的未取餐提醒记录数据访问
+type sqlNoShowAlertRepository struct {
+	db database.Conn
+}
+
+func (r *sqlNoShowAlertRepository) Create(alert *NoShowAlert) error {
+	id, err := r.db.InsertID(
+		`INSERT INTO no_show_alerts (student_id, class, window_start, window_end, expected, no_show, notified_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		alert.StudentID, alert.Class, alert.WindowStart, alert.WindowEnd, alert.Expected, alert.NoShow, alert.NotifiedAt.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	alert.ID = int(id)
+	return nil
+}
+
+func (r *sqlNoShowAlertRepository) ListStudentIDsSince(since time.Time) ([]int, error) {
+	rows, err := r.db.Query("SELECT DISTINCT student_id FROM no_show_alerts WHERE notified_at >= ? ORDER BY student_id", since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var studentIDs []int
+	for rows.Next() {
+		var studentID int
+		if err := rows.Scan(&studentID); err != nil {
+			return nil, err
+		}
+		studentIDs = append(studentIDs, studentID)
+	}
+
+	return studentIDs, rows.Err()
+}
@@ -1,9 +1,5 @@
 package models
 
-import (
-	"github.com/itsHenry35/canteen-management-system/database"
-)
-
 // ParentStudentRelation 家长学生关系模型
 type ParentStudentRelation struct {
 	ID          int    `json:"id"`
@@ -15,105 +11,57 @@ type ParentStudentRelation struct {
 
 // GetStudentsByParentID 根据家长ID获取所有关联的学生
 func GetStudentsByParentID(parentID string) ([]*ParentStudentRelation, error) {
-	// 获取数据库连接
-	db := database.GetDB()
-
-	// 执行查询
-	rows, err := db.Query(`
-        SELECT psr.id, psr.parent_id, psr.student_id, psr.relation, s.full_name
-        FROM parent_student_relations psr
-        JOIN students s ON psr.student_id = s.dingtalk_id
-        WHERE psr.parent_id = ?
-    `, parentID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	// 处理结果
-	var relations []*ParentStudentRelation
-	for rows.Next() {
-		var relation ParentStudentRelation
-		err := rows.Scan(&relation.ID, &relation.ParentID, &relation.StudentID, &relation.Relation, &relation.StudentName)
-		if err != nil {
-			return nil, err
-		}
-		relations = append(relations, &relation)
-	}
-
-	return relations, nil
+	return repos().Relations.ListByParent(parentID)
 }
 
 // SaveParentStudentRelation 保存家长学生关系
 func SaveParentStudentRelation(parentID string, studentID string, relation string) error {
-	// 获取数据库连接
-	db := database.GetDB()
-
-	// 检查关系是否已存在
-	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM parent_student_relations WHERE parent_id = ? AND student_id = ? AND relation = ?",
-		parentID, studentID, relation).Scan(&count)
-	if err != nil {
-		return err
-	}
+	return repos().Relations.Save(&ParentStudentRelation{ParentID: parentID, StudentID: studentID, Relation: relation})
+}
 
-	// 如果关系已存在，不需要再次添加
-	if count > 0 {
-		return nil
-	}
+// ParentStudentRelationChange 家长学生关系描述变更
+type ParentStudentRelationChange struct {
+	ParentID    string `json:"parent_id"`    // 家长钉钉ID
+	StudentID   string `json:"student_id"`   // 学生钉钉ID
+	OldRelation string `json:"old_relation"` // 原关系描述
+	NewRelation string `json:"new_relation"` // 新关系描述
+}
 
-	// 插入新的关系
-	_, err = db.Exec(
-		"INSERT INTO parent_student_relations (parent_id, student_id, relation) VALUES (?, ?, ?)",
-		parentID, studentID, relation,
-	)
+// ParentStudentRelationDiff 家长学生关系差异
+type ParentStudentRelationDiff struct {
+	Added   []*ParentStudentRelation       `json:"added"`
+	Removed []*ParentStudentRelation       `json:"removed"`
+	Changed []*ParentStudentRelationChange `json:"changed"`
+}
 
-	return err
+// IsEmpty 判断差异是否为空
+func (d *ParentStudentRelationDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
 }
 
-// ClearAllParentStudentRelations 清空所有家长-学生关系
-func ClearAllParentStudentRelations() error {
-	// 获取数据库连接
-	db := database.GetDB()
+// GetAllParentStudentRelations 获取所有家长-学生关系
+func GetAllParentStudentRelations() ([]*ParentStudentRelation, error) {
+	return repos().Relations.List()
+}
 
-	// 删除所有关系
-	_, err := db.Exec("DELETE FROM parent_student_relations")
-	return err
+// ApplyParentStudentRelationDiff 在单个事务中应用家长-学生关系差异
+func ApplyParentStudentRelationDiff(diff *ParentStudentRelationDiff) error {
+	return repos().Relations.ApplyDiff(diff)
 }
 
 // GetParentsByStudentID 根据学生ID获取所有家长的钉钉ID
 func GetParentsByStudentID(studentID int) ([]string, error) {
-	// 获取数据库连接
-	db := database.GetDB()
-
 	// 首先获取学生的钉钉ID
-	var studentDingTalkID string
-	err := db.QueryRow("SELECT dingtalk_id FROM students WHERE id = ?", studentID).Scan(&studentDingTalkID)
+	student, err := repos().Students.GetByID(studentID)
 	if err != nil {
 		return nil, err
 	}
 
 	// 如果学生没有钉钉ID或钉钉ID为0，则返回空列表
-	if studentDingTalkID == "" || studentDingTalkID == "0" {
+	if student.DingTalkID == "" || student.DingTalkID == "0" {
 		return []string{}, nil
 	}
 
-	// 执行查询获取关联的家长ID
-	rows, err := db.Query("SELECT parent_id FROM parent_student_relations WHERE student_id = ?", studentDingTalkID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	// 收集家长ID
-	var parentIDs []string
-	for rows.Next() {
-		var parentID string
-		if err := rows.Scan(&parentID); err != nil {
-			return nil, err
-		}
-		parentIDs = append(parentIDs, parentID)
-	}
-
-	return parentIDs, nil
+	// 获取关联的家长ID
+	return repos().Relations.ListParentIDs(student.DingTalkID)
 }
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"github.com/itsHenry35/canteen-management-system/database"
+)
+
+// sqlParentStudentRelationRepository 基于 SQL 数据库的家长-学生关系数据访问
+type sqlParentStudentRelationRepository struct {
+	db database.Conn
+}
+
+func (r *sqlParentStudentRelationRepository) Save(relation *ParentStudentRelation) error {
+	// 已存在相同关系时由唯一约束忽略
+	_, err := r.db.Exec(
+		r.db.Dialect().InsertIgnore("INSERT INTO parent_student_relations (parent_id, student_id, relation) VALUES (?, ?, ?)"),
+		relation.ParentID, relation.StudentID, relation.Relation,
+	)
+	return err
+}
+
+func (r *sqlParentStudentRelationRepository) List() ([]*ParentStudentRelation, error) {
+	rows, err := r.db.Query("SELECT id, parent_id, student_id, relation FROM parent_student_relations ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var relations []*ParentStudentRelation
+	for rows.Next() {
+		var relation ParentStudentRelation
+		if err := rows.Scan(&relation.ID, &relation.ParentID, &relation.StudentID, &relation.Relation); err != nil {
+			return nil, err
+		}
+		relations = append(relations, &relation)
+	}
+
+	return relations, rows.Err()
+}
+
+func (r *sqlParentStudentRelationRepository) ListByParent(parentID string) ([]*ParentStudentRelation, error) {
+	rows, err := r.db.Query(`
+        SELECT psr.id, psr.parent_id, psr.student_id, psr.relation, s.full_name
+        FROM parent_student_relations psr
+        JOIN students s ON psr.student_id = s.dingtalk_id
+        WHERE psr.parent_id = ? AND s.archived = FALSE
+        ORDER BY psr.id
+    `, parentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var relations []*ParentStudentRelation
+	for rows.Next() {
+		var relation ParentStudentRelation
+		err := rows.Scan(&relation.ID, &relation.ParentID, &relation.StudentID, &relation.Relation, &relation.StudentName)
+		if err != nil {
+			return nil, err
+		}
+		relations = append(relations, &relation)
+	}
+
+	return relations, rows.Err()
+}
+
+func (r *sqlParentStudentRelationRepository) ListParentIDs(studentDingTalkID string) ([]string, error) {
+	rows, err := r.db.Query("SELECT parent_id FROM parent_student_relations WHERE student_id = ? ORDER BY id", studentDingTalkID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var parentIDs []string
+	for rows.Next() {
+		var parentID string
+		if err := rows.Scan(&parentID); err != nil {
+			return nil, err
+		}
+		parentIDs = append(parentIDs, parentID)
+	}
+
+	return parentIDs, rows.Err()
+}
+
+func (r *sqlParentStudentRelationRepository) ApplyDiff(diff *ParentStudentRelationDiff) error {
+	return database.WithTx(r.db, func(tx *database.Tx) error {
+		return applyRelationDiff(tx, diff)
+	})
+}
+
+// applyRelationDiff 在事务中应用家长-学生关系的差异
+func applyRelationDiff(tx *database.Tx, diff *ParentStudentRelationDiff) error {
+	// 删除已不存在的关系
+	for _, rel := range diff.Removed {
+		_, err := tx.Exec(
+			"DELETE FROM parent_student_relations WHERE parent_id = ? AND student_id = ? AND relation = ?",
+			rel.ParentID, rel.StudentID, rel.Relation,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 更新关系描述
+	for _, change := range diff.Changed {
+		_, err := tx.Exec(
+			"UPDATE parent_student_relations SET relation = ? WHERE parent_id = ? AND student_id = ? AND relation = ?",
+			change.NewRelation, change.ParentID, change.StudentID, change.OldRelation,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 插入新增的关系
+	for _, rel := range diff.Added {
+		_, err := tx.Exec(
+			tx.Dialect().InsertIgnore("INSERT INTO parent_student_relations (parent_id, student_id, relation) VALUES (?, ?, ?)"),
+			rel.ParentID, rel.StudentID, rel.Relation,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
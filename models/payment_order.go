@@ -0,0 +1,175 @@
+package models
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// 充值订单状态
+const (
+	PaymentStatusPending = "pending" // 待支付
+	PaymentStatusPaid    = "paid"    // 已支付并记入余额
+	PaymentStatusFailed  = "failed"  // 支付失败
+	PaymentStatusClosed  = "closed"  // 超时未支付，已关闭
+)
+
+// PaymentOrder 在线充值订单，金额单位为分
+type PaymentOrder struct {
+	ID                  int        `json:"id"`
+	OrderNo             string     `json:"order_no"`
+	StudentID           int        `json:"student_id"`
+	Amount              int        `json:"amount"`
+	Gateway             string     `json:"gateway"`
+	Status              string     `json:"status"`
+	TradeNo             string     `json:"trade_no"`              // 网关交易号
+	FailureReason       string     `json:"failure_reason"`        // 失败或关闭的原因
+	WalletTransactionID int        `json:"wallet_transaction_id"` // 支付成功后的充值流水
+	Operator            string     `json:"operator"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	PaidAt              *time.Time `json:"paid_at"`
+	StudentName         string     `json:"student_name,omitempty"`
+}
+
+// PaymentOrderFilter 充值订单查询条件，为空的条件不参与筛选
+type PaymentOrderFilter struct {
+	StudentID int
+	Status    string
+	Page      int // 从1开始
+	PageSize  int
+}
+
+// IsValidPaymentStatus 判断充值订单状态是否有效
+func IsValidPaymentStatus(status string) bool {
+	switch status {
+	case PaymentStatusPending, PaymentStatusPaid, PaymentStatusFailed, PaymentStatusClosed:
+		return true
+	}
+	return false
+}
+
+// newPaymentOrderNo 生成订单号：T + 时间 + 6位随机数
+func newPaymentOrderNo() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("T%s%06d", time.Now().Format("20060102150405"), n.Int64()), nil
+}
+
+// CreatePaymentOrder 创建待支付的充值订单
+func CreatePaymentOrder(studentID, amount int, gateway, operator string) (*PaymentOrder, error) {
+	if amount <= 0 {
+		return nil, errors.New("金额必须大于0")
+	}
+	if _, err := GetStudentByID(studentID); err != nil {
+		return nil, err
+	}
+	orderNo, err := newPaymentOrderNo()
+	if err != nil {
+		return nil, err
+	}
+
+	// 创建订单
+	now := time.Now()
+	order := &PaymentOrder{
+		OrderNo:   orderNo,
+		StudentID: studentID,
+		Amount:    amount,
+		Gateway:   gateway,
+		Status:    PaymentStatusPending,
+		Operator:  operator,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := repos().PaymentOrders.Create(order); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// GetPaymentOrderByNo 根据订单号获取充值订单
+func GetPaymentOrderByNo(orderNo string) (*PaymentOrder, error) {
+	return repos().PaymentOrders.GetByOrderNo(orderNo)
+}
+
+// GetPaymentOrders 分页查询充值订单，按创建时间倒序，同时返回总数
+func GetPaymentOrders(filter PaymentOrderFilter) ([]*PaymentOrder, int, error) {
+	return repos().PaymentOrders.List(filter)
+}
+
+// GetPendingPaymentOrders 获取所有待支付的订单，用于对账
+func GetPendingPaymentOrders() ([]*PaymentOrder, error) {
+	orders, _, err := GetPaymentOrders(PaymentOrderFilter{Status: PaymentStatusPending, PageSize: 1000})
+	return orders, err
+}
+
+// MarkPaymentOrderPaid 确认订单支付成功并记入余额，返回订单和本次是否入账
+// 重复的回调或对账不会重复入账；已失败或已关闭的订单如果网关确认已支付，仍然入账
+func MarkPaymentOrderPaid(orderNo, tradeNo string, amount int, paidAt time.Time) (*PaymentOrder, bool, error) {
+	order, err := GetPaymentOrderByNo(orderNo)
+	if err != nil {
+		return nil, false, err
+	}
+	if order.Status == PaymentStatusPaid {
+		return order, false, nil
+	}
+	if amount != order.Amount {
+		return nil, false, fmt.Errorf("支付金额 %s 元与订单金额 %s 元不一致", FormatAmount(amount), FormatAmount(order.Amount))
+	}
+	if paidAt.IsZero() {
+		paidAt = time.Now()
+	}
+
+	// 在单个事务中更新订单状态并记入余额
+	posted := false
+	err = repos().InTx(func(r *Repositories) error {
+		// 更新订单状态，并发的回调和对账只有一个能更新成功
+		updated, err := r.PaymentOrders.MarkPaid(orderNo, tradeNo, paidAt)
+		if err != nil || !updated {
+			return err
+		}
+
+		// 记入余额
+		entry := &WalletTransaction{
+			StudentID: order.StudentID,
+			Type:      WalletTypeTopUp,
+			Amount:    order.Amount,
+			Note:      "在线充值 " + orderNo,
+			Operator:  order.Operator,
+		}
+		if err := r.Wallets.Post(entry); err != nil {
+			return err
+		}
+		if err := r.PaymentOrders.SetWalletTransaction(orderNo, entry.ID); err != nil {
+			return err
+		}
+		posted = true
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	order, err = GetPaymentOrderByNo(orderNo)
+	return order, posted, err
+}
+
+// MarkPaymentOrderFailed 将待支付的订单标记为支付失败，订单不是待支付时不做修改
+func MarkPaymentOrderFailed(orderNo, reason string) error {
+	return finishPaymentOrder(orderNo, PaymentStatusFailed, reason)
+}
+
+// ClosePaymentOrder 关闭超时未支付的订单，订单不是待支付时不做修改
+func ClosePaymentOrder(orderNo, reason string) error {
+	return finishPaymentOrder(orderNo, PaymentStatusClosed, reason)
+}
+
+// finishPaymentOrder 将待支付的订单改为失败或关闭
+func finishPaymentOrder(orderNo, status, reason string) error {
+	return repos().PaymentOrders.Finish(orderNo, status, reason)
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/database"
+)
+
+// sqlPaymentOrderRepository 基于 SQL 数据库的充值订单数据访问
+type sqlPaymentOrderRepository struct {
+	db database.Conn
+}
+
+const paymentOrderColumns = `o.id, o.order_no, o.student_id, o.amount, o.gateway, o.status, o.trade_no, o.failure_reason,
+	o.wallet_transaction_id, o.operator, o.created_at, o.updated_at, o.paid_at, COALESCE(s.full_name, '')`
+
+// scanPaymentOrder 读取一行充值订单
+func scanPaymentOrder(row interface{ Scan(...interface{}) error }) (*PaymentOrder, error) {
+	var order PaymentOrder
+	var paidAt sql.NullTime
+	err := row.Scan(
+		&order.ID, &order.OrderNo, &order.StudentID, &order.Amount, &order.Gateway, &order.Status, &order.TradeNo,
+		&order.FailureReason, &order.WalletTransactionID, &order.Operator, &order.CreatedAt, &order.UpdatedAt,
+		&paidAt, &order.StudentName,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	if paidAt.Valid {
+		order.PaidAt = &paidAt.Time
+	}
+
+	return &order, nil
+}
+
+func (r *sqlPaymentOrderRepository) Create(order *PaymentOrder) error {
+	id, err := r.db.InsertID(
+		`INSERT INTO payment_orders (order_no, student_id, amount, gateway, status, operator, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		order.OrderNo, order.StudentID, order.Amount, order.Gateway, order.Status, order.Operator,
+		order.CreatedAt.UTC(), order.UpdatedAt.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	order.ID = int(id)
+	return nil
+}
+
+func (r *sqlPaymentOrderRepository) GetByOrderNo(orderNo string) (*PaymentOrder, error) {
+	return scanPaymentOrder(r.db.QueryRow(
+		"SELECT "+paymentOrderColumns+" FROM payment_orders o LEFT JOIN students s ON s.id = o.student_id WHERE o.order_no = ?",
+		orderNo,
+	))
+}
+
+func (r *sqlPaymentOrderRepository) List(filter PaymentOrderFilter) ([]*PaymentOrder, int, error) {
+	// 构建查询条件
+	var conditions []string
+	var args []interface{}
+	if filter.StudentID != 0 {
+		conditions = append(conditions, "o.student_id = ?")
+		args = append(args, filter.StudentID)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "o.status = ?")
+		args = append(args, filter.Status)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// 统计总数
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM payment_orders o "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	// 分页参数
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = 20
+	}
+
+	// 查询记录
+	rows, err := r.db.Query(
+		"SELECT "+paymentOrderColumns+" FROM payment_orders o LEFT JOIN students s ON s.id = o.student_id "+where+
+			" ORDER BY o.id DESC LIMIT ? OFFSET ?",
+		append(args, filter.PageSize, (filter.Page-1)*filter.PageSize)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	// 处理结果
+	orders := []*PaymentOrder{}
+	for rows.Next() {
+		order, err := scanPaymentOrder(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, total, rows.Err()
+}
+
+func (r *sqlPaymentOrderRepository) MarkPaid(orderNo, tradeNo string, paidAt time.Time) (bool, error) {
+	// 并发的回调和对账只有一个能更新成功
+	result, err := r.db.Exec(
+		`UPDATE payment_orders SET status = ?, trade_no = ?, failure_reason = '', paid_at = ?, updated_at = ?
+		WHERE order_no = ? AND status <> ?`,
+		PaymentStatusPaid, tradeNo, paidAt.UTC(), time.Now().UTC(), orderNo, PaymentStatusPaid,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *sqlPaymentOrderRepository) SetWalletTransaction(orderNo string, transactionID int) error {
+	_, err := r.db.Exec("UPDATE payment_orders SET wallet_transaction_id = ? WHERE order_no = ?", transactionID, orderNo)
+	return err
+}
+
+func (r *sqlPaymentOrderRepository) Finish(orderNo, status, reason string) error {
+	_, err := r.db.Exec(
+		"UPDATE payment_orders SET status = ?, failure_reason = ?, updated_at = ? WHERE order_no = ? AND status = ?",
+		status, reason, time.Now().UTC(), orderNo, PaymentStatusPending,
+	)
+	return err
+}
@@ -0,0 +1,177 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/config"
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+// ProductionClassCount 一个班级当天需要准备的份数
+type ProductionClassCount struct {
+	Class      string `json:"class"`
+	Students   int    `json:"students"`   // 在读学生数
+	TypeA      int    `json:"type_a"`     // A餐份数
+	TypeB      int    `json:"type_b"`     // B餐份数
+	Unselected int    `json:"unselected"` // 未选餐人数，不计入份数
+	Absent     int    `json:"absent"`     // 请假人数，不计入份数
+	Portions   int    `json:"portions"`   // 合计份数
+}
+
+// ProductionReport 某一天的备餐报表，按在读学生的选餐统计每个班级每个选项的份数，当天请假的学生不计入份数
+// 一个餐在领餐时间内每天的菜单相同，因此当天的份数即该餐的选餐人数
+type ProductionReport struct {
+	Date        string                  `json:"date"`                  // 日期（YYYY-MM-DD）
+	Meal        *Meal                   `json:"meal,omitempty"`        // 当天领餐的餐，没有餐或不供餐时为空
+	NotServing  string                  `json:"not_serving,omitempty"` // 校历中当天不供餐的原因，如节假日名称
+	Classes     []*ProductionClassCount `json:"classes"`               // 按班级排序
+	Total       ProductionClassCount    `json:"total"`                 // 合计，Class 为空
+	GeneratedAt time.Time               `json:"generated_at"`
+}
+
+// BuildProductionReport 生成指定日期（YYYY-MM-DD，服务器本地日期）的备餐报表
+// 当天没有餐或校历中当天不供餐时返回的报表 Meal 为空
+func BuildProductionReport(date string) (*ProductionReport, error) {
+	day, err := time.ParseInLocation(collectionDateLayout, date, time.Local)
+	if err != nil {
+		return nil, errors.New("无效的日期")
+	}
+	report := &ProductionReport{Date: date, Classes: []*ProductionClassCount{}, GeneratedAt: time.Now()}
+
+	// 校历中不供餐的日期
+	if serving, reason := IsServingDay(date); !serving {
+		report.NotServing = reason
+		return report, nil
+	}
+
+	// 查找当天领餐的餐，领餐时间不会重叠，因此最多一个
+	meals, err := getMealsServedBetween(repos(), day, day)
+	if err != nil {
+		return nil, err
+	}
+	if len(meals) == 0 {
+		return report, nil
+	}
+	meal := meals[0]
+	report.Meal = meal
+
+	// 获取选餐记录
+	selections, err := repos().Selections.ListByMeal(meal.ID)
+	if err != nil {
+		return nil, err
+	}
+	selectionByStudent := make(map[int]MealType)
+	for _, selection := range selections {
+		selectionByStudent[selection.StudentID] = selection.MealType
+	}
+
+	// 获取当天请假的学生
+	absent, err := getAbsenceDays(repos(), 0, date, date)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按在读学生统计
+	students, err := GetAllStudents()
+	if err != nil {
+		return nil, err
+	}
+	classes := make(map[string]*ProductionClassCount)
+	for _, student := range students {
+		count, ok := classes[student.Class]
+		if !ok {
+			count = &ProductionClassCount{Class: student.Class}
+			classes[student.Class] = count
+			report.Classes = append(report.Classes, count)
+		}
+		isAbsent := absent.absent(student.ID, date)
+		count.add(selectionByStudent[student.ID], isAbsent)
+		report.Total.add(selectionByStudent[student.ID], isAbsent)
+	}
+
+	// 班级按名称排序
+	sort.Slice(report.Classes, func(i, j int) bool {
+		return report.Classes[i].Class < report.Classes[j].Class
+	})
+
+	return report, nil
+}
+
+// add 统计一名学生，请假的学生不计入份数
+func (count *ProductionClassCount) add(mealType MealType, absent bool) {
+	count.Students++
+	if absent {
+		count.Absent++
+		return
+	}
+	switch mealType {
+	case MealTypeA:
+		count.TypeA++
+		count.Portions++
+	case MealTypeB:
+		count.TypeB++
+		count.Portions++
+	default:
+		count.Unselected++
+	}
+}
+
+// NotifyProductionReport 将备餐报表通过钉钉发送给食堂工作人员，返回通知的人数
+func NotifyProductionReport(report *ProductionReport) (int, error) {
+	// 收集食堂工作人员的钉钉ID
+	var dingTalkIDs []string
+	for _, role := range []Role{RoleCanteenA, RoleCanteenB} {
+		users, err := repos().Users.List(role)
+		if err != nil {
+			return 0, fmt.Errorf("获取食堂工作人员失败: %v", err)
+		}
+		for _, user := range users {
+			if user.DingTalkID != "" && user.DingTalkID != "0" {
+				dingTalkIDs = append(dingTalkIDs, user.DingTalkID)
+			}
+		}
+	}
+
+	// 如果没有需要通知的人，只记录日志
+	if len(dingTalkIDs) == 0 {
+		utils.LogError("没有找到绑定钉钉的食堂工作人员")
+		return 0, nil
+	}
+
+	// 构建消息
+	var markdown strings.Builder
+	fmt.Fprintf(&markdown, "## %s 备餐报表\n\n", report.Date)
+	if report.Meal == nil {
+		markdown.WriteString("今天没有需要领餐的餐。")
+	} else {
+		fmt.Fprintf(&markdown, "### %s\n\n", report.Meal.Name)
+		fmt.Fprintf(&markdown, "**A餐 %d 份，B餐 %d 份，合计 %d 份**", report.Total.TypeA, report.Total.TypeB, report.Total.Portions)
+		if report.Total.Unselected > 0 {
+			fmt.Fprintf(&markdown, "（另有 %d 人未选餐）", report.Total.Unselected)
+		}
+		if report.Total.Absent > 0 {
+			fmt.Fprintf(&markdown, "（另有 %d 人请假）", report.Total.Absent)
+		}
+		markdown.WriteString("\n\n")
+		for _, count := range report.Classes {
+			fmt.Fprintf(&markdown, "- %s：A餐 %d，B餐 %d\n", count.Class, count.TypeA, count.TypeB)
+		}
+	}
+	card := utils.ActionCardMessage{
+		Title:       fmt.Sprintf("%s 备餐报表", report.Date),
+		Markdown:    markdown.String(),
+		SingleTitle: "查看详情",
+		SingleURL:   fmt.Sprintf("%s/dingtalk_auth", config.Get().Website.Domain),
+	}
+
+	// 发送通知
+	if err := utils.SendDingTalkActionCard(dingTalkIDs, card); err != nil {
+		return 0, fmt.Errorf("发送备餐报表失败: %v", err)
+	}
+
+	return len(dingTalkIDs), nil
+}
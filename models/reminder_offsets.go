@@ -0,0 +1,62 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ReminderOffsets 选餐截止前发送提醒的时间偏移列表，如 ["24h", "6h", "1h"]
+// 在数据库中以逗号分隔的字符串保存，为空表示使用系统设置
+type ReminderOffsets []string
+
+// Durations 解析为时间间隔
+func (o ReminderOffsets) Durations() ([]time.Duration, error) {
+	durations := make([]time.Duration, 0, len(o))
+	for _, offset := range o {
+		d, err := time.ParseDuration(strings.TrimSpace(offset))
+		if err != nil {
+			return nil, fmt.Errorf("无效的提醒时间 %q，应为如 24h、90m 的格式", offset)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("提醒时间 %q 必须大于0", offset)
+		}
+		durations = append(durations, d)
+	}
+	return durations, nil
+}
+
+// Validate 校验所有偏移的格式
+func (o ReminderOffsets) Validate() error {
+	_, err := o.Durations()
+	return err
+}
+
+// Scan 实现 sql.Scanner
+func (o *ReminderOffsets) Scan(value interface{}) error {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		s = ""
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("无法将 %T 转换为提醒时间", value)
+	}
+
+	*o = nil
+	for _, offset := range strings.Split(s, ",") {
+		if offset = strings.TrimSpace(offset); offset != "" {
+			*o = append(*o, offset)
+		}
+	}
+	return nil
+}
+
+// Value 实现 driver.Valuer
+func (o ReminderOffsets) Value() (driver.Value, error) {
+	return strings.Join(o, ","), nil
+}
@@ -0,0 +1,197 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/database"
+)
+
+// ErrNotFound 仓储中未找到记录
+var ErrNotFound = errors.New("record not found")
+
+// UserRepository 用户数据访问
+type UserRepository interface {
+	Create(user *User) error // user.Password 为哈希后的密码，成功后回填 ID
+	GetByID(id int) (*User, error)
+	GetByUsername(username string) (*User, error)
+	GetByDingTalkID(dingTalkID string) (*User, error)
+	List(role Role) ([]*User, error) // role 为空时返回所有用户
+	Update(user *User) error         // 更新姓名和钉钉ID
+	UpdatePassword(id int, hashedPassword string) error
+	Delete(id int) error
+}
+
+// StudentRepository 学生数据访问
+type StudentRepository interface {
+	Create(fullName, class, dingTalkID string) (*Student, error)                       // 生成唯一用户名后写入
+	CreateWithUsername(username, fullName, class, dingTalkID string) (*Student, error) // 使用指定的用户名写入，username 为空时同 Create
+	GetByID(id int) (*Student, error)
+	GetByDingTalkID(dingTalkID string) (*Student, error) // 只查找在读学生
+	List(includeArchived bool) ([]*Student, error)       // 按班级、姓名排序
+	Update(student *Student) error
+	Delete(id int) error // 同时删除该学生的选餐记录和取餐记录，有余额、余额流水或充值订单时返回 ErrStudentHasWallet
+}
+
+// MealRepository 餐数据访问
+type MealRepository interface {
+	Create(meal *Meal) error // 成功后回填 ID
+	GetByID(id int) (*Meal, error)
+	GetEffectiveAt(t time.Time) (*Meal, error)                         // 领餐时间包含 t 的餐
+	List() ([]*Meal, error)                                            // 未归档的餐，按领餐开始时间排序
+	ListArchived(from, to time.Time) ([]*Meal, error)                  // 领餐时间与 [from, to] 重叠的已归档餐，零值表示不限制
+	ListSelectable(now time.Time) (current, future []*Meal, err error) // 正在选餐与尚未开始选餐的餐
+	ListEndedBefore(t time.Time) ([]*Meal, error)                      // 领餐已结束但未归档的餐
+	ListArchivedEndedBefore(t time.Time) ([]*Meal, error)              // 领餐在 t 之前结束的已归档餐
+	CountOverlapping(excludeID int, start, end time.Time) (int, error) // 领餐时间与 [start, end] 重叠的其他餐数
+	Update(meal *Meal) error
+	Archive(id int, at time.Time) error // 已归档的餐保持原归档时间
+	Delete(id int) error                // 同时删除该餐的选餐记录、取餐记录和餐模板的生成记录
+}
+
+// MealSelectionRepository 选餐记录数据访问
+type MealSelectionRepository interface {
+	Save(selection *MealSelection) error              // 按学生和餐新增或更新，成功后回填 ID
+	SaveAll(selections []*MealSelection) (int, error) // 在单个事务中保存，返回保存的记录数
+	GetByStudentAndMeal(studentID, mealID int) (*MealSelection, error)
+	ListByStudent(studentID int) ([]*MealSelection, error)
+	ListByMeal(mealID int) ([]*MealSelection, error)
+	ListHistory(studentID, mealID int) ([]*MealSelectionHistory, error) // 为0的条件不参与筛选，按时间倒序
+}
+
+// ParentStudentRelationRepository 家长-学生关系数据访问
+type ParentStudentRelationRepository interface {
+	Save(relation *ParentStudentRelation) error                     // 已存在相同关系时忽略
+	List() ([]*ParentStudentRelation, error)                        // 按 ID 排序
+	ListByParent(parentID string) ([]*ParentStudentRelation, error) // 只包含在读学生，并填充学生姓名
+	ListParentIDs(studentDingTalkID string) ([]string, error)
+	ApplyDiff(diff *ParentStudentRelationDiff) error // 在单个事务中应用差异
+}
+
+// WalletRepository 余额和余额流水数据访问
+type WalletRepository interface {
+	GetBalance(studentID int) (int, error)                                  // 没有钱包时为0
+	LockBalance(studentID int) (int, error)                                 // 锁定钱包后读取余额，在 InTx 中调用时其他记账等待事务结束
+	Post(entry *WalletTransaction) error                                    // 更新余额并追加流水，成功后回填 ID、记账后余额和时间
+	List(filter WalletTransactionFilter) ([]*WalletTransaction, int, error) // 按时间倒序分页，同时返回总数
+	SelectionChargeNet(studentID, mealID int) (int, error)                  // 该餐按选餐扣费的净额（扣费为负，退款为正）
+	HasSelectionCharges(studentID, mealID int) (bool, error)                // 该餐是否有按选餐扣费的流水，包括已全部退还的
+}
+
+// PaymentOrderRepository 充值订单数据访问
+type PaymentOrderRepository interface {
+	Create(order *PaymentOrder) error // 成功后回填 ID
+	GetByOrderNo(orderNo string) (*PaymentOrder, error)
+	List(filter PaymentOrderFilter) ([]*PaymentOrder, int, error)     // 按创建时间倒序分页，同时返回总数
+	MarkPaid(orderNo, tradeNo string, paidAt time.Time) (bool, error) // 订单已支付时不修改，返回 false
+	SetWalletTransaction(orderNo string, transactionID int) error     // 记录入账的充值流水
+	Finish(orderNo, status, reason string) error                      // 只修改待支付的订单
+}
+
+// AbsenceRepository 请假记录数据访问，日期均为 YYYY-MM-DD
+type AbsenceRepository interface {
+	Create(absence *Absence) error                                // 成功后回填 ID
+	CountOverlapping(studentID int, from, to string) (int, error) // 学生与 [from, to] 重叠的请假数
+	GetByID(id int) (*Absence, error)
+	List(filter AbsenceFilter) ([]*Absence, int, error)             // 按开始日期倒序分页，同时返回总数
+	ListBetween(studentID int, from, to string) ([]*Absence, error) // 与 [from, to] 重叠的请假，studentID 为0时包括所有学生
+	Delete(id int) error
+}
+
+// CalendarEventRepository 校历事件数据访问
+type CalendarEventRepository interface {
+	Create(event *CalendarEvent) error // 成功后回填 ID
+	GetByID(id int) (*CalendarEvent, error)
+	GetByUID(uid string) (*CalendarEvent, error)
+	List(from, to, eventType string) ([]*CalendarEvent, error) // 与 [from, to] 重叠的事件，按开始日期排序；为空的条件不参与筛选
+	Update(event *CalendarEvent) error                         // 更新类型、名称和日期
+	Delete(id int) error
+}
+
+// MealTemplateRepository 餐模板数据访问
+type MealTemplateRepository interface {
+	Create(template *MealTemplate) error // 成功后回填 ID
+	GetByID(id int) (*MealTemplate, error)
+	List() ([]*MealTemplate, error) // 按 ID 排序
+	Update(template *MealTemplate) error
+	Delete(id int) error                                        // 同时删除生成记录，已生成的餐保留
+	GetMealID(templateID int, weekStart string) (int, error)    // 模板在该周生成的餐，未生成时返回 ErrNotFound
+	AddMeal(templateID int, weekStart string, mealID int) error // 记录模板在该周生成的餐
+}
+
+// NoShowAlertRepository 未取餐提醒记录数据访问
+type NoShowAlertRepository interface {
+	Create(alert *NoShowAlert) error                    // 成功后回填 ID
+	ListStudentIDsSince(since time.Time) ([]int, error) // since 之后提醒过的学生
+}
+
+// Repositories 各实体的数据访问
+type Repositories struct {
+	Users          UserRepository
+	Students       StudentRepository
+	Meals          MealRepository
+	Selections     MealSelectionRepository
+	Relations      ParentStudentRelationRepository
+	Wallets        WalletRepository
+	PaymentOrders  PaymentOrderRepository
+	Absences       AbsenceRepository
+	CalendarEvents CalendarEventRepository
+	MealTemplates  MealTemplateRepository
+	NoShowAlerts   NoShowAlertRepository
+
+	// inTx 开始事务并传入绑定该事务的数据访问，为空时表示不支持事务或已在事务中
+	inTx func(fn func(r *Repositories) error) error
+}
+
+// InTx 在单个事务中执行 fn，fn 通过 r 进行的读写都在该事务内，fn 返回错误时全部回滚
+// 已在事务中时直接执行，由外层事务提交或回滚
+func (r *Repositories) InTx(fn func(r *Repositories) error) error {
+	if r.inTx == nil {
+		return fn(r)
+	}
+	return r.inTx(fn)
+}
+
+// NewSQLRepositories 创建基于 SQL 数据库的数据访问，SQLite 和 PostgreSQL 的差异由 db 的方言处理
+func NewSQLRepositories(db *database.DB) *Repositories {
+	r := newSQLRepositories(db)
+	r.inTx = func(fn func(r *Repositories) error) error {
+		return database.WithTx(db, func(tx *database.Tx) error {
+			return fn(newSQLRepositories(tx))
+		})
+	}
+	return r
+}
+
+// newSQLRepositories 创建基于数据库连接或事务的数据访问
+func newSQLRepositories(conn database.Conn) *Repositories {
+	return &Repositories{
+		Users:          &sqlUserRepository{db: conn},
+		Students:       &sqlStudentRepository{db: conn},
+		Meals:          &sqlMealRepository{db: conn},
+		Selections:     &sqlMealSelectionRepository{db: conn},
+		Relations:      &sqlParentStudentRelationRepository{db: conn},
+		Wallets:        &sqlWalletRepository{db: conn},
+		PaymentOrders:  &sqlPaymentOrderRepository{db: conn},
+		Absences:       &sqlAbsenceRepository{db: conn},
+		CalendarEvents: &sqlCalendarEventRepository{db: conn},
+		MealTemplates:  &sqlMealTemplateRepository{db: conn},
+		NoShowAlerts:   &sqlNoShowAlertRepository{db: conn},
+	}
+}
+
+// repositoryOverride 替换默认的数据访问，为空时使用当前数据库连接
+var repositoryOverride *Repositories
+
+// SetRepositories 替换模型使用的数据访问，传入 nil 时恢复为当前数据库连接
+func SetRepositories(r *Repositories) {
+	repositoryOverride = r
+}
+
+// repos 返回模型使用的数据访问
+func repos() *Repositories {
+	if repositoryOverride != nil {
+		return repositoryOverride
+	}
+	return NewSQLRepositories(database.GetDB())
+}
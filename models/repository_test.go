@@ -0,0 +1,29 @@
+package models_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/itsHenry35/canteen-management-system/database"
+	"github.com/itsHenry35/canteen-management-system/models"
+	"github.com/itsHenry35/canteen-management-system/models/repotest"
+)
+
+// TestSQLiteRepositories 每个子测试使用临时目录中的新数据库文件
+func TestSQLiteRepositories(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) *models.Repositories {
+		return repotest.Open(t, database.DialectSQLite, filepath.Join(t.TempDir(), "canteen.db"))
+	})
+}
+
+// TestPostgresRepositories 需要通过 CANTEEN_TEST_POSTGRES_DSN 指定一个可清空的测试数据库
+func TestPostgresRepositories(t *testing.T) {
+	dsn := os.Getenv("CANTEEN_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("CANTEEN_TEST_POSTGRES_DSN not set")
+	}
+	repotest.Run(t, func(t *testing.T) *models.Repositories {
+		return repotest.Open(t, database.DialectPostgres, dsn)
+	})
+}
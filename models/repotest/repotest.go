@@ -0,0 +1,822 @@
+// Package repotest 提供数据访问的通用测试，SQLite 和 PostgreSQL 的实现都应通过同一组测试。
+//
+// SQLite 和 PostgreSQL 的测试入口见 models/repository_test.go，PostgreSQL 测试需设置 CANTEEN_TEST_POSTGRES_DSN。
+package repotest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/database"
+	"github.com/itsHenry35/canteen-management-system/models"
+)
+
+// Open 连接数据库、执行迁移并清空数据表，返回基于该数据库的数据访问，测试结束时关闭连接
+func Open(t *testing.T, dialect database.Dialect, dsn string) *models.Repositories {
+	t.Helper()
+
+	db, err := database.Connect(dialect, dsn)
+	if err != nil {
+		t.Fatalf("connect %s: %v", dialect, err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.MigrateTo(0); err != nil {
+		t.Fatalf("migrate %s: %v", dialect, err)
+	}
+
+	// 按外键依赖顺序清空数据表
+	for _, table := range []string{"no_show_alerts", "wallet_transactions", "student_wallets", "payment_orders", "student_absences", "calendar_events", "meal_template_meals", "meal_templates", "meal_collections", "meal_selection_history", "meal_selections", "parent_student_relations", "meals", "students", "users"} {
+		if _, err := db.Exec("DELETE FROM " + table); err != nil {
+			t.Fatalf("clear %s: %v", table, err)
+		}
+	}
+
+	return models.NewSQLRepositories(db)
+}
+
+// Run 运行通用测试，每个子测试调用 newRepositories 获取基于空数据库的数据访问
+func Run(t *testing.T, newRepositories func(t *testing.T) *models.Repositories) {
+	t.Run("Users", func(t *testing.T) { testUsers(t, newRepositories(t)) })
+	t.Run("Students", func(t *testing.T) { testStudents(t, newRepositories(t)) })
+	t.Run("Meals", func(t *testing.T) { testMeals(t, newRepositories(t)) })
+	t.Run("Selections", func(t *testing.T) { testSelections(t, newRepositories(t)) })
+	t.Run("Relations", func(t *testing.T) { testRelations(t, newRepositories(t)) })
+	t.Run("Wallets", func(t *testing.T) { testWallets(t, newRepositories(t)) })
+	t.Run("PaymentOrders", func(t *testing.T) { testPaymentOrders(t, newRepositories(t)) })
+	t.Run("Absences", func(t *testing.T) { testAbsences(t, newRepositories(t)) })
+	t.Run("CalendarEvents", func(t *testing.T) { testCalendarEvents(t, newRepositories(t)) })
+	t.Run("MealTemplates", func(t *testing.T) { testMealTemplates(t, newRepositories(t)) })
+	t.Run("NoShowAlerts", func(t *testing.T) { testNoShowAlerts(t, newRepositories(t)) })
+	t.Run("Transactions", func(t *testing.T) { testTransactions(t, newRepositories(t)) })
+}
+
+func testUsers(t *testing.T, r *models.Repositories) {
+	admin := &models.User{Username: "admin", Password: "hash", FullName: "管理员", Role: models.RoleAdmin, DingTalkID: "0"}
+	canteen := &models.User{Username: "canteen", Password: "hash", FullName: "食堂", Role: models.RoleCanteenA, DingTalkID: "u1"}
+	for _, user := range []*models.User{admin, canteen} {
+		if err := r.Users.Create(user); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+		if user.ID == 0 {
+			t.Fatalf("create user %s: id not set", user.Username)
+		}
+	}
+
+	// 重复的用户名
+	if err := r.Users.Create(&models.User{Username: "admin", Password: "hash", Role: models.RoleAdmin}); err == nil {
+		t.Errorf("create duplicate username: expected error")
+	}
+
+	// 查询
+	got, err := r.Users.GetByUsername("canteen")
+	if err != nil || got.ID != canteen.ID || got.Password != "hash" || got.Role != models.RoleCanteenA {
+		t.Errorf("get by username = %+v, %v", got, err)
+	}
+	if got, err := r.Users.GetByDingTalkID("u1"); err != nil || got.ID != canteen.ID {
+		t.Errorf("get by dingtalk id = %+v, %v", got, err)
+	}
+	if _, err := r.Users.GetByID(canteen.ID + 100); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("get missing user: err = %v, want ErrNotFound", err)
+	}
+
+	// 按角色列出
+	if users, err := r.Users.List(models.RoleCanteenA); err != nil || len(users) != 1 || users[0].ID != canteen.ID {
+		t.Errorf("list canteen_a = %v, %v", users, err)
+	}
+	if users, err := r.Users.List(""); err != nil || len(users) != 2 {
+		t.Errorf("list all = %v, %v", users, err)
+	}
+
+	// 更新
+	canteen.FullName = "食堂A"
+	canteen.DingTalkID = "u2"
+	if err := r.Users.Update(canteen); err != nil {
+		t.Fatalf("update user: %v", err)
+	}
+	if err := r.Users.UpdatePassword(canteen.ID, "newhash"); err != nil {
+		t.Fatalf("update password: %v", err)
+	}
+	got, err = r.Users.GetByID(canteen.ID)
+	if err != nil || got.FullName != "食堂A" || got.DingTalkID != "u2" || got.Password != "newhash" {
+		t.Errorf("after update = %+v, %v", got, err)
+	}
+
+	// 删除
+	if err := r.Users.Delete(canteen.ID); err != nil {
+		t.Fatalf("delete user: %v", err)
+	}
+	if _, err := r.Users.GetByID(canteen.ID); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("get deleted user: err = %v, want ErrNotFound", err)
+	}
+}
+
+func testStudents(t *testing.T, r *models.Repositories) {
+	zhang, err := r.Students.Create("张三", "一班", "s1")
+	if err != nil {
+		t.Fatalf("create student: %v", err)
+	}
+	li, err := r.Students.Create("李四", "一班", "")
+	if err != nil {
+		t.Fatalf("create student: %v", err)
+	}
+	if zhang.ID == 0 || zhang.Username == "" || zhang.Username == li.Username {
+		t.Fatalf("created students %+v, %+v", zhang, li)
+	}
+
+	// 指定用户名时不能与现有用户名重复
+	wang, err := r.Students.CreateWithUsername("wang.wu", "王五", "二班", "")
+	if err != nil || wang.Username != "wang.wu" {
+		t.Fatalf("create with username = %+v, %v", wang, err)
+	}
+	if _, err := r.Students.CreateWithUsername("wang.wu", "赵六", "二班", ""); err == nil {
+		t.Errorf("create with duplicate username: expected error")
+	}
+	if err := r.Students.Delete(wang.ID); err != nil {
+		t.Fatalf("delete student: %v", err)
+	}
+
+	// 查询
+	if got, err := r.Students.GetByDingTalkID("s1"); err != nil || got.ID != zhang.ID {
+		t.Errorf("get by dingtalk id = %+v, %v", got, err)
+	}
+	if _, err := r.Students.GetByID(li.ID + 100); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("get missing student: err = %v, want ErrNotFound", err)
+	}
+
+	// 更新
+	collected := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	li.Class = "二班"
+	li.DingTalkID = "s2"
+	li.LastMealCollectionDate = &collected
+	if err := r.Students.Update(li); err != nil {
+		t.Fatalf("update student: %v", err)
+	}
+	got, err := r.Students.GetByID(li.ID)
+	if err != nil || got.Class != "二班" || got.DingTalkID != "s2" ||
+		got.LastMealCollectionDate == nil || !got.LastMealCollectionDate.Equal(collected) {
+		t.Errorf("after update = %+v, %v", got, err)
+	}
+
+	// 按班级排序
+	students, err := r.Students.List(false)
+	if err != nil || len(students) != 2 || students[0].ID != zhang.ID || students[1].ID != li.ID {
+		t.Errorf("list students = %v, %v", students, err)
+	}
+
+	// 删除学生时同时删除选餐记录
+	meal := newMeal(t, r, time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC))
+	if err := r.Selections.Save(&models.MealSelection{StudentID: li.ID, MealID: meal.ID, MealType: models.MealTypeA}); err != nil {
+		t.Fatalf("save selection: %v", err)
+	}
+	if err := r.Students.Delete(li.ID); err != nil {
+		t.Fatalf("delete student: %v", err)
+	}
+	if selections, err := r.Selections.ListByMeal(meal.ID); err != nil || len(selections) != 0 {
+		t.Errorf("selections after delete = %v, %v", selections, err)
+	}
+}
+
+// newMeal 创建从 start 开始领餐一天、提前两天选餐的餐
+func newMeal(t *testing.T, r *models.Repositories, start time.Time) *models.Meal {
+	t.Helper()
+	meal := &models.Meal{
+		Name:               "餐" + start.Format("0102"),
+		SelectionStartTime: start.AddDate(0, 0, -2),
+		SelectionEndTime:   start.AddDate(0, 0, -1),
+		EffectiveStartDate: start,
+		EffectiveEndDate:   start.Add(24*time.Hour - time.Second),
+		ImagePath:          "/images/meal.jpg",
+	}
+	if err := r.Meals.Create(meal); err != nil {
+		t.Fatalf("create meal: %v", err)
+	}
+	return meal
+}
+
+func testMeals(t *testing.T, r *models.Repositories) {
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 0, 0, 0, 0, time.UTC) }
+	first := newMeal(t, r, day(10))
+	second := newMeal(t, r, day(12))
+	if first.ID == 0 || second.ID == first.ID {
+		t.Fatalf("created meals %+v, %+v", first, second)
+	}
+
+	// 读取后字段保持一致
+	first.ReminderOffsets = models.ReminderOffsets{"24h0m0s", "1h0m0s"}
+	if err := r.Meals.Update(first); err != nil {
+		t.Fatalf("update meal: %v", err)
+	}
+	got, err := r.Meals.GetByID(first.ID)
+	if err != nil {
+		t.Fatalf("get meal: %v", err)
+	}
+	if !got.SelectionStartTime.Equal(first.SelectionStartTime) || !got.EffectiveEndDate.Equal(first.EffectiveEndDate) ||
+		got.Name != first.Name || got.ImagePath != first.ImagePath || !reflect.DeepEqual(got.ReminderOffsets, first.ReminderOffsets) {
+		t.Errorf("get meal = %+v, want %+v", got, first)
+	}
+	if _, err := r.Meals.GetByID(second.ID + 100); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("get missing meal: err = %v, want ErrNotFound", err)
+	}
+
+	// 按时间查询
+	if got, err := r.Meals.GetEffectiveAt(day(12).Add(8 * time.Hour)); err != nil || got.ID != second.ID {
+		t.Errorf("effective at day 12 = %+v, %v", got, err)
+	}
+	if _, err := r.Meals.GetEffectiveAt(day(11).Add(8 * time.Hour)); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("effective at day 11: err = %v, want ErrNotFound", err)
+	}
+	current, future, err := r.Meals.ListSelectable(day(8).Add(time.Hour))
+	if err != nil || len(current) != 1 || current[0].ID != first.ID || len(future) != 1 || future[0].ID != second.ID {
+		t.Errorf("selectable on day 8 = %v, %v, %v", current, future, err)
+	}
+	if ended, err := r.Meals.ListEndedBefore(day(12)); err != nil || len(ended) != 1 || ended[0].ID != first.ID {
+		t.Errorf("ended before day 12 = %v, %v", ended, err)
+	}
+	if meals, err := r.Meals.List(); err != nil || len(meals) != 2 || meals[0].ID != first.ID {
+		t.Errorf("list meals = %v, %v", meals, err)
+	}
+
+	// 领餐时间重叠
+	if n, err := r.Meals.CountOverlapping(0, day(10).Add(time.Hour), day(12).Add(time.Hour)); err != nil || n != 2 {
+		t.Errorf("overlapping = %d, %v, want 2", n, err)
+	}
+	if n, err := r.Meals.CountOverlapping(first.ID, day(10), day(11)); err != nil || n != 0 {
+		t.Errorf("overlapping excluding self = %d, %v, want 0", n, err)
+	}
+
+	// 归档
+	if err := r.Meals.Archive(first.ID, day(12)); err != nil {
+		t.Fatalf("archive meal: %v", err)
+	}
+	if err := r.Meals.Archive(first.ID, day(13)); err != nil {
+		t.Fatalf("archive meal again: %v", err)
+	}
+	if got, err := r.Meals.GetByID(first.ID); err != nil || got.ArchivedAt == nil || !got.ArchivedAt.Equal(day(12)) {
+		t.Errorf("get archived meal = %+v, %v", got, err)
+	}
+	if meals, err := r.Meals.List(); err != nil || len(meals) != 1 || meals[0].ID != second.ID {
+		t.Errorf("list meals after archive = %v, %v", meals, err)
+	}
+	if ended, err := r.Meals.ListEndedBefore(day(12)); err != nil || len(ended) != 0 {
+		t.Errorf("ended before day 12 after archive = %v, %v", ended, err)
+	}
+	if archived, err := r.Meals.ListArchived(day(1), day(10)); err != nil || len(archived) != 1 || archived[0].ID != first.ID {
+		t.Errorf("archived between day 1 and 10 = %v, %v", archived, err)
+	}
+	if archived, err := r.Meals.ListArchived(day(11), time.Time{}); err != nil || len(archived) != 0 {
+		t.Errorf("archived since day 11 = %v, %v", archived, err)
+	}
+	if archived, err := r.Meals.ListArchivedEndedBefore(day(11)); err != nil || len(archived) != 1 || archived[0].ID != first.ID {
+		t.Errorf("archived ended before day 11 = %v, %v", archived, err)
+	}
+	if archived, err := r.Meals.ListArchivedEndedBefore(day(10)); err != nil || len(archived) != 0 {
+		t.Errorf("archived ended before day 10 = %v, %v", archived, err)
+	}
+
+	// 删除
+	if err := r.Meals.Delete(first.ID); err != nil {
+		t.Fatalf("delete meal: %v", err)
+	}
+	if _, err := r.Meals.GetByID(first.ID); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("get deleted meal: err = %v, want ErrNotFound", err)
+	}
+}
+
+func testSelections(t *testing.T, r *models.Repositories) {
+	zhang, err := r.Students.Create("张三", "一班", "s1")
+	if err != nil {
+		t.Fatalf("create student: %v", err)
+	}
+	li, err := r.Students.Create("李四", "一班", "s2")
+	if err != nil {
+		t.Fatalf("create student: %v", err)
+	}
+	meal := newMeal(t, r, time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC))
+
+	// 新增后再次保存为更新
+	selection := &models.MealSelection{StudentID: zhang.ID, MealID: meal.ID, MealType: models.MealTypeA, Source: models.SelectionSourceStudent}
+	if err := r.Selections.Save(selection); err != nil || selection.ID == 0 {
+		t.Fatalf("save selection: id=%d, %v", selection.ID, err)
+	}
+	again := &models.MealSelection{StudentID: zhang.ID, MealID: meal.ID, MealType: models.MealTypeB, Operator: "admin", Source: models.SelectionSourceAdmin}
+	if err := r.Selections.Save(again); err != nil || again.ID != selection.ID {
+		t.Fatalf("save again: id=%d, want %d, %v", again.ID, selection.ID, err)
+	}
+	got, err := r.Selections.GetByStudentAndMeal(zhang.ID, meal.ID)
+	if err != nil || got.MealType != models.MealTypeB || got.Operator != "admin" || got.Source != models.SelectionSourceAdmin {
+		t.Errorf("get selection = %+v, %v", got, err)
+	}
+	if _, err := r.Selections.GetByStudentAndMeal(li.ID, meal.ID); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("get missing selection: err = %v, want ErrNotFound", err)
+	}
+
+	// 批量保存
+	count, err := r.Selections.SaveAll([]*models.MealSelection{
+		{StudentID: zhang.ID, MealID: meal.ID, MealType: models.MealTypeA, Operator: "admin"},
+		{StudentID: li.ID, MealID: meal.ID, MealType: models.MealTypeA, Operator: "admin"},
+	})
+	if err != nil || count != 2 {
+		t.Fatalf("save all = %d, %v", count, err)
+	}
+	if selections, err := r.Selections.ListByMeal(meal.ID); err != nil || len(selections) != 2 || selections[0].MealType != models.MealTypeA {
+		t.Errorf("list by meal = %v, %v", selections, err)
+	}
+	if selections, err := r.Selections.ListByStudent(li.ID); err != nil || len(selections) != 1 || selections[0].MealID != meal.ID {
+		t.Errorf("list by student = %v, %v", selections, err)
+	}
+
+	// 每次保存都追加变更历史，按时间倒序
+	history, err := r.Selections.ListHistory(zhang.ID, meal.ID)
+	if err != nil || len(history) != 3 {
+		t.Fatalf("list history = %v, %v", history, err)
+	}
+	if history[2].PreviousMealType != "" || history[2].NewMealType != models.MealTypeA || history[2].Source != models.SelectionSourceStudent {
+		t.Errorf("first history entry = %+v", history[2])
+	}
+	if history[1].PreviousMealType != models.MealTypeA || history[1].NewMealType != models.MealTypeB || history[1].Operator != "admin" {
+		t.Errorf("second history entry = %+v", history[1])
+	}
+	if history, err := r.Selections.ListHistory(0, meal.ID); err != nil || len(history) != 4 {
+		t.Errorf("list history by meal = %v, %v", history, err)
+	}
+
+	// 删除餐时同时删除选餐记录
+	if err := r.Meals.Delete(meal.ID); err != nil {
+		t.Fatalf("delete meal: %v", err)
+	}
+	if selections, err := r.Selections.ListByStudent(zhang.ID); err != nil || len(selections) != 0 {
+		t.Errorf("selections after meal delete = %v, %v", selections, err)
+	}
+	if history, err := r.Selections.ListHistory(0, meal.ID); err != nil || len(history) != 0 {
+		t.Errorf("history after meal delete = %v, %v", history, err)
+	}
+}
+
+func testRelations(t *testing.T, r *models.Repositories) {
+	if _, err := r.Students.Create("张三", "一班", "s1"); err != nil {
+		t.Fatalf("create student: %v", err)
+	}
+
+	// 重复保存相同关系时忽略
+	for i := 0; i < 2; i++ {
+		if err := r.Relations.Save(&models.ParentStudentRelation{ParentID: "p1", StudentID: "s1", Relation: "父亲"}); err != nil {
+			t.Fatalf("save relation: %v", err)
+		}
+	}
+	if err := r.Relations.Save(&models.ParentStudentRelation{ParentID: "p2", StudentID: "s1", Relation: "母亲"}); err != nil {
+		t.Fatalf("save relation: %v", err)
+	}
+	if relations, err := r.Relations.List(); err != nil || len(relations) != 2 {
+		t.Errorf("list relations = %v, %v", relations, err)
+	}
+
+	// 按家长查询时填充学生姓名
+	relations, err := r.Relations.ListByParent("p1")
+	if err != nil || len(relations) != 1 || relations[0].StudentName != "张三" {
+		t.Errorf("list by parent = %v, %v", relations, err)
+	}
+	if parents, err := r.Relations.ListParentIDs("s1"); err != nil || !reflect.DeepEqual(parents, []string{"p1", "p2"}) {
+		t.Errorf("parent ids = %v, %v", parents, err)
+	}
+
+	// 应用差异
+	diff := &models.ParentStudentRelationDiff{
+		Added:   []*models.ParentStudentRelation{{ParentID: "p3", StudentID: "s1", Relation: "爷爷"}, {ParentID: "p2", StudentID: "s1", Relation: "母亲"}},
+		Removed: []*models.ParentStudentRelation{{ParentID: "p1", StudentID: "s1", Relation: "父亲"}},
+		Changed: []*models.ParentStudentRelationChange{{ParentID: "p2", StudentID: "s1", OldRelation: "母亲", NewRelation: "妈妈"}},
+	}
+	if err := r.Relations.ApplyDiff(diff); err != nil {
+		t.Fatalf("apply diff: %v", err)
+	}
+	relations, err = r.Relations.List()
+	if err != nil {
+		t.Fatalf("list relations: %v", err)
+	}
+	got := map[string]string{}
+	for _, rel := range relations {
+		got[rel.ParentID+"/"+rel.Relation] = rel.StudentID
+	}
+	want := map[string]string{"p2/妈妈": "s1", "p2/母亲": "s1", "p3/爷爷": "s1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("relations after diff = %v, want %v", got, want)
+	}
+}
+
+// newStudent 创建学生
+func newStudent(t *testing.T, r *models.Repositories, fullName, class string) *models.Student {
+	t.Helper()
+	student, err := r.Students.Create(fullName, class, "")
+	if err != nil {
+		t.Fatalf("create student: %v", err)
+	}
+	return student
+}
+
+func testWallets(t *testing.T, r *models.Repositories) {
+	zhang := newStudent(t, r, "张三", "一班")
+	li := newStudent(t, r, "李四", "一班")
+	meal := newMeal(t, r, time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC))
+
+	// 没有钱包时余额为0
+	if balance, err := r.Wallets.GetBalance(zhang.ID); err != nil || balance != 0 {
+		t.Errorf("balance without wallet = %d, %v", balance, err)
+	}
+
+	// 记账后回填余额
+	entries := []*models.WalletTransaction{
+		{StudentID: zhang.ID, Type: models.WalletTypeTopUp, Amount: 1000, Note: "充值", Operator: "admin"},
+		{StudentID: zhang.ID, Type: models.WalletTypeCharge, Amount: -300, MealID: meal.ID, MealType: models.MealTypeA},
+		{StudentID: zhang.ID, Type: models.WalletTypeRefund, Amount: 100, MealID: meal.ID, MealType: models.MealTypeB},
+		{StudentID: zhang.ID, Type: models.WalletTypeCharge, Amount: -200, MealID: meal.ID, MealType: models.MealTypeA, ServiceDate: "2025-03-10"},
+	}
+	for _, entry := range entries {
+		if err := r.Wallets.Post(entry); err != nil {
+			t.Fatalf("post %s: %v", entry.Type, err)
+		}
+		if entry.ID == 0 || entry.CreatedAt.IsZero() {
+			t.Fatalf("posted entry = %+v", entry)
+		}
+	}
+	if entries[0].BalanceAfter != 1000 || entries[3].BalanceAfter != 600 {
+		t.Errorf("balance after = %d, %d, want 1000, 600", entries[0].BalanceAfter, entries[3].BalanceAfter)
+	}
+	if balance, err := r.Wallets.GetBalance(zhang.ID); err != nil || balance != 600 {
+		t.Errorf("balance = %d, %v, want 600", balance, err)
+	}
+	if balance, err := r.Wallets.LockBalance(zhang.ID); err != nil || balance != 600 {
+		t.Errorf("locked balance = %d, %v, want 600", balance, err)
+	}
+	if balance, err := r.Wallets.LockBalance(li.ID); err != nil || balance != 0 {
+		t.Errorf("locked balance without wallet = %d, %v", balance, err)
+	}
+
+	// 按选餐扣费的净额不包括取餐扣费
+	if net, err := r.Wallets.SelectionChargeNet(zhang.ID, meal.ID); err != nil || net != -200 {
+		t.Errorf("selection charge net = %d, %v, want -200", net, err)
+	}
+	if charged, err := r.Wallets.HasSelectionCharges(zhang.ID, meal.ID); err != nil || !charged {
+		t.Errorf("has selection charges = %v, %v, want true", charged, err)
+	}
+	if charged, err := r.Wallets.HasSelectionCharges(li.ID, meal.ID); err != nil || charged {
+		t.Errorf("has selection charges without entries = %v, %v, want false", charged, err)
+	}
+	if net, err := r.Wallets.SelectionChargeNet(li.ID, meal.ID); err != nil || net != 0 {
+		t.Errorf("selection charge net without charges = %d, %v", net, err)
+	}
+
+	// 分页查询，按时间倒序
+	transactions, total, err := r.Wallets.List(models.WalletTransactionFilter{StudentID: zhang.ID, PageSize: 3})
+	if err != nil || total != 4 || len(transactions) != 3 || transactions[0].ID != entries[3].ID || transactions[0].StudentName != "张三" {
+		t.Errorf("list transactions = %v, %d, %v", transactions, total, err)
+	}
+	if transactions, total, err := r.Wallets.List(models.WalletTransactionFilter{StudentID: zhang.ID, PageSize: 3, Page: 2}); err != nil || total != 4 || len(transactions) != 1 || transactions[0].ID != entries[0].ID {
+		t.Errorf("list second page = %v, %d, %v", transactions, total, err)
+	}
+	if _, total, err := r.Wallets.List(models.WalletTransactionFilter{Type: models.WalletTypeCharge, MealID: meal.ID}); err != nil || total != 2 {
+		t.Errorf("list charges = %d, %v, want 2", total, err)
+	}
+	if _, total, err := r.Wallets.List(models.WalletTransactionFilter{StudentID: li.ID}); err != nil || total != 0 {
+		t.Errorf("list without transactions = %d, %v", total, err)
+	}
+
+	// 有余额流水的学生不能删除，只有空钱包的学生可以删除
+	if err := r.Students.Delete(zhang.ID); !errors.Is(err, models.ErrStudentHasWallet) {
+		t.Errorf("delete student with transactions = %v, want ErrStudentHasWallet", err)
+	}
+	if balance, err := r.Wallets.GetBalance(zhang.ID); err != nil || balance != 600 {
+		t.Errorf("balance after refused delete = %d, %v, want 600", balance, err)
+	}
+	if err := r.Students.Delete(li.ID); err != nil {
+		t.Errorf("delete student with empty wallet: %v", err)
+	}
+}
+
+func testPaymentOrders(t *testing.T, r *models.Repositories) {
+	zhang := newStudent(t, r, "张三", "一班")
+	now := time.Now()
+
+	for _, orderNo := range []string{"T1", "T2"} {
+		order := &models.PaymentOrder{
+			OrderNo: orderNo, StudentID: zhang.ID, Amount: 5000, Gateway: "mock", Status: models.PaymentStatusPending,
+			Operator: "父亲", CreatedAt: now, UpdatedAt: now,
+		}
+		if err := r.PaymentOrders.Create(order); err != nil || order.ID == 0 {
+			t.Fatalf("create order: id=%d, %v", order.ID, err)
+		}
+	}
+	got, err := r.PaymentOrders.GetByOrderNo("T1")
+	if err != nil || got.Amount != 5000 || got.Status != models.PaymentStatusPending || got.StudentName != "张三" || got.PaidAt != nil {
+		t.Errorf("get order = %+v, %v", got, err)
+	}
+	if _, err := r.PaymentOrders.GetByOrderNo("T3"); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("get missing order: err = %v, want ErrNotFound", err)
+	}
+
+	// 只有待支付的订单可以标记为失败或关闭
+	if err := r.PaymentOrders.Finish("T1", models.PaymentStatusFailed, "余额不足"); err != nil {
+		t.Fatalf("finish order: %v", err)
+	}
+	if got, err := r.PaymentOrders.GetByOrderNo("T1"); err != nil || got.Status != models.PaymentStatusFailed || got.FailureReason != "余额不足" {
+		t.Errorf("failed order = %+v, %v", got, err)
+	}
+
+	// 已支付的订单不会再次更新
+	paidAt := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	if updated, err := r.PaymentOrders.MarkPaid("T2", "trade-1", paidAt); err != nil || !updated {
+		t.Fatalf("mark paid = %v, %v", updated, err)
+	}
+	if updated, err := r.PaymentOrders.MarkPaid("T2", "trade-2", paidAt); err != nil || updated {
+		t.Errorf("mark paid again = %v, %v, want false", updated, err)
+	}
+	if err := r.PaymentOrders.SetWalletTransaction("T2", 42); err != nil {
+		t.Fatalf("set wallet transaction: %v", err)
+	}
+	if err := r.PaymentOrders.Finish("T2", models.PaymentStatusClosed, "超时"); err != nil {
+		t.Fatalf("finish paid order: %v", err)
+	}
+	got, err = r.PaymentOrders.GetByOrderNo("T2")
+	if err != nil || got.Status != models.PaymentStatusPaid || got.TradeNo != "trade-1" || got.WalletTransactionID != 42 ||
+		got.PaidAt == nil || !got.PaidAt.Equal(paidAt) {
+		t.Errorf("paid order = %+v, %v", got, err)
+	}
+
+	// 分页查询，按创建时间倒序
+	if orders, total, err := r.PaymentOrders.List(models.PaymentOrderFilter{StudentID: zhang.ID}); err != nil || total != 2 || orders[0].OrderNo != "T2" {
+		t.Errorf("list orders = %v, %d, %v", orders, total, err)
+	}
+	if orders, total, err := r.PaymentOrders.List(models.PaymentOrderFilter{Status: models.PaymentStatusPaid}); err != nil || total != 1 || len(orders) != 1 {
+		t.Errorf("list paid orders = %v, %d, %v", orders, total, err)
+	}
+
+	// 有充值订单的学生不能删除，订单保留
+	if err := r.Students.Delete(zhang.ID); !errors.Is(err, models.ErrStudentHasWallet) {
+		t.Errorf("delete student with orders = %v, want ErrStudentHasWallet", err)
+	}
+	if _, total, err := r.PaymentOrders.List(models.PaymentOrderFilter{StudentID: zhang.ID}); err != nil || total != 2 {
+		t.Errorf("orders after refused delete = %d, %v, want 2", total, err)
+	}
+}
+
+func testAbsences(t *testing.T, r *models.Repositories) {
+	zhang := newStudent(t, r, "张三", "一班")
+	li := newStudent(t, r, "李四", "二班")
+	now := time.Now()
+
+	absences := []*models.Absence{
+		{StudentID: zhang.ID, StartDate: "2025-03-10", EndDate: "2025-03-12", Reason: "生病", ReportedBy: models.AbsenceReporterParent, Operator: "父亲", CreatedAt: now},
+		{StudentID: zhang.ID, StartDate: "2025-03-20", EndDate: "2025-03-20", Reason: "事假", ReportedBy: models.AbsenceReporterAdmin, Operator: "admin", CreatedAt: now},
+		{StudentID: li.ID, StartDate: "2025-03-11", EndDate: "2025-03-11", Reason: "比赛", ReportedBy: models.AbsenceReporterTeacher, CreatedAt: now},
+	}
+	for _, absence := range absences {
+		if err := r.Absences.Create(absence); err != nil || absence.ID == 0 {
+			t.Fatalf("create absence: id=%d, %v", absence.ID, err)
+		}
+	}
+
+	// 查询时填充学生姓名和班级
+	got, err := r.Absences.GetByID(absences[0].ID)
+	if err != nil || got.StartDate != "2025-03-10" || got.EndDate != "2025-03-12" || got.Reason != "生病" ||
+		got.ReportedBy != models.AbsenceReporterParent || got.StudentName != "张三" || got.Class != "一班" {
+		t.Errorf("get absence = %+v, %v", got, err)
+	}
+
+	// 重叠的请假
+	if n, err := r.Absences.CountOverlapping(zhang.ID, "2025-03-12", "2025-03-15"); err != nil || n != 1 {
+		t.Errorf("overlapping = %d, %v, want 1", n, err)
+	}
+	if n, err := r.Absences.CountOverlapping(zhang.ID, "2025-03-13", "2025-03-19"); err != nil || n != 0 {
+		t.Errorf("overlapping gap = %d, %v, want 0", n, err)
+	}
+	if between, err := r.Absences.ListBetween(0, "2025-03-11", "2025-03-11"); err != nil || len(between) != 2 {
+		t.Errorf("absences on day 11 = %v, %v", between, err)
+	}
+	if between, err := r.Absences.ListBetween(zhang.ID, "2025-03-01", "2025-03-31"); err != nil || len(between) != 2 || between[0].ID != absences[0].ID {
+		t.Errorf("student absences in march = %v, %v", between, err)
+	}
+
+	// 分页查询，按开始日期倒序
+	list, total, err := r.Absences.List(models.AbsenceFilter{Class: "一班"})
+	if err != nil || total != 2 || list[0].ID != absences[1].ID {
+		t.Errorf("list by class = %v, %d, %v", list, total, err)
+	}
+	if list, total, err := r.Absences.List(models.AbsenceFilter{From: "2025-03-12", To: "2025-03-19"}); err != nil || total != 1 || list[0].ID != absences[0].ID {
+		t.Errorf("list by dates = %v, %d, %v", list, total, err)
+	}
+
+	// 删除
+	if err := r.Absences.Delete(absences[0].ID); err != nil {
+		t.Fatalf("delete absence: %v", err)
+	}
+	if _, err := r.Absences.GetByID(absences[0].ID); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("get deleted absence: err = %v, want ErrNotFound", err)
+	}
+}
+
+func testCalendarEvents(t *testing.T, r *models.Repositories) {
+	now := time.Now()
+	holiday := &models.CalendarEvent{Type: models.CalendarEventHoliday, Name: "清明节", StartDate: "2025-04-04", EndDate: "2025-04-06", UID: "qingming", CreatedAt: now}
+	workday := &models.CalendarEvent{Type: models.CalendarEventWorkday, Name: "补班", StartDate: "2025-04-27", EndDate: "2025-04-27", CreatedAt: now}
+	term := &models.CalendarEvent{Type: models.CalendarEventTerm, Name: "春季学期", StartDate: "2025-02-17", EndDate: "2025-07-04", CreatedAt: now}
+	for _, event := range []*models.CalendarEvent{holiday, workday, term} {
+		if err := r.CalendarEvents.Create(event); err != nil || event.ID == 0 {
+			t.Fatalf("create event: id=%d, %v", event.ID, err)
+		}
+	}
+
+	// 查询
+	if got, err := r.CalendarEvents.GetByUID("qingming"); err != nil || got.ID != holiday.ID || got.Name != "清明节" {
+		t.Errorf("get by uid = %+v, %v", got, err)
+	}
+	if _, err := r.CalendarEvents.GetByID(term.ID + 100); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("get missing event: err = %v, want ErrNotFound", err)
+	}
+	if events, err := r.CalendarEvents.List("", "", ""); err != nil || len(events) != 3 || events[0].ID != term.ID {
+		t.Errorf("list all = %v, %v", events, err)
+	}
+	if events, err := r.CalendarEvents.List("2025-04-06", "2025-04-20", ""); err != nil || len(events) != 2 {
+		t.Errorf("list in april = %v, %v", events, err)
+	}
+	if events, err := r.CalendarEvents.List("", "", models.CalendarEventWorkday); err != nil || len(events) != 1 || events[0].ID != workday.ID {
+		t.Errorf("list workdays = %v, %v", events, err)
+	}
+
+	// 更新和删除
+	holiday.StartDate, holiday.EndDate = "2025-04-05", "2025-04-07"
+	if err := r.CalendarEvents.Update(holiday); err != nil {
+		t.Fatalf("update event: %v", err)
+	}
+	if got, err := r.CalendarEvents.GetByID(holiday.ID); err != nil || got.StartDate != "2025-04-05" || got.EndDate != "2025-04-07" || got.UID != "qingming" {
+		t.Errorf("after update = %+v, %v", got, err)
+	}
+	if err := r.CalendarEvents.Delete(workday.ID); err != nil {
+		t.Fatalf("delete event: %v", err)
+	}
+	if _, err := r.CalendarEvents.GetByID(workday.ID); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("get deleted event: err = %v, want ErrNotFound", err)
+	}
+}
+
+func testMealTemplates(t *testing.T, r *models.Repositories) {
+	now := time.Now()
+	template := &models.MealTemplate{
+		Name:            "午餐",
+		ReminderOffsets: models.ReminderOffsets{"24h0m0s"},
+		PriceA:          1500,
+		PriceB:          1200,
+		Recurrence: models.MealRecurrence{
+			IntervalWeeks:       1,
+			ServingStartWeekday: 1,
+			ServingEndWeekday:   5,
+			SelectionStart:      models.RecurrenceMoment{WeeksBefore: 1, Weekday: 1, Time: "00:00"},
+			SelectionEnd:        models.RecurrenceMoment{WeeksBefore: 1, Weekday: 4, Time: "18:00"},
+		},
+		StartDate: "2025-03-03",
+		Enabled:   true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := r.MealTemplates.Create(template); err != nil || template.ID == 0 {
+		t.Fatalf("create template: id=%d, %v", template.ID, err)
+	}
+
+	// 读取后字段保持一致
+	got, err := r.MealTemplates.GetByID(template.ID)
+	if err != nil {
+		t.Fatalf("get template: %v", err)
+	}
+	if got.Name != template.Name || got.PriceA != 1500 || !got.Enabled || !reflect.DeepEqual(got.Recurrence, template.Recurrence) ||
+		!reflect.DeepEqual(got.ReminderOffsets, template.ReminderOffsets) || got.StartDate != "2025-03-03" || got.EndDate != "" {
+		t.Errorf("get template = %+v, want %+v", got, template)
+	}
+	if _, err := r.MealTemplates.GetByID(template.ID + 100); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("get missing template: err = %v, want ErrNotFound", err)
+	}
+
+	// 更新
+	template.Enabled = false
+	template.EndDate = "2025-07-04"
+	template.Recurrence.SelectionEnd.Time = "12:00"
+	if err := r.MealTemplates.Update(template); err != nil {
+		t.Fatalf("update template: %v", err)
+	}
+	if templates, err := r.MealTemplates.List(); err != nil || len(templates) != 1 || templates[0].Enabled ||
+		templates[0].EndDate != "2025-07-04" || templates[0].Recurrence.SelectionEnd.Time != "12:00" {
+		t.Errorf("list templates = %v, %v", templates, err)
+	}
+
+	// 生成记录，同一周只能记录一次
+	meal := newMeal(t, r, time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC))
+	if _, err := r.MealTemplates.GetMealID(template.ID, "2025-03-10"); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("get meal before add: err = %v, want ErrNotFound", err)
+	}
+	if err := r.MealTemplates.AddMeal(template.ID, "2025-03-10", meal.ID); err != nil {
+		t.Fatalf("add meal: %v", err)
+	}
+	if err := r.MealTemplates.AddMeal(template.ID, "2025-03-10", meal.ID); err == nil {
+		t.Errorf("add meal twice: expected error")
+	}
+	if mealID, err := r.MealTemplates.GetMealID(template.ID, "2025-03-10"); err != nil || mealID != meal.ID {
+		t.Errorf("get meal = %d, %v, want %d", mealID, err, meal.ID)
+	}
+
+	// 删除生成的餐时同时删除生成记录
+	deleted := newMeal(t, r, time.Date(2025, 3, 17, 0, 0, 0, 0, time.UTC))
+	if err := r.MealTemplates.AddMeal(template.ID, "2025-03-17", deleted.ID); err != nil {
+		t.Fatalf("add meal: %v", err)
+	}
+	if err := r.Meals.Delete(deleted.ID); err != nil {
+		t.Fatalf("delete generated meal: %v", err)
+	}
+	if _, err := r.MealTemplates.GetMealID(template.ID, "2025-03-17"); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("get deleted meal: err = %v, want ErrNotFound", err)
+	}
+
+	// 删除模板时同时删除生成记录，餐保留
+	if err := r.MealTemplates.Delete(template.ID); err != nil {
+		t.Fatalf("delete template: %v", err)
+	}
+	if _, err := r.MealTemplates.GetByID(template.ID); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("get deleted template: err = %v, want ErrNotFound", err)
+	}
+	if _, err := r.MealTemplates.GetMealID(template.ID, "2025-03-10"); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("get meal after delete: err = %v, want ErrNotFound", err)
+	}
+	if _, err := r.Meals.GetByID(meal.ID); err != nil {
+		t.Errorf("generated meal after template delete: %v", err)
+	}
+}
+
+func testNoShowAlerts(t *testing.T, r *models.Repositories) {
+	zhang := newStudent(t, r, "张三", "一班")
+	li := newStudent(t, r, "李四", "一班")
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 8, 0, 0, 0, time.UTC) }
+
+	alerts := []*models.NoShowAlert{
+		{StudentID: zhang.ID, Class: "一班", WindowStart: "2025-02-01", WindowEnd: "2025-02-28", Expected: 20, NoShow: 8, NotifiedAt: day(1)},
+		{StudentID: li.ID, Class: "一班", WindowStart: "2025-02-08", WindowEnd: "2025-03-07", Expected: 20, NoShow: 10, NotifiedAt: day(8)},
+		{StudentID: li.ID, Class: "一班", WindowStart: "2025-02-09", WindowEnd: "2025-03-08", Expected: 20, NoShow: 11, NotifiedAt: day(9)},
+	}
+	for _, alert := range alerts {
+		if err := r.NoShowAlerts.Create(alert); err != nil || alert.ID == 0 {
+			t.Fatalf("create alert: id=%d, %v", alert.ID, err)
+		}
+	}
+
+	if studentIDs, err := r.NoShowAlerts.ListStudentIDsSince(day(1)); err != nil || !reflect.DeepEqual(studentIDs, []int{zhang.ID, li.ID}) {
+		t.Errorf("alerted since day 1 = %v, %v", studentIDs, err)
+	}
+	if studentIDs, err := r.NoShowAlerts.ListStudentIDsSince(day(2)); err != nil || !reflect.DeepEqual(studentIDs, []int{li.ID}) {
+		t.Errorf("alerted since day 2 = %v, %v", studentIDs, err)
+	}
+}
+
+func testTransactions(t *testing.T, r *models.Repositories) {
+	// fn 返回错误时全部回滚
+	errRollback := errors.New("rollback")
+	err := r.InTx(func(tx *models.Repositories) error {
+		student, err := tx.Students.Create("张三", "一班", "s1")
+		if err != nil {
+			return err
+		}
+		if err := tx.Wallets.Post(&models.WalletTransaction{StudentID: student.ID, Type: models.WalletTypeTopUp, Amount: 1000}); err != nil {
+			return err
+		}
+
+		// 事务中可以读到未提交的修改，嵌套调用在同一事务中执行
+		return tx.InTx(func(tx *models.Repositories) error {
+			if balance, err := tx.Wallets.GetBalance(student.ID); err != nil || balance != 1000 {
+				t.Errorf("balance in transaction = %d, %v", balance, err)
+			}
+			return errRollback
+		})
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("in tx: err = %v, want rollback", err)
+	}
+	if students, err := r.Students.List(true); err != nil || len(students) != 0 {
+		t.Errorf("students after rollback = %v, %v", students, err)
+	}
+	if _, total, err := r.Wallets.List(models.WalletTransactionFilter{}); err != nil || total != 0 {
+		t.Errorf("transactions after rollback = %d, %v", total, err)
+	}
+
+	// 成功时提交
+	var studentID int
+	err = r.InTx(func(tx *models.Repositories) error {
+		student, err := tx.Students.Create("李四", "一班", "s2")
+		if err != nil {
+			return err
+		}
+		studentID = student.ID
+		return tx.Wallets.Post(&models.WalletTransaction{StudentID: student.ID, Type: models.WalletTypeTopUp, Amount: 500})
+	})
+	if err != nil {
+		t.Fatalf("in tx: %v", err)
+	}
+	if balance, err := r.Wallets.GetBalance(studentID); err != nil || balance != 500 {
+		t.Errorf("balance after commit = %d, %v, want 500", balance, err)
+	}
+}
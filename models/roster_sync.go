@@ -0,0 +1,284 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/database"
+)
+
+// StudentRosterUpdate 学生信息变更
+type StudentRosterUpdate struct {
+	StudentID   int    `json:"student_id"`
+	DingTalkID  string `json:"dingtalk_id"`
+	OldFullName string `json:"old_full_name"`
+	NewFullName string `json:"new_full_name"`
+	OldClass    string `json:"old_class"`
+	NewClass    string `json:"new_class"`
+	Restored    bool   `json:"restored"` // 是否从归档状态恢复
+}
+
+// StudentRosterDiff 学生名单差异
+type StudentRosterDiff struct {
+	Created  []*Student             `json:"created"`
+	Updated  []*StudentRosterUpdate `json:"updated"`
+	Archived []*Student             `json:"archived"`
+}
+
+// IsEmpty 判断差异是否为空
+func (d *StudentRosterDiff) IsEmpty() bool {
+	return len(d.Created) == 0 && len(d.Updated) == 0 && len(d.Archived) == 0
+}
+
+// ApplyStudentRosterDiff 在单个事务中应用学生名单差异，新建学生的ID和用户名会回填到差异中
+func ApplyStudentRosterDiff(diff *StudentRosterDiff) error {
+	// 获取数据库连接
+	db := database.GetDB()
+
+	// 开始事务
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 创建新学生
+	for i, student := range diff.Created {
+		created, err := insertStudent(tx, "", student.FullName, student.Class, student.DingTalkID)
+		if err != nil {
+			return err
+		}
+		diff.Created[i] = created
+	}
+
+	// 更新姓名、班级并恢复归档
+	for _, update := range diff.Updated {
+		_, err = tx.Exec(
+			"UPDATE students SET full_name = ?, class = ?, archived = FALSE WHERE id = ?",
+			update.NewFullName, update.NewClass, update.StudentID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 归档已离开的学生
+	for _, student := range diff.Archived {
+		_, err = tx.Exec("UPDATE students SET archived = TRUE WHERE id = ?", student.ID)
+		if err != nil {
+			return err
+		}
+		student.Archived = true
+	}
+
+	// 提交事务
+	return tx.Commit()
+}
+
+// RemoveDingTalkUsers 处理已从钉钉移除的用户：归档对应的学生，并删除其作为学生或家长的关系
+// 返回归档的学生数和删除的关系数
+func RemoveDingTalkUsers(dingTalkIDs []string) (int, int, error) {
+	// 获取数据库连接
+	db := database.GetDB()
+
+	// 开始事务
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	archivedCount := 0
+	removedCount := 0
+	for _, dingTalkID := range dingTalkIDs {
+		// 忽略手动创建的学生使用的占位ID
+		if dingTalkID == "" || dingTalkID == "0" {
+			continue
+		}
+
+		// 归档学生
+		result, err := tx.Exec("UPDATE students SET archived = TRUE WHERE dingtalk_id = ? AND archived = FALSE", dingTalkID)
+		if err != nil {
+			return 0, 0, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return 0, 0, err
+		}
+		archivedCount += int(affected)
+
+		// 删除关系
+		result, err = tx.Exec("DELETE FROM parent_student_relations WHERE student_id = ? OR parent_id = ?", dingTalkID, dingTalkID)
+		if err != nil {
+			return 0, 0, err
+		}
+		affected, err = result.RowsAffected()
+		if err != nil {
+			return 0, 0, err
+		}
+		removedCount += int(affected)
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+
+	return archivedCount, removedCount, nil
+}
+
+// RosterSyncReport 学生名单同步报告
+type RosterSyncReport struct {
+	ID               int                `json:"id"`
+	StartedAt        time.Time          `json:"started_at"`
+	FinishedAt       *time.Time         `json:"finished_at,omitempty"`
+	DryRun           bool               `json:"dry_run"`            // 是否仅预览差异
+	Source           string             `json:"source"`             // 触发方式：manual 或 scheduler
+	Status           string             `json:"status"`             // 同步状态
+	ClassCount       int                `json:"class_count"`        // 班级总数
+	FailedClassCount int                `json:"failed_class_count"` // 获取失败的班级数
+	CreatedCount     int                `json:"created_count"`      // 新建学生数
+	UpdatedCount     int                `json:"updated_count"`      // 更新学生数
+	ArchivedCount    int                `json:"archived_count"`     // 归档学生数
+	Error            string             `json:"error,omitempty"`    // 失败原因
+	Details          *StudentRosterDiff `json:"details,omitempty"`  // 差异明细
+}
+
+// CreateRosterSyncReport 创建学生名单同步报告
+func CreateRosterSyncReport(dryRun bool, source string) (*RosterSyncReport, error) {
+	// 获取数据库连接
+	db := database.GetDB()
+
+	report := &RosterSyncReport{
+		StartedAt: time.Now(),
+		DryRun:    dryRun,
+		Source:    source,
+		Status:    SyncStatusRunning,
+	}
+
+	// 插入报告
+	id, err := db.InsertID(
+		"INSERT INTO roster_sync_reports (started_at, dry_run, source, status, error, details) VALUES (?, ?, ?, ?, '', '')",
+		report.StartedAt, report.DryRun, report.Source, report.Status,
+	)
+	if err != nil {
+		return nil, err
+	}
+	report.ID = int(id)
+
+	return report, nil
+}
+
+// FinishRosterSyncReport 保存学生名单同步结果
+func FinishRosterSyncReport(report *RosterSyncReport) error {
+	// 获取数据库连接
+	db := database.GetDB()
+
+	// 记录结束时间
+	now := time.Now()
+	report.FinishedAt = &now
+
+	// 统计差异数量
+	details := ""
+	if report.Details != nil {
+		report.CreatedCount = len(report.Details.Created)
+		report.UpdatedCount = len(report.Details.Updated)
+		report.ArchivedCount = len(report.Details.Archived)
+
+		data, err := json.Marshal(report.Details)
+		if err != nil {
+			return err
+		}
+		details = string(data)
+	}
+
+	// 更新报告
+	_, err := db.Exec(
+		`UPDATE roster_sync_reports SET finished_at = ?, status = ?, class_count = ?, failed_class_count = ?,
+		created_count = ?, updated_count = ?, archived_count = ?, error = ?, details = ? WHERE id = ?`,
+		report.FinishedAt, report.Status, report.ClassCount, report.FailedClassCount,
+		report.CreatedCount, report.UpdatedCount, report.ArchivedCount, report.Error, details, report.ID,
+	)
+
+	return err
+}
+
+// GetRosterSyncReports 获取最近的学生名单同步报告（不含差异明细）
+func GetRosterSyncReports(limit int) ([]*RosterSyncReport, error) {
+	// 获取数据库连接
+	db := database.GetDB()
+
+	// 查询报告
+	rows, err := db.Query(
+		`SELECT id, started_at, finished_at, dry_run, source, status, class_count, failed_class_count,
+		created_count, updated_count, archived_count, error
+		FROM roster_sync_reports ORDER BY id DESC LIMIT ?`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// 处理结果
+	var reports []*RosterSyncReport
+	for rows.Next() {
+		var report RosterSyncReport
+		var finishedAt sql.NullTime
+		err := rows.Scan(
+			&report.ID, &report.StartedAt, &finishedAt, &report.DryRun, &report.Source, &report.Status, &report.ClassCount, &report.FailedClassCount,
+			&report.CreatedCount, &report.UpdatedCount, &report.ArchivedCount, &report.Error,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if finishedAt.Valid {
+			report.FinishedAt = &finishedAt.Time
+		}
+		reports = append(reports, &report)
+	}
+
+	return reports, rows.Err()
+}
+
+// GetRosterSyncReportByID 获取学生名单同步报告及差异明细
+func GetRosterSyncReportByID(id int) (*RosterSyncReport, error) {
+	// 获取数据库连接
+	db := database.GetDB()
+
+	// 查询报告
+	var report RosterSyncReport
+	var finishedAt sql.NullTime
+	var details string
+	err := db.QueryRow(
+		`SELECT id, started_at, finished_at, dry_run, source, status, class_count, failed_class_count,
+		created_count, updated_count, archived_count, error, details
+		FROM roster_sync_reports WHERE id = ?`,
+		id,
+	).Scan(
+		&report.ID, &report.StartedAt, &finishedAt, &report.DryRun, &report.Source, &report.Status, &report.ClassCount, &report.FailedClassCount,
+		&report.CreatedCount, &report.UpdatedCount, &report.ArchivedCount, &report.Error, &details,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("同步报告不存在")
+		}
+		return nil, err
+	}
+
+	if finishedAt.Valid {
+		report.FinishedAt = &finishedAt.Time
+	}
+
+	// 解析差异明细
+	if details != "" {
+		report.Details = &StudentRosterDiff{}
+		if err := json.Unmarshal([]byte(details), report.Details); err != nil {
+			return nil, err
+		}
+	}
+
+	return &report, nil
+}
@@ -0,0 +1,225 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 导入选餐时匹配学生的方式
+const (
+	SelectionMatchStudentID        = "student_id"         // 学生ID
+	SelectionMatchUsername         = "username"           // 学生用户名
+	SelectionMatchDingTalkID       = "dingtalk_id"        // 学生钉钉ID
+	SelectionMatchParentDingTalkID = "parent_dingtalk_id" // 家长钉钉ID，使用第一个关联的学生
+	SelectionMatchNameClass        = "name_class"         // 姓名和班级
+)
+
+// SelectionImportRow 选餐导入文件中的一行及其处理结果
+// 按学生ID、用户名、钉钉ID、姓名和班级的顺序使用第一个不为空的字段匹配学生
+type SelectionImportRow struct {
+	Row              int      `json:"row"`                  // 文件中的行号，表头为第1行
+	StudentID        string   `json:"student_id,omitempty"` // 文件中的学生ID
+	Username         string   `json:"username,omitempty"`
+	DingTalkID       string   `json:"dingtalk_id,omitempty"` // 学生或家长的钉钉ID
+	FullName         string   `json:"full_name,omitempty"`
+	Class            string   `json:"class,omitempty"`
+	Option           string   `json:"option"`                       // 文件中的餐食选项，如 A、B餐
+	MealType         MealType `json:"meal_type,omitempty"`          // 解析后的餐食类型
+	MatchedBy        string   `json:"matched_by,omitempty"`         // 匹配学生的方式
+	Student          *Student `json:"student,omitempty"`            // 匹配到的学生
+	PreviousMealType MealType `json:"previous_meal_type,omitempty"` // 导入前的选餐，未选餐时为空
+	Status           string   `json:"status"`
+	Errors           []string `json:"errors,omitempty"`
+}
+
+// SelectionImportReport 选餐导入报告
+type SelectionImportReport struct {
+	MealID   int                   `json:"meal_id"`
+	DryRun   bool                  `json:"dry_run"`
+	Total    int                   `json:"total"`    // 数据行数
+	Valid    int                   `json:"valid"`    // 校验通过的行数
+	Imported int                   `json:"imported"` // 写入的选餐数，预览模式下为0
+	Failed   int                   `json:"failed"`   // 校验未通过的行数
+	Rows     []*SelectionImportRow `json:"rows"`
+}
+
+// ParseMealOption 解析表格中的餐食选项，支持 A、B、A餐、B餐（不区分大小写）
+func ParseMealOption(option string) (MealType, bool) {
+	option = strings.ToUpper(strings.TrimSuffix(strings.TrimSpace(option), "餐"))
+	switch MealType(option) {
+	case MealTypeA:
+		return MealTypeA, true
+	case MealTypeB:
+		return MealTypeB, true
+	}
+	return "", false
+}
+
+// ImportSelections 校验导入的选餐并在单个事务中保存校验通过的行，dryRun 为 true 时只校验不写入
+// 钉钉ID未匹配到学生时视为家长的钉钉ID，使用第一个关联的学生
+func ImportSelections(mealID int, rows []*SelectionImportRow, dryRun bool, operator string) (*SelectionImportReport, error) {
+	report := &SelectionImportReport{MealID: mealID, DryRun: dryRun, Total: len(rows), Rows: rows}
+
+	// 验证餐
+	meal, err := GetMealByID(mealID)
+	if err != nil {
+		return nil, err
+	}
+	if meal.ArchivedAt != nil {
+		return nil, errors.New("餐已归档，不能修改选餐")
+	}
+
+	// 获取在读学生
+	students, err := GetAllStudents()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]*Student)
+	byUsername := make(map[string]*Student)
+	byNameClass := make(map[string][]*Student)
+	for _, student := range students {
+		byID[student.ID] = student
+		byUsername[student.Username] = student
+		key := student.FullName + "\x00" + student.Class
+		byNameClass[key] = append(byNameClass[key], student)
+	}
+
+	// 获取该餐现有的选餐
+	existing, err := repos().Selections.ListByMeal(mealID)
+	if err != nil {
+		return nil, err
+	}
+	previous := make(map[int]MealType)
+	for _, selection := range existing {
+		previous[selection.StudentID] = selection.MealType
+	}
+
+	// 逐行校验
+	seen := make(map[int]int) // 学生ID -> 行号
+	var selections []*MealSelection
+	var valid []*SelectionImportRow
+	for _, row := range rows {
+		// 解析餐食类型
+		mealType, ok := ParseMealOption(row.Option)
+		if ok {
+			row.MealType = mealType
+		} else if row.Option == "" {
+			row.addError("餐食选项不能为空")
+		} else {
+			row.addError("无效的餐食选项：" + row.Option)
+		}
+
+		// 匹配学生
+		student, err := matchImportStudent(row, byID, byUsername, byNameClass)
+		if err != nil {
+			row.addError(err.Error())
+		} else {
+			row.Student = student
+			row.PreviousMealType = previous[student.ID]
+		}
+		if len(row.Errors) > 0 {
+			row.Status = ImportRowStatusInvalid
+			report.Failed++
+			continue
+		}
+
+		// 同一学生只能出现一次
+		if line, ok := seen[student.ID]; ok {
+			row.addError(fmt.Sprintf("学生与第%d行重复", line))
+			row.Status = ImportRowStatusDuplicate
+			report.Failed++
+			continue
+		}
+		seen[student.ID] = row.Row
+
+		row.Status = ImportRowStatusValid
+		valid = append(valid, row)
+		selections = append(selections, &MealSelection{
+			StudentID: student.ID,
+			MealID:    mealID,
+			MealType:  mealType,
+			Operator:  operator,
+			Source:    SelectionSourceImport,
+		})
+	}
+	report.Valid = len(valid)
+
+	// 预览模式或没有可写入的行时不修改数据
+	if dryRun || len(valid) == 0 {
+		return report, nil
+	}
+
+	// 在单个事务中保存并扣费
+	var count int
+	err = repos().InTx(func(r *Repositories) error {
+		var err error
+		if count, err = r.Selections.SaveAll(selections); err != nil {
+			return err
+		}
+		return chargeSelections(r, meal, selections)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range valid {
+		row.Status = ImportRowStatusImported
+	}
+	report.Imported = count
+
+	return report, nil
+}
+
+// matchImportStudent 按行中第一个不为空的字段匹配在读学生，并记录匹配方式
+func matchImportStudent(row *SelectionImportRow, byID map[int]*Student, byUsername map[string]*Student, byNameClass map[string][]*Student) (*Student, error) {
+	switch {
+	case row.StudentID != "":
+		row.MatchedBy = SelectionMatchStudentID
+		id, err := strconv.Atoi(row.StudentID)
+		if err != nil {
+			return nil, errors.New("无效的学生ID：" + row.StudentID)
+		}
+		if student, ok := byID[id]; ok {
+			return student, nil
+		}
+		return nil, errors.New("未找到学生ID：" + row.StudentID)
+
+	case row.Username != "":
+		row.MatchedBy = SelectionMatchUsername
+		if student, ok := byUsername[row.Username]; ok {
+			return student, nil
+		}
+		return nil, errors.New("未找到用户名：" + row.Username)
+
+	case row.DingTalkID != "":
+		student, byParent, err := FindStudentByDingTalkIDOrParent(row.DingTalkID)
+		if err != nil {
+			return nil, err
+		}
+		row.MatchedBy = SelectionMatchDingTalkID
+		if byParent {
+			row.MatchedBy = SelectionMatchParentDingTalkID
+		}
+		return student, nil
+
+	case row.FullName != "" && row.Class != "":
+		row.MatchedBy = SelectionMatchNameClass
+		matches := byNameClass[row.FullName+"\x00"+row.Class]
+		switch len(matches) {
+		case 0:
+			return nil, fmt.Errorf("未找到学生：%s（%s）", row.FullName, row.Class)
+		case 1:
+			return matches[0], nil
+		default:
+			return nil, fmt.Errorf("%s有%d名学生叫%s，请使用学生ID、用户名或钉钉ID", row.Class, len(matches), row.FullName)
+		}
+	}
+
+	return nil, errors.New("缺少学生ID、用户名、钉钉ID或姓名和班级")
+}
+
+// addError 添加一条错误信息
+func (row *SelectionImportRow) addError(message string) {
+	row.Errors = append(row.Errors, message)
+}
@@ -0,0 +1,350 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/config"
+	"github.com/itsHenry35/canteen-management-system/database"
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+// statementMonthLayout 账单月份格式
+const statementMonthLayout = "2006-01"
+
+// StatementDay 账单中的一个领餐日
+type StatementDay struct {
+	Date      string   `json:"date"` // YYYY-MM-DD
+	MealID    int      `json:"meal_id"`
+	MealName  string   `json:"meal_name"`
+	MealType  MealType `json:"meal_type"` // 未选餐时为空
+	Price     int      `json:"price"`     // 所选餐的单价（分），未选餐或请假时为0
+	Collected bool     `json:"collected"`
+	Absent    bool     `json:"absent"` // 当天请假且未取餐，不计入餐费
+}
+
+// Statement 一名学生某个月的账单，金额单位为分
+type Statement struct {
+	Month          string               `json:"month"` // YYYY-MM
+	Student        *Student             `json:"student"`
+	Days           []*StatementDay      `json:"days"` // 本月每个领餐日，按日期排序
+	SelectedDays   int                  `json:"selected_days"`
+	CollectedDays  int                  `json:"collected_days"`
+	MealTotal      int                  `json:"meal_total"`      // 已选餐日的餐费合计
+	CollectedTotal int                  `json:"collected_total"` // 已取餐日的餐费合计
+	OpeningBalance int                  `json:"opening_balance"` // 月初余额
+	TopUps         int                  `json:"top_ups"`         // 本月充值
+	Charges        int                  `json:"charges"`         // 本月扣费净额（扣费减去退款），正数表示支出
+	Adjustments    int                  `json:"adjustments"`     // 本月调整，可正可负
+	ClosingBalance int                  `json:"closing_balance"` // 月末余额，当月未结束时为当前余额
+	Transactions   []*WalletTransaction `json:"transactions"`    // 本月流水，按时间排序
+	GeneratedAt    time.Time            `json:"generated_at"`
+}
+
+// FamilyStatement 一位家长名下所有学生某个月的账单
+type FamilyStatement struct {
+	Month          string       `json:"month"`
+	Statements     []*Statement `json:"statements"` // 按学生姓名排序
+	MealTotal      int          `json:"meal_total"`
+	CollectedTotal int          `json:"collected_total"`
+	Charges        int          `json:"charges"`
+	ClosingBalance int          `json:"closing_balance"`
+	GeneratedAt    time.Time    `json:"generated_at"`
+}
+
+// parseStatementMonth 解析账单月份（YYYY-MM），返回该月第一天和最后一天（服务器本地时间）
+func parseStatementMonth(month string) (time.Time, time.Time, error) {
+	first, err := time.ParseInLocation(statementMonthLayout, month, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("无效的月份，格式应为 YYYY-MM")
+	}
+	return first, first.AddDate(0, 1, -1), nil
+}
+
+// BuildStatement 生成学生某个月（YYYY-MM）的账单，包括已归档的学生
+func BuildStatement(studentID int, month string) (*Statement, error) {
+	first, last, err := parseStatementMonth(month)
+	if err != nil {
+		return nil, err
+	}
+	student, err := GetStudentByID(studentID)
+	if err != nil {
+		return nil, err
+	}
+	statement := &Statement{
+		Month:        month,
+		Student:      student,
+		Days:         []*StatementDay{},
+		Transactions: []*WalletTransaction{},
+		GeneratedAt:  time.Now(),
+	}
+
+	// 本月领餐的餐
+	meals, err := getMealsServedBetween(repos(), first, last)
+	if err != nil {
+		return nil, err
+	}
+
+	// 本月的取餐记录
+	collected, err := getStudentCollections(studentID, first.Format(collectionDateLayout), last.Format(collectionDateLayout))
+	if err != nil {
+		return nil, err
+	}
+
+	// 本月的请假日期
+	absent, err := getAbsenceDays(repos(), studentID, first.Format(collectionDateLayout), last.Format(collectionDateLayout))
+	if err != nil {
+		return nil, err
+	}
+
+	// 逐日列出选餐和取餐情况
+	for _, meal := range meals {
+		selection, err := repos().Selections.GetByStudentAndMeal(studentID, meal.ID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		for _, date := range meal.ServingDates() {
+			if date < first.Format(collectionDateLayout) || date > last.Format(collectionDateLayout) {
+				continue
+			}
+			day := &StatementDay{Date: date, MealID: meal.ID, MealName: meal.Name}
+			if absent.absent(studentID, date) && !collected[collectionKey(meal.ID, date)] {
+				day.Absent = true
+				if selection != nil {
+					day.MealType = selection.MealType
+				}
+				statement.Days = append(statement.Days, day)
+				continue
+			}
+			if selection != nil {
+				day.MealType = selection.MealType
+				day.Price = meal.Price(selection.MealType)
+				statement.SelectedDays++
+				statement.MealTotal += day.Price
+			}
+			if collected[collectionKey(meal.ID, date)] {
+				day.Collected = true
+				statement.CollectedDays++
+				statement.CollectedTotal += day.Price
+			}
+			statement.Days = append(statement.Days, day)
+		}
+	}
+	sort.SliceStable(statement.Days, func(i, j int) bool {
+		return statement.Days[i].Date < statement.Days[j].Date
+	})
+
+	// 余额和流水
+	if err := statement.loadWallet(first, last); err != nil {
+		return nil, err
+	}
+
+	return statement, nil
+}
+
+// loadWallet 加载账单月份的余额和流水
+func (statement *Statement) loadWallet(first, last time.Time) error {
+	// 获取数据库连接
+	db := database.GetDB()
+
+	// 月初余额为月初之前最后一条流水记账后的余额
+	start := first.UTC()
+	end := last.AddDate(0, 0, 1).UTC()
+	err := db.QueryRow(
+		"SELECT balance_after FROM wallet_transactions WHERE student_id = ? AND created_at < ? ORDER BY id DESC LIMIT 1",
+		statement.Student.ID, start,
+	).Scan(&statement.OpeningBalance)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	statement.ClosingBalance = statement.OpeningBalance
+
+	// 本月流水
+	rows, err := db.Query(
+		`SELECT id, student_id, type, amount, balance_after, meal_id, meal_type, service_date, note, operator, created_at
+		FROM wallet_transactions WHERE student_id = ? AND created_at >= ? AND created_at < ? ORDER BY id`,
+		statement.Student.ID, start, end,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		entry := &WalletTransaction{StudentName: statement.Student.FullName}
+		err := rows.Scan(
+			&entry.ID, &entry.StudentID, &entry.Type, &entry.Amount, &entry.BalanceAfter, &entry.MealID, &entry.MealType,
+			&entry.ServiceDate, &entry.Note, &entry.Operator, &entry.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		switch entry.Type {
+		case WalletTypeTopUp:
+			statement.TopUps += entry.Amount
+		case WalletTypeCharge, WalletTypeRefund:
+			statement.Charges -= entry.Amount
+		case WalletTypeAdjustment:
+			statement.Adjustments += entry.Amount
+		}
+		statement.ClosingBalance = entry.BalanceAfter
+		statement.Transactions = append(statement.Transactions, entry)
+	}
+
+	return rows.Err()
+}
+
+// collectionKey 取餐记录的键：餐ID和取餐日期
+func collectionKey(mealID int, date string) string {
+	return fmt.Sprintf("%d|%s", mealID, date)
+}
+
+// getStudentCollections 获取学生在 [from, to] 期间的取餐记录，键为 collectionKey
+func getStudentCollections(studentID int, from, to string) (map[string]bool, error) {
+	// 获取数据库连接
+	db := database.GetDB()
+
+	rows, err := db.Query(
+		"SELECT meal_id, collection_date FROM meal_collections WHERE student_id = ? AND collection_date >= ? AND collection_date <= ?",
+		studentID, from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collected := make(map[string]bool)
+	for rows.Next() {
+		var mealID int
+		var date string
+		if err := rows.Scan(&mealID, &date); err != nil {
+			return nil, err
+		}
+		collected[collectionKey(mealID, date)] = true
+	}
+
+	return collected, rows.Err()
+}
+
+// BuildFamilyStatement 生成家长（钉钉ID）名下所有学生某个月的账单，parentIDs 有多个时合并去重
+func BuildFamilyStatement(parentIDs []string, month string) (*FamilyStatement, error) {
+	if _, _, err := parseStatementMonth(month); err != nil {
+		return nil, err
+	}
+
+	// 收集家长名下的学生
+	seen := make(map[int]bool)
+	var students []*Student
+	for _, parentID := range parentIDs {
+		relations, err := GetStudentsByParentID(parentID)
+		if err != nil {
+			return nil, err
+		}
+		for _, relation := range relations {
+			student, err := GetStudentByDingTalkID(relation.StudentID)
+			if err != nil || seen[student.ID] {
+				continue
+			}
+			seen[student.ID] = true
+			students = append(students, student)
+		}
+	}
+	if len(students) == 0 {
+		return nil, errors.New("未找到家长关联的学生")
+	}
+	sort.Slice(students, func(i, j int) bool {
+		return students[i].FullName < students[j].FullName
+	})
+
+	// 逐个学生生成账单并合计
+	family := &FamilyStatement{Month: month, GeneratedAt: time.Now()}
+	for _, student := range students {
+		statement, err := BuildStatement(student.ID, month)
+		if err != nil {
+			return nil, err
+		}
+		family.Statements = append(family.Statements, statement)
+		family.MealTotal += statement.MealTotal
+		family.CollectedTotal += statement.CollectedTotal
+		family.Charges += statement.Charges
+		family.ClosingBalance += statement.ClosingBalance
+	}
+
+	return family, nil
+}
+
+// NotifyStatements 通过钉钉向学生和家长推送某个月的账单摘要，本月没有选餐和流水的学生跳过，返回推送的学生数
+func NotifyStatements(month string) (int, error) {
+	if _, _, err := parseStatementMonth(month); err != nil {
+		return 0, err
+	}
+
+	// 获取在读学生
+	students, err := GetAllStudents()
+	if err != nil {
+		return 0, fmt.Errorf("获取学生列表失败: %v", err)
+	}
+
+	count := 0
+	var failed []string
+	for _, student := range students {
+		statement, err := BuildStatement(student.ID, month)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s(%v)", student.FullName, err))
+			continue
+		}
+		if statement.SelectedDays == 0 && len(statement.Transactions) == 0 {
+			continue
+		}
+
+		// 收集学生和家长的钉钉ID
+		var dingTalkIDs []string
+		if student.DingTalkID != "" && student.DingTalkID != "0" {
+			dingTalkIDs = append(dingTalkIDs, student.DingTalkID)
+		}
+		parents, err := GetParentsByStudentID(student.ID)
+		if err != nil {
+			utils.LogError(fmt.Sprintf("获取学生ID=%d的家长信息失败: %v", student.ID, err))
+		}
+		for _, parent := range parents {
+			if parent != "" && parent != "0" {
+				dingTalkIDs = append(dingTalkIDs, parent)
+			}
+		}
+		if len(dingTalkIDs) == 0 {
+			continue
+		}
+
+		// 发送账单摘要
+		if err := utils.SendDingTalkActionCard(dingTalkIDs, statement.card()); err != nil {
+			failed = append(failed, fmt.Sprintf("%s(%v)", student.FullName, err))
+			continue
+		}
+		count++
+	}
+
+	if len(failed) > 0 {
+		return count, fmt.Errorf("部分学生发送失败: %s", strings.Join(failed, "；"))
+	}
+	return count, nil
+}
+
+// card 账单摘要的钉钉消息
+func (statement *Statement) card() utils.ActionCardMessage {
+	var markdown strings.Builder
+	fmt.Fprintf(&markdown, "## %s 餐费账单\n\n", statement.Month)
+	fmt.Fprintf(&markdown, "**%s**（%s）\n\n", statement.Student.FullName, statement.Student.Class)
+	fmt.Fprintf(&markdown, "- 选餐 %d 天，已取餐 %d 天\n", statement.SelectedDays, statement.CollectedDays)
+	fmt.Fprintf(&markdown, "- 餐费合计 %s 元\n", FormatAmount(statement.MealTotal))
+	fmt.Fprintf(&markdown, "- 本月充值 %s 元，扣费 %s 元\n", FormatAmount(statement.TopUps), FormatAmount(statement.Charges))
+	fmt.Fprintf(&markdown, "- 月末余额 **%s 元**\n", FormatAmount(statement.ClosingBalance))
+	return utils.ActionCardMessage{
+		Title:       fmt.Sprintf("%s %s 餐费账单", statement.Student.FullName, statement.Month),
+		Markdown:    markdown.String(),
+		SingleTitle: "查看详情",
+		SingleURL:   fmt.Sprintf("%s/dingtalk_auth", config.Get().Website.Domain),
+	}
+}
@@ -28,6 +28,7 @@ type Student struct {
 	Class                  string     `json:"class"`
 	DingTalkID             string     `json:"dingtalk_id"`
 	LastMealCollectionDate *time.Time `json:"last_meal_collection_date,omitempty"`
+	Archived               bool       `json:"archived"` // 是否已归档（已从钉钉家校通讯录中移除）
 }
 
 // 生成学生用户名：stu+姓名首字母+随机数
@@ -65,8 +66,13 @@ func generateStudentUsername(fullName string) (string, error) {
 	return username, nil
 }
 
+// queryRower 可执行单行查询的数据库连接或事务
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 // 检查用户名是否已存在
-func isUsernameExists(db *sql.DB, username string) (bool, error) {
+func isUsernameExists(db queryRower, username string) (bool, error) {
 	var count int
 	err := db.QueryRow("SELECT COUNT(*) FROM students WHERE username = ?", username).Scan(&count)
 	if err != nil {
@@ -77,22 +83,24 @@ func isUsernameExists(db *sql.DB, username string) (bool, error) {
 
 // CreateStudent 创建新学生
 func CreateStudent(fullName string, class string, dingTalkID string) (*Student, error) {
-	// 获取数据库连接
-	db := database.GetDB()
+	return repos().Students.Create(fullName, class, dingTalkID)
+}
 
+// generateUniqueStudentUsername 生成数据库中不存在的学生用户名
+func generateUniqueStudentUsername(tx *database.Tx, fullName string) (string, error) {
 	// 初始化随机数生成器
 	rand.Seed(time.Now().UnixNano())
 
 	// 生成用户名
 	username, err := generateStudentUsername(fullName)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
 	// 检查用户名是否已存在，如果已存在则重新生成
-	exists, err := isUsernameExists(db, username)
+	exists, err := isUsernameExists(tx, username)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
 	// 如果用户名已存在，尝试重新生成最多5次
@@ -100,11 +108,11 @@ func CreateStudent(fullName string, class string, dingTalkID string) (*Student,
 	for exists && attempts < 5 {
 		username, err = generateStudentUsername(fullName)
 		if err != nil {
-			return nil, err
+			return "", err
 		}
-		exists, err = isUsernameExists(db, username)
+		exists, err = isUsernameExists(tx, username)
 		if err != nil {
-			return nil, err
+			return "", err
 		}
 		attempts++
 	}
@@ -115,6 +123,19 @@ func CreateStudent(fullName string, class string, dingTalkID string) (*Student,
 		username = fmt.Sprintf("%s%d", username, timestamp)
 	}
 
+	return username, nil
+}
+
+// insertStudent 在事务中插入学生，username 为空时生成唯一用户名
+func insertStudent(tx *database.Tx, username string, fullName string, class string, dingTalkID string) (*Student, error) {
+	// 生成用户名
+	if username == "" {
+		var err error
+		if username, err = generateUniqueStudentUsername(tx, fullName); err != nil {
+			return nil, err
+		}
+	}
+
 	// 如果没有提供钉钉ID，设置为空字符串
 	if dingTalkID == "" {
 		dingTalkID = "0"
@@ -123,15 +144,8 @@ func CreateStudent(fullName string, class string, dingTalkID string) (*Student,
 	// 设置默认日期为2000年1月1日
 	defaultDate := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
 
-	// 开始事务
-	tx, err := db.Begin()
-	if err != nil {
-		return nil, err
-	}
-	defer tx.Rollback()
-
 	// 插入学生数据
-	result, err := tx.Exec(
+	studentID, err := tx.InsertID(
 		"INSERT INTO students (username, full_name, class, dingtalk_id, last_meal_collection_date) VALUES (?, ?, ?, ?, ?)",
 		username, fullName, class, dingTalkID, defaultDate,
 	)
@@ -139,18 +153,6 @@ func CreateStudent(fullName string, class string, dingTalkID string) (*Student,
 		return nil, err
 	}
 
-	// 获取插入的 ID
-	studentID, err := result.LastInsertId()
-	if err != nil {
-		return nil, err
-	}
-
-	// 提交事务
-	if err := tx.Commit(); err != nil {
-		return nil, err
-	}
-
-	// 返回创建的学生
 	return &Student{
 		ID:                     int(studentID),
 		Username:               username,
@@ -163,152 +165,64 @@ func CreateStudent(fullName string, class string, dingTalkID string) (*Student,
 
 // GetStudentByID 通过 ID 获取学生
 func GetStudentByID(id int) (*Student, error) {
-	// 获取数据库连接
-	db := database.GetDB()
-
-	// 查询学生
-	var student Student
-	var lastMealCollectionDate sql.NullTime
-
-	err := db.QueryRow(
-		`SELECT s.id, s.username, s.full_name, s.class, s.dingtalk_id, s.last_meal_collection_date
-		FROM students s 
-		WHERE s.id = ?`,
-		id,
-	).Scan(
-		&student.ID, &student.Username, &student.FullName, &student.Class,
-		&student.DingTalkID, &lastMealCollectionDate,
-	)
-
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("student not found")
-		}
-		return nil, err
-	}
-
-	if lastMealCollectionDate.Valid {
-		student.LastMealCollectionDate = &lastMealCollectionDate.Time
-	}
-
-	return &student, nil
+	return studentOrNotFound(repos().Students.GetByID(id))
 }
 
-// GetAllStudents 获取所有学生
+// GetAllStudents 获取所有在读（未归档）学生
 func GetAllStudents() ([]*Student, error) {
-	// 获取数据库连接
-	db := database.GetDB()
-
-	// 查询所有学生
-	query := `
-        SELECT s.id, s.username, s.full_name, s.class, s.dingtalk_id, s.last_meal_collection_date
-        FROM students s
-        ORDER BY s.class, s.full_name
-    `
-
-	// 执行查询
-	rows, err := db.Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	// 处理结果
-	var students []*Student
-	for rows.Next() {
-		var s Student
-		var lastMealCollectionDate sql.NullTime
-
-		err := rows.Scan(
-			&s.ID, &s.Username, &s.FullName, &s.Class,
-			&s.DingTalkID, &lastMealCollectionDate,
-		)
-		if err != nil {
-			return nil, err
-		}
-
-		if lastMealCollectionDate.Valid {
-			s.LastMealCollectionDate = &lastMealCollectionDate.Time
-		}
-
-		students = append(students, &s)
-	}
+	return repos().Students.List(false)
+}
 
-	return students, nil
+// GetStudentsIncludingArchived 获取包括已归档在内的所有学生
+func GetStudentsIncludingArchived() ([]*Student, error) {
+	return repos().Students.List(true)
 }
 
 // GetStudentByDingTalkID 通过钉钉ID获取学生
 func GetStudentByDingTalkID(dingTalkID string) (*Student, error) {
-	// 获取数据库连接
-	db := database.GetDB()
-
-	// 查询学生
-	var student Student
-	var lastMealCollectionDate sql.NullTime
-
-	err := db.QueryRow(
-		`SELECT s.id, s.username, s.full_name, s.class, s.dingtalk_id, s.last_meal_collection_date
-		FROM students s 
-		WHERE s.dingtalk_id = ?`,
-		dingTalkID,
-	).Scan(
-		&student.ID, &student.Username, &student.FullName, &student.Class,
-		&student.DingTalkID, &lastMealCollectionDate,
-	)
+	return studentOrNotFound(repos().Students.GetByDingTalkID(dingTalkID))
+}
 
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("student not found")
-		}
-		return nil, err
+// FindStudentByDingTalkIDOrParent 通过钉钉ID查找在读学生；未找到时视为家长的钉钉ID，使用第一个关联的学生
+// byParent 表示是否通过家长匹配
+func FindStudentByDingTalkIDOrParent(dingTalkID string) (student *Student, byParent bool, err error) {
+	// 使用钉钉ID查找学生
+	student, err = GetStudentByDingTalkID(dingTalkID)
+	if err == nil {
+		return student, false, nil
+	}
+
+	// 如果学生未找到，可能是家长的钉钉ID，尝试查找关联学生
+	parents, err := GetStudentsByParentID(dingTalkID)
+	if err != nil || len(parents) == 0 {
+		return nil, false, errors.New("未找到与该钉钉ID关联的学生")
 	}
 
-	if lastMealCollectionDate.Valid {
-		student.LastMealCollectionDate = &lastMealCollectionDate.Time
+	// 使用第一个关联学生
+	student, err = GetStudentByDingTalkID(parents[0].StudentID)
+	if err != nil {
+		return nil, false, errors.New("未找到学生")
 	}
+	return student, true, nil
+}
 
-	return &student, nil
+// studentOrNotFound 将未找到记录转换为原有的错误信息
+func studentOrNotFound(student *Student, err error) (*Student, error) {
+	if errors.Is(err, ErrNotFound) {
+		return nil, errors.New("student not found")
+	}
+	return student, err
 }
 
 // UpdateStudent 更新学生信息
 func UpdateStudent(student *Student) error {
-	// 获取数据库连接
-	db := database.GetDB()
-
-	// 更新学生数据
-	_, err := db.Exec(
-		`UPDATE students SET full_name = ?, class = ?, dingtalk_id = ?, last_meal_collection_date = ?
-		WHERE id = ?`,
-		student.FullName, student.Class, student.DingTalkID, student.LastMealCollectionDate, student.ID,
-	)
-
-	return err
+	return repos().Students.Update(student)
 }
 
-// DeleteStudent 删除学生
-func DeleteStudent(id int) error {
-	// 获取数据库连接
-	db := database.GetDB()
+// ErrStudentHasWallet 学生有余额、余额流水或充值订单，不能删除
+var ErrStudentHasWallet = errors.New("学生有余额、余额流水或充值订单，不能删除")
 
-	// 开始事务
-	tx, err := db.Begin()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
-	// 删除学生的选餐记录
-	_, err = tx.Exec("DELETE FROM meal_selections WHERE student_id = ?", id)
-	if err != nil {
-		return err
-	}
-
-	// 删除学生
-	_, err = tx.Exec("DELETE FROM students WHERE id = ?", id)
-	if err != nil {
-		return err
-	}
-
-	// 提交事务
-	return tx.Commit()
+// DeleteStudent 删除学生及其选餐记录，有余额、余额流水或充值订单时返回 ErrStudentHasWallet
+func DeleteStudent(id int) error {
+	return repos().Students.Delete(id)
 }
@@ -0,0 +1,190 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+)
+
+// 导入行的处理结果
+const (
+	ImportRowStatusValid     = "valid"     // 校验通过（预览模式下不写入）
+	ImportRowStatusImported  = "imported"  // 已写入
+	ImportRowStatusInvalid   = "invalid"   // 数据不完整或格式错误
+	ImportRowStatusDuplicate = "duplicate" // 与现有数据或文件中前面的行重复
+)
+
+// studentUsernamePattern 导入时指定的学生用户名格式
+var studentUsernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,64}$`)
+
+// StudentImportRow 学生导入文件中的一行及其处理结果
+type StudentImportRow struct {
+	Row        int      `json:"row"` // 文件中的行号，表头为第1行
+	FullName   string   `json:"full_name"`
+	Class      string   `json:"class"`
+	DingTalkID string   `json:"dingtalk_id"`
+	Username   string   `json:"username"` // 为空时自动生成，写入后回填
+	Status     string   `json:"status"`
+	Errors     []string `json:"errors,omitempty"`
+	StudentID  int      `json:"student_id,omitempty"` // 写入后的学生ID
+}
+
+// StudentImportReport 学生导入报告
+type StudentImportReport struct {
+	DryRun   bool                `json:"dry_run"`
+	Total    int                 `json:"total"`    // 数据行数
+	Valid    int                 `json:"valid"`    // 校验通过的行数
+	Imported int                 `json:"imported"` // 写入的学生数，预览模式下为0
+	Failed   int                 `json:"failed"`   // 校验未通过的行数
+	Rows     []*StudentImportRow `json:"rows"`
+}
+
+// ImportStudents 校验导入的学生并在单个事务中创建校验通过的学生，dryRun 为 true 时只校验不写入
+// 有钉钉ID的行按钉钉ID判断是否与现有学生（包括已归档）重复，没有钉钉ID的行按姓名和班级判断
+func ImportStudents(rows []*StudentImportRow, dryRun bool) (*StudentImportReport, error) {
+	report := &StudentImportReport{DryRun: dryRun, Total: len(rows), Rows: rows}
+
+	// 获取现有学生
+	students, err := GetStudentsIncludingArchived()
+	if err != nil {
+		return nil, err
+	}
+	byDingTalkID := make(map[string]*Student)
+	byUsername := make(map[string]bool)
+	byNameClass := make(map[string]bool)
+	for _, student := range students {
+		if student.DingTalkID != "" && student.DingTalkID != "0" {
+			byDingTalkID[student.DingTalkID] = student
+		}
+		byUsername[student.Username] = true
+		if !student.Archived {
+			byNameClass[student.FullName+"\x00"+student.Class] = true
+		}
+	}
+
+	// 文件中已出现的行
+	fileDingTalkIDs := make(map[string]int)
+	fileUsernames := make(map[string]int)
+	fileNameClasses := make(map[string]int)
+
+	// 逐行校验
+	var valid []*StudentImportRow
+	for _, row := range rows {
+		validateStudentImportRow(row)
+		if len(row.Errors) > 0 {
+			row.Status = ImportRowStatusInvalid
+			report.Failed++
+			continue
+		}
+
+		// 检查重复
+		nameClass := row.FullName + "\x00" + row.Class
+		if row.DingTalkID != "" {
+			if existing, ok := byDingTalkID[row.DingTalkID]; ok {
+				row.addError(fmt.Sprintf("钉钉ID与现有学生重复：%s（%s）", existing.FullName, existing.Class))
+			} else if line, ok := fileDingTalkIDs[row.DingTalkID]; ok {
+				row.addError(fmt.Sprintf("钉钉ID与第%d行重复", line))
+			}
+		} else {
+			if byNameClass[nameClass] {
+				row.addError("同班已有同名学生")
+			} else if line, ok := fileNameClasses[nameClass]; ok {
+				row.addError(fmt.Sprintf("姓名和班级与第%d行重复", line))
+			}
+		}
+		if row.Username != "" {
+			if byUsername[row.Username] {
+				row.addError("用户名已被使用")
+			} else if line, ok := fileUsernames[row.Username]; ok {
+				row.addError(fmt.Sprintf("用户名与第%d行重复", line))
+			}
+		}
+		if len(row.Errors) > 0 {
+			row.Status = ImportRowStatusDuplicate
+			report.Failed++
+			continue
+		}
+
+		// 记录已出现的行
+		if row.DingTalkID != "" {
+			fileDingTalkIDs[row.DingTalkID] = row.Row
+		} else {
+			fileNameClasses[nameClass] = row.Row
+		}
+		if row.Username != "" {
+			fileUsernames[row.Username] = row.Row
+		}
+
+		row.Status = ImportRowStatusValid
+		valid = append(valid, row)
+	}
+	report.Valid = len(valid)
+
+	// 预览模式或没有可写入的行时不修改数据
+	if dryRun || len(valid) == 0 {
+		return report, nil
+	}
+
+	// 在单个事务中创建学生
+	if err := createImportedStudents(valid); err != nil {
+		return nil, err
+	}
+	report.Imported = len(valid)
+
+	return report, nil
+}
+
+// validateStudentImportRow 校验单行数据的完整性和格式
+func validateStudentImportRow(row *StudentImportRow) {
+	if row.DingTalkID == "0" {
+		row.DingTalkID = ""
+	}
+	if row.FullName == "" {
+		row.addError("姓名不能为空")
+	} else if utf8.RuneCountInString(row.FullName) > 64 {
+		row.addError("姓名不能超过64个字符")
+	}
+	if row.Class == "" {
+		row.addError("班级不能为空")
+	} else if utf8.RuneCountInString(row.Class) > 64 {
+		row.addError("班级不能超过64个字符")
+	}
+	if len(row.DingTalkID) > 64 {
+		row.addError("钉钉ID不能超过64个字符")
+	}
+	if row.Username != "" && !studentUsernamePattern.MatchString(row.Username) {
+		row.addError("用户名只能包含字母、数字、下划线、点和短横线，长度为3到64个字符")
+	}
+}
+
+// addError 添加一条错误信息
+func (row *StudentImportRow) addError(message string) {
+	row.Errors = append(row.Errors, message)
+}
+
+// createImportedStudents 在单个事务中创建学生，任一失败时全部回滚，学生ID和用户名会回填到行中
+func createImportedStudents(rows []*StudentImportRow) error {
+	// 创建学生
+	created := make([]*Student, len(rows))
+	err := repos().InTx(func(r *Repositories) error {
+		for i, row := range rows {
+			student, err := r.Students.CreateWithUsername(row.Username, row.FullName, row.Class, row.DingTalkID)
+			if err != nil {
+				return fmt.Errorf("第%d行写入失败: %v", row.Row, err)
+			}
+			created[i] = student
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// 成功写入后回填并更新状态
+	for i, row := range rows {
+		row.StudentID = created[i].ID
+		row.Username = created[i].Username
+		row.Status = ImportRowStatusImported
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package models
+
+import "testing"
+
+func TestImportStudents(t *testing.T) {
+	r := newTestRepositories(t)
+	existing := newTestStudent(t, r, "张三", 0)
+
+	rows := []*StudentImportRow{
+		{Row: 2, FullName: "李四", Class: "一班", DingTalkID: "s2", Username: "li.si"},
+		{Row: 3, FullName: "王五", Class: "二班"},
+		{Row: 4, FullName: "赵六", Class: "二班", Username: existing.Username},
+		{Row: 5, FullName: "", Class: "二班"},
+	}
+	report, err := ImportStudents(rows, false)
+	if err != nil {
+		t.Fatalf("import students: %v", err)
+	}
+	if report.Imported != 2 || report.Failed != 2 {
+		t.Errorf("report = imported %d, failed %d, want 2, 2", report.Imported, report.Failed)
+	}
+
+	// 写入的行回填学生ID和用户名
+	wantStatus := []string{ImportRowStatusImported, ImportRowStatusImported, ImportRowStatusDuplicate, ImportRowStatusInvalid}
+	for i, row := range rows {
+		if row.Status != wantStatus[i] {
+			t.Errorf("row %d status = %s, want %s", row.Row, row.Status, wantStatus[i])
+		}
+	}
+	for _, row := range rows[:2] {
+		student, err := r.Students.GetByID(row.StudentID)
+		if err != nil || student.FullName != row.FullName || student.Username != row.Username || row.Username == "" {
+			t.Errorf("row %d student = %+v, %v", row.Row, student, err)
+		}
+	}
+	if rows[0].Username != "li.si" {
+		t.Errorf("row 2 username = %s, want li.si", rows[0].Username)
+	}
+}
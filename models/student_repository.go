@@ -0,0 +1,154 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/itsHenry35/canteen-management-system/database"
+)
+
+// sqlStudentRepository 基于 SQL 数据库的学生数据访问
+type sqlStudentRepository struct {
+	db database.Conn
+}
+
+const studentColumns = "s.id, s.username, s.full_name, s.class, s.dingtalk_id, s.last_meal_collection_date, s.archived"
+
+// scanStudent 读取一行学生数据
+func scanStudent(row interface{ Scan(...interface{}) error }) (*Student, error) {
+	var student Student
+	var dingTalkID sql.NullString
+	var lastMealCollectionDate sql.NullTime
+	err := row.Scan(
+		&student.ID, &student.Username, &student.FullName, &student.Class,
+		&dingTalkID, &lastMealCollectionDate, &student.Archived,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	student.DingTalkID = dingTalkID.String
+	if lastMealCollectionDate.Valid {
+		student.LastMealCollectionDate = &lastMealCollectionDate.Time
+	}
+
+	return &student, nil
+}
+
+func (r *sqlStudentRepository) Create(fullName, class, dingTalkID string) (*Student, error) {
+	return r.CreateWithUsername("", fullName, class, dingTalkID)
+}
+
+func (r *sqlStudentRepository) CreateWithUsername(username, fullName, class, dingTalkID string) (*Student, error) {
+	// 在事务中生成用户名并插入学生数据
+	var student *Student
+	err := database.WithTx(r.db, func(tx *database.Tx) error {
+		var err error
+		student, err = insertStudent(tx, username, fullName, class, dingTalkID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return student, nil
+}
+
+func (r *sqlStudentRepository) GetByID(id int) (*Student, error) {
+	return scanStudent(r.db.QueryRow("SELECT "+studentColumns+" FROM students s WHERE s.id = ?", id))
+}
+
+func (r *sqlStudentRepository) GetByDingTalkID(dingTalkID string) (*Student, error) {
+	return scanStudent(r.db.QueryRow(
+		"SELECT "+studentColumns+" FROM students s WHERE s.dingtalk_id = ? AND s.archived = FALSE",
+		dingTalkID,
+	))
+}
+
+func (r *sqlStudentRepository) List(includeArchived bool) ([]*Student, error) {
+	// 查询条件
+	query := "SELECT " + studentColumns + " FROM students s"
+	if !includeArchived {
+		query += " WHERE s.archived = FALSE"
+	}
+	query += " ORDER BY s.class, s.full_name, s.id"
+
+	// 执行查询
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// 处理结果
+	var students []*Student
+	for rows.Next() {
+		student, err := scanStudent(rows)
+		if err != nil {
+			return nil, err
+		}
+		students = append(students, student)
+	}
+
+	return students, rows.Err()
+}
+
+func (r *sqlStudentRepository) Update(student *Student) error {
+	_, err := r.db.Exec(
+		`UPDATE students SET full_name = ?, class = ?, dingtalk_id = ?, last_meal_collection_date = ?
+		WHERE id = ?`,
+		student.FullName, student.Class, student.DingTalkID, student.LastMealCollectionDate, student.ID,
+	)
+	return err
+}
+
+func (r *sqlStudentRepository) Delete(id int) error {
+	return database.WithTx(r.db, func(tx *database.Tx) error {
+		return deleteStudent(tx, id)
+	})
+}
+
+// deleteStudent 在事务中删除学生及其相关记录
+func deleteStudent(tx *database.Tx, id int) error {
+	// 有余额、余额流水或充值订单的学生不能删除，以免丢失账目
+	var wallets int
+	err := tx.QueryRow(
+		`SELECT (SELECT COUNT(*) FROM wallet_transactions WHERE student_id = ?)
+		+ (SELECT COUNT(*) FROM student_wallets WHERE student_id = ? AND balance <> 0)
+		+ (SELECT COUNT(*) FROM payment_orders WHERE student_id = ?)`,
+		id, id, id,
+	).Scan(&wallets)
+	if err != nil {
+		return err
+	}
+	if wallets > 0 {
+		return ErrStudentHasWallet
+	}
+
+	// 删除学生的选餐记录、变更历史、取餐记录和未取餐提醒记录
+	if _, err := tx.Exec("DELETE FROM meal_selections WHERE student_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM meal_selection_history WHERE student_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM meal_collections WHERE student_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM no_show_alerts WHERE student_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM student_wallets WHERE student_id = ?", id); err != nil { // 余额为0且没有流水的空钱包
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM student_absences WHERE student_id = ?", id); err != nil {
+		return err
+	}
+
+	// 删除学生
+	_, err = tx.Exec("DELETE FROM students WHERE id = ?", id)
+	return err
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/itsHenry35/canteen-management-system/database"
+)
+
+// sqlUserRepository 基于 SQL 数据库的用户数据访问
+type sqlUserRepository struct {
+	db database.Conn
+}
+
+const userColumns = "id, username, password, full_name, role, dingtalk_id"
+
+// scanUser 读取一行用户数据
+func scanUser(row interface{ Scan(...interface{}) error }) (*User, error) {
+	var user User
+	var dingTalkID sql.NullString
+	err := row.Scan(&user.ID, &user.Username, &user.Password, &user.FullName, &user.Role, &dingTalkID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	if dingTalkID.Valid {
+		user.DingTalkID = dingTalkID.String
+	}
+
+	return &user, nil
+}
+
+func (r *sqlUserRepository) Create(user *User) error {
+	// 插入用户数据
+	id, err := r.db.InsertID(
+		"INSERT INTO users (username, password, full_name, role, dingtalk_id) VALUES (?, ?, ?, ?, ?)",
+		user.Username, user.Password, user.FullName, user.Role, user.DingTalkID,
+	)
+	if err != nil {
+		return err
+	}
+
+	user.ID = int(id)
+	return nil
+}
+
+func (r *sqlUserRepository) GetByID(id int) (*User, error) {
+	return scanUser(r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ?", id))
+}
+
+func (r *sqlUserRepository) GetByUsername(username string) (*User, error) {
+	return scanUser(r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE username = ?", username))
+}
+
+func (r *sqlUserRepository) GetByDingTalkID(dingTalkID string) (*User, error) {
+	return scanUser(r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE dingtalk_id = ?", dingTalkID))
+}
+
+func (r *sqlUserRepository) List(role Role) ([]*User, error) {
+	// 查询条件
+	query := "SELECT " + userColumns + " FROM users"
+	var args []interface{}
+	if role != "" {
+		query += " WHERE role = ?"
+		args = append(args, role)
+	}
+	query += " ORDER BY id"
+
+	// 执行查询
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// 处理结果
+	var users []*User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+func (r *sqlUserRepository) Update(user *User) error {
+	_, err := r.db.Exec(
+		"UPDATE users SET full_name = ?, dingtalk_id = ? WHERE id = ?",
+		user.FullName, user.DingTalkID, user.ID,
+	)
+	return err
+}
+
+func (r *sqlUserRepository) UpdatePassword(id int, hashedPassword string) error {
+	_, err := r.db.Exec("UPDATE users SET password = ? WHERE id = ?", hashedPassword, id)
+	return err
+}
+
+func (r *sqlUserRepository) Delete(id int) error {
+	_, err := r.db.Exec("DELETE FROM users WHERE id = ?", id)
+	return err
+}
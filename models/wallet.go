@@ -0,0 +1,370 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/config"
+)
+
+// 余额流水类型
+const (
+	WalletTypeTopUp      = "top_up"     // 充值
+	WalletTypeCharge     = "charge"     // 扣费
+	WalletTypeRefund     = "refund"     // 退款
+	WalletTypeAdjustment = "adjustment" // 调整，金额可正可负
+)
+
+// 扣费时机
+const (
+	ChargeOnSelection  = "selection"  // 选餐时按领餐天数扣费，修改选餐时退还差额
+	ChargeOnCollection = "collection" // 每次取餐时扣一份的费用
+)
+
+// WalletTransaction 余额流水，只追加不修改，金额单位为分
+type WalletTransaction struct {
+	ID           int       `json:"id"`
+	StudentID    int       `json:"student_id"`
+	Type         string    `json:"type"`
+	Amount       int       `json:"amount"`                 // 正数增加余额，负数减少余额
+	BalanceAfter int       `json:"balance_after"`          // 记账后的余额
+	MealID       int       `json:"meal_id,omitempty"`      // 选餐和取餐扣费关联的餐
+	MealType     MealType  `json:"meal_type,omitempty"`    // 选餐和取餐扣费的餐食类型
+	ServiceDate  string    `json:"service_date,omitempty"` // 取餐扣费的取餐日期（YYYY-MM-DD），选餐扣费为空
+	Note         string    `json:"note"`
+	Operator     string    `json:"operator"`
+	CreatedAt    time.Time `json:"created_at"`
+	StudentName  string    `json:"student_name,omitempty"`
+}
+
+// WalletTransactionFilter 余额流水查询条件，为空的条件不参与筛选
+type WalletTransactionFilter struct {
+	StudentID int
+	Type      string
+	MealID    int
+	From      time.Time // 起始时间（含）
+	To        time.Time // 结束时间（含）
+	Page      int       // 从1开始
+	PageSize  int
+}
+
+// IsValidWalletType 判断余额流水类型是否有效
+func IsValidWalletType(txType string) bool {
+	switch txType {
+	case WalletTypeTopUp, WalletTypeCharge, WalletTypeRefund, WalletTypeAdjustment:
+		return true
+	}
+	return false
+}
+
+// FormatAmount 将金额（分）格式化为元，如 1250 -> 12.50
+func FormatAmount(amount int) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
+// GetWalletBalance 获取学生余额（分），没有流水时为0
+func GetWalletBalance(studentID int) (int, error) {
+	return repos().Wallets.GetBalance(studentID)
+}
+
+// CreateWalletTransaction 手动记账：充值、退款和扣费的 amount 为正数，调整的 amount 可正可负
+func CreateWalletTransaction(studentID int, txType string, amount int, note, operator string) (*WalletTransaction, error) {
+	// 验证参数
+	switch txType {
+	case WalletTypeTopUp, WalletTypeRefund:
+		if amount <= 0 {
+			return nil, errors.New("金额必须大于0")
+		}
+	case WalletTypeCharge:
+		if amount <= 0 {
+			return nil, errors.New("金额必须大于0")
+		}
+		amount = -amount
+	case WalletTypeAdjustment:
+		if amount == 0 {
+			return nil, errors.New("调整金额不能为0")
+		}
+	default:
+		return nil, errors.New("无效的流水类型")
+	}
+	if _, err := GetStudentByID(studentID); err != nil {
+		return nil, err
+	}
+
+	// 记账
+	entry := &WalletTransaction{StudentID: studentID, Type: txType, Amount: amount, Note: note, Operator: operator}
+	if err := repos().Wallets.Post(entry); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// GetWalletTransactions 分页查询余额流水，按时间倒序，同时返回总数
+func GetWalletTransactions(filter WalletTransactionFilter) ([]*WalletTransaction, int, error) {
+	return repos().Wallets.List(filter)
+}
+
+// billingChargesOn 扣费已启用且扣费时机为 chargeOn 时返回 true
+func billingChargesOn(chargeOn string) bool {
+	billing := config.Get().Billing
+	return billing.Enabled && billing.ChargeOn == chargeOn
+}
+
+// selectionCharge 按选餐扣费时，选餐按校历 cal 应扣的总金额（分）和计费天数，请假的日期不计费
+func selectionCharge(r *Repositories, cal schoolCalendar, meal *Meal, studentID int, mealType MealType) (int, int, error) {
+	absent, err := getMealAbsenceDays(r, cal, meal, studentID)
+	if err != nil {
+		return 0, 0, err
+	}
+	days := absent.presentDays(studentID, cal.servingDates(meal))
+	return meal.Price(mealType) * days, days, nil
+}
+
+// checkSelectionBalance 学生或家长选餐前，在选餐事务中锁定余额并检查，余额不足且设置了禁止选餐时返回错误
+// 按选餐扣费时需要足够支付与已扣费用的差额，按取餐扣费时需要足够支付整个领餐时间的费用
+func checkSelectionBalance(r *Repositories, studentID int, meal *Meal, mealType MealType) error {
+	billing := config.Get().Billing
+	if !billing.Enabled || !billing.BlockInsufficientBalance {
+		return nil
+	}
+
+	// 计算需要的金额
+	required, _, err := selectionCharge(r, currentCalendar(), meal, studentID, mealType)
+	if err != nil {
+		return err
+	}
+	if billing.ChargeOn == ChargeOnSelection {
+		net, err := r.Wallets.SelectionChargeNet(studentID, meal.ID)
+		if err != nil {
+			return err
+		}
+		required += net
+	}
+	if required <= 0 {
+		return nil
+	}
+
+	// 锁定并检查余额，并发的选餐和扣费在事务提交前不能修改余额
+	balance, err := r.Wallets.LockBalance(studentID)
+	if err != nil {
+		return err
+	}
+	if balance < required {
+		return fmt.Errorf("余额不足，需要 %s 元，当前余额 %s 元", FormatAmount(required), FormatAmount(balance))
+	}
+
+	return nil
+}
+
+// chargeSelections 按选餐扣费时，在保存选餐的事务中为选餐记账：补扣或退还与已扣费用的差额
+// 记账失败时返回错误，选餐随事务一起回滚
+func chargeSelections(r *Repositories, meal *Meal, selections []*MealSelection) error {
+	if !billingChargesOn(ChargeOnSelection) || len(selections) == 0 {
+		return nil
+	}
+	if err := postSelectionCharges(r, currentCalendar(), meal, selections, ""); err != nil {
+		return fmt.Errorf("选餐扣费失败: %v", err)
+	}
+	return nil
+}
+
+// postSelectionCharges 通过 r 按校历 cal 为选餐记账
+// adjustment 不为空时表示因请假或校历变化重新计算（如"请假"、"校历调整"），只调整已扣过费的选餐，
+// 包括因请假或节假日已全部退还的选餐，未扣过费的选餐（如未启用扣费时保存的选餐）不调整
+func postSelectionCharges(r *Repositories, cal schoolCalendar, meal *Meal, selections []*MealSelection, adjustment string) error {
+	for _, selection := range selections {
+		// 计算差额
+		net, err := r.Wallets.SelectionChargeNet(selection.StudentID, meal.ID)
+		if err != nil {
+			return err
+		}
+		if adjustment != "" && net == 0 {
+			charged, err := r.Wallets.HasSelectionCharges(selection.StudentID, meal.ID)
+			if err != nil {
+				return err
+			}
+			if !charged {
+				continue
+			}
+		}
+		charge, days, err := selectionCharge(r, cal, meal, selection.StudentID, selection.MealType)
+		if err != nil {
+			return err
+		}
+		diff := -charge - net
+		if diff == 0 {
+			continue
+		}
+
+		// 记账
+		entry := &WalletTransaction{
+			StudentID: selection.StudentID,
+			Type:      WalletTypeCharge,
+			Amount:    diff,
+			MealID:    meal.ID,
+			MealType:  selection.MealType,
+			Note:      fmt.Sprintf("%s %s餐 %d天", meal.Name, selection.MealType, days),
+			Operator:  selection.Operator,
+		}
+		switch {
+		case adjustment != "" && diff > 0:
+			entry.Type = WalletTypeRefund
+			entry.Note = fmt.Sprintf("%s %s退还差额，按%d天计", meal.Name, adjustment, days)
+		case adjustment != "":
+			entry.Note = fmt.Sprintf("%s %s补扣差额，按%d天计", meal.Name, adjustment, days)
+		case diff > 0:
+			entry.Type = WalletTypeRefund
+			entry.Note = fmt.Sprintf("%s 改选%s餐退还差额", meal.Name, selection.MealType)
+		case net != 0:
+			entry.Note = fmt.Sprintf("%s 改选%s餐补扣差额", meal.Name, selection.MealType)
+		}
+		if err := r.Wallets.Post(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// adjustSelectionCharges 按选餐扣费时，通过 r 按校历 cal 为领餐日期与 [from, to] 重叠的餐重新计算已扣的费用，退还或补扣差额
+// studentID 为0时调整所有学生；流水的说明包含 adjustment，操作人为 operator
+// 由请假或校历修改的事务调用，返回错误时整个修改回滚
+func adjustSelectionCharges(r *Repositories, cal schoolCalendar, from, to time.Time, studentID int, adjustment, operator string) error {
+	if !billingChargesOn(ChargeOnSelection) {
+		return nil
+	}
+
+	// 期间领餐的餐
+	meals, err := getMealsServedBetween(r, from, to)
+	if err != nil {
+		return fmt.Errorf("获取%s期间的餐失败: %v", adjustment, err)
+	}
+	for _, meal := range meals {
+		// 获取选餐记录
+		var selections []*MealSelection
+		if studentID != 0 {
+			selection, err := r.Selections.GetByStudentAndMeal(studentID, meal.ID)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("获取学生ID=%d的选餐记录失败: %v", studentID, err)
+			}
+			if selection != nil {
+				selections = append(selections, selection)
+			}
+		} else {
+			selections, err = r.Selections.ListByMeal(meal.ID)
+			if err != nil {
+				return fmt.Errorf("获取餐ID=%d的选餐记录失败: %v", meal.ID, err)
+			}
+		}
+		if len(selections) == 0 {
+			continue
+		}
+
+		// 流水的操作人为调整的人
+		if err := postSelectionCharges(r, cal, meal, withOperator(selections, operator), adjustment); err != nil {
+			return fmt.Errorf("餐ID=%d的%s餐费调整失败: %v", meal.ID, adjustment, err)
+		}
+	}
+
+	return nil
+}
+
+// withOperator 复制选餐记录并把操作人改为 operator，用于调整餐费时记录调整的人
+func withOperator(selections []*MealSelection, operator string) []*MealSelection {
+	copied := make([]*MealSelection, 0, len(selections))
+	for _, selection := range selections {
+		selectionCopy := *selection
+		selectionCopy.Operator = operator
+		copied = append(copied, &selectionCopy)
+	}
+	return copied
+}
+
+// recostMealCharges 按选餐扣费时，在修改餐的事务中按新的价格和领餐日期重新计算已扣的费用，退还或补扣差额
+func recostMealCharges(r *Repositories, meal *Meal, operator string) error {
+	if !billingChargesOn(ChargeOnSelection) {
+		return nil
+	}
+	selections, err := r.Selections.ListByMeal(meal.ID)
+	if err != nil {
+		return fmt.Errorf("获取餐ID=%d的选餐记录失败: %v", meal.ID, err)
+	}
+	if err := postSelectionCharges(r, currentCalendar(), meal, withOperator(selections, operator), "餐调整"); err != nil {
+		return fmt.Errorf("餐ID=%d的餐费调整失败: %v", meal.ID, err)
+	}
+	return nil
+}
+
+// refundDeletedMeal 在删除餐的事务中退还按选餐扣的餐费，已经过去的供餐日按请假后的天数保留，其余全部退还
+// 不论当前的扣费设置如何，只要该餐还有扣费就退还，避免删除餐后家长的钱无法退回
+func refundDeletedMeal(r *Repositories, meal *Meal, operator string) error {
+	selections, err := r.Selections.ListByMeal(meal.ID)
+	if err != nil {
+		return fmt.Errorf("获取餐ID=%d的选餐记录失败: %v", meal.ID, err)
+	}
+
+	// 今天之前的领餐日期
+	today := time.Now()
+	served := *meal
+	served.EffectiveEndDate = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, -1)
+
+	cal := currentCalendar()
+	for _, selection := range selections {
+		net, err := r.Wallets.SelectionChargeNet(selection.StudentID, meal.ID)
+		if err != nil {
+			return err
+		}
+		if net >= 0 {
+			continue
+		}
+		kept, days, err := selectionCharge(r, cal, &served, selection.StudentID, selection.MealType)
+		if err != nil {
+			return err
+		}
+		refund := -net - kept
+		if refund <= 0 {
+			continue
+		}
+		if err := r.Wallets.Post(&WalletTransaction{
+			StudentID: selection.StudentID,
+			Type:      WalletTypeRefund,
+			Amount:    refund,
+			MealID:    meal.ID,
+			MealType:  selection.MealType,
+			Note:      fmt.Sprintf("%s 已删除，退还餐费，保留已领餐的%d天", meal.Name, days),
+			Operator:  operator,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// chargeCollection 按取餐扣费时，通过绑定取餐事务的 r 扣一份的费用；meal 为空或价格为0时不记账
+func chargeCollection(r *Repositories, meal *Meal, studentID int, mealType MealType, date, operator string) error {
+	if meal == nil {
+		return nil
+	}
+	price := meal.Price(mealType)
+	if price == 0 {
+		return nil
+	}
+	return r.Wallets.Post(&WalletTransaction{
+		StudentID:   studentID,
+		Type:        WalletTypeCharge,
+		Amount:      -price,
+		MealID:      meal.ID,
+		MealType:    mealType,
+		ServiceDate: date,
+		Note:        fmt.Sprintf("%s %s餐 %s", meal.Name, mealType, date),
+		Operator:    operator,
+	})
+}
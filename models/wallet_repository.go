@@ -0,0 +1,176 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/database"
+)
+
+// sqlWalletRepository 基于 SQL 数据库的余额数据访问
+type sqlWalletRepository struct {
+	db database.Conn
+}
+
+func (r *sqlWalletRepository) GetBalance(studentID int) (int, error) {
+	var balance int
+	err := r.db.QueryRow("SELECT balance FROM student_wallets WHERE student_id = ?", studentID).Scan(&balance)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return balance, err
+}
+
+func (r *sqlWalletRepository) LockBalance(studentID int) (int, error) {
+	var balance int
+	err := database.WithTx(r.db, func(tx *database.Tx) error {
+		if err := ensureWallet(tx, studentID, time.Now()); err != nil {
+			return err
+		}
+
+		// UPDATE 锁定该行，其他事务的记账需等待本事务结束
+		if _, err := tx.Exec("UPDATE student_wallets SET balance = balance WHERE student_id = ?", studentID); err != nil {
+			return err
+		}
+		return tx.QueryRow("SELECT balance FROM student_wallets WHERE student_id = ?", studentID).Scan(&balance)
+	})
+	return balance, err
+}
+
+// ensureWallet 确保学生的钱包存在
+func ensureWallet(tx *database.Tx, studentID int, now time.Time) error {
+	_, err := tx.Exec(
+		tx.Dialect().InsertIgnore("INSERT INTO student_wallets (student_id, balance, updated_at) VALUES (?, 0, ?)"),
+		studentID, now.UTC(),
+	)
+	return err
+}
+
+func (r *sqlWalletRepository) Post(entry *WalletTransaction) error {
+	return database.WithTx(r.db, func(tx *database.Tx) error {
+		entry.CreatedAt = time.Now()
+		if err := ensureWallet(tx, entry.StudentID, entry.CreatedAt); err != nil {
+			return err
+		}
+
+		// 更新余额，UPDATE 会锁定该行，并发记账时余额不会丢失
+		_, err := tx.Exec(
+			"UPDATE student_wallets SET balance = balance + ?, updated_at = ? WHERE student_id = ?",
+			entry.Amount, entry.CreatedAt.UTC(), entry.StudentID,
+		)
+		if err != nil {
+			return err
+		}
+		if err := tx.QueryRow("SELECT balance FROM student_wallets WHERE student_id = ?", entry.StudentID).Scan(&entry.BalanceAfter); err != nil {
+			return err
+		}
+
+		// 追加流水
+		id, err := tx.InsertID(
+			`INSERT INTO wallet_transactions (student_id, type, amount, balance_after, meal_id, meal_type, service_date, note, operator, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			entry.StudentID, entry.Type, entry.Amount, entry.BalanceAfter, entry.MealID, entry.MealType, entry.ServiceDate,
+			entry.Note, entry.Operator, entry.CreatedAt.UTC(),
+		)
+		if err != nil {
+			return err
+		}
+		entry.ID = int(id)
+
+		return nil
+	})
+}
+
+func (r *sqlWalletRepository) List(filter WalletTransactionFilter) ([]*WalletTransaction, int, error) {
+	// 构建查询条件
+	var conditions []string
+	var args []interface{}
+	if filter.StudentID != 0 {
+		conditions = append(conditions, "t.student_id = ?")
+		args = append(args, filter.StudentID)
+	}
+	if filter.Type != "" {
+		conditions = append(conditions, "t.type = ?")
+		args = append(args, filter.Type)
+	}
+	if filter.MealID != 0 {
+		conditions = append(conditions, "t.meal_id = ?")
+		args = append(args, filter.MealID)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "t.created_at >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "t.created_at <= ?")
+		args = append(args, filter.To.UTC())
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// 统计总数
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM wallet_transactions t "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	// 分页参数
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = 20
+	}
+
+	// 查询记录
+	rows, err := r.db.Query(
+		`SELECT t.id, t.student_id, t.type, t.amount, t.balance_after, t.meal_id, t.meal_type, t.service_date, t.note, t.operator, t.created_at,
+		COALESCE(s.full_name, '')
+		FROM wallet_transactions t LEFT JOIN students s ON s.id = t.student_id `+where+` ORDER BY t.id DESC LIMIT ? OFFSET ?`,
+		append(args, filter.PageSize, (filter.Page-1)*filter.PageSize)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	// 处理结果
+	transactions := []*WalletTransaction{}
+	for rows.Next() {
+		var entry WalletTransaction
+		err := rows.Scan(
+			&entry.ID, &entry.StudentID, &entry.Type, &entry.Amount, &entry.BalanceAfter, &entry.MealID, &entry.MealType,
+			&entry.ServiceDate, &entry.Note, &entry.Operator, &entry.CreatedAt, &entry.StudentName,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		transactions = append(transactions, &entry)
+	}
+
+	return transactions, total, rows.Err()
+}
+
+func (r *sqlWalletRepository) SelectionChargeNet(studentID, mealID int) (int, error) {
+	var net int
+	err := r.db.QueryRow(
+		`SELECT COALESCE(SUM(amount), 0) FROM wallet_transactions
+		WHERE student_id = ? AND meal_id = ? AND service_date = '' AND type IN (?, ?)`,
+		studentID, mealID, WalletTypeCharge, WalletTypeRefund,
+	).Scan(&net)
+	return net, err
+}
+
+func (r *sqlWalletRepository) HasSelectionCharges(studentID, mealID int) (bool, error) {
+	var count int
+	err := r.db.QueryRow(
+		`SELECT COUNT(*) FROM wallet_transactions
+		WHERE student_id = ? AND meal_id = ? AND service_date = '' AND type IN (?, ?)`,
+		studentID, mealID, WalletTypeCharge, WalletTypeRefund,
+	).Scan(&count)
+	return count > 0, err
+}
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/itsHenry35/canteen-management-system/config"
+)
+
+func TestPostSelectionCharges(t *testing.T) {
+	type step struct {
+		mealType   MealType
+		adjustment string
+	}
+	tests := []struct {
+		name     string
+		steps    []step
+		wantNet  int
+		wantType string // 最后一条流水的类型
+		wantNote string // 最后一条流水说明包含的内容
+	}{
+		{"first selection", []step{{MealTypeA, ""}}, -1500, WalletTypeCharge, "A餐 3天"},
+		{"switch to dearer", []step{{MealTypeA, ""}, {MealTypeB, ""}}, -2100, WalletTypeCharge, "改选B餐补扣差额"},
+		{"switch to cheaper", []step{{MealTypeB, ""}, {MealTypeA, ""}}, -1500, WalletTypeRefund, "改选A餐退还差额"},
+		{"same selection again", []step{{MealTypeA, ""}, {MealTypeA, ""}}, -1500, WalletTypeCharge, "A餐 3天"},
+		{"adjust uncharged", []step{{MealTypeA, "请假"}}, 0, WalletTypeTopUp, ""},
+		{"adjust charged", []step{{MealTypeA, ""}, {MealTypeB, "校历调整"}}, -2100, WalletTypeCharge, "校历调整补扣差额"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRepositories(t)
+			useBilling(t, ChargeOnSelection, false)
+			meal := newTestMeal(t, r, testDay(1), 3, 500, 700)
+			student := newTestStudent(t, r, "张三", 10000)
+
+			for _, s := range tt.steps {
+				selection := &MealSelection{StudentID: student.ID, MealID: meal.ID, MealType: s.mealType, Operator: "admin"}
+				if err := postSelectionCharges(r, currentCalendar(), meal, []*MealSelection{selection}, s.adjustment); err != nil {
+					t.Fatalf("post selection charges: %v", err)
+				}
+			}
+
+			if net, err := r.Wallets.SelectionChargeNet(student.ID, meal.ID); err != nil || net != tt.wantNet {
+				t.Errorf("selection charge net = %d, %v, want %d", net, err, tt.wantNet)
+			}
+			wantBalance(t, r, student.ID, 10000+tt.wantNet)
+			entries, _, err := r.Wallets.List(WalletTransactionFilter{StudentID: student.ID})
+			if err != nil || len(entries) == 0 {
+				t.Fatalf("list transactions = %v, %v", entries, err)
+			}
+			if entries[0].Type != tt.wantType || !strings.Contains(entries[0].Note, tt.wantNote) {
+				t.Errorf("latest transaction = %s %q, want %s containing %q", entries[0].Type, entries[0].Note, tt.wantType, tt.wantNote)
+			}
+		})
+	}
+}
+
+func TestAbsenceAdjustsSelectionCharges(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end int // 请假日期相对今天的天数
+		wantRefund int
+	}{
+		{"one day", 2, 2, 500},
+		{"whole meal", 1, 3, 1500},
+		{"overlapping end", 3, 5, 500},
+		{"outside meal", 5, 6, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRepositories(t)
+			useBilling(t, ChargeOnSelection, false)
+			meal := newTestMeal(t, r, testDay(1), 3, 500, 700)
+			student := newTestStudent(t, r, "张三", 10000)
+			selectAndCharge(t, r, meal, student.ID, MealTypeA)
+
+			// 登记请假时退还请假日期的餐费
+			absence, err := CreateAbsence(student.ID, testDay(tt.start).Format(collectionDateLayout), testDay(tt.end).Format(collectionDateLayout), "病假", AbsenceReporterAdmin, "admin")
+			if err != nil {
+				t.Fatalf("create absence: %v", err)
+			}
+			wantBalance(t, r, student.ID, 10000-1500+tt.wantRefund)
+
+			// 取消请假时补扣
+			if _, err := DeleteAbsence(absence.ID, "admin"); err != nil {
+				t.Fatalf("delete absence: %v", err)
+			}
+			wantBalance(t, r, student.ID, 10000-1500)
+		})
+	}
+}
+
+func TestCalendarChangeAdjustsSelectionCharges(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end int // 节假日相对今天的天数
+		wantRefund int
+	}{
+		{"one holiday", 2, 2, 500},
+		{"two holidays", 1, 2, 1000},
+		{"outside meal", 5, 5, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRepositories(t)
+			useBilling(t, ChargeOnSelection, false)
+			meal := newTestMeal(t, r, testDay(1), 3, 500, 700)
+			student := newTestStudent(t, r, "张三", 10000)
+			selectAndCharge(t, r, meal, student.ID, MealTypeA)
+
+			// 添加节假日时退还节假日的餐费
+			event, err := CreateCalendarEvent(CalendarEventHoliday, "假期", testDay(tt.start).Format(collectionDateLayout), testDay(tt.end).Format(collectionDateLayout), "admin")
+			if err != nil {
+				t.Fatalf("create calendar event: %v", err)
+			}
+			wantBalance(t, r, student.ID, 10000-1500+tt.wantRefund)
+
+			// 删除节假日时补扣
+			if _, err := DeleteCalendarEvent(event.ID, "admin"); err != nil {
+				t.Fatalf("delete calendar event: %v", err)
+			}
+			wantBalance(t, r, student.ID, 10000-1500)
+		})
+	}
+}
+
+func TestCheckSelectionBalance(t *testing.T) {
+	tests := []struct {
+		name     string
+		enabled  bool
+		chargeOn string
+		block    bool
+		balance  int
+		charged  MealType // 不为空时先按该餐食类型扣费
+		mealType MealType
+		wantErr  bool
+	}{
+		{"billing disabled", false, ChargeOnSelection, true, 0, "", MealTypeA, false},
+		{"not blocking", true, ChargeOnSelection, false, 0, "", MealTypeA, false},
+		{"enough for selection", true, ChargeOnSelection, true, 1500, "", MealTypeA, false},
+		{"short for selection", true, ChargeOnSelection, true, 1499, "", MealTypeA, true},
+		{"already charged", true, ChargeOnSelection, true, 1500, MealTypeA, MealTypeA, false},
+		{"cheaper after charge", true, ChargeOnSelection, true, 1500, MealTypeB, MealTypeA, false},
+		{"dearer difference covered", true, ChargeOnSelection, true, 600, MealTypeA, MealTypeB, false},
+		{"dearer difference short", true, ChargeOnSelection, true, 599, MealTypeA, MealTypeB, true},
+		{"enough for collection", true, ChargeOnCollection, true, 2100, "", MealTypeB, false},
+		{"short for collection", true, ChargeOnCollection, true, 2000, "", MealTypeB, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRepositories(t)
+			useBilling(t, ChargeOnSelection, false)
+			meal := newTestMeal(t, r, testDay(1), 3, 500, 700)
+			student := newTestStudent(t, r, "张三", tt.balance)
+			if tt.charged != "" {
+				// 先充值扣费所需的金额，扣费后余额仍为 tt.balance
+				charge := meal.Price(tt.charged) * 3
+				if err := r.Wallets.Post(&WalletTransaction{StudentID: student.ID, Type: WalletTypeTopUp, Amount: charge, Operator: "admin"}); err != nil {
+					t.Fatalf("top up: %v", err)
+				}
+				selectAndCharge(t, r, meal, student.ID, tt.charged)
+			}
+			useBilling(t, tt.chargeOn, tt.block)
+			config.Get().Billing.Enabled = tt.enabled
+
+			err := checkSelectionBalance(r, student.ID, meal, tt.mealType)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkSelectionBalance = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/config"
+	"github.com/itsHenry35/canteen-management-system/models"
+)
+
+// missedJob 计划时间已过的任务
+type missedJob struct {
+	jobKey      string
+	mealID      int
+	scheduledAt time.Time
+	job         func() (int, error)
+}
+
+// catchUpMissedJobs 检查停机期间错过的任务，并按宽限期补执行
+// 任务在计划时间之后有运行记录即视为已执行；超过宽限期的任务只记录日志，不再补执行
+func catchUpMissedJobs() {
+	cfg := config.Get()
+
+	// 如果定时任务或补执行未启用，直接返回
+	if !cfg.Scheduler.Enabled || !cfg.Scheduler.CatchUpEnabled {
+		return
+	}
+
+	// 收集计划时间已过的任务
+	now := time.Now()
+	candidates, err := collectDueJobs(now)
+	if err != nil {
+		addLog(fmt.Sprintf("检查错过的任务失败：%v", err))
+		return
+	}
+
+	// 按计划时间先后补执行
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].scheduledAt.Before(candidates[j].scheduledAt)
+	})
+
+	grace := time.Duration(cfg.Scheduler.CatchUpGraceHours) * time.Hour
+	for _, candidate := range candidates {
+		// 检查计划时间之后是否已经运行过
+		ran, err := models.HasJobRunSince(candidate.jobKey, candidate.mealID, candidate.scheduledAt)
+		if err != nil {
+			addLog(fmt.Sprintf("查询任务 %s 的运行记录失败：%v", candidate.jobKey, err))
+			continue
+		}
+		if ran {
+			continue
+		}
+
+		// 超过宽限期的任务不再补执行
+		late := now.Sub(candidate.scheduledAt).Round(time.Second)
+		if grace > 0 && late > grace {
+			addLog(fmt.Sprintf("任务 %s（餐ID=%d）原定于 %s 执行，已超过补执行宽限期，跳过",
+				candidate.jobKey, candidate.mealID, candidate.scheduledAt.Format("2006-01-02 15:04:05")))
+			continue
+		}
+
+		addLog(fmt.Sprintf("补执行错过的任务 %s（餐ID=%d），原定于 %s 执行，延迟 %s",
+			candidate.jobKey, candidate.mealID, candidate.scheduledAt.Format("2006-01-02 15:04:05"), late))
+		scheduledAt := candidate.scheduledAt
+		runJob(candidate.jobKey, candidate.mealID, models.JobRunSourceCatchUp, &scheduledAt, candidate.job)
+	}
+}
+
+// collectDueJobs 根据当前配置列出最近一次计划时间已过的任务
+func collectDueJobs(now time.Time) ([]*missedJob, error) {
+	cfg := config.Get()
+	var candidates []*missedJob
+
+	// 按配置时间执行的任务：取最近一次已过的执行时间，每月任务取最近一次已过的每月1日
+	for _, job := range dailyJobs {
+		if !job.enabled(cfg) {
+			continue
+		}
+		scheduledAt, ok := lastDailyTime(job.time(cfg), now)
+		if !ok {
+			continue
+		}
+		if job.monthly {
+			scheduledAt = time.Date(scheduledAt.Year(), scheduledAt.Month(), 1, scheduledAt.Hour(), scheduledAt.Minute(), 0, 0, now.Location())
+		}
+		candidates = append(candidates, &missedJob{job.key, 0, scheduledAt, job.run})
+	}
+
+	// 餐相关任务
+	if !cfg.Scheduler.AutoSelectEnabled && !cfg.Scheduler.ReminderEnabled {
+		return candidates, nil
+	}
+	meals, err := models.GetAllMeals()
+	if err != nil {
+		return nil, fmt.Errorf("获取餐列表失败：%v", err)
+	}
+
+	for _, meal := range meals {
+		mealID := meal.ID
+
+		// 自动选餐：选餐已截止，但餐尚未结束
+		if cfg.Scheduler.AutoSelectEnabled && !meal.SelectionEndTime.After(now) && meal.EffectiveEndDate.After(now) {
+			candidates = append(candidates, &missedJob{JobAutoSelect, mealID, meal.SelectionEndTime, func() (int, error) {
+				return autoSelectMeals(mealID)
+			}})
+		}
+
+		// 选餐提醒：提醒时间已过，但选餐尚未截止；多个提醒都已错过时只补发最近的一次，
+		// 已错过截止前提醒时不再补发选餐开始通知
+		if cfg.Scheduler.ReminderEnabled && meal.SelectionEndTime.After(now) && !meal.SelectionStartTime.After(now) {
+			offsets, err := reminderOffsetsForMeal(meal)
+			if err != nil {
+				addLog(fmt.Sprintf("餐ID=%d的提醒时间设置无效：%v", mealID, err))
+				continue
+			}
+			var latest time.Time
+			for _, offset := range offsets {
+				reminderTime := meal.SelectionEndTime.Add(-offset)
+				if !reminderTime.After(now) && !reminderTime.Before(meal.SelectionStartTime) && reminderTime.After(latest) {
+					latest = reminderTime
+				}
+			}
+			if !latest.IsZero() {
+				candidates = append(candidates, &missedJob{JobReminder, mealID, latest, func() (int, error) {
+					return sendReminderForMeal(mealID)
+				}})
+			} else if cfg.Scheduler.OpeningNotification {
+				candidates = append(candidates, &missedJob{JobOpening, mealID, meal.SelectionStartTime, func() (int, error) {
+					return sendOpeningForMeal(mealID)
+				}})
+			}
+		}
+	}
+
+	return candidates, nil
+}
+
+// lastDailyTime 计算 HH:MM 格式的每日时间在当前时间之前最近的一次
+func lastDailyTime(hhmm string, now time.Time) (time.Time, bool) {
+	parts := strings.Split(hhmm, ":")
+	if len(parts) != 2 {
+		return time.Time{}, false
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return time.Time{}, false
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	scheduledAt := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	if scheduledAt.After(now) {
+		scheduledAt = scheduledAt.AddDate(0, 0, -1)
+	}
+
+	return scheduledAt, true
+}
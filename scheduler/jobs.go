@@ -0,0 +1,242 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/config"
+	"github.com/itsHenry35/canteen-management-system/models"
+	"github.com/itsHenry35/canteen-management-system/services"
+)
+
+// 任务名称，记录在运行历史中
+const (
+	JobCleanup    = "cleanup"           // 归档过期餐食
+	JobReminder   = "reminder"          // 选餐提醒
+	JobOpening    = "opening"           // 选餐开始通知
+	JobAutoSelect = "auto_select"       // 自动选餐
+	JobRosterSync = "roster_sync"       // 同步学生名单
+	JobBackup     = "backup"            // 备份数据库和餐食图片
+	JobPurge      = "purge"             // 彻底删除超过保留期限的已归档餐食
+	JobProduction = "production_report" // 发送当天的备餐报表
+	JobNoShow     = "no_show_alert"     // 向班主任发送经常未取餐学生的提醒
+	JobStatement  = "monthly_statement" // 向学生和家长推送上个月的餐费账单
+	JobReconcile  = "payment_reconcile" // 充值订单对账
+	JobTemplate   = "meal_template"     // 按餐模板生成未来几周的餐
+)
+
+// UpcomingJob 已计划的任务
+type UpcomingJob struct {
+	TaskKey string    `json:"task_key"`          // 任务ID，如 reminder_3_6h0m0s
+	JobKey  string    `json:"job_key"`           // 任务名称
+	MealID  int       `json:"meal_id,omitempty"` // 关联的餐ID
+	NextRun time.Time `json:"next_run"`          // 下次执行时间
+}
+
+// dailyJob 按配置的 HH:MM 时间执行的任务，定时执行、补执行和手动触发共用
+type dailyJob struct {
+	key     string                          // 任务名称，同时作为每日任务的ID
+	name    string                          // 日志中显示的名称
+	monthly bool                            // 只在每月1日执行
+	enabled func(cfg *config.Config) bool   // 任务是否启用
+	time    func(cfg *config.Config) string // 执行时间，格式为 HH:MM
+	detail  func(cfg *config.Config) string // 添加任务时日志中的补充说明，可为空
+	run     func() (int, error)             // 任务函数
+	manual  func() (int, error)             // 手动触发时的任务函数，为空时与 run 相同
+}
+
+// dailyJobs 所有按配置时间执行的任务
+var dailyJobs = []*dailyJob{
+	{
+		key:     JobCleanup,
+		name:    "归档过期餐食",
+		enabled: func(cfg *config.Config) bool { return cfg.Scheduler.CleanupEnabled },
+		time:    func(cfg *config.Config) string { return cfg.Scheduler.CleanupTime },
+		run:     cleanupExpiredMeals,
+	},
+	{
+		key:     JobRosterSync,
+		name:    "学生名单同步",
+		enabled: func(cfg *config.Config) bool { return cfg.Scheduler.RosterSyncEnabled },
+		time:    func(cfg *config.Config) string { return cfg.Scheduler.RosterSyncTime },
+		run:     syncStudentRoster,
+	},
+	{
+		key:     JobBackup,
+		name:    "定时备份",
+		enabled: func(cfg *config.Config) bool { return cfg.Scheduler.BackupEnabled },
+		time:    func(cfg *config.Config) string { return cfg.Scheduler.BackupTime },
+		detail: func(cfg *config.Config) string {
+			return fmt.Sprintf("保留最近 %d 个定时备份", cfg.Scheduler.BackupRetention)
+		},
+		run: scheduledBackup,
+		// 手动触发的备份不会被保留数量删除
+		manual: func() (int, error) { return createBackup(services.BackupSourceManual, 0) },
+	},
+	{
+		key:     JobPurge,
+		name:    "彻底删除已归档餐食",
+		enabled: func(cfg *config.Config) bool { return cfg.Scheduler.PurgeEnabled },
+		time:    func(cfg *config.Config) string { return cfg.Scheduler.PurgeTime },
+		detail: func(cfg *config.Config) string {
+			return fmt.Sprintf("保留领餐结束后 %d 天内的餐", cfg.Scheduler.MealRetentionDays)
+		},
+		run: purgeArchivedMeals,
+	},
+	{
+		key:     JobProduction,
+		name:    "备餐报表",
+		enabled: func(cfg *config.Config) bool { return cfg.Scheduler.ProductionReportEnabled },
+		time:    func(cfg *config.Config) string { return cfg.Scheduler.ProductionReportTime },
+		run:     sendProductionReport,
+	},
+	{
+		key:     JobNoShow,
+		name:    "未取餐提醒",
+		enabled: func(cfg *config.Config) bool { return cfg.Scheduler.NoShowAlertEnabled },
+		time:    func(cfg *config.Config) string { return cfg.Scheduler.NoShowAlertTime },
+		detail: func(cfg *config.Config) string {
+			return fmt.Sprintf("统计最近 %d 天，未取餐率达到 %d%% 且不少于 %d 次时提醒",
+				cfg.Scheduler.NoShowWindowDays, cfg.Scheduler.NoShowThreshold, cfg.Scheduler.NoShowMinCount)
+		},
+		run: sendNoShowAlerts,
+	},
+	{
+		key:     JobStatement,
+		name:    "月度账单",
+		monthly: true,
+		enabled: func(cfg *config.Config) bool { return cfg.Scheduler.StatementEnabled },
+		time:    func(cfg *config.Config) string { return cfg.Scheduler.StatementTime },
+		run:     sendMonthlyStatements,
+	},
+	{
+		key:     JobTemplate,
+		name:    "餐模板",
+		enabled: func(cfg *config.Config) bool { return cfg.Scheduler.MealTemplateEnabled },
+		time:    func(cfg *config.Config) string { return cfg.Scheduler.MealTemplateTime },
+		detail: func(cfg *config.Config) string {
+			return fmt.Sprintf("提前生成 %d 周的餐", cfg.Scheduler.MealTemplateWeeksAhead)
+		},
+		run: generateTemplateMeals,
+	},
+}
+
+// findDailyJob 按任务名称查找按配置时间执行的任务
+func findDailyJob(jobKey string) *dailyJob {
+	for _, job := range dailyJobs {
+		if job.key == jobKey {
+			return job
+		}
+	}
+	return nil
+}
+
+// runJob 执行任务并记录运行历史；记录写入失败时任务仍会执行
+// scheduledAt 为计划执行时间，手动触发时为 nil
+func runJob(jobKey string, mealID int, source string, scheduledAt *time.Time, job func() (int, error)) *models.JobRun {
+	// 记录开始
+	run, err := models.CreateJobRun(jobKey, mealID, source, scheduledAt)
+	if err != nil {
+		addLog(fmt.Sprintf("记录任务 %s 运行历史失败：%v", jobKey, err))
+	}
+
+	// 执行任务
+	count, jobErr := job()
+
+	// 记录结果
+	if run == nil {
+		return nil
+	}
+	if err := models.FinishJobRun(run, count, jobErr); err != nil {
+		addLog(fmt.Sprintf("记录任务 %s 运行结果失败：%v", jobKey, err))
+	}
+
+	return run
+}
+
+// RunJob 立即执行一次任务（不影响已计划的任务），reminder、opening 和 auto_select 需要指定餐ID
+func RunJob(jobKey string, mealID int) (*models.JobRun, error) {
+	var job func() (int, error)
+	daily := findDailyJob(jobKey)
+	switch {
+	case daily != nil:
+		job = daily.run
+		if daily.manual != nil {
+			job = daily.manual
+		}
+		mealID = 0
+	case jobKey == JobReconcile:
+		job = reconcilePaymentOrders
+		mealID = 0
+	case jobKey == JobReminder, jobKey == JobOpening, jobKey == JobAutoSelect:
+		// 检查餐是否存在
+		if _, err := models.GetMealByID(mealID); err != nil {
+			return nil, errors.New("未找到指定的餐")
+		}
+		switch jobKey {
+		case JobReminder:
+			job = func() (int, error) { return sendReminderForMeal(mealID) }
+		case JobOpening:
+			job = func() (int, error) { return sendOpeningForMeal(mealID) }
+		default:
+			job = func() (int, error) { return autoSelectMeals(mealID) }
+		}
+	default:
+		return nil, fmt.Errorf("未知的任务：%s", jobKey)
+	}
+
+	addLog(fmt.Sprintf("管理员手动触发任务：%s", jobKey))
+	run := runJob(jobKey, mealID, models.JobRunSourceManual, nil, job)
+	if run == nil {
+		return nil, errors.New("记录任务运行历史失败")
+	}
+
+	return run, nil
+}
+
+// GetUpcomingJobs 获取所有已计划的任务及下次执行时间
+func GetUpcomingJobs() []*UpcomingJob {
+	jobs := []*UpcomingJob{}
+
+	// 每日任务
+	taskIDsMutex.RLock()
+	if scheduler != nil {
+		for key, id := range taskIDs {
+			entry := scheduler.Entry(id)
+			if entry.Valid() {
+				jobs = append(jobs, &UpcomingJob{TaskKey: key, JobKey: key, NextRun: entry.Next})
+			}
+		}
+	}
+	taskIDsMutex.RUnlock()
+
+	// 与餐相关的一次性任务
+	for _, entry := range timers.Entries() {
+		job := &UpcomingJob{TaskKey: entry.Key, JobKey: entry.Key, NextRun: entry.At}
+		switch {
+		case strings.HasPrefix(entry.Key, TaskReminder):
+			// reminder_<餐ID>_<截止前时间> 或 reminder_<餐ID>_opening
+			mealID, suffix, _ := strings.Cut(strings.TrimPrefix(entry.Key, TaskReminder), "_")
+			job.JobKey = JobReminder
+			if suffix == taskOpeningSuffix {
+				job.JobKey = JobOpening
+			}
+			job.MealID, _ = strconv.Atoi(mealID)
+		case strings.HasPrefix(entry.Key, TaskAutoSelect):
+			job.JobKey = JobAutoSelect
+			job.MealID, _ = strconv.Atoi(strings.TrimPrefix(entry.Key, TaskAutoSelect))
+		}
+		jobs = append(jobs, job)
+	}
+
+	// 按执行时间排序
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].NextRun.Before(jobs[j].NextRun)
+	})
+
+	return jobs
+}
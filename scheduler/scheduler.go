@@ -9,6 +9,7 @@ import (
 
 	"github.com/itsHenry35/canteen-management-system/config"
 	"github.com/itsHenry35/canteen-management-system/models"
+	"github.com/itsHenry35/canteen-management-system/services"
 	"github.com/robfig/cron/v3"
 )
 
@@ -16,20 +17,25 @@ var (
 	scheduler         *cron.Cron
 	schedulerLogs     []string
 	schedulerLogMutex sync.Mutex
-	taskIDs           map[string]cron.EntryID // 存储任务ID，用于管理
+	taskIDs           map[string]cron.EntryID // 存储每日任务的ID，用于管理
 	taskIDsMutex      sync.RWMutex
+	timers            *TimerQueue // 与餐相关的一次性任务
+	subscribeOnce     sync.Once
 )
 
-// 任务类型常量
+// 任务类型常量，按配置时间执行的任务以任务名称作为任务ID
 const (
-	TaskCleanup    = "cleanup"      // 清理过期餐食任务
-	TaskReminder   = "reminder_"    // 选餐提醒任务
-	TaskAutoSelect = "auto_select_" // 自动选餐任务
+	TaskReminder   = "reminder_"         // 选餐提醒任务，格式为 reminder_<餐ID>_<截止前时间> 或 reminder_<餐ID>_opening
+	TaskAutoSelect = "auto_select_"      // 自动选餐任务
+	TaskReconcile  = "payment_reconcile" // 充值订单对账任务
+
+	taskOpeningSuffix = "opening" // 选餐开始通知的任务ID后缀
 )
 
 // 初始化
 func init() {
 	taskIDs = make(map[string]cron.EntryID)
+	timers = NewTimerQueue(nil)
 }
 
 // 添加日志函数
@@ -71,8 +77,18 @@ func Initialize() error {
 	scheduler.Start()
 	addLog("定时任务管理器已启动")
 
+	// 餐创建、更新或删除时调整该餐的任务
+	subscribeOnce.Do(func() {
+		models.SubscribeMealEvents(onMealEvent)
+	})
+
 	// 初始化任务
-	return ReloadTasks()
+	err := ReloadTasks()
+
+	// 在后台补执行停机期间错过的任务
+	go catchUpMissedJobs()
+
+	return err
 }
 
 // ReloadTasks 重新加载所有定时任务
@@ -89,9 +105,11 @@ func ReloadTasks() error {
 	// 重新加载各个任务
 	var errors []string
 
-	// 1. 清理过期餐食任务
-	if err := reloadCleanupTask(); err != nil {
-		errors = append(errors, fmt.Sprintf("加载清理过期餐食任务失败: %v", err))
+	// 1. 按配置时间执行的每日任务
+	for _, job := range dailyJobs {
+		if err := reloadDailyTask(job); err != nil {
+			errors = append(errors, fmt.Sprintf("加载%s任务失败: %v", job.name, err))
+		}
 	}
 
 	// 2. 选餐提醒任务
@@ -104,6 +122,11 @@ func ReloadTasks() error {
 		errors = append(errors, fmt.Sprintf("加载自动选餐任务失败: %v", err))
 	}
 
+	// 4. 充值订单对账任务
+	if err := reloadReconcileTask(); err != nil {
+		errors = append(errors, fmt.Sprintf("加载充值订单对账任务失败: %v", err))
+	}
+
 	// 如果有错误，合并返回
 	if len(errors) > 0 {
 		return fmt.Errorf("%s", strings.Join(errors, "; "))
@@ -112,44 +135,89 @@ func ReloadTasks() error {
 	return nil
 }
 
-// reloadCleanupTask 重新加载清理过期餐食任务
-func reloadCleanupTask() error {
+// reloadDailyTask 重新加载按配置时间执行的任务
+func reloadDailyTask(job *dailyJob) error {
 	cfg := config.Get()
 
 	// 移除旧任务
-	removeTask(TaskCleanup)
+	removeTask(job.key)
 
 	// 如果任务未启用，直接返回
-	if !cfg.Scheduler.CleanupEnabled {
-		addLog("清理过期餐食任务未启用")
+	if !job.enabled(cfg) {
+		addLog(fmt.Sprintf("%s任务未启用", job.name))
 		return nil
 	}
 
-	// 时间格式为 HH:MM，转换为 cron 表达式 "0 MM HH * * *"
-	timeParts := strings.Split(cfg.Scheduler.CleanupTime, ":")
+	// 时间格式为 HH:MM，转换为 cron 表达式 "0 MM HH * * *"，每月任务为 "0 MM HH 1 * *"
+	hhmm := job.time(cfg)
+	timeParts := strings.Split(hhmm, ":")
 	if len(timeParts) != 2 {
-		return fmt.Errorf("无效的时间格式：%s，应为 HH:MM", cfg.Scheduler.CleanupTime)
+		return fmt.Errorf("无效的时间格式：%s，应为 HH:MM", hhmm)
+	}
+	day, when := "*", hhmm
+	if job.monthly {
+		day, when = "1", "每月1日 "+hhmm
+	}
+
+	jobCron := fmt.Sprintf("0 %s %s %s * *", timeParts[1], timeParts[0], day)
+	entryID, err := scheduler.AddFunc(jobCron, func() {
+		scheduledAt := time.Now().Truncate(time.Minute)
+		runJob(job.key, 0, models.JobRunSourceSchedule, &scheduledAt, job.run)
+	})
+	if err != nil {
+		return fmt.Errorf("添加%s的定时任务失败：%v", job.name, err)
+	}
+
+	// 保存任务ID
+	saveTaskID(job.key, entryID)
+	message := fmt.Sprintf("已添加%s的定时任务，执行时间：%s", job.name, when)
+	if job.detail != nil {
+		message += "，" + job.detail(cfg)
+	}
+	addLog(message)
+
+	return nil
+}
+
+// reloadReconcileTask 重新加载充值订单对账任务，启用在线充值时按间隔执行
+func reloadReconcileTask() error {
+	cfg := config.Get()
+
+	// 移除旧任务
+	removeTask(TaskReconcile)
+
+	// 如果未启用在线充值，直接返回
+	if !cfg.Payment.Enabled {
+		addLog("未启用在线充值，不添加对账任务")
+		return nil
+	}
+	if cfg.Payment.ReconcileIntervalMinutes < 1 || cfg.Payment.ReconcileIntervalMinutes > 59 {
+		return fmt.Errorf("无效的对账间隔：%d 分钟，应为 1 到 59", cfg.Payment.ReconcileIntervalMinutes)
 	}
 
-	cleanupCron := fmt.Sprintf("0 %s %s * * *", timeParts[1], timeParts[0])
-	entryID, err := scheduler.AddFunc(cleanupCron, cleanupExpiredMeals)
+	// 每隔 N 分钟执行一次，cron 表达式为 "0 */N * * * *"
+	reconcileCron := fmt.Sprintf("0 */%d * * * *", cfg.Payment.ReconcileIntervalMinutes)
+	entryID, err := scheduler.AddFunc(reconcileCron, func() {
+		scheduledAt := time.Now().Truncate(time.Minute)
+		runJob(JobReconcile, 0, models.JobRunSourceSchedule, &scheduledAt, reconcilePaymentOrders)
+	})
 	if err != nil {
-		return fmt.Errorf("添加清理过期餐食的定时任务失败：%v", err)
+		return fmt.Errorf("添加充值订单对账的定时任务失败：%v", err)
 	}
 
 	// 保存任务ID
-	saveTaskID(TaskCleanup, entryID)
-	addLog(fmt.Sprintf("已添加清理过期餐食的定时任务，执行时间：%s", cfg.Scheduler.CleanupTime))
+	saveTaskID(TaskReconcile, entryID)
+	addLog(fmt.Sprintf("已添加充值订单对账的定时任务，每 %d 分钟执行一次", cfg.Payment.ReconcileIntervalMinutes))
 
 	return nil
 }
 
-// reloadAutoSelectTasks 重新加载自动选餐任务
+// reloadAutoSelectTasks 重新加载所有自动选餐任务
 func reloadAutoSelectTasks() error {
 	cfg := config.Get()
 
 	// 移除所有以'auto_select_'开头的任务
-	removeTasksWithPrefix(TaskAutoSelect)
+	cancelTimersWithPrefix(TaskAutoSelect)
 
 	// 如果任务未启用，直接返回
 	if !cfg.Scheduler.AutoSelectEnabled {
@@ -163,92 +231,235 @@ func reloadAutoSelectTasks() error {
 		return fmt.Errorf("获取餐列表失败：%v", err)
 	}
 
-	// 当前时间
-	now := time.Now()
-
-	// 为每个未过期且选餐结束时间在未来的餐添加自动选餐任务
+	// 为每个选餐结束时间在未来的餐添加自动选餐任务
 	for _, meal := range meals {
-		// 只为选餐结束时间在当前时间之后的餐添加自动选餐任务
-		if meal.SelectionEndTime.After(now) {
-			// 为该餐创建一个在选餐截止时执行的定时任务
-			// 计算从现在到选餐截止时间还有多长时间
-			duration := meal.SelectionEndTime.Sub(now)
-			seconds := int(duration.Seconds())
-
-			// 只有当选餐截止时间在未来时才添加任务
-			if seconds > 0 {
-				// 创建一个cron表达式，在指定的时间点运行一次
-				// 格式：秒 分 时 日 月 星期
-				cronExpr := fmt.Sprintf("%d %d %d %d %d *",
-					meal.SelectionEndTime.Second(),
-					meal.SelectionEndTime.Minute(),
-					meal.SelectionEndTime.Hour(),
-					meal.SelectionEndTime.Day(),
-					int(meal.SelectionEndTime.Month()))
-
-				// 创建一个闭包，捕获当前的mealID
-				autoSelectFunc := func(mealID int) func() {
-					return func() {
-						autoSelectMeals(mealID)
-					}
-				}(meal.ID)
-
-				// 添加定时任务
-				entryID, err := scheduler.AddFunc(cronExpr, autoSelectFunc)
-				if err != nil {
-					addLog(fmt.Sprintf("为餐ID=%d添加自动选餐任务失败：%v", meal.ID, err))
-					continue
-				}
-
-				// 保存任务ID
-				taskKey := fmt.Sprintf("%s%d", TaskAutoSelect, meal.ID)
-				saveTaskID(taskKey, entryID)
-				addLog(fmt.Sprintf("已为餐ID=%d添加自动选餐任务，执行时间：%s",
-					meal.ID, meal.SelectionEndTime.Format("2006-01-02 15:04:05")))
-			}
-		}
+		scheduleAutoSelect(meal)
 	}
 
 	return nil
 }
 
-// CheckAndUpdateTasks 检查并更新任务（当餐菜单变更时调用）
-func CheckAndUpdateTasks() error {
-	// 更新自动选餐任务
-	if err := reloadAutoSelectTasks(); err != nil {
-		return fmt.Errorf("更新自动选餐任务失败: %v", err)
+// scheduleAutoSelect 在选餐截止时为该餐执行一次自动选餐，截止时间已过时不添加
+func scheduleAutoSelect(meal *models.Meal) {
+	taskKey := fmt.Sprintf("%s%d", TaskAutoSelect, meal.ID)
+	mealID := meal.ID
+	scheduledAt := meal.SelectionEndTime
+
+	scheduled := timers.Schedule(taskKey, scheduledAt, func() {
+		runJob(JobAutoSelect, mealID, models.JobRunSourceSchedule, &scheduledAt, func() (int, error) {
+			return autoSelectMeals(mealID)
+		})
+	})
+	if scheduled {
+		addLog(fmt.Sprintf("已为餐ID=%d添加自动选餐任务，执行时间：%s",
+			mealID, scheduledAt.Format("2006-01-02 15:04:05")))
 	}
+}
 
-	// 更新提醒任务
-	if err := reloadReminderTasks(); err != nil {
-		return fmt.Errorf("更新提醒任务失败: %v", err)
+// onMealEvent 根据餐的创建、更新、删除和归档调整该餐的一次性任务
+func onMealEvent(event models.MealEvent) {
+	cfg := config.Get()
+
+	// 定时任务总开关未启用时不添加任务
+	if !cfg.Scheduler.Enabled {
+		return
 	}
 
-	return nil
+	// 移除该餐原有的任务
+	cancelTimer(fmt.Sprintf("%s%d", TaskAutoSelect, event.MealID))
+	cancelTimersWithPrefix(fmt.Sprintf("%s%d_", TaskReminder, event.MealID))
+	if event.Type == models.MealEventDeleted || event.Type == models.MealEventArchived || event.Meal == nil {
+		return
+	}
+
+	// 按新的时间重新添加
+	if cfg.Scheduler.AutoSelectEnabled {
+		scheduleAutoSelect(event.Meal)
+	}
+	if cfg.Scheduler.ReminderEnabled {
+		scheduleReminder(event.Meal)
+	}
 }
 
-// autoSelectMeals 自动为未选餐学生选餐
-func autoSelectMeals(mealID int) {
+// autoSelectMeals 自动为未选餐学生选餐，返回选餐的学生数
+func autoSelectMeals(mealID int) (int, error) {
 	addLog(fmt.Sprintf("开始为餐ID=%d的未选餐学生自动选餐...", mealID))
 
 	// 调用模型层的自动选餐函数
 	count, err := models.BatchSelectMealsRandomly(mealID)
 	if err != nil {
 		addLog(fmt.Sprintf("为餐ID=%d自动选餐失败：%v", mealID, err))
-		return
+		return count, err
 	}
 
 	addLog(fmt.Sprintf("已成功为餐ID=%d的%d名未选餐学生完成自动选餐", mealID, count))
+	return count, nil
+}
+
+// cleanupExpiredMeals 归档过期餐食，返回归档的餐数
+func cleanupExpiredMeals() (int, error) {
+	addLog("开始执行归档过期餐食的定时任务...")
+	count, err := models.ArchiveExpiredMeals()
+	if err != nil {
+		addLog(fmt.Sprintf("归档过期餐食失败：%v", err))
+		return count, err
+	}
+
+	addLog(fmt.Sprintf("归档过期餐食成功，共归档 %d 个餐", count))
+	return count, nil
+}
+
+// purgeArchivedMeals 彻底删除超过保留期限的已归档餐食，返回删除的餐数
+func purgeArchivedMeals() (int, error) {
+	retentionDays := config.Get().Scheduler.MealRetentionDays
+	addLog(fmt.Sprintf("开始彻底删除领餐结束超过 %d 天的已归档餐食...", retentionDays))
+	count, err := models.PurgeArchivedMeals(retentionDays)
+	if err != nil {
+		addLog(fmt.Sprintf("彻底删除已归档餐食失败：%v", err))
+		return count, err
+	}
+
+	addLog(fmt.Sprintf("彻底删除已归档餐食成功，共删除 %d 个餐", count))
+	return count, nil
+}
+
+// sendProductionReport 生成当天的备餐报表并发送给食堂工作人员，返回通知的人数
+func sendProductionReport() (int, error) {
+	date := time.Now().Format("2006-01-02")
+	addLog(fmt.Sprintf("开始生成 %s 的备餐报表...", date))
+	report, err := models.BuildProductionReport(date)
+	if err != nil {
+		addLog(fmt.Sprintf("生成备餐报表失败：%v", err))
+		return 0, err
+	}
+
+	// 当天没有餐或不供餐时不发送
+	if report.NotServing != "" {
+		addLog(fmt.Sprintf("%s 不供餐（%s），不发送备餐报表", date, report.NotServing))
+		return 0, nil
+	}
+	if report.Meal == nil {
+		addLog(fmt.Sprintf("%s 没有需要领餐的餐，不发送备餐报表", date))
+		return 0, nil
+	}
+
+	count, err := models.NotifyProductionReport(report)
+	if err != nil {
+		addLog(fmt.Sprintf("发送备餐报表失败：%v", err))
+		return count, err
+	}
+
+	addLog(fmt.Sprintf("已向 %d 名食堂工作人员发送备餐报表，A餐 %d 份，B餐 %d 份", count, report.Total.TypeA, report.Total.TypeB))
+	return count, nil
 }
 
-func cleanupExpiredMeals() {
-	addLog("开始执行清理过期餐食的定时任务...")
-	err := models.CleanupExpiredMeals()
+// sendNoShowAlerts 将经常未取餐的学生发送给班主任，返回提醒的学生数
+func sendNoShowAlerts() (int, error) {
+	cfg := config.Get()
+	addLog(fmt.Sprintf("开始统计最近 %d 天的未取餐情况...", cfg.Scheduler.NoShowWindowDays))
+	count, err := models.NotifyChronicNoShows(cfg.Scheduler.NoShowWindowDays, cfg.Scheduler.NoShowThreshold, cfg.Scheduler.NoShowMinCount)
 	if err != nil {
-		addLog(fmt.Sprintf("清理过期餐食失败：%v", err))
-	} else {
-		addLog("清理过期餐食成功")
+		addLog(fmt.Sprintf("发送未取餐提醒失败：%v", err))
+		return count, err
 	}
+
+	addLog(fmt.Sprintf("已向班主任发送 %d 名经常未取餐学生的提醒", count))
+	return count, nil
+}
+
+// sendMonthlyStatements 向学生和家长推送上个月的餐费账单，返回推送的学生数
+func sendMonthlyStatements() (int, error) {
+	now := time.Now()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local).AddDate(0, -1, 0).Format("2006-01")
+	addLog(fmt.Sprintf("开始推送 %s 的餐费账单...", month))
+	count, err := models.NotifyStatements(month)
+	if err != nil {
+		addLog(fmt.Sprintf("推送餐费账单失败：%v", err))
+		return count, err
+	}
+
+	addLog(fmt.Sprintf("已推送 %d 名学生 %s 的餐费账单", count, month))
+	return count, nil
+}
+
+// reconcilePaymentOrders 向支付网关查询待支付的充值订单并更新状态，返回状态变化的订单数
+func reconcilePaymentOrders() (int, error) {
+	count, err := services.ReconcilePaymentOrders()
+	if err != nil {
+		addLog(fmt.Sprintf("充值订单对账失败：%v", err))
+		return count, err
+	}
+
+	if count > 0 {
+		addLog(fmt.Sprintf("充值订单对账完成，%d 个订单状态已更新", count))
+	}
+	return count, nil
+}
+
+// generateTemplateMeals 按启用的餐模板生成未来几周的餐，返回生成的餐数
+func generateTemplateMeals() (int, error) {
+	weeks := config.Get().Scheduler.MealTemplateWeeksAhead
+	addLog(fmt.Sprintf("开始按餐模板生成未来 %d 周的餐...", weeks))
+	occurrences, err := models.GenerateMealsFromTemplates(weeks)
+
+	// 记录每周的结果，之前已生成的周不再记录
+	count := 0
+	for _, occurrence := range occurrences {
+		switch occurrence.Status {
+		case models.MealTemplateCreated:
+			count++
+			addLog(fmt.Sprintf("已按餐模板 %s 生成餐 %s（餐ID=%d）", occurrence.TemplateName, occurrence.Name, occurrence.MealID))
+		case models.MealTemplateSkipped, models.MealTemplateFailed:
+			addLog(fmt.Sprintf("餐模板 %s 未生成 %s 所在周的餐：%s", occurrence.TemplateName, occurrence.WeekStart, occurrence.Reason))
+		}
+	}
+	if err != nil {
+		addLog(fmt.Sprintf("按餐模板生成餐失败：%v", err))
+		return count, err
+	}
+
+	addLog(fmt.Sprintf("按餐模板生成餐完成，共生成 %d 个餐", count))
+	return count, nil
+}
+
+// syncStudentRoster 从钉钉同步学生名单，返回变更的学生数
+func syncStudentRoster() (int, error) {
+	addLog("开始执行学生名单同步的定时任务...")
+	report, err := services.SyncStudentRoster(false, services.RosterSyncSourceScheduler)
+	if err != nil {
+		addLog(fmt.Sprintf("同步学生名单失败：%v", err))
+		return 0, err
+	}
+
+	addLog(fmt.Sprintf("同步学生名单成功，新建 %d 名，更新 %d 名，归档 %d 名",
+		report.CreatedCount, report.UpdatedCount, report.ArchivedCount))
+	return report.CreatedCount + report.UpdatedCount + report.ArchivedCount, nil
+}
+
+// scheduledBackup 创建定时备份，并按保留数量删除较早的定时备份，返回创建的备份数
+func scheduledBackup() (int, error) {
+	return createBackup(services.BackupSourceScheduler, config.Get().Scheduler.BackupRetention)
+}
+
+// createBackup 创建备份，retention 大于0时只保留最近的 retention 个定时备份
+func createBackup(source string, retention int) (int, error) {
+	addLog("开始备份数据库和餐食图片...")
+	backup, err := services.CreateBackup(source)
+	if err != nil {
+		addLog(fmt.Sprintf("备份失败：%v", err))
+		return 0, err
+	}
+	addLog(fmt.Sprintf("备份成功：%s（%d 字节，%d 张图片）", backup.Name, backup.Size, backup.ImageCount))
+
+	// 删除超出保留数量的定时备份，失败不影响本次备份结果
+	pruned, err := services.PruneBackups(retention)
+	if err != nil {
+		addLog(fmt.Sprintf("删除过期备份失败：%v", err))
+	} else if pruned > 0 {
+		addLog(fmt.Sprintf("已删除 %d 个过期的定时备份", pruned))
+	}
+
+	return 1, nil
 }
 
 // reloadReminderTasks 重新加载所有提醒任务
@@ -256,7 +467,7 @@ func reloadReminderTasks() error {
 	cfg := config.Get()
 
 	// 移除所有以'reminder_'开头的任务
-	removeTasksWithPrefix(TaskReminder)
+	cancelTimersWithPrefix(TaskReminder)
 
 	// 如果任务未启用，直接返回
 	if !cfg.Scheduler.ReminderEnabled {
@@ -270,56 +481,115 @@ func reloadReminderTasks() error {
 		return fmt.Errorf("获取餐列表失败：%v", err)
 	}
 
-	// 当前时间
-	now := time.Now()
-
-	// 为每个餐在选餐截止前特定小时添加提醒任务
+	// 为每个餐在选餐截止前的各个时间添加提醒任务
 	for _, meal := range meals {
-		reminderTime := meal.SelectionEndTime.Add(-time.Duration(cfg.Scheduler.ReminderBeforeEndHours) * time.Hour)
-
-		// 只为提醒时间在未来的餐添加提醒任务
-		if reminderTime.After(now) {
-			cronExpr := fmt.Sprintf("%d %d %d %d %d *",
-				reminderTime.Second(),
-				reminderTime.Minute(),
-				reminderTime.Hour(),
-				reminderTime.Day(),
-				int(reminderTime.Month()))
-
-			// 创建一个闭包捕获当前的mealID
-			reminderFunc := func(mealID int) func() {
-				return func() {
-					sendReminderForMeal(mealID)
-				}
-			}(meal.ID)
-
-			// 添加定时任务
-			entryID, err := scheduler.AddFunc(cronExpr, reminderFunc)
-			if err != nil {
-				addLog(fmt.Sprintf("为餐ID=%d添加提醒任务失败：%v", meal.ID, err))
-				continue
-			}
-
-			// 保存任务ID
-			taskKey := fmt.Sprintf("%s%d", TaskReminder, meal.ID)
-			saveTaskID(taskKey, entryID)
-			addLog(fmt.Sprintf("已为餐ID=%d添加提醒任务，执行时间：%s",
-				meal.ID, reminderTime.Format("2006-01-02 15:04:05")))
-		}
+		scheduleReminder(meal)
 	}
 
 	return nil
 }
 
-// sendReminderForMeal 为特定餐发送提醒
-func sendReminderForMeal(mealID int) {
+// scheduleReminder 按提醒时间列表为该餐添加提醒任务，并在启用时于选餐开始时发送通知，时间已过的不添加
+func scheduleReminder(meal *models.Meal) {
+	cfg := config.Get()
+	mealID := meal.ID
+
+	// 选餐开始通知
+	if cfg.Scheduler.OpeningNotification {
+		taskKey := fmt.Sprintf("%s%d_%s", TaskReminder, mealID, taskOpeningSuffix)
+		scheduledAt := meal.SelectionStartTime
+		scheduled := timers.Schedule(taskKey, scheduledAt, func() {
+			runJob(JobOpening, mealID, models.JobRunSourceSchedule, &scheduledAt, func() (int, error) {
+				return sendOpeningForMeal(mealID)
+			})
+		})
+		if scheduled {
+			addLog(fmt.Sprintf("已为餐ID=%d添加选餐开始通知任务，执行时间：%s",
+				mealID, scheduledAt.Format("2006-01-02 15:04:05")))
+		}
+	}
+
+	// 选餐截止前的提醒
+	offsets, err := reminderOffsetsForMeal(meal)
+	if err != nil {
+		addLog(fmt.Sprintf("餐ID=%d的提醒时间设置无效：%v", mealID, err))
+		return
+	}
+	for _, offset := range offsets {
+		taskKey := fmt.Sprintf("%s%d_%s", TaskReminder, mealID, offset)
+		scheduledAt := meal.SelectionEndTime.Add(-offset)
+
+		// 早于选餐开始的提醒没有意义
+		if scheduledAt.Before(meal.SelectionStartTime) {
+			continue
+		}
+
+		scheduled := timers.Schedule(taskKey, scheduledAt, func() {
+			runJob(JobReminder, mealID, models.JobRunSourceSchedule, &scheduledAt, func() (int, error) {
+				return sendReminderForMeal(mealID)
+			})
+		})
+		if scheduled {
+			addLog(fmt.Sprintf("已为餐ID=%d添加截止前%s的提醒任务，执行时间：%s",
+				mealID, offset, scheduledAt.Format("2006-01-02 15:04:05")))
+		}
+	}
+}
+
+// reminderOffsetsForMeal 返回该餐的提醒时间（去重），依次取餐的设置、系统设置的列表和 reminder_before_end_hours
+func reminderOffsetsForMeal(meal *models.Meal) ([]time.Duration, error) {
+	cfg := config.Get()
+
+	offsets := meal.ReminderOffsets
+	if len(offsets) == 0 {
+		offsets = cfg.Scheduler.ReminderOffsets
+	}
+	if len(offsets) == 0 {
+		return []time.Duration{time.Duration(cfg.Scheduler.ReminderBeforeEndHours) * time.Hour}, nil
+	}
+
+	durations, err := offsets.Durations()
+	if err != nil {
+		return nil, err
+	}
+
+	// 去除重复的时间，如 1h 和 60m
+	seen := make(map[time.Duration]bool)
+	unique := make([]time.Duration, 0, len(durations))
+	for _, d := range durations {
+		if !seen[d] {
+			seen[d] = true
+			unique = append(unique, d)
+		}
+	}
+
+	return unique, nil
+}
+
+// sendOpeningForMeal 为特定餐发送选餐开始通知，返回通知的学生数
+func sendOpeningForMeal(mealID int) (int, error) {
+	addLog(fmt.Sprintf("开始为餐ID=%d发送选餐开始通知...", mealID))
+	count, err := models.NotifySelectionOpenedByMealId(mealID)
+	if err != nil {
+		addLog(fmt.Sprintf("为餐ID=%d发送选餐开始通知失败：%v", mealID, err))
+		return count, err
+	}
+
+	addLog(fmt.Sprintf("已成功为餐ID=%d的%d名学生发送选餐开始通知", mealID, count))
+	return count, nil
+}
+
+// sendReminderForMeal 为特定餐发送提醒，返回未选餐的学生数
+func sendReminderForMeal(mealID int) (int, error) {
 	addLog(fmt.Sprintf("开始为餐ID=%d发送未选餐提醒...", mealID))
-	err := models.NotifyUnselectedStudentsByMealId(mealID)
+	count, err := models.NotifyUnselectedStudentsByMealId(mealID)
 	if err != nil {
 		addLog(fmt.Sprintf("为餐ID=%d发送提醒失败：%v", mealID, err))
-	} else {
-		addLog(fmt.Sprintf("已成功为餐ID=%d的未选餐学生发送提醒", mealID))
+		return count, err
 	}
+
+	addLog(fmt.Sprintf("已成功为餐ID=%d的%d名未选餐学生发送提醒", mealID, count))
+	return count, nil
 }
 
 // 任务ID管理函数
@@ -340,16 +610,16 @@ func removeTask(key string) {
 	}
 }
 
-func removeTasksWithPrefix(prefix string) {
-	taskIDsMutex.Lock()
-	defer taskIDsMutex.Unlock()
+// 一次性任务管理函数
+func cancelTimer(key string) {
+	if timers.Cancel(key) {
+		addLog(fmt.Sprintf("已移除任务：%s", key))
+	}
+}
 
-	for key, id := range taskIDs {
-		if strings.HasPrefix(key, prefix) {
-			scheduler.Remove(id)
-			delete(taskIDs, key)
-			addLog(fmt.Sprintf("已移除任务：%s", key))
-		}
+func cancelTimersWithPrefix(prefix string) {
+	for _, key := range timers.CancelPrefix(prefix) {
+		addLog(fmt.Sprintf("已移除任务：%s", key))
 	}
 }
 
@@ -361,11 +631,13 @@ func clearAllTasks() {
 		scheduler.Remove(id)
 		delete(taskIDs, key)
 	}
+	timers.Stop()
 	addLog("已清除所有定时任务")
 }
 
 // Stop 停止定时任务管理器
 func Stop() {
+	timers.Stop()
 	if scheduler != nil {
 		scheduler.Stop()
 		addLog("定时任务管理器已停止")
@@ -0,0 +1,155 @@
+package scheduler
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Clock 时间来源，便于在测试中替换为可手动推进的时钟
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer 由 Clock 创建的定时器
+type Timer interface {
+	Stop() bool
+}
+
+// realClock 使用系统时间
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// TimerEntry 队列中等待执行的一次性任务
+type TimerEntry struct {
+	Key string    // 任务ID，同一ID只保留最后一次计划
+	At  time.Time // 执行时间
+}
+
+// timerItem 队列内部的任务
+type timerItem struct {
+	TimerEntry
+	timer Timer
+}
+
+// TimerQueue 一次性定时任务队列：每个任务只在计划时间执行一次，执行后自动移除
+type TimerQueue struct {
+	mu    sync.Mutex
+	clock Clock
+	items map[string]*timerItem
+}
+
+// NewTimerQueue 创建定时任务队列，clock 为 nil 时使用系统时间
+func NewTimerQueue(clock Clock) *TimerQueue {
+	if clock == nil {
+		clock = realClock{}
+	}
+	return &TimerQueue{
+		clock: clock,
+		items: make(map[string]*timerItem),
+	}
+}
+
+// Schedule 在指定时间执行任务，同一 key 的旧计划会被替换；执行时间不在未来时不计划并返回 false
+func (q *TimerQueue) Schedule(key string, at time.Time, fn func()) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// 替换旧计划
+	q.cancelLocked(key)
+
+	delay := at.Sub(q.clock.Now())
+	if delay <= 0 {
+		return false
+	}
+
+	item := &timerItem{TimerEntry: TimerEntry{Key: key, At: at}}
+	item.timer = q.clock.AfterFunc(delay, func() {
+		// 执行前先从队列移除；若已被取消或替换则不执行
+		q.mu.Lock()
+		if q.items[key] != item {
+			q.mu.Unlock()
+			return
+		}
+		delete(q.items, key)
+		q.mu.Unlock()
+
+		fn()
+	})
+	q.items[key] = item
+
+	return true
+}
+
+// Cancel 取消任务，返回任务是否存在
+func (q *TimerQueue) Cancel(key string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.cancelLocked(key)
+}
+
+// CancelPrefix 取消所有以 prefix 开头的任务，返回取消的任务ID
+func (q *TimerQueue) CancelPrefix(prefix string) []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var keys []string
+	for key := range q.items {
+		if strings.HasPrefix(key, prefix) {
+			q.cancelLocked(key)
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// cancelLocked 取消任务，调用方需持有锁
+func (q *TimerQueue) cancelLocked(key string) bool {
+	item, exists := q.items[key]
+	if !exists {
+		return false
+	}
+	item.timer.Stop()
+	delete(q.items, key)
+	return true
+}
+
+// Entries 返回所有等待执行的任务，按执行时间排序
+func (q *TimerQueue) Entries() []TimerEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entries := make([]TimerEntry, 0, len(q.items))
+	for _, item := range q.items {
+		entries = append(entries, item.TimerEntry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].At.Before(entries[j].At)
+	})
+	return entries
+}
+
+// Len 返回等待执行的任务数
+func (q *TimerQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Stop 取消所有任务
+func (q *TimerQueue) Stop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for key := range q.items {
+		q.cancelLocked(key)
+	}
+}
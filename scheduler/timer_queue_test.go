@@ -0,0 +1,214 @@
+package scheduler
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock 手动推进的时钟
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock   *fakeClock
+	at      time.Time
+	fn      func()
+	stopped bool
+	fired   bool
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 9, 1, 8, 0, 0, 0, time.Local)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	timer := &fakeTimer{clock: c, at: c.now.Add(d), fn: f}
+	c.timers = append(c.timers, timer)
+	return timer
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := !t.stopped && !t.fired
+	t.stopped = true
+	return active
+}
+
+// Advance 推进时钟，按时间顺序执行到期的定时器
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due []*fakeTimer
+	for _, timer := range c.timers {
+		if !timer.stopped && !timer.fired && !timer.at.After(c.now) {
+			timer.fired = true
+			due = append(due, timer)
+		}
+	}
+	c.mu.Unlock()
+
+	// 在锁外执行，回调中会访问队列
+	sort.SliceStable(due, func(i, j int) bool { return due[i].at.Before(due[j].at) })
+	for _, timer := range due {
+		timer.fn()
+	}
+}
+
+// counter 记录每个任务执行的次数
+type counter struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func newCounter() *counter {
+	return &counter{calls: make(map[string]int)}
+}
+
+func (c *counter) fn(key string) func() {
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.calls[key]++
+	}
+}
+
+func (c *counter) get(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls[key]
+}
+
+func TestTimerQueueFiresOnce(t *testing.T) {
+	clock := newFakeClock()
+	queue := NewTimerQueue(clock)
+	calls := newCounter()
+
+	if !queue.Schedule("reminder_1", clock.Now().Add(time.Hour), calls.fn("reminder_1")) {
+		t.Fatalf("schedule future task: expected true")
+	}
+
+	clock.Advance(59 * time.Minute)
+	if got := calls.get("reminder_1"); got != 0 {
+		t.Fatalf("fired before due: %d", got)
+	}
+	clock.Advance(time.Minute)
+	clock.Advance(24 * time.Hour)
+	if got := calls.get("reminder_1"); got != 1 {
+		t.Errorf("fired %d times, want 1", got)
+	}
+
+	// 执行时间不在未来时不计划
+	if queue.Schedule("reminder_2", clock.Now(), calls.fn("reminder_2")) {
+		t.Errorf("schedule past task: expected false")
+	}
+	if queue.Len() != 0 {
+		t.Errorf("queue length = %d, want 0", queue.Len())
+	}
+}
+
+func TestTimerQueueRemovesAfterFire(t *testing.T) {
+	clock := newFakeClock()
+	queue := NewTimerQueue(clock)
+	calls := newCounter()
+
+	queue.Schedule("reminder_1", clock.Now().Add(time.Hour), calls.fn("reminder_1"))
+	queue.Schedule("reminder_2", clock.Now().Add(2*time.Hour), calls.fn("reminder_2"))
+
+	clock.Advance(time.Hour)
+	entries := queue.Entries()
+	if len(entries) != 1 || entries[0].Key != "reminder_2" {
+		t.Fatalf("entries after first fire = %+v", entries)
+	}
+
+	// 已执行的任务不能再取消
+	if queue.Cancel("reminder_1") {
+		t.Errorf("cancel fired task: expected false")
+	}
+
+	clock.Advance(time.Hour)
+	if queue.Len() != 0 {
+		t.Errorf("queue length = %d, want 0", queue.Len())
+	}
+}
+
+func TestTimerQueueReplacesOnUpdate(t *testing.T) {
+	clock := newFakeClock()
+	queue := NewTimerQueue(clock)
+	calls := newCounter()
+
+	// 餐更新后同一任务重新计划到更晚的时间
+	queue.Schedule("reminder_1", clock.Now().Add(time.Hour), calls.fn("old"))
+	queue.Schedule("reminder_1", clock.Now().Add(3*time.Hour), calls.fn("new"))
+
+	entries := queue.Entries()
+	if len(entries) != 1 || !entries[0].At.Equal(clock.Now().Add(3*time.Hour)) {
+		t.Fatalf("entries after replace = %+v", entries)
+	}
+
+	clock.Advance(time.Hour)
+	if calls.get("old") != 0 || calls.get("new") != 0 {
+		t.Fatalf("replaced task fired: old=%d new=%d", calls.get("old"), calls.get("new"))
+	}
+	clock.Advance(2 * time.Hour)
+	if calls.get("old") != 0 || calls.get("new") != 1 {
+		t.Errorf("after due: old=%d new=%d, want 0 and 1", calls.get("old"), calls.get("new"))
+	}
+
+	// 重新计划到更早的时间同样只执行一次
+	queue.Schedule("reminder_2", clock.Now().Add(2*time.Hour), calls.fn("late"))
+	queue.Schedule("reminder_2", clock.Now().Add(time.Hour), calls.fn("early"))
+	clock.Advance(3 * time.Hour)
+	if calls.get("late") != 0 || calls.get("early") != 1 {
+		t.Errorf("earlier replace: late=%d early=%d, want 0 and 1", calls.get("late"), calls.get("early"))
+	}
+}
+
+func TestTimerQueueCancelsOnDelete(t *testing.T) {
+	clock := newFakeClock()
+	queue := NewTimerQueue(clock)
+	calls := newCounter()
+
+	queue.Schedule("reminder_1_1h0m0s", clock.Now().Add(time.Hour), calls.fn("reminder_1_1h0m0s"))
+	queue.Schedule("reminder_1_2h0m0s", clock.Now().Add(2*time.Hour), calls.fn("reminder_1_2h0m0s"))
+	queue.Schedule("reminder_1_opening", clock.Now().Add(time.Hour), calls.fn("reminder_1_opening"))
+	queue.Schedule("reminder_12_opening", clock.Now().Add(time.Hour), calls.fn("reminder_12_opening"))
+	queue.Schedule("auto_select_1", clock.Now().Add(2*time.Hour), calls.fn("auto_select_1"))
+
+	// 删除餐时取消该餐的所有任务，其他餐不受影响
+	cancelled := queue.CancelPrefix("reminder_1_")
+	sort.Strings(cancelled)
+	if len(cancelled) != 3 || cancelled[2] != "reminder_1_opening" {
+		t.Fatalf("cancelled = %v", cancelled)
+	}
+	if !queue.Cancel("auto_select_1") || queue.Cancel("auto_select_1") {
+		t.Errorf("cancel single task: expected true then false")
+	}
+	entries := queue.Entries()
+	if len(entries) != 1 || entries[0].Key != "reminder_12_opening" {
+		t.Fatalf("entries after delete = %+v", entries)
+	}
+
+	clock.Advance(3 * time.Hour)
+	for _, key := range []string{"reminder_1_1h0m0s", "reminder_1_2h0m0s", "reminder_1_opening", "auto_select_1"} {
+		if got := calls.get(key); got != 0 {
+			t.Errorf("cancelled task %s fired %d times", key, got)
+		}
+	}
+	if got := calls.get("reminder_12_opening"); got != 1 {
+		t.Errorf("other meal's task fired %d times, want 1", got)
+	}
+}
@@ -27,6 +27,7 @@ type JWTClaims struct {
 	Username string   `json:"username"`
 	Role     UserRole `json:"role"`
 	Relation string   `json:"relation"`
+	ParentID string   `json:"parent_id,omitempty"` // 家长登录时为家长的钉钉ID
 	jwt.StandardClaims
 }
 
@@ -39,8 +40,8 @@ type StudentData struct {
 	Token    string `json:"token"`
 }
 
-// GenerateToken 生成 JWT 令牌
-func GenerateToken(id int, username string, role UserRole, relation string) (string, error) {
+// GenerateToken 生成 JWT 令牌，parentID 为家长登录时家长的钉钉ID，其他情况为空
+func GenerateToken(id int, username string, role UserRole, relation, parentID string) (string, error) {
 	// 获取 JWT 密钥
 	cfg := config.Get()
 	jwtSecret := []byte(cfg.Security.JWTSecret)
@@ -54,6 +55,7 @@ func GenerateToken(id int, username string, role UserRole, relation string) (str
 		Username: username,
 		Role:     role,
 		Relation: relation,
+		ParentID: parentID,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expirationTime.Unix(),
 		},
@@ -117,7 +119,7 @@ func Login(username, password string) (string, interface{}, error) {
 	}
 
 	// 生成 token
-	token, err := GenerateToken(user.ID, user.Username, role, "")
+	token, err := GenerateToken(user.ID, user.Username, role, "", "")
 	if err != nil {
 		return "", nil, err
 	}
@@ -141,7 +143,7 @@ func DingTalkLogin(code string) (string, interface{}, error) {
 	student, err := models.GetStudentByDingTalkID(userInfo.UserID)
 	if err == nil {
 		// 学生找到，生成学生 token
-		token, err := GenerateToken(student.ID, student.Username, RoleStudent, "本人")
+		token, err := GenerateToken(student.ID, student.Username, RoleStudent, "本人", "")
 		if err != nil {
 			return "", nil, err
 		}
@@ -160,7 +162,7 @@ func DingTalkLogin(code string) (string, interface{}, error) {
 		}
 
 		// 生成 token
-		token, err := GenerateToken(user.ID, user.Username, role, "")
+		token, err := GenerateToken(user.ID, user.Username, role, "", "")
 		if err != nil {
 			return "", nil, err
 		}
@@ -185,7 +187,7 @@ func DingTalkLogin(code string) (string, interface{}, error) {
 		}
 
 		// 为每个学生生成token
-		token, err := GenerateToken(student.ID, student.Username, RoleStudent, relation.Relation)
+		token, err := GenerateToken(student.ID, student.Username, RoleStudent, relation.Relation, userInfo.UserID)
 		if err != nil {
 			continue
 		}
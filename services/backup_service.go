@@ -0,0 +1,511 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/config"
+	"github.com/itsHenry35/canteen-management-system/database"
+)
+
+// 备份的触发方式
+const (
+	BackupSourceManual    = "manual"    // 管理员手动触发
+	BackupSourceScheduler = "scheduler" // 定时任务触发
+	BackupSourceCLI       = "cli"       // 命令行触发
+)
+
+// 备份文件格式：zip 压缩包，包含清单、数据库快照和餐食图片
+const (
+	backupFormat        = "canteen-backup"
+	backupFormatVersion = 1
+	backupManifestName  = "manifest.json"
+	backupDatabaseName  = "canteen.db"
+	backupImagesPrefix  = "images/"
+	mealImageDir        = "./data/images"
+)
+
+// ErrBackupNotFound 备份文件不存在
+var ErrBackupNotFound = errors.New("备份文件不存在")
+
+// 同一时间只允许一个备份或恢复
+var backupMutex sync.Mutex
+
+// BackupManifest 备份文件中的清单
+type BackupManifest struct {
+	Format        string    `json:"format"`
+	FormatVersion int       `json:"format_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	Source        string    `json:"source"`         // 触发方式
+	SchemaVersion int       `json:"schema_version"` // 数据库迁移版本
+	ImageCount    int       `json:"image_count"`    // 图片数量
+}
+
+// BackupInfo 备份文件信息
+type BackupInfo struct {
+	Name          string    `json:"name"`
+	Size          int64     `json:"size"` // 文件大小（字节）
+	CreatedAt     time.Time `json:"created_at"`
+	Source        string    `json:"source"`
+	SchemaVersion int       `json:"schema_version"`
+	ImageCount    int       `json:"image_count"`
+	Valid         bool      `json:"valid"` // 是否能读取到清单
+}
+
+// CreateBackup 在线备份数据库和餐食图片，保存到备份目录
+// 先使用 VACUUM INTO 生成一致的数据库快照，再打包快照和图片；压缩包写完后才重命名为正式文件名
+func CreateBackup(source string) (*BackupInfo, error) {
+	if !backupMutex.TryLock() {
+		return nil, errors.New("备份或恢复正在进行中，请稍后再试")
+	}
+	defer backupMutex.Unlock()
+
+	// 确保备份目录存在
+	dir := config.Get().Backup.Dir
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建备份目录失败: %v", err)
+	}
+
+	// 生成文件名
+	now := time.Now()
+	name := fmt.Sprintf("canteen-%s-%s.zip", now.Format("20060102-150405"), source)
+	archivePath := filepath.Join(dir, name)
+	if _, err := os.Stat(archivePath); err == nil {
+		return nil, fmt.Errorf("备份文件 %s 已存在", name)
+	}
+
+	// 生成数据库快照
+	snapshotPath := archivePath + ".db.tmp"
+	os.Remove(snapshotPath)
+	defer os.Remove(snapshotPath)
+	if err := database.BackupTo(snapshotPath); err != nil {
+		return nil, err
+	}
+	schemaVersion, err := database.ValidateSQLiteFile(snapshotPath)
+	if err != nil {
+		return nil, fmt.Errorf("数据库快照校验失败: %v", err)
+	}
+
+	// 打包
+	manifest := &BackupManifest{
+		Format:        backupFormat,
+		FormatVersion: backupFormatVersion,
+		CreatedAt:     now,
+		Source:        source,
+		SchemaVersion: schemaVersion,
+	}
+	tmpPath := archivePath + ".tmp"
+	if err := writeBackupArchive(tmpPath, snapshotPath, manifest); err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, archivePath); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("保存备份文件失败: %v", err)
+	}
+
+	log.Printf("已创建备份 %s，包含 %d 张图片", name, manifest.ImageCount)
+	return readBackupInfo(archivePath), nil
+}
+
+// writeBackupArchive 将数据库快照、餐食图片和清单写入压缩包
+func writeBackupArchive(archivePath, snapshotPath string, manifest *BackupManifest) error {
+	file, err := os.Create(archivePath)
+	if err != nil {
+		return fmt.Errorf("创建备份文件失败: %v", err)
+	}
+	defer file.Close()
+	zw := zip.NewWriter(file)
+
+	// 数据库快照
+	if err := addFileToZip(zw, backupDatabaseName, snapshotPath); err != nil {
+		return fmt.Errorf("写入数据库失败: %v", err)
+	}
+
+	// 餐食图片，图片目录不存在时跳过
+	err = filepath.WalkDir(mealImageDir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && filePath == mealImageDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(mealImageDir, filePath)
+		if err != nil {
+			return err
+		}
+		manifest.ImageCount++
+		return addFileToZip(zw, backupImagesPrefix+filepath.ToSlash(rel), filePath)
+	})
+	if err != nil {
+		return fmt.Errorf("写入图片失败: %v", err)
+	}
+
+	// 清单
+	writer, err := zw.CreateHeader(&zip.FileHeader{Name: backupManifestName, Method: zip.Deflate, Modified: manifest.CreatedAt})
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// addFileToZip 将文件写入压缩包
+func addFileToZip(zw *zip.Writer, name, filePath string) error {
+	src, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+
+	writer, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, src)
+	return err
+}
+
+// ListBackups 列出备份目录中的备份，按创建时间倒序
+func ListBackups() ([]*BackupInfo, error) {
+	entries, err := os.ReadDir(config.Get().Backup.Dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return []*BackupInfo{}, nil
+		}
+		return nil, err
+	}
+
+	backups := []*BackupInfo{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".zip") {
+			continue
+		}
+		backups = append(backups, readBackupInfo(filepath.Join(config.Get().Backup.Dir, entry.Name())))
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+
+	return backups, nil
+}
+
+// readBackupInfo 读取备份文件信息，无法读取清单时使用文件修改时间
+func readBackupInfo(archivePath string) *BackupInfo {
+	info := &BackupInfo{Name: filepath.Base(archivePath)}
+	if stat, err := os.Stat(archivePath); err == nil {
+		info.Size = stat.Size()
+		info.CreatedAt = stat.ModTime()
+	}
+
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return info
+	}
+	defer zr.Close()
+
+	manifest, err := readBackupManifest(&zr.Reader)
+	if err != nil {
+		return info
+	}
+	info.CreatedAt = manifest.CreatedAt
+	info.Source = manifest.Source
+	info.SchemaVersion = manifest.SchemaVersion
+	info.ImageCount = manifest.ImageCount
+	info.Valid = true
+
+	return info
+}
+
+// readBackupManifest 读取并检查压缩包中的清单
+func readBackupManifest(zr *zip.Reader) (*BackupManifest, error) {
+	file, err := zr.Open(backupManifestName)
+	if err != nil {
+		return nil, errors.New("备份文件中缺少清单")
+	}
+	defer file.Close()
+
+	var manifest BackupManifest
+	if err := json.NewDecoder(file).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("无法解析备份清单: %v", err)
+	}
+	if manifest.Format != backupFormat {
+		return nil, errors.New("不是本系统的备份文件")
+	}
+	if manifest.FormatVersion > backupFormatVersion {
+		return nil, fmt.Errorf("不支持的备份格式版本 %d", manifest.FormatVersion)
+	}
+
+	return &manifest, nil
+}
+
+// GetBackupPath 获取备份目录中指定备份的路径
+func GetBackupPath(name string) (string, error) {
+	// 只允许备份目录中的 zip 文件
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".zip") {
+		return "", ErrBackupNotFound
+	}
+
+	archivePath := filepath.Join(config.Get().Backup.Dir, name)
+	if stat, err := os.Stat(archivePath); err != nil || !stat.Mode().IsRegular() {
+		return "", ErrBackupNotFound
+	}
+
+	return archivePath, nil
+}
+
+// DeleteBackup 删除备份目录中指定的备份
+func DeleteBackup(name string) error {
+	archivePath, err := GetBackupPath(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(archivePath)
+}
+
+// PruneBackups 只保留最近 keep 个定时备份，删除更早的定时备份，返回删除的数量
+// 手动和命令行创建的备份不会被删除；keep 为0时不删除
+func PruneBackups(keep int) (int, error) {
+	if keep <= 0 {
+		return 0, nil
+	}
+
+	backups, err := ListBackups()
+	if err != nil {
+		return 0, err
+	}
+
+	// 备份已按创建时间倒序排列
+	count := 0
+	kept := 0
+	for _, backup := range backups {
+		if !backup.Valid || backup.Source != BackupSourceScheduler {
+			continue
+		}
+		kept++
+		if kept <= keep {
+			continue
+		}
+		if err := DeleteBackup(backup.Name); err != nil {
+			return count, fmt.Errorf("删除过期备份 %s 失败: %v", backup.Name, err)
+		}
+		log.Printf("已删除过期备份 %s", backup.Name)
+		count++
+	}
+
+	return count, nil
+}
+
+// ValidateBackup 检查备份文件：清单、文件路径和数据库快照的完整性与迁移版本
+func ValidateBackup(archivePath string) (*BackupManifest, error) {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("无法打开备份文件: %v", err)
+	}
+	defer zr.Close()
+
+	manifest, dbFile, err := checkBackupArchive(&zr.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// 将数据库解压到临时文件后检查
+	tmp, err := os.CreateTemp("", "canteen-restore-*.db")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := extractZipFile(dbFile, tmp.Name()); err != nil {
+		return nil, fmt.Errorf("解压数据库失败: %v", err)
+	}
+	if _, err := database.ValidateSQLiteFile(tmp.Name()); err != nil {
+		return nil, fmt.Errorf("备份中的数据库无效: %v", err)
+	}
+
+	return manifest, nil
+}
+
+// checkBackupArchive 检查压缩包的清单和文件路径，返回清单和数据库文件
+func checkBackupArchive(zr *zip.Reader) (*BackupManifest, *zip.File, error) {
+	manifest, err := readBackupManifest(zr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var dbFile *zip.File
+	for _, file := range zr.File {
+		name := file.Name
+		switch {
+		case name == backupManifestName || strings.HasSuffix(name, "/"):
+			continue
+		case name == backupDatabaseName:
+			dbFile = file
+		case strings.HasPrefix(name, backupImagesPrefix) && isSafeArchivePath(name):
+			continue
+		default:
+			return nil, nil, fmt.Errorf("备份文件包含无效的路径: %s", name)
+		}
+	}
+	if dbFile == nil {
+		return nil, nil, errors.New("备份文件中缺少数据库")
+	}
+
+	return manifest, dbFile, nil
+}
+
+// isSafeArchivePath 检查压缩包中的路径不会解压到目标目录之外
+func isSafeArchivePath(name string) bool {
+	return path.Clean(name) == name && !path.IsAbs(name) && !strings.HasPrefix(name, "../") &&
+		!strings.Contains(name, "/../") && !strings.Contains(name, "\\")
+}
+
+// extractZipFile 将压缩包中的文件解压到 dest
+func extractZipFile(file *zip.File, dest string) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// RestoreBackup 从备份文件恢复数据库和餐食图片，恢复前必须停止服务
+// 备份通过检查后才会替换现有文件；原有的数据库和图片目录会加上 .before-restore-<时间> 后缀保留，
+// 返回原数据库的保留路径（原数据库不存在时为空）
+func RestoreBackup(archivePath string) (*BackupManifest, string, error) {
+	if !backupMutex.TryLock() {
+		return nil, "", errors.New("备份或恢复正在进行中，请稍后再试")
+	}
+	defer backupMutex.Unlock()
+
+	// 只支持 SQLite
+	cfg := config.Get()
+	dialect, err := database.ParseDialect(cfg.Database.Driver)
+	if err != nil {
+		return nil, "", err
+	}
+	if dialect != database.DialectSQLite {
+		return nil, "", fmt.Errorf("恢复仅支持 SQLite 数据库，当前为 %s", dialect)
+	}
+
+	// 检查备份
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, "", fmt.Errorf("无法打开备份文件: %v", err)
+	}
+	defer zr.Close()
+	manifest, dbFile, err := checkBackupArchive(&zr.Reader)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// 解压数据库到目标目录下的临时文件，检查通过后再替换
+	dbPath := cfg.Database.Path
+	tmpDBPath := dbPath + ".restore.tmp"
+	os.Remove(tmpDBPath)
+	defer os.Remove(tmpDBPath)
+	if err := extractZipFile(dbFile, tmpDBPath); err != nil {
+		return nil, "", fmt.Errorf("解压数据库失败: %v", err)
+	}
+	if _, err := database.ValidateSQLiteFile(tmpDBPath); err != nil {
+		return nil, "", fmt.Errorf("备份中的数据库无效: %v", err)
+	}
+
+	// 解压图片到临时目录
+	tmpImageDir := mealImageDir + ".restore.tmp"
+	if err := os.RemoveAll(tmpImageDir); err != nil {
+		return nil, "", err
+	}
+	defer os.RemoveAll(tmpImageDir)
+	if err := os.MkdirAll(tmpImageDir, 0755); err != nil {
+		return nil, "", err
+	}
+	for _, file := range zr.File {
+		if !strings.HasPrefix(file.Name, backupImagesPrefix) || strings.HasSuffix(file.Name, "/") {
+			continue
+		}
+		dest := filepath.Join(tmpImageDir, filepath.FromSlash(strings.TrimPrefix(file.Name, backupImagesPrefix)))
+		if err := extractZipFile(file, dest); err != nil {
+			return nil, "", fmt.Errorf("解压图片 %s 失败: %v", file.Name, err)
+		}
+	}
+
+	// 保留原有的数据库（含 WAL 文件）和图片目录
+	suffix := ".before-restore-" + time.Now().Format("20060102-150405")
+	previousDBPath := ""
+	for _, ext := range []string{"", "-wal", "-shm"} {
+		if _, err := os.Stat(dbPath + ext); err != nil {
+			continue
+		}
+		if err := os.Rename(dbPath+ext, dbPath+suffix+ext); err != nil {
+			return nil, "", fmt.Errorf("保留原数据库失败: %v", err)
+		}
+		if ext == "" {
+			previousDBPath = dbPath + suffix
+		}
+	}
+	if _, err := os.Stat(mealImageDir); err == nil {
+		if err := os.Rename(mealImageDir, mealImageDir+suffix); err != nil {
+			return nil, previousDBPath, fmt.Errorf("保留原图片目录失败: %v", err)
+		}
+	}
+
+	// 替换为备份中的文件
+	if err := os.Rename(tmpDBPath, dbPath); err != nil {
+		return nil, previousDBPath, fmt.Errorf("替换数据库失败: %v", err)
+	}
+	if err := os.Rename(tmpImageDir, mealImageDir); err != nil {
+		return nil, previousDBPath, fmt.Errorf("替换图片目录失败: %v", err)
+	}
+
+	log.Printf("已从 %s 恢复数据库和 %d 张图片", filepath.Base(archivePath), manifest.ImageCount)
+	return manifest, previousDBPath, nil
+}
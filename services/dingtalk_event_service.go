@@ -0,0 +1,361 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/models"
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+// 钉钉事件类型
+const (
+	DingTalkEventCheckURL = "check_url" // 回调地址校验
+)
+
+// 钉钉中移除用户的事件，对应的学生会被归档，关系会被删除
+var dingTalkUserRemoveEvents = map[string]bool{
+	"edu_user_delete": true,
+	"user_leave_org":  true,
+}
+
+// 后台处理事件的参数
+const (
+	dingTalkEventQueueSize = 256            // 等待处理的事件数上限，队列已满时不应答，由钉钉重试推送
+	dingTalkEventDedupTTL  = 24 * time.Hour // 事件ID的去重时间，钉钉在此期间内的重复推送不再处理
+	dingTalkEventAttempts  = 3              // 每个事件最多处理的次数
+)
+
+// dingTalkEventRetryDelay 事件处理失败后第 n 次重试前等待 n 倍的该时间
+var dingTalkEventRetryDelay = 5 * time.Second
+
+// DingTalkEvent 钉钉推送的事件
+type DingTalkEvent struct {
+	ID        string // 事件ID，事件内容没有 EventId 时为事件内容的哈希，用于去重
+	EventType string
+	UserIDs   []string // 事件涉及的用户钉钉ID
+	ClassIDs  []string // 事件涉及的班级（部门）ID
+}
+
+var (
+	// 事件依次处理，避免同时处理的事件基于过期的数据计算差异
+	dingTalkEventMutex sync.Mutex
+	// 班级缓存（ID -> 班级），增量同步只需要班级名称，避免每个事件都遍历部门树
+	dingTalkClassCache map[string]utils.DingTalkClass
+	// 后台处理队列，回调收到事件后立即应答，事件在后台依次处理
+	dingTalkEventQueue struct {
+		sync.Mutex
+		events  chan *DingTalkEvent
+		seen    map[string]time.Time // 事件ID -> 接收时间
+		pending sync.WaitGroup
+	}
+)
+
+// ParseDingTalkEvent 解析解密后的事件内容
+func ParseDingTalkEvent(plaintext string) (*DingTalkEvent, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(plaintext), &raw); err != nil {
+		return nil, fmt.Errorf("解析事件内容失败: %v", err)
+	}
+
+	event := &DingTalkEvent{}
+	for key, value := range raw {
+		// 不同事件的字段命名不统一，统一转为小写比较
+		switch strings.ToLower(key) {
+		case "eventtype":
+			event.EventType, _ = value.(string)
+		case "eventid":
+			event.ID, _ = value.(string)
+		case "userid", "userids", "useridlist":
+			event.UserIDs = append(event.UserIDs, collectEventIDs(value)...)
+		case "deptid", "deptids", "deptidlist", "classid", "classids":
+			event.ClassIDs = append(event.ClassIDs, collectEventIDs(value)...)
+		}
+	}
+
+	if event.EventType == "" {
+		return nil, errors.New("事件内容缺少EventType")
+	}
+	if event.ID == "" {
+		// 钉钉重试推送的事件内容（包括时间戳）相同
+		sum := sha256.Sum256([]byte(plaintext))
+		event.ID = hex.EncodeToString(sum[:])
+	}
+
+	return event, nil
+}
+
+// collectEventIDs 将事件中的ID字段（字符串、数字或数组）转为字符串列表
+func collectEventIDs(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []string{v}
+	case float64:
+		return []string{strconv.FormatInt(int64(v), 10)}
+	case []interface{}:
+		var ids []string
+		for _, item := range v {
+			ids = append(ids, collectEventIDs(item)...)
+		}
+		return ids
+	}
+	return nil
+}
+
+// EnqueueDingTalkEvent 将事件加入后台处理队列后立即返回，回调随后应答 success，避免处理时间过长导致钉钉超时重试
+// 已接收过的事件ID直接返回；队列已满时返回错误，回调不应答，钉钉会重试推送；回调地址校验事件无需处理
+func EnqueueDingTalkEvent(event *DingTalkEvent) error {
+	if event.EventType == DingTalkEventCheckURL {
+		return nil
+	}
+
+	queue := &dingTalkEventQueue
+	queue.Lock()
+	defer queue.Unlock()
+
+	// 启动后台处理
+	if queue.events == nil {
+		queue.events = make(chan *DingTalkEvent, dingTalkEventQueueSize)
+		queue.seen = make(map[string]time.Time)
+		go processDingTalkEvents(queue.events)
+	}
+
+	// 去重，同时清理过期的事件ID
+	now := time.Now()
+	for id, receivedAt := range queue.seen {
+		if now.Sub(receivedAt) > dingTalkEventDedupTTL {
+			delete(queue.seen, id)
+		}
+	}
+	if _, exists := queue.seen[event.ID]; exists {
+		log.Printf("忽略重复推送的钉钉事件: %s (%s)", event.EventType, event.ID)
+		return nil
+	}
+
+	// 加入队列
+	select {
+	case queue.events <- event:
+		queue.seen[event.ID] = now
+		queue.pending.Add(1)
+		return nil
+	default:
+		return errors.New("钉钉事件队列已满，请稍后重试")
+	}
+}
+
+// WaitDingTalkEvents 等待已加入队列的事件处理完成
+func WaitDingTalkEvents() {
+	dingTalkEventQueue.pending.Wait()
+}
+
+// processDingTalkEvents 依次处理队列中的事件，失败时重试，多次失败后放弃并允许钉钉再次推送该事件
+// 放弃的事件由定时的学生名单同步兜底
+func processDingTalkEvents(events <-chan *DingTalkEvent) {
+	for event := range events {
+		var err error
+		for attempt := 1; attempt <= dingTalkEventAttempts; attempt++ {
+			if err = HandleDingTalkEvent(event); err == nil {
+				break
+			}
+			if attempt < dingTalkEventAttempts {
+				time.Sleep(time.Duration(attempt) * dingTalkEventRetryDelay)
+			}
+		}
+		if err != nil {
+			utils.LogError(fmt.Sprintf("钉钉事件 %s 处理 %d 次均失败，将在下次学生名单同步时处理: %v", event.EventType, dingTalkEventAttempts, err))
+			dingTalkEventQueue.Lock()
+			delete(dingTalkEventQueue.seen, event.ID)
+			dingTalkEventQueue.Unlock()
+		}
+		dingTalkEventQueue.pending.Done()
+	}
+}
+
+// HandleDingTalkEvent 处理事件，处理完成后才返回；回调地址校验事件无需处理
+// 事件的处理结果与处理次数无关，失败后可以重新处理
+func HandleDingTalkEvent(event *DingTalkEvent) error {
+	if event.EventType == DingTalkEventCheckURL {
+		return nil
+	}
+
+	dingTalkEventMutex.Lock()
+	defer dingTalkEventMutex.Unlock()
+
+	if err := ApplyDingTalkEvent(event); err != nil {
+		utils.LogError(fmt.Sprintf("处理钉钉事件 %s 失败: %v", event.EventType, err))
+		return err
+	}
+	return nil
+}
+
+// ApplyDingTalkEvent 将钉钉事件增量应用到学生和家长-学生关系
+func ApplyDingTalkEvent(event *DingTalkEvent) error {
+	log.Printf("收到钉钉事件: %s, 用户: %v, 班级: %v", event.EventType, event.UserIDs, event.ClassIDs)
+
+	// 用户被移除：归档学生并删除关系
+	if dingTalkUserRemoveEvents[event.EventType] {
+		archivedCount, removedCount, err := models.RemoveDingTalkUsers(event.UserIDs)
+		if err != nil {
+			return fmt.Errorf("移除钉钉用户失败: %v", err)
+		}
+		log.Printf("钉钉事件 %s 处理完成，归档学生 %d 名，删除关系 %d 条", event.EventType, archivedCount, removedCount)
+		return nil
+	}
+
+	// 班级被删除时无法获取成员，等待用户移除事件或定时同步处理
+	if event.EventType == "edu_dept_delete" {
+		log.Printf("班级 %v 已在钉钉中删除，其学生将在用户移除事件或下次名单同步时处理", event.ClassIDs)
+		return nil
+	}
+
+	// 其余家校通讯录事件：重新同步涉及的班级；事件未携带班级时同步所有班级
+	// 部门事件可能新建或重命名了班级，需要刷新班级缓存
+	if strings.HasPrefix(event.EventType, "edu_") {
+		return syncDingTalkClasses(event.ClassIDs, strings.HasPrefix(event.EventType, "edu_dept_"))
+	}
+
+	log.Printf("忽略钉钉事件: %s", event.EventType)
+	return nil
+}
+
+// dingTalkClasses 返回指定的班级，classIDs 为空时返回所有班级，不是班级的ID会被忽略
+// 需要刷新、需要所有班级或缓存中没有某个ID时才重新获取班级列表
+func dingTalkClasses(classIDs []string, refresh bool) ([]utils.DingTalkClass, error) {
+	if dingTalkClassCache == nil || len(classIDs) == 0 {
+		refresh = true
+	}
+	for _, id := range classIDs {
+		if _, exists := dingTalkClassCache[id]; !exists {
+			refresh = true
+		}
+	}
+
+	if refresh {
+		allClasses, err := utils.GetAllClasses(func(string) {})
+		if err != nil {
+			return nil, fmt.Errorf("获取班级列表失败: %v", err)
+		}
+		dingTalkClassCache = make(map[string]utils.DingTalkClass, len(allClasses))
+		for _, class := range allClasses {
+			dingTalkClassCache[class.ID] = class
+		}
+		if len(classIDs) == 0 {
+			return allClasses, nil
+		}
+	}
+
+	var classes []utils.DingTalkClass
+	for _, id := range classIDs {
+		if class, exists := dingTalkClassCache[id]; exists {
+			classes = append(classes, class)
+		}
+	}
+	return classes, nil
+}
+
+// syncDingTalkClasses 增量同步指定班级的学生与家长-学生关系，classIDs 为空时同步所有班级
+// 只新建和更新学生，不归档；任一班级获取失败时不做任何修改
+func syncDingTalkClasses(classIDs []string, refreshClasses bool) error {
+	// 获取涉及的班级，用于确定班级名称
+	classes, err := dingTalkClasses(classIDs, refreshClasses)
+	if err != nil {
+		return err
+	}
+	if len(classes) == 0 {
+		log.Printf("班级 %v 不是家校通讯录中的班级，忽略", classIDs)
+		return nil
+	}
+
+	// 获取班级的学生与关系
+	var remoteStudents []rosterStudent
+	var remoteRelations []utils.DingTalkGuardianStudentRel
+	for _, class := range classes {
+		students, err := utils.GetClassStudents(class.ID)
+		if err != nil {
+			return fmt.Errorf("获取班级 %s 的学生失败: %v", class.Name, err)
+		}
+		for _, student := range students {
+			remoteStudents = append(remoteStudents, rosterStudent{DingTalkStudent: student, ClassName: class.Name})
+		}
+
+		relations, err := utils.GetClassParentStudentRelations(class.ID)
+		if err != nil {
+			return fmt.Errorf("获取班级 %s 的家长关系失败: %v", class.Name, err)
+		}
+		remoteRelations = append(remoteRelations, relations...)
+	}
+
+	// 计算学生名单差异
+	localStudents, err := models.GetStudentsIncludingArchived()
+	if err != nil {
+		return fmt.Errorf("获取现有学生失败: %v", err)
+	}
+	rosterDiff := diffStudentRoster(localStudents, remoteStudents, false)
+
+	// 计算关系差异，仅比较这些班级的学生
+	classStudentIDs := make(map[string]bool)
+	for _, student := range remoteStudents {
+		classStudentIDs[student.UserID] = true
+	}
+	for _, rel := range remoteRelations {
+		classStudentIDs[rel.StudentUserId] = true
+	}
+	allRelations, err := models.GetAllParentStudentRelations()
+	if err != nil {
+		return fmt.Errorf("获取现有关系失败: %v", err)
+	}
+	var localRelations []*models.ParentStudentRelation
+	for _, rel := range allRelations {
+		if classStudentIDs[rel.StudentID] {
+			localRelations = append(localRelations, rel)
+		}
+	}
+	relationDiff := diffParentStudentRelations(localRelations, remoteRelations)
+
+	// 应用学生名单差异并记录同步报告
+	if !rosterDiff.IsEmpty() {
+		report, err := models.CreateRosterSyncReport(false, RosterSyncSourceCallback)
+		if err != nil {
+			return fmt.Errorf("创建同步报告失败: %v", err)
+		}
+		report.ClassCount = len(classes)
+		report.Details = rosterDiff
+
+		applyErr := models.ApplyStudentRosterDiff(rosterDiff)
+		if applyErr != nil {
+			report.Status = models.SyncStatusFailed
+			report.Error = applyErr.Error()
+		} else {
+			report.Status = models.SyncStatusSuccess
+		}
+		if err := models.FinishRosterSyncReport(report); err != nil {
+			log.Printf("保存同步报告失败: %v", err)
+		}
+		if applyErr != nil {
+			return fmt.Errorf("应用学生名单差异失败: %v", applyErr)
+		}
+	}
+
+	// 应用关系差异
+	if !relationDiff.IsEmpty() {
+		if err := models.ApplyParentStudentRelationDiff(relationDiff); err != nil {
+			return fmt.Errorf("应用家长-学生关系差异失败: %v", err)
+		}
+	}
+
+	log.Printf("班级同步完成。新建学生: %d, 更新学生: %d, 新增关系: %d, 删除关系: %d, 变更关系: %d",
+		len(rosterDiff.Created), len(rosterDiff.Updated),
+		len(relationDiff.Added), len(relationDiff.Removed), len(relationDiff.Changed))
+	return nil
+}
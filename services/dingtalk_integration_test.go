@@ -0,0 +1,346 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/config"
+	"github.com/itsHenry35/canteen-management-system/database"
+	"github.com/itsHenry35/canteen-management-system/models"
+	"github.com/itsHenry35/canteen-management-system/utils"
+	"github.com/itsHenry35/canteen-management-system/utils/dingtalkfake"
+)
+
+// TestMain 在临时目录中创建配置文件和 SQLite 数据库，测试结束后删除
+func TestMain(m *testing.M) {
+	os.Exit(runWithTempSystem(m))
+}
+
+func runWithTempSystem(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "canteen-services-test")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chdir(dir); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	// 写入测试配置
+	cfg := map[string]interface{}{
+		"database": map[string]string{"driver": "sqlite", "path": filepath.Join(dir, "canteen.db")},
+		"dingtalk": map[string]string{"app_key": "key", "app_secret": "secret", "agent_id": "1001"},
+		"website":  map[string]string{"domain": "https://canteen.example.com"},
+	}
+	data, _ := json.Marshal(cfg)
+	if err := os.WriteFile("config.json", data, 0644); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if err := config.Load(); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	// 初始化数据库
+	if err := database.Initialize(); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer database.Close()
+
+	return m.Run()
+}
+
+// newFakeDingTalk 清空业务数据并启动模拟钉钉服务，测试结束时恢复全局客户端
+func newFakeDingTalk(t *testing.T) *dingtalkfake.Server {
+	t.Helper()
+
+	for _, table := range []string{"meal_selections", "meals", "parent_student_relations", "students"} {
+		if _, err := database.GetDB().Exec("DELETE FROM " + table); err != nil {
+			t.Fatalf("clear %s: %v", table, err)
+		}
+	}
+	if _, err := database.GetDB().Exec("DELETE FROM users WHERE username <> 'admin'"); err != nil {
+		t.Fatalf("clear users: %v", err)
+	}
+
+	fake := dingtalkfake.NewServer()
+	utils.SetDingTalkClient(fake.Client())
+	t.Cleanup(func() {
+		utils.SetDingTalkClient(nil)
+		fake.Close()
+	})
+	return fake
+}
+
+// addSchool 在模拟服务中添加一个年级和两个班级
+func addSchool(fake *dingtalkfake.Server) {
+	fake.AddDepartment(dingtalkfake.Department{ID: 1, ParentID: 0, Name: "初中部", Type: "period"})
+	fake.AddDepartment(dingtalkfake.Department{ID: 10, ParentID: 1, Name: "七年级", Type: "grade"})
+	fake.AddDepartment(dingtalkfake.Department{ID: 101, ParentID: 10, Name: "1班", Type: "class"})
+	fake.AddDepartment(dingtalkfake.Department{ID: 102, ParentID: 10, Name: "2班", Type: "class"})
+}
+
+func TestDingTalkLogin(t *testing.T) {
+	fake := newFakeDingTalk(t)
+
+	student, err := models.CreateStudent("张三", "七年级1班", "s1")
+	if err != nil {
+		t.Fatalf("create student: %v", err)
+	}
+	if err := models.SaveParentStudentRelation("p1", "s1", "父亲"); err != nil {
+		t.Fatalf("create relation: %v", err)
+	}
+	fake.AddUser("code-student", utils.DingTalkUserInfo{UserID: "s1", Name: "张三"})
+	fake.AddUser("code-parent", utils.DingTalkUserInfo{UserID: "p1", Name: "张父"})
+	fake.AddUser("code-stranger", utils.DingTalkUserInfo{UserID: "x1", Name: "路人"})
+
+	// 学生本人登录
+	token, data, err := DingTalkLogin("code-student")
+	if err != nil || token == "" {
+		t.Fatalf("student login = %q, %v", token, err)
+	}
+	if got, ok := data.(*models.Student); !ok || got.ID != student.ID {
+		t.Errorf("student login data = %+v", data)
+	}
+	claims, err := ValidateToken(token)
+	if err != nil || claims.Role != RoleStudent || claims.UserID != student.ID {
+		t.Errorf("student token claims = %+v, %v", claims, err)
+	}
+
+	// 家长登录返回关联学生的凭证
+	token, data, err = DingTalkLogin("code-parent")
+	if err != nil || token != "" {
+		t.Fatalf("parent login = %q, %v", token, err)
+	}
+	students, ok := data.([]StudentData)
+	if !ok || len(students) != 1 || students[0].ID != student.ID {
+		t.Fatalf("parent login data = %+v", data)
+	}
+	claims, err = ValidateToken(students[0].Token)
+	if err != nil || claims.Relation != "父亲" || claims.ParentID != "p1" {
+		t.Errorf("parent token claims = %+v, %v", claims, err)
+	}
+
+	// 未关联的用户和无效的免登码
+	if _, _, err := DingTalkLogin("code-stranger"); err == nil || !strings.Contains(err.Error(), "x1") {
+		t.Errorf("stranger login error = %v", err)
+	}
+	if _, _, err := DingTalkLogin("code-unknown"); err == nil {
+		t.Errorf("unknown code login: expected error")
+	}
+}
+
+func TestRebuildParentStudentMapping(t *testing.T) {
+	fake := newFakeDingTalk(t)
+	addSchool(fake)
+	fake.PageSize = 1
+	fake.AddRelation(dingtalkfake.Relation{ClassID: 101, GuardianUserID: "p1", StudentUserID: "s1", RelationName: "父亲"})
+	fake.AddRelation(dingtalkfake.Relation{ClassID: 101, GuardianUserID: "p2", StudentUserID: "s1", RelationName: "母亲"})
+	fake.AddRelation(dingtalkfake.Relation{ClassID: 102, GuardianUserID: "p3", StudentUserID: "s2", RelationName: "爷爷"})
+
+	// 已有一条过期关系和一条描述变化的关系
+	if err := models.SaveParentStudentRelation("p9", "s9", "父亲"); err != nil {
+		t.Fatalf("create relation: %v", err)
+	}
+	if err := models.SaveParentStudentRelation("p3", "s2", "外公"); err != nil {
+		t.Fatalf("create relation: %v", err)
+	}
+
+	// 预览不修改数据
+	report, err := RebuildParentStudentMapping(true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if report.ClassCount != 2 || len(report.Details.Added) != 2 || len(report.Details.Removed) != 1 || len(report.Details.Changed) != 1 {
+		t.Errorf("dry run report = %+v", report)
+	}
+	relations, _ := models.GetAllParentStudentRelations()
+	if len(relations) != 2 {
+		t.Errorf("dry run changed relations: %d", len(relations))
+	}
+
+	// 同步后与钉钉一致
+	if _, err := RebuildParentStudentMapping(false); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	got := make(map[string]string)
+	relations, _ = models.GetAllParentStudentRelations()
+	for _, rel := range relations {
+		got[rel.ParentID+"-"+rel.StudentID] = rel.Relation
+	}
+	want := map[string]string{"p1-s1": "父亲", "p2-s1": "母亲", "p3-s2": "爷爷"}
+	if len(got) != len(want) {
+		t.Errorf("relations after rebuild = %v", got)
+	}
+	for key, relation := range want {
+		if got[key] != relation {
+			t.Errorf("relation %s = %q, want %q", key, got[key], relation)
+		}
+	}
+
+	// 某个班级获取失败时不做任何修改
+	fake.RemoveRelation("p1", "s1")
+	fake.Fail("/topapi/edu/user/relation/list#102", 88)
+	if _, err := RebuildParentStudentMapping(false); err == nil {
+		t.Errorf("rebuild with failed class: expected error")
+	}
+	relations, _ = models.GetAllParentStudentRelations()
+	if len(relations) != 3 {
+		t.Errorf("relations after failed rebuild = %d, want 3", len(relations))
+	}
+
+	// 年级的子部门获取失败时同样不做任何修改
+	fake.Fail("/topapi/edu/user/relation/list#102", 0)
+	fake.Fail("/topapi/edu/dept/list#10", 88)
+	if _, err := RebuildParentStudentMapping(false); err == nil {
+		t.Errorf("rebuild with failed department: expected error")
+	}
+	relations, _ = models.GetAllParentStudentRelations()
+	if len(relations) != 3 {
+		t.Errorf("relations after failed department = %d, want 3", len(relations))
+	}
+
+	// 未获取到任何班级时同样不做修改
+	fake.Fail("/topapi/edu/dept/list#10", 0)
+	fake.Fail("/topapi/edu/dept/list#0", 60123)
+	if _, err := RebuildParentStudentMapping(false); err == nil {
+		t.Errorf("rebuild without classes: expected error")
+	}
+	relations, _ = models.GetAllParentStudentRelations()
+	if len(relations) != 3 {
+		t.Errorf("relations after empty rebuild = %d, want 3", len(relations))
+	}
+}
+
+func TestNotifyUnselectedStudents(t *testing.T) {
+	fake := newFakeDingTalk(t)
+
+	selected, err := models.CreateStudent("李四", "七年级1班", "s1")
+	if err != nil {
+		t.Fatalf("create student: %v", err)
+	}
+	if _, err := models.CreateStudent("王五", "七年级2班", "s2"); err != nil {
+		t.Fatalf("create student: %v", err)
+	}
+	if err := models.SaveParentStudentRelation("p2", "s2", "母亲"); err != nil {
+		t.Fatalf("create relation: %v", err)
+	}
+
+	// 选餐进行中的餐，其中一名学生已选餐
+	now := time.Now()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	meal, err := models.CreateMeal("午餐", now.Add(-time.Hour), now.Add(time.Hour), day.AddDate(0, 0, 1), day.AddDate(0, 0, 1), "", nil, 0, 0)
+	if err != nil {
+		t.Fatalf("create meal: %v", err)
+	}
+	if _, err := models.CreateMealSelection(selected.ID, meal.ID, models.MealTypeA, true, "李四", models.SelectionSourceStudent); err != nil {
+		t.Fatalf("create selection: %v", err)
+	}
+
+	count, err := models.NotifyUnselectedStudentsByMealId(meal.ID)
+	if err != nil || count != 1 {
+		t.Fatalf("notify = %d, %v", count, err)
+	}
+
+	// 只提醒未选餐的学生及其家长
+	messages := fake.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("messages = %+v", messages)
+	}
+	msg := messages[0]
+	if msg.AgentID != "1001" || strings.Join(msg.UserIDs, ",") != "s2,p2" {
+		t.Errorf("message recipients = %s %v", msg.AgentID, msg.UserIDs)
+	}
+	if msg.Title != "选餐提醒" || !strings.Contains(msg.Body, "午餐") || msg.URL != "https://canteen.example.com/dingtalk_auth" {
+		t.Errorf("message = %+v", msg)
+	}
+}
+
+func TestSyncStudentRoster(t *testing.T) {
+	fake := newFakeDingTalk(t)
+	addSchool(fake)
+	fake.AddStudent(dingtalkfake.Student{ClassID: 101, UserID: "s1", Name: "张三"})
+	fake.AddStudent(dingtalkfake.Student{ClassID: 102, UserID: "s2", Name: "李四"})
+	if _, err := models.CreateStudent("王五", "七年级2班", "s3"); err != nil {
+		t.Fatalf("create student: %v", err)
+	}
+
+	// 新学生被创建，已不在班级中的学生被归档
+	if _, err := SyncStudentRoster(false, RosterSyncSourceManual); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	students, _ := models.GetAllStudents()
+	classes := make(map[string]string)
+	for _, student := range students {
+		classes[student.DingTalkID] = student.Class
+	}
+	if len(classes) != 2 || classes["s1"] != "七年级1班" || classes["s2"] != "七年级2班" {
+		t.Errorf("students after sync = %v", classes)
+	}
+
+	// 年级的子部门获取失败时不归档任何学生
+	fake.Fail("/topapi/edu/dept/list#10", 88)
+	if _, err := SyncStudentRoster(false, RosterSyncSourceManual); err == nil {
+		t.Errorf("sync with failed grade: expected error")
+	}
+	students, _ = models.GetAllStudents()
+	if len(students) != 2 {
+		t.Errorf("students after failed sync = %d, want 2", len(students))
+	}
+
+	// 未获取到任何班级时同样不做修改
+	fake.Fail("/topapi/edu/dept/list#10", 0)
+	fake.Fail("/topapi/edu/dept/list#0", 60123)
+	if _, err := SyncStudentRoster(false, RosterSyncSourceManual); err == nil {
+		t.Errorf("sync without classes: expected error")
+	}
+	students, _ = models.GetAllStudents()
+	if len(students) != 2 {
+		t.Errorf("students after empty sync = %d, want 2", len(students))
+	}
+}
+
+func TestEnqueueDingTalkEventRetries(t *testing.T) {
+	fake := newFakeDingTalk(t)
+	addSchool(fake)
+	fake.AddStudent(dingtalkfake.Student{ClassID: 101, UserID: "s1", Name: "张三"})
+	delay := dingTalkEventRetryDelay
+	dingTalkEventRetryDelay = time.Millisecond
+	defer func() { dingTalkEventRetryDelay = delay }()
+
+	// 每次处理都失败时重试后放弃，学生不会被创建
+	event, err := ParseDingTalkEvent(`{"EventType":"edu_user_insert","UserId":["s1"],"DeptId":[101],"TimeStamp":"1"}`)
+	if err != nil {
+		t.Fatalf("parse event: %v", err)
+	}
+	fake.Fail("/topapi/edu/user/list#101", 88)
+	if err := EnqueueDingTalkEvent(event); err != nil {
+		t.Fatalf("enqueue event: %v", err)
+	}
+	WaitDingTalkEvents()
+	if got := fake.Requests("/topapi/edu/user/list"); got < dingTalkEventAttempts {
+		t.Errorf("member requests = %d, want at least %d", got, dingTalkEventAttempts)
+	}
+	if _, err := models.GetStudentByDingTalkID("s1"); err == nil {
+		t.Fatalf("student created by failed event")
+	}
+
+	// 放弃的事件可以被钉钉再次推送并处理
+	fake.Fail("/topapi/edu/user/list#101", 0)
+	if err := EnqueueDingTalkEvent(event); err != nil {
+		t.Fatalf("enqueue event again: %v", err)
+	}
+	WaitDingTalkEvents()
+	if student, err := models.GetStudentByDingTalkID("s1"); err != nil || student.Class != "七年级1班" {
+		t.Errorf("student after retried event = %+v, %v", student, err)
+	}
+}
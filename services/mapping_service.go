@@ -1,6 +1,7 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"sync"
@@ -60,13 +61,15 @@ func ClearMappingLogs() {
 	mappingLogs = []string{}
 }
 
-// RebuildParentStudentMapping 重建所有家长-学生映射关系
-func RebuildParentStudentMapping() error {
+// RebuildParentStudentMapping 同步所有家长-学生映射关系
+// 先从钉钉获取全部班级的关系，与数据库比对后在单个事务中应用差异；
+// 任一部门或班级获取失败时不做任何修改。dryRun 为 true 时只生成差异报告。
+func RebuildParentStudentMapping(dryRun bool) (*models.MappingSyncReport, error) {
 	// 检查是否已经在重建
 	rebuildingMutex.Lock()
 	if isRebuilding {
 		rebuildingMutex.Unlock()
-		return fmt.Errorf("映射关系重建已在进行中，请等待完成")
+		return nil, fmt.Errorf("映射关系重建已在进行中，请等待完成")
 	}
 
 	// 设置重建状态为 true
@@ -83,36 +86,99 @@ func RebuildParentStudentMapping() error {
 		rebuildingMutex.Unlock()
 	}()
 
+	// 创建同步报告
+	report, err := models.CreateMappingSyncReport(dryRun)
+	if err != nil {
+		errMsg := fmt.Sprintf("创建同步报告失败: %v", err)
+		addMappingLog(errMsg)
+		return nil, errors.New(errMsg)
+	}
+
 	// 记录开始
-	addMappingLog("开始重建家长-学生映射关系")
+	if dryRun {
+		addMappingLog("开始预览家长-学生映射关系差异（不会修改数据）")
+	} else {
+		addMappingLog("开始同步家长-学生映射关系")
+	}
+
+	// 同步并保存报告
+	syncErr := syncParentStudentMapping(report)
+	if syncErr != nil {
+		report.Status = models.SyncStatusFailed
+		report.Error = syncErr.Error()
+		addMappingLog(syncErr.Error())
+	} else {
+		report.Status = models.SyncStatusSuccess
+	}
+
+	if err := models.FinishMappingSyncReport(report); err != nil {
+		addMappingLog(fmt.Sprintf("保存同步报告失败: %v", err))
+	}
+
+	return report, syncErr
+}
 
-	// 获取所有班级ID
+// syncParentStudentMapping 获取钉钉中的关系并应用差异，结果写入报告
+func syncParentStudentMapping(report *models.MappingSyncReport) error {
+	// 获取所有班级ID，部门树未完整获取时直接返回，避免删除缺失班级的关系
 	classIDs, err := utils.GetAllClassIDs(addMappingLog)
 	if err != nil {
-		errMsg := fmt.Sprintf("获取班级列表失败: %v", err)
-		addMappingLog(errMsg)
-		return fmt.Errorf(errMsg)
+		return fmt.Errorf("获取班级列表失败: %v", err)
+	}
+	if len(classIDs) == 0 {
+		return errors.New("未获取到任何班级，未修改任何映射关系")
 	}
 
+	report.ClassCount = len(classIDs)
 	addMappingLog(fmt.Sprintf("共获取到 %d 个班级需要处理", len(classIDs)))
 
-	// 清空现有的映射关系
-	if err := models.ClearAllParentStudentRelations(); err != nil {
-		errMsg := fmt.Sprintf("清空映射关系失败: %v", err)
-		addMappingLog(errMsg)
-		return fmt.Errorf(errMsg)
+	// 获取钉钉中全部家长-学生关系
+	remoteRelations, failCount := fetchAllClassRelations(classIDs)
+	report.FailedClassCount = failCount
+	if failCount > 0 {
+		return fmt.Errorf("部分班级(%d/%d)获取失败，未修改任何映射关系", failCount, len(classIDs))
+	}
+
+	// 获取数据库中现有的关系
+	localRelations, err := models.GetAllParentStudentRelations()
+	if err != nil {
+		return fmt.Errorf("获取现有映射关系失败: %v", err)
+	}
+
+	// 计算差异
+	diff := diffParentStudentRelations(localRelations, remoteRelations)
+	report.Details = diff
+	addMappingLog(fmt.Sprintf("差异计算完成。新增: %d, 删除: %d, 变更: %d",
+		len(diff.Added), len(diff.Removed), len(diff.Changed)))
+
+	// 预览模式或没有差异时不修改数据
+	if report.DryRun {
+		addMappingLog("预览模式，未应用任何修改")
+		return nil
+	}
+	if diff.IsEmpty() {
+		addMappingLog("映射关系已是最新，无需修改")
+		return nil
 	}
 
-	addMappingLog("已清空现有映射关系")
+	// 在单个事务中应用差异
+	if err := models.ApplyParentStudentRelationDiff(diff); err != nil {
+		return fmt.Errorf("应用映射关系差异失败: %v", err)
+	}
+
+	addMappingLog("家长-学生映射关系同步完成")
+	return nil
+}
 
+// fetchAllClassRelations 并发获取所有班级的家长-学生关系，返回关系列表和失败的班级数
+func fetchAllClassRelations(classIDs []string) ([]utils.DingTalkGuardianStudentRel, int) {
 	// 使用等待组但有限制并发数
 	var wg sync.WaitGroup
 	semaphore := make(chan struct{}, 2) // 最多2个并发请求，避免触发QPS限制
 
 	// 记录处理结果
-	successCount := 0
+	var allRelations []utils.DingTalkGuardianStudentRel
 	failCount := 0
-	relationCount := 0
 	var resultMutex sync.Mutex
 
 	// 遍历所有班级并获取家长-学生关系
@@ -128,56 +194,98 @@ func RebuildParentStudentMapping() error {
 			addMappingLog(fmt.Sprintf("正在处理班级 %s (%d/%d)", cid, index+1, len(classIDs)))
 			relations, err := utils.GetClassParentStudentRelations(cid)
 			if err != nil {
-				errMsg := fmt.Sprintf("获取班级 %s 的关系失败: %v", cid, err)
-				addMappingLog(errMsg)
+				addMappingLog(fmt.Sprintf("获取班级 %s 的关系失败: %v", cid, err))
 				resultMutex.Lock()
 				failCount++
 				resultMutex.Unlock()
 				return
 			}
 
-			if relations == nil || len(relations) == 0 {
-				addMappingLog(fmt.Sprintf("班级 %s (%d/%d) 没有家长-学生关系", cid, index+1, len(classIDs)))
-				return
-			}
-
-			// 保存本班级获取到的计数
-			localRelationCount := 0
-
-			// 保存获取到的关系
-			for _, rel := range relations {
-				// 保存关系到数据库
-				err := models.SaveParentStudentRelation(rel.GuardianUserID, rel.StudentUserId, rel.Relation)
-				if err != nil {
-					errMsg := fmt.Sprintf("保存关系失败 (家长: %s, 学生: %s): %v",
-						rel.GuardianUserID, rel.StudentUserId, err)
-					addMappingLog(errMsg)
-				} else {
-					localRelationCount++
-				}
-			}
-
 			resultMutex.Lock()
-			successCount++
-			relationCount += localRelationCount
+			allRelations = append(allRelations, relations...)
 			resultMutex.Unlock()
 
-			addMappingLog(fmt.Sprintf("班级 %s (%d/%d) 处理完成，保存了 %d 个关系",
-				cid, index+1, len(classIDs), localRelationCount))
+			addMappingLog(fmt.Sprintf("班级 %s (%d/%d) 获取完成，共 %d 个关系",
+				cid, index+1, len(classIDs), len(relations)))
 		}(classID, i)
 	}
 
 	// 等待所有操作完成
 	wg.Wait()
 
-	// 总结日志
-	summaryMsg := fmt.Sprintf("家长-学生映射关系重建完成。成功: %d 班级, 失败: %d 班级, 共创建 %d 个关系",
-		successCount, failCount, relationCount)
-	addMappingLog(summaryMsg)
+	return allRelations, failCount
+}
 
-	if failCount > 0 {
-		return fmt.Errorf("部分班级(%d/%d)处理失败", failCount, len(classIDs))
+// diffParentStudentRelations 比较本地与钉钉中的家长-学生关系
+// 同一家长与学生之间仅有一条关系且描述不同时视为变更，其余差异视为新增或删除
+func diffParentStudentRelations(local []*models.ParentStudentRelation, remote []utils.DingTalkGuardianStudentRel) *models.ParentStudentRelationDiff {
+	type pairKey struct{ parentID, studentID string }
+
+	// 按家长和学生分组
+	localPairs := make(map[pairKey]map[string]bool)
+	for _, rel := range local {
+		key := pairKey{rel.ParentID, rel.StudentID}
+		if localPairs[key] == nil {
+			localPairs[key] = make(map[string]bool)
+		}
+		localPairs[key][rel.Relation] = true
 	}
 
-	return nil
+	remotePairs := make(map[pairKey]map[string]bool)
+	var remoteOrder []pairKey
+	for _, rel := range remote {
+		key := pairKey{rel.GuardianUserID, rel.StudentUserId}
+		if remotePairs[key] == nil {
+			remotePairs[key] = make(map[string]bool)
+			remoteOrder = append(remoteOrder, key)
+		}
+		remotePairs[key][rel.Relation] = true
+	}
+
+	diff := &models.ParentStudentRelationDiff{
+		Added:   []*models.ParentStudentRelation{},
+		Removed: []*models.ParentStudentRelation{},
+		Changed: []*models.ParentStudentRelationChange{},
+	}
+
+	// 新增与变更
+	for _, key := range remoteOrder {
+		var added, removed []string
+		for relation := range remotePairs[key] {
+			if !localPairs[key][relation] {
+				added = append(added, relation)
+			}
+		}
+		for relation := range localPairs[key] {
+			if !remotePairs[key][relation] {
+				removed = append(removed, relation)
+			}
+		}
+
+		if len(added) == 1 && len(removed) == 1 {
+			diff.Changed = append(diff.Changed, &models.ParentStudentRelationChange{
+				ParentID:    key.parentID,
+				StudentID:   key.studentID,
+				OldRelation: removed[0],
+				NewRelation: added[0],
+			})
+			continue
+		}
+
+		for _, relation := range added {
+			diff.Added = append(diff.Added, &models.ParentStudentRelation{ParentID: key.parentID, StudentID: key.studentID, Relation: relation})
+		}
+		for _, relation := range removed {
+			diff.Removed = append(diff.Removed, &models.ParentStudentRelation{ParentID: key.parentID, StudentID: key.studentID, Relation: relation})
+		}
+	}
+
+	// 删除钉钉中已不存在的关系
+	for _, rel := range local {
+		if _, exists := remotePairs[pairKey{rel.ParentID, rel.StudentID}]; !exists {
+			diff.Removed = append(diff.Removed, rel)
+		}
+	}
+
+	return diff
 }
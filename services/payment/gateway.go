@@ -0,0 +1,106 @@
+// Package payment 定义支付网关接口：充值订单通过网关下单，支付结果通过异步回调通知，并可以主动查询用于对账。
+// 目前内置模拟网关，接入微信支付或支付宝时实现 Gateway 接口并通过 Register 注册即可。
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/config"
+)
+
+// 网关返回的支付状态
+const (
+	StatusPending  = "pending"   // 未支付
+	StatusPaid     = "paid"      // 支付成功
+	StatusFailed   = "failed"    // 支付失败
+	StatusNotFound = "not_found" // 网关中没有该订单，如未打开支付页面
+)
+
+// CreateRequest 下单请求，金额单位为分
+type CreateRequest struct {
+	OrderNo   string
+	Amount    int
+	Subject   string
+	NotifyURL string    // 支付结果回调地址
+	ExpireAt  time.Time // 订单过期时间
+}
+
+// CreateResult 下单结果
+type CreateResult struct {
+	PayURL string // 付款页面地址，由前端跳转
+}
+
+// Result 回调或查询得到的支付结果
+type Result struct {
+	OrderNo string
+	TradeNo string // 网关交易号
+	Status  string
+	Amount  int
+	PaidAt  time.Time
+	Reason  string // 失败原因
+}
+
+// Gateway 支付网关
+type Gateway interface {
+	// Name 网关名称，用于配置和回调地址
+	Name() string
+	// Create 下单，返回付款页面地址
+	Create(req CreateRequest) (*CreateResult, error)
+	// ParseNotify 校验回调签名并解析支付结果，签名无效时返回错误
+	ParseNotify(r *http.Request) (*Result, error)
+	// AckNotify 按网关要求应答回调，err 不为空时表示处理失败，网关会重试
+	AckNotify(w http.ResponseWriter, err error)
+	// Query 主动查询订单的支付结果，用于对账
+	Query(orderNo string) (*Result, error)
+}
+
+var (
+	gateways   = make(map[string]Gateway)
+	gatewaysMu sync.RWMutex
+)
+
+// Register 注册支付网关，同名网关会被替换
+func Register(gateway Gateway) {
+	gatewaysMu.Lock()
+	defer gatewaysMu.Unlock()
+	gateways[gateway.Name()] = gateway
+}
+
+// Get 获取已注册的支付网关
+func Get(name string) (Gateway, error) {
+	gatewaysMu.RLock()
+	defer gatewaysMu.RUnlock()
+	gateway, ok := gateways[name]
+	if !ok {
+		return nil, fmt.Errorf("不支持的支付网关：%s", name)
+	}
+	return gateway, nil
+}
+
+// Available 获取可以用于充值的支付网关，模拟网关只有启用 payment.allow_mock 时可用
+func Available(name string) (Gateway, error) {
+	if name == "" {
+		return nil, errors.New("未配置支付网关")
+	}
+	if name == MockName && !config.Get().Payment.AllowMock {
+		return nil, errors.New("模拟网关只能在开发环境中启用 payment.allow_mock 后使用")
+	}
+	return Get(name)
+}
+
+// Names 返回已注册的网关名称
+func Names() []string {
+	gatewaysMu.RLock()
+	defer gatewaysMu.RUnlock()
+	names := make([]string, 0, len(gateways))
+	for name := range gateways {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,245 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/config"
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+// MockName 模拟网关的名称
+const MockName = "mock"
+
+// 模拟的支付结果
+const (
+	MockResultSuccess = "success" // 支付成功并立即回调
+	MockResultFailure = "failure" // 支付失败并立即回调
+	MockResultDelayed = "delayed" // 支付成功，延迟回调
+	MockResultLost    = "lost"    // 支付成功但不回调，只能通过对账确认
+)
+
+// mockNotifyAttempts 回调失败时的最多尝试次数
+const mockNotifyAttempts = 3
+
+// mockOrder 模拟网关中的订单
+type mockOrder struct {
+	request CreateRequest
+	result  Result
+}
+
+// MockGateway 模拟支付网关，订单保存在内存中，通过付款页面选择支付结果后按与真实网关相同的方式签名回调
+type MockGateway struct {
+	mu     sync.Mutex
+	orders map[string]*mockOrder
+	client *http.Client
+	delay  time.Duration // 回调重试间隔
+}
+
+// NewMockGateway 创建模拟支付网关
+func NewMockGateway() *MockGateway {
+	return &MockGateway{
+		orders: make(map[string]*mockOrder),
+		client: &http.Client{Timeout: 10 * time.Second},
+		delay:  5 * time.Second,
+	}
+}
+
+func init() {
+	Register(NewMockGateway())
+}
+
+// Name 网关名称
+func (g *MockGateway) Name() string {
+	return MockName
+}
+
+// Create 记录订单，返回模拟的付款页面地址
+func (g *MockGateway) Create(req CreateRequest) (*CreateResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.orders[req.OrderNo] = &mockOrder{
+		request: req,
+		result:  Result{OrderNo: req.OrderNo, Status: StatusPending, Amount: req.Amount},
+	}
+	return &CreateResult{
+		PayURL: fmt.Sprintf("%s/api/payment/mock/pay?order_no=%s", config.Get().Website.Domain, url.QueryEscape(req.OrderNo)),
+	}, nil
+}
+
+// Order 获取模拟网关中的订单，用于显示付款页面
+func (g *MockGateway) Order(orderNo string) (CreateRequest, Result, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	order, ok := g.orders[orderNo]
+	if !ok {
+		return CreateRequest{}, Result{}, false
+	}
+	return order.request, order.result, true
+}
+
+// Simulate 模拟付款，delayed 时在 delay 后回调，lost 时不回调
+func (g *MockGateway) Simulate(orderNo, outcome string, delay time.Duration) error {
+	g.mu.Lock()
+	order, ok := g.orders[orderNo]
+	if !ok {
+		g.mu.Unlock()
+		return errors.New("订单不存在")
+	}
+	if order.result.Status != StatusPending {
+		g.mu.Unlock()
+		return errors.New("订单已支付或已失败")
+	}
+
+	// 更新订单状态
+	switch outcome {
+	case MockResultSuccess, MockResultDelayed, MockResultLost:
+		order.result.Status = StatusPaid
+		order.result.TradeNo = fmt.Sprintf("MOCK%d", time.Now().UnixNano())
+		order.result.PaidAt = time.Now()
+	case MockResultFailure:
+		order.result.Status = StatusFailed
+		order.result.Reason = "模拟支付失败"
+	default:
+		g.mu.Unlock()
+		return fmt.Errorf("无效的模拟结果：%s", outcome)
+	}
+	result := order.result
+	notifyURL := order.request.NotifyURL
+	g.mu.Unlock()
+
+	// 回调
+	switch outcome {
+	case MockResultLost:
+	case MockResultDelayed:
+		time.AfterFunc(delay, func() { g.notify(notifyURL, result) })
+	default:
+		go g.notify(notifyURL, result)
+	}
+
+	return nil
+}
+
+// notify 发送签名的回调，应答不是 success 时重试
+func (g *MockGateway) notify(notifyURL string, result Result) {
+	values := url.Values{}
+	values.Set("order_no", result.OrderNo)
+	values.Set("trade_no", result.TradeNo)
+	values.Set("status", result.Status)
+	values.Set("amount", strconv.Itoa(result.Amount))
+	values.Set("reason", result.Reason)
+	if !result.PaidAt.IsZero() {
+		values.Set("paid_at", strconv.FormatInt(result.PaidAt.Unix(), 10))
+	}
+	values.Set("sign", mockSign(values))
+
+	var lastErr error
+	for attempt := 1; attempt <= mockNotifyAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(g.delay)
+		}
+		resp, err := g.client.PostForm(notifyURL, values)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		if strings.TrimSpace(string(body)) == "success" {
+			return
+		}
+		lastErr = fmt.Errorf("应答：%s", strings.TrimSpace(string(body)))
+	}
+	utils.LogError(fmt.Sprintf("模拟网关回调订单 %s 失败: %v", result.OrderNo, lastErr))
+}
+
+// ParseNotify 校验签名并解析回调
+func (g *MockGateway) ParseNotify(r *http.Request) (*Result, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	values := r.PostForm
+	if !hmac.Equal([]byte(values.Get("sign")), []byte(mockSign(values))) {
+		return nil, errors.New("回调签名无效")
+	}
+
+	amount, err := strconv.Atoi(values.Get("amount"))
+	if err != nil {
+		return nil, errors.New("无效的金额")
+	}
+	result := &Result{
+		OrderNo: values.Get("order_no"),
+		TradeNo: values.Get("trade_no"),
+		Status:  values.Get("status"),
+		Amount:  amount,
+		Reason:  values.Get("reason"),
+	}
+	if paidAt, err := strconv.ParseInt(values.Get("paid_at"), 10, 64); err == nil {
+		result.PaidAt = time.Unix(paidAt, 0)
+	}
+	return result, nil
+}
+
+// AckNotify 处理成功时应答 success，否则应答 fail 以便重试
+func (g *MockGateway) AckNotify(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "fail: %v", err)
+		return
+	}
+	io.WriteString(w, "success")
+}
+
+// Query 查询订单的支付结果
+func (g *MockGateway) Query(orderNo string) (*Result, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	order, ok := g.orders[orderNo]
+	if !ok {
+		return &Result{OrderNo: orderNo, Status: StatusNotFound}, nil
+	}
+	result := order.result
+	return &result, nil
+}
+
+// mockSign 按参数名排序后拼接为 key=value&...，使用 HMAC-SHA256 签名，不包括 sign 本身
+// 未设置 payment.mock_secret 时使用 JWT 密钥派生的密钥
+func mockSign(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if key != "sign" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key + "=" + values.Get(key)
+	}
+
+	cfg := config.Get()
+	secret := cfg.Payment.MockSecret
+	if secret == "" {
+		derive := hmac.New(sha256.New, []byte(cfg.Security.JWTSecret))
+		derive.Write([]byte("mock-payment"))
+		secret = hex.EncodeToString(derive.Sum(nil))
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join(parts, "&")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
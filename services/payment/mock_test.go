@@ -0,0 +1,153 @@
+package payment
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/config"
+)
+
+// TestMain 在临时目录中使用默认配置运行测试，避免在源码目录中生成配置文件
+func TestMain(m *testing.M) {
+	os.Exit(runInTempDir(m))
+}
+
+func runInTempDir(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "canteen-payment-test")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chdir(dir); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if err := config.Load(); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return m.Run()
+}
+
+// signedNotify 返回签名后的回调参数
+func signedNotify(amount string) url.Values {
+	values := url.Values{}
+	values.Set("order_no", "P1")
+	values.Set("trade_no", "MOCK1")
+	values.Set("status", StatusPaid)
+	values.Set("amount", amount)
+	values.Set("paid_at", "1741568400")
+	values.Set("sign", mockSign(values))
+	return values
+}
+
+// notifyRequest 以回调的格式发送参数
+func notifyRequest(values url.Values) *http.Request {
+	req := httptest.NewRequest("POST", "/api/payment/notify/mock", strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func TestMockParseNotify(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  func() url.Values
+		wantErr bool
+	}{
+		{"valid", func() url.Values { return signedNotify("1000") }, false},
+		{"tampered amount", func() url.Values {
+			values := signedNotify("1000")
+			values.Set("amount", "100000")
+			return values
+		}, true},
+		{"tampered status", func() url.Values {
+			values := signedNotify("1000")
+			values.Set("status", StatusFailed)
+			return values
+		}, true},
+		{"added field", func() url.Values {
+			values := signedNotify("1000")
+			values.Set("reason", "x")
+			return values
+		}, true},
+		{"missing sign", func() url.Values {
+			values := signedNotify("1000")
+			values.Del("sign")
+			return values
+		}, true},
+		{"other secret", func() url.Values {
+			payment := &config.Get().Payment
+			saved := payment.MockSecret
+			payment.MockSecret = "other-secret"
+			defer func() { payment.MockSecret = saved }()
+			return signedNotify("1000")
+		}, true},
+		{"invalid amount", func() url.Values { return signedNotify("ten") }, true},
+	}
+	gateway := NewMockGateway()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := gateway.ParseNotify(notifyRequest(tt.values()))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseNotify = %+v, %v, want error %v", result, err, tt.wantErr)
+			}
+			if err == nil && (result.OrderNo != "P1" || result.Status != StatusPaid || result.Amount != 1000 || result.PaidAt.Unix() != 1741568400) {
+				t.Errorf("result = %+v", result)
+			}
+		})
+	}
+}
+
+func TestMockGatewayNotify(t *testing.T) {
+	gateway := NewMockGateway()
+	gateway.delay = time.Millisecond
+
+	// 前两次应答失败，第三次成功
+	results := make(chan *Result, mockNotifyAttempts)
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		result, err := gateway.ParseNotify(r)
+		if err == nil && attempts < mockNotifyAttempts {
+			err = fmt.Errorf("attempt %d", attempts)
+		}
+		if err == nil {
+			results <- result
+		}
+		gateway.AckNotify(w, err)
+	}))
+	defer server.Close()
+
+	if _, err := gateway.Create(CreateRequest{OrderNo: "P1", Amount: 1000, NotifyURL: server.URL}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := gateway.Simulate("P1", MockResultSuccess, 0); err != nil {
+		t.Fatalf("simulate: %v", err)
+	}
+	select {
+	case result := <-results:
+		if result.OrderNo != "P1" || result.Status != StatusPaid || result.Amount != 1000 || result.TradeNo == "" {
+			t.Errorf("notified result = %+v", result)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no successful notify")
+	}
+
+	// 已支付的订单不能再次模拟
+	if err := gateway.Simulate("P1", MockResultFailure, 0); err == nil {
+		t.Errorf("simulate paid order: expected error")
+	}
+	if result, err := gateway.Query("P1"); err != nil || result.Status != StatusPaid {
+		t.Errorf("query = %+v, %v", result, err)
+	}
+	if result, err := gateway.Query("P2"); err != nil || result.Status != StatusNotFound {
+		t.Errorf("query missing order = %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/config"
+	"github.com/itsHenry35/canteen-management-system/models"
+	"github.com/itsHenry35/canteen-management-system/services/payment"
+)
+
+// ErrPaymentDisabled 未启用在线充值
+var ErrPaymentDisabled = errors.New("未启用在线充值")
+
+// TopUpOrder 充值下单结果
+type TopUpOrder struct {
+	Order  *models.PaymentOrder `json:"order"`
+	PayURL string               `json:"pay_url"` // 付款页面地址，由前端跳转
+}
+
+// CreateTopUpOrder 为学生创建充值订单并向支付网关下单，金额单位为分
+func CreateTopUpOrder(studentID, amount int, operator string) (*TopUpOrder, error) {
+	cfg := config.Get()
+	if !cfg.Payment.Enabled {
+		return nil, ErrPaymentDisabled
+	}
+
+	// 检查金额
+	if amount < cfg.Payment.MinAmount || amount > cfg.Payment.MaxAmount {
+		return nil, fmt.Errorf("充值金额必须在 %s 元到 %s 元之间",
+			models.FormatAmount(cfg.Payment.MinAmount), models.FormatAmount(cfg.Payment.MaxAmount))
+	}
+
+	// 获取支付网关
+	gateway, err := payment.Available(cfg.Payment.Gateway)
+	if err != nil {
+		return nil, err
+	}
+
+	// 创建订单
+	order, err := models.CreatePaymentOrder(studentID, amount, gateway.Name(), operator)
+	if err != nil {
+		return nil, err
+	}
+
+	// 向网关下单，失败时将订单标记为失败
+	result, err := gateway.Create(payment.CreateRequest{
+		OrderNo:   order.OrderNo,
+		Amount:    order.Amount,
+		Subject:   cfg.Website.Name + " 餐费充值",
+		NotifyURL: fmt.Sprintf("%s/api/payment/notify/%s", cfg.Website.Domain, gateway.Name()),
+		ExpireAt:  order.CreatedAt.Add(time.Duration(cfg.Payment.OrderExpireMinutes) * time.Minute),
+	})
+	if err != nil {
+		if markErr := models.MarkPaymentOrderFailed(order.OrderNo, err.Error()); markErr != nil {
+			log.Printf("标记订单 %s 失败时出错: %v", order.OrderNo, markErr)
+		}
+		return nil, fmt.Errorf("下单失败: %v", err)
+	}
+
+	return &TopUpOrder{Order: order, PayURL: result.PayURL}, nil
+}
+
+// ApplyPaymentResult 根据网关回调或查询得到的支付结果更新订单，支付成功时记入余额
+// 同一结果重复处理不会重复入账
+func ApplyPaymentResult(gatewayName string, result *payment.Result) (*models.PaymentOrder, error) {
+	order, err := models.GetPaymentOrderByNo(result.OrderNo)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, errors.New("订单不存在")
+		}
+		return nil, err
+	}
+	if order.Gateway != gatewayName {
+		return nil, errors.New("订单不属于该支付网关")
+	}
+
+	switch result.Status {
+	case payment.StatusPaid:
+		paid, credited, err := models.MarkPaymentOrderPaid(order.OrderNo, result.TradeNo, result.Amount, result.PaidAt)
+		if err != nil {
+			return nil, err
+		}
+		if credited {
+			log.Printf("充值订单 %s 支付成功，已为学生ID=%d 充值 %s 元", paid.OrderNo, paid.StudentID, models.FormatAmount(paid.Amount))
+		}
+		return paid, nil
+	case payment.StatusFailed:
+		if err := models.MarkPaymentOrderFailed(order.OrderNo, result.Reason); err != nil {
+			return nil, err
+		}
+		return models.GetPaymentOrderByNo(order.OrderNo)
+	}
+
+	// 未支付或网关中没有该订单时不做修改
+	return order, nil
+}
+
+// ReconcilePaymentOrders 对账：向网关查询所有待支付订单的结果，补记丢失回调的订单，关闭超时未支付的订单
+// 返回状态发生变化的订单数
+func ReconcilePaymentOrders() (int, error) {
+	orders, err := models.GetPendingPaymentOrders()
+	if err != nil {
+		return 0, fmt.Errorf("获取待支付订单失败: %v", err)
+	}
+
+	expire := time.Duration(config.Get().Payment.OrderExpireMinutes) * time.Minute
+	count := 0
+	var failed []string
+	for _, order := range orders {
+		// 查询支付结果
+		gateway, err := payment.Get(order.Gateway)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s(%v)", order.OrderNo, err))
+			continue
+		}
+		result, err := gateway.Query(order.OrderNo)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s(%v)", order.OrderNo, err))
+			continue
+		}
+
+		// 已支付或已失败时按结果更新订单
+		if result.Status == payment.StatusPaid || result.Status == payment.StatusFailed {
+			updated, err := ApplyPaymentResult(order.Gateway, result)
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("%s(%v)", order.OrderNo, err))
+				continue
+			}
+			if updated.Status != models.PaymentStatusPending {
+				count++
+			}
+			continue
+		}
+
+		// 超时未支付的订单关闭
+		if time.Since(order.CreatedAt) > expire {
+			if err := models.ClosePaymentOrder(order.OrderNo, "超时未支付"); err != nil {
+				failed = append(failed, fmt.Sprintf("%s(%v)", order.OrderNo, err))
+				continue
+			}
+			count++
+		}
+	}
+
+	if len(failed) > 0 {
+		return count, fmt.Errorf("部分订单对账失败: %s", strings.Join(failed, "；"))
+	}
+	return count, nil
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/config"
+	"github.com/itsHenry35/canteen-management-system/database"
+	"github.com/itsHenry35/canteen-management-system/models"
+	"github.com/itsHenry35/canteen-management-system/services/payment"
+)
+
+// newPaymentStudent 清空充值相关数据，启用模拟网关的在线充值并创建一个学生，测试结束时恢复设置
+func newPaymentStudent(t *testing.T, expireMinutes int) *models.Student {
+	t.Helper()
+
+	for _, table := range []string{"payment_orders", "wallet_transactions", "student_wallets", "meal_selections", "parent_student_relations", "students"} {
+		if _, err := database.GetDB().Exec("DELETE FROM " + table); err != nil {
+			t.Fatalf("clear %s: %v", table, err)
+		}
+	}
+
+	cfg := &config.Get().Payment
+	saved := *cfg
+	cfg.Enabled = true
+	cfg.Gateway = payment.MockName
+	cfg.AllowMock = true
+	cfg.OrderExpireMinutes = expireMinutes
+	t.Cleanup(func() { *cfg = saved })
+
+	student, err := models.CreateStudent("张三", "七年级1班", "")
+	if err != nil {
+		t.Fatalf("create student: %v", err)
+	}
+	return student
+}
+
+// wantStudentBalance 检查学生的余额
+func wantStudentBalance(t *testing.T, studentID, want int) {
+	t.Helper()
+
+	if balance, err := models.GetWalletBalance(studentID); err != nil || balance != want {
+		t.Errorf("balance = %d, %v, want %d", balance, err, want)
+	}
+}
+
+func TestMarkPaymentOrderPaidIdempotent(t *testing.T) {
+	student := newPaymentStudent(t, 30)
+	topUp, err := CreateTopUpOrder(student.ID, 1000, "张三")
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	orderNo := topUp.Order.OrderNo
+
+	// 金额不一致时不入账
+	if _, _, err := models.MarkPaymentOrderPaid(orderNo, "T1", 999, time.Now()); err == nil {
+		t.Errorf("mark paid with wrong amount: expected error")
+	}
+	wantStudentBalance(t, student.ID, 0)
+
+	// 并发的回调和对账只有一个入账
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	credited := 0
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ok, err := models.MarkPaymentOrderPaid(orderNo, "T1", 1000, time.Now())
+			if err != nil {
+				t.Errorf("mark paid: %v", err)
+			}
+			if ok {
+				mu.Lock()
+				credited++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if credited != 1 {
+		t.Errorf("credited %d times, want 1", credited)
+	}
+	wantStudentBalance(t, student.ID, 1000)
+
+	// 已支付的订单重复回调、回调失败都不修改
+	tests := []struct {
+		name   string
+		result *payment.Result
+	}{
+		{"repeated paid", &payment.Result{OrderNo: orderNo, TradeNo: "T1", Status: payment.StatusPaid, Amount: 1000}},
+		{"failed after paid", &payment.Result{OrderNo: orderNo, Status: payment.StatusFailed, Reason: "失败"}},
+		{"pending after paid", &payment.Result{OrderNo: orderNo, Status: payment.StatusPending}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := ApplyPaymentResult(payment.MockName, tt.result)
+			if err != nil || order.Status != models.PaymentStatusPaid || order.WalletTransactionID == 0 {
+				t.Errorf("apply = %+v, %v", order, err)
+			}
+			wantStudentBalance(t, student.ID, 1000)
+		})
+	}
+
+	// 其他网关的回调不能修改订单
+	if _, err := ApplyPaymentResult("other", tests[0].result); err == nil {
+		t.Errorf("apply from other gateway: expected error")
+	}
+}
+
+func TestReconcilePaymentOrders(t *testing.T) {
+	tests := []struct {
+		name          string
+		outcome       string // 模拟网关中的支付结果，为空时不打开付款页面
+		expireMinutes int
+		wantStatus    string
+		wantBalance   int
+	}{
+		{"lost callback", payment.MockResultLost, 30, models.PaymentStatusPaid, 1000},
+		{"lost callback after expiry", payment.MockResultLost, 0, models.PaymentStatusPaid, 1000},
+		{"pending within expiry", "", 30, models.PaymentStatusPending, 0},
+		{"pending after expiry", "", 0, models.PaymentStatusClosed, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			student := newPaymentStudent(t, tt.expireMinutes)
+			topUp, err := CreateTopUpOrder(student.ID, 1000, "张三")
+			if err != nil {
+				t.Fatalf("create order: %v", err)
+			}
+			if tt.outcome != "" {
+				gateway, _ := payment.Get(payment.MockName)
+				if err := gateway.(*payment.MockGateway).Simulate(topUp.Order.OrderNo, tt.outcome, 0); err != nil {
+					t.Fatalf("simulate: %v", err)
+				}
+			}
+			time.Sleep(time.Millisecond)
+
+			count, err := ReconcilePaymentOrders()
+			if err != nil {
+				t.Fatalf("reconcile: %v", err)
+			}
+			wantCount := 1
+			if tt.wantStatus == models.PaymentStatusPending {
+				wantCount = 0
+			}
+			if count != wantCount {
+				t.Errorf("reconciled %d orders, want %d", count, wantCount)
+			}
+			order, err := models.GetPaymentOrderByNo(topUp.Order.OrderNo)
+			if err != nil || order.Status != tt.wantStatus {
+				t.Errorf("order after reconcile = %+v, %v, want %s", order, err, tt.wantStatus)
+			}
+			wantStudentBalance(t, student.ID, tt.wantBalance)
+
+			// 再次对账不重复入账
+			if _, err := ReconcilePaymentOrders(); err != nil {
+				t.Fatalf("reconcile again: %v", err)
+			}
+			wantStudentBalance(t, student.ID, tt.wantBalance)
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/itsHenry35/canteen-management-system/models"
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+// 学生名单同步的触发方式
+const (
+	RosterSyncSourceManual    = "manual"    // 管理员手动触发
+	RosterSyncSourceScheduler = "scheduler" // 定时任务触发
+	RosterSyncSourceCallback  = "callback"  // 钉钉事件推送触发
+)
+
+// 学生名单同步日志与状态
+var (
+	rosterLogs      []string
+	rosterLogMutex  sync.Mutex
+	isSyncingRoster bool
+	rosterSyncMutex sync.Mutex
+)
+
+// GetRosterSyncLogs 获取最近一次学生名单同步的日志
+func GetRosterSyncLogs() []string {
+	rosterLogMutex.Lock()
+	defer rosterLogMutex.Unlock()
+
+	// 返回日志副本，而不是直接返回引用
+	logs := make([]string, len(rosterLogs))
+	copy(logs, rosterLogs)
+	return logs
+}
+
+// IsSyncingRoster 检查是否正在同步学生名单
+func IsSyncingRoster() bool {
+	rosterSyncMutex.Lock()
+	defer rosterSyncMutex.Unlock()
+	return isSyncingRoster
+}
+
+// addRosterLog 添加学生名单同步日志
+func addRosterLog(message string) {
+	rosterLogMutex.Lock()
+	defer rosterLogMutex.Unlock()
+
+	// 添加时间戳
+	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	rosterLogs = append(rosterLogs, fmt.Sprintf("[%s] %s", timestamp, message))
+
+	// 同时输出到标准日志
+	log.Println(message)
+}
+
+// SyncStudentRoster 根据钉钉家校通讯录的班级成员同步学生名单
+// 按钉钉ID匹配学生：新出现的学生会被创建，姓名或班级变化的学生会被更新，
+// 已不在任何班级中的学生会被归档。任一部门或班级获取失败时不做任何修改。
+func SyncStudentRoster(dryRun bool, source string) (*models.RosterSyncReport, error) {
+	// 检查是否已经在同步
+	rosterSyncMutex.Lock()
+	if isSyncingRoster {
+		rosterSyncMutex.Unlock()
+		return nil, fmt.Errorf("学生名单同步已在进行中，请等待完成")
+	}
+	isSyncingRoster = true
+	rosterSyncMutex.Unlock()
+
+	// 函数结束时复位状态
+	defer func() {
+		rosterSyncMutex.Lock()
+		isSyncingRoster = false
+		rosterSyncMutex.Unlock()
+	}()
+
+	// 清除之前的日志
+	rosterLogMutex.Lock()
+	rosterLogs = []string{}
+	rosterLogMutex.Unlock()
+
+	// 创建同步报告
+	report, err := models.CreateRosterSyncReport(dryRun, source)
+	if err != nil {
+		errMsg := fmt.Sprintf("创建同步报告失败: %v", err)
+		addRosterLog(errMsg)
+		return nil, errors.New(errMsg)
+	}
+
+	// 记录开始
+	if dryRun {
+		addRosterLog("开始预览学生名单差异（不会修改数据）")
+	} else {
+		addRosterLog("开始同步学生名单")
+	}
+
+	// 同步并保存报告
+	syncErr := syncStudentRoster(report)
+	if syncErr != nil {
+		report.Status = models.SyncStatusFailed
+		report.Error = syncErr.Error()
+		addRosterLog(syncErr.Error())
+	} else {
+		report.Status = models.SyncStatusSuccess
+	}
+
+	if err := models.FinishRosterSyncReport(report); err != nil {
+		addRosterLog(fmt.Sprintf("保存同步报告失败: %v", err))
+	}
+
+	return report, syncErr
+}
+
+// syncStudentRoster 获取钉钉中的班级成员并应用差异，结果写入报告
+func syncStudentRoster(report *models.RosterSyncReport) error {
+	// 获取所有班级，部门树未完整获取时直接返回，避免归档缺失班级的学生
+	classes, err := utils.GetAllClasses(addRosterLog)
+	if err != nil {
+		return fmt.Errorf("获取班级列表失败: %v", err)
+	}
+	if len(classes) == 0 {
+		return errors.New("未获取到任何班级，未修改任何学生信息")
+	}
+
+	report.ClassCount = len(classes)
+	addRosterLog(fmt.Sprintf("共获取到 %d 个班级需要处理", len(classes)))
+
+	// 获取钉钉中所有班级的学生
+	remoteStudents, failCount := fetchAllClassStudents(classes)
+	report.FailedClassCount = failCount
+	if failCount > 0 {
+		return fmt.Errorf("部分班级(%d/%d)获取失败，未修改任何学生信息", failCount, len(classes))
+	}
+
+	// 获取数据库中的学生（包括已归档）
+	localStudents, err := models.GetStudentsIncludingArchived()
+	if err != nil {
+		return fmt.Errorf("获取现有学生失败: %v", err)
+	}
+
+	// 计算差异
+	diff := diffStudentRoster(localStudents, remoteStudents, true)
+	report.Details = diff
+	addRosterLog(fmt.Sprintf("差异计算完成。新建: %d, 更新: %d, 归档: %d",
+		len(diff.Created), len(diff.Updated), len(diff.Archived)))
+
+	// 预览模式或没有差异时不修改数据
+	if report.DryRun {
+		addRosterLog("预览模式，未应用任何修改")
+		return nil
+	}
+	if diff.IsEmpty() {
+		addRosterLog("学生名单已是最新，无需修改")
+		return nil
+	}
+
+	// 在单个事务中应用差异
+	if err := models.ApplyStudentRosterDiff(diff); err != nil {
+		return fmt.Errorf("应用学生名单差异失败: %v", err)
+	}
+
+	addRosterLog("学生名单同步完成")
+	return nil
+}
+
+// rosterStudent 钉钉中的学生及其所在班级名称
+type rosterStudent struct {
+	utils.DingTalkStudent
+	ClassName string
+}
+
+// fetchAllClassStudents 并发获取所有班级的学生，返回学生列表和失败的班级数
+func fetchAllClassStudents(classes []utils.DingTalkClass) ([]rosterStudent, int) {
+	// 使用等待组但有限制并发数
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, 2) // 最多2个并发请求，避免触发QPS限制
+
+	// 记录处理结果
+	var allStudents []rosterStudent
+	failCount := 0
+	var resultMutex sync.Mutex
+
+	for i, class := range classes {
+		wg.Add(1)
+		semaphore <- struct{}{} // 占用一个并发槽
+
+		go func(class utils.DingTalkClass, index int) {
+			defer wg.Done()
+			defer func() { <-semaphore }() // 释放并发槽
+
+			addRosterLog(fmt.Sprintf("正在处理班级 %s (%d/%d)", class.Name, index+1, len(classes)))
+			students, err := utils.GetClassStudents(class.ID)
+			if err != nil {
+				addRosterLog(fmt.Sprintf("获取班级 %s 的学生失败: %v", class.Name, err))
+				resultMutex.Lock()
+				failCount++
+				resultMutex.Unlock()
+				return
+			}
+
+			resultMutex.Lock()
+			for _, student := range students {
+				allStudents = append(allStudents, rosterStudent{DingTalkStudent: student, ClassName: class.Name})
+			}
+			resultMutex.Unlock()
+
+			addRosterLog(fmt.Sprintf("班级 %s (%d/%d) 获取完成，共 %d 名学生",
+				class.Name, index+1, len(classes), len(students)))
+		}(class, i)
+	}
+
+	// 等待所有操作完成
+	wg.Wait()
+
+	return allStudents, failCount
+}
+
+// diffStudentRoster 按钉钉ID比较本地与钉钉中的学生；archiveMissing 为 true 时归档钉钉中已不存在的学生
+// 没有钉钉ID的学生（手动创建）不参与比较
+func diffStudentRoster(local []*models.Student, remote []rosterStudent, archiveMissing bool) *models.StudentRosterDiff {
+	// 按钉钉ID索引本地学生
+	localByDingTalkID := make(map[string]*models.Student)
+	for _, student := range local {
+		if student.DingTalkID == "" || student.DingTalkID == "0" {
+			continue
+		}
+		if _, exists := localByDingTalkID[student.DingTalkID]; !exists {
+			localByDingTalkID[student.DingTalkID] = student
+		}
+	}
+
+	diff := &models.StudentRosterDiff{
+		Created:  []*models.Student{},
+		Updated:  []*models.StudentRosterUpdate{},
+		Archived: []*models.Student{},
+	}
+
+	// 新建与更新
+	seen := make(map[string]bool)
+	for _, remoteStudent := range remote {
+		// 同一学生出现在多个班级时只处理第一次
+		if seen[remoteStudent.UserID] {
+			continue
+		}
+		seen[remoteStudent.UserID] = true
+
+		student, exists := localByDingTalkID[remoteStudent.UserID]
+		if !exists {
+			diff.Created = append(diff.Created, &models.Student{
+				FullName:   remoteStudent.Name,
+				Class:      remoteStudent.ClassName,
+				DingTalkID: remoteStudent.UserID,
+			})
+			continue
+		}
+
+		if student.FullName != remoteStudent.Name || student.Class != remoteStudent.ClassName || student.Archived {
+			diff.Updated = append(diff.Updated, &models.StudentRosterUpdate{
+				StudentID:   student.ID,
+				DingTalkID:  student.DingTalkID,
+				OldFullName: student.FullName,
+				NewFullName: remoteStudent.Name,
+				OldClass:    student.Class,
+				NewClass:    remoteStudent.ClassName,
+				Restored:    student.Archived,
+			})
+		}
+	}
+
+	// 归档钉钉中已不存在的学生
+	if archiveMissing {
+		for dingTalkID, student := range localByDingTalkID {
+			if !seen[dingTalkID] && !student.Archived {
+				diff.Archived = append(diff.Archived, student)
+			}
+		}
+	}
+
+	return diff
+}
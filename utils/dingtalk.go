@@ -7,181 +7,310 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/itsHenry35/canteen-management-system/config"
 )
 
+// DefaultDingTalkBaseURL 钉钉开放平台默认接口地址
+const DefaultDingTalkBaseURL = "https://oapi.dingtalk.com"
+
 // DingTalkToken 钉钉访问令牌结构
 type DingTalkToken struct {
 	AccessToken string `json:"access_token"`
 	ExpiresIn   int    `json:"expires_in"`
 	ExpiresAt   time.Time
+	AppKey      string `json:"-"` // 获取令牌时使用的AppKey，配置变更后令牌失效
+}
+
+// DingTalkClient 钉钉接口客户端
+type DingTalkClient struct {
+	BaseURL         string        // 接口地址，为空时使用 DefaultDingTalkBaseURL
+	HTTPClient      *http.Client  // 发送请求使用的HTTP客户端
+	MaxRetries      int           // 最大重试次数
+	RetryBackoff    time.Duration // 首次重试前的等待时间，之后每次翻倍
+	RequestInterval time.Duration // 分页接口每次请求前的等待时间，避免QPS限制
+	BatchInterval   time.Duration // 分批发送消息之间的等待时间
+
+	tokenMutex sync.Mutex
+	token      *DingTalkToken
+}
+
+// dingTalkResult 钉钉接口通用返回字段
+type dingTalkResult struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
 }
 
 var (
-	dingTalkToken *DingTalkToken
+	defaultDingTalkClient *DingTalkClient
+	dingTalkClientMutex   sync.Mutex
 )
 
+// NewDingTalkClient 创建钉钉接口客户端
+func NewDingTalkClient(baseURL string, httpClient *http.Client) *DingTalkClient {
+	if baseURL == "" {
+		baseURL = DefaultDingTalkBaseURL
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &DingTalkClient{
+		BaseURL:         strings.TrimRight(baseURL, "/"),
+		HTTPClient:      httpClient,
+		MaxRetries:      3,
+		RetryBackoff:    500 * time.Millisecond,
+		RequestInterval: 500 * time.Millisecond,
+		BatchInterval:   1000 * time.Millisecond,
+	}
+}
+
+// GetDingTalkClient 获取全局钉钉客户端，首次调用时按配置创建
+func GetDingTalkClient() *DingTalkClient {
+	dingTalkClientMutex.Lock()
+	defer dingTalkClientMutex.Unlock()
+
+	if defaultDingTalkClient == nil {
+		defaultDingTalkClient = NewDingTalkClient(config.Get().DingTalk.BaseURL, nil)
+	}
+	return defaultDingTalkClient
+}
+
+// SetDingTalkClient 替换全局钉钉客户端（用于测试或切换接口地址）
+func SetDingTalkClient(client *DingTalkClient) {
+	dingTalkClientMutex.Lock()
+	defer dingTalkClientMutex.Unlock()
+	defaultDingTalkClient = client
+}
+
 // GetDingTalkToken 获取钉钉访问令牌
 func GetDingTalkToken() (string, error) {
-	// 检查令牌是否存在且有效
-	if dingTalkToken != nil && time.Now().Before(dingTalkToken.ExpiresAt) {
-		return dingTalkToken.AccessToken, nil
-	}
+	return GetDingTalkClient().GetToken()
+}
 
-	// 获取配置
-	cfg := config.Get()
-	appKey := cfg.DingTalk.AppKey
-	appSecret := cfg.DingTalk.AppSecret
+// GetDingTalkUserInfo 获取钉钉用户信息
+func GetDingTalkUserInfo(code string) (*DingTalkUserInfo, error) {
+	return GetDingTalkClient().GetUserInfo(code)
+}
 
-	// 检查配置是否完整
-	if appKey == "" || appSecret == "" {
-		return "", fmt.Errorf("钉钉配置不完整")
+// GetAllClassIDs 获取所有班级的ID
+func GetAllClassIDs(addMappingLog func(string)) ([]string, error) {
+	return GetDingTalkClient().GetAllClassIDs(addMappingLog)
+}
+
+// GetAllClasses 获取所有班级
+func GetAllClasses(addLog func(string)) ([]DingTalkClass, error) {
+	return GetDingTalkClient().GetAllClasses(addLog)
+}
+
+// GetClassStudents 获取指定班级的所有学生
+func GetClassStudents(classID string) ([]DingTalkStudent, error) {
+	return GetDingTalkClient().GetClassStudents(classID)
+}
+
+// GetClassParentStudentRelations 获取指定班级的所有家长-学生关系
+func GetClassParentStudentRelations(classID string) ([]DingTalkGuardianStudentRel, error) {
+	return GetDingTalkClient().GetClassParentStudentRelations(classID)
+}
+
+// SendDingTalkActionCard 发送钉钉卡片消息
+func SendDingTalkActionCard(userIDs []string, card ActionCardMessage) error {
+	return GetDingTalkClient().SendActionCard(userIDs, card)
+}
+
+// backoff 重试前等待，等待时间随着重试次数增加而增加 (500ms, 1000ms, 2000ms)
+func (c *DingTalkClient) backoff(attempt int, action string) {
+	backoffTime := c.RetryBackoff * time.Duration(1<<uint(attempt-1))
+	time.Sleep(backoffTime)
+	log.Printf("重试%s，第 %d 次尝试, 等待时间: %v", action, attempt+1, backoffTime)
+}
+
+// call 调用钉钉接口，遇到网络错误或QPS超限时自动重试，成功时将响应解析到 result
+// result 必须内嵌 dingTalkResult 字段以便检查错误码
+func (c *DingTalkClient) call(method, path string, query url.Values, payload interface{}, action string, result interface{}) (dingTalkResult, error) {
+	// 编码请求数据
+	var jsonData []byte
+	if payload != nil {
+		var err error
+		jsonData, err = json.Marshal(payload)
+		if err != nil {
+			return dingTalkResult{}, fmt.Errorf("编码请求失败: %v", err)
+		}
 	}
 
 	// 请求URL
-	url := fmt.Sprintf("https://oapi.dingtalk.com/gettoken?appkey=%s&appsecret=%s", appKey, appSecret)
+	requestURL := c.BaseURL + path
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
 
-	// 最大重试次数
-	maxRetries := 3
 	var lastErr error
+	var status dingTalkResult
 
-	for attempt := 0; attempt < maxRetries; attempt++ {
+	for attempt := 0; attempt < c.MaxRetries; attempt++ {
 		// 如果不是第一次尝试，等待一段时间再重试
 		if attempt > 0 {
-			backoffTime := time.Duration(500*1<<uint(attempt-1)) * time.Millisecond
-			time.Sleep(backoffTime)
-			log.Printf("重试获取钉钉访问令牌，第 %d 次尝试, 等待时间: %v", attempt+1, backoffTime)
+			c.backoff(attempt, action)
+		}
+
+		// 构建请求
+		var body io.Reader
+		if jsonData != nil {
+			body = bytes.NewReader(jsonData)
+		}
+		req, err := http.NewRequest(method, requestURL, body)
+		if err != nil {
+			lastErr = fmt.Errorf("创建请求失败: %v", err)
+			continue
+		}
+		if jsonData != nil {
+			req.Header.Set("Content-Type", "application/json")
 		}
 
 		// 发送请求
-		resp, err := http.Get(url)
+		resp, err := c.HTTPClient.Do(req)
 		if err != nil {
-			lastErr = fmt.Errorf("failed to request DingTalk token: %v", err)
+			lastErr = fmt.Errorf("发送请求失败: %v", err)
 			continue
 		}
 
 		// 读取响应
-		body, err := io.ReadAll(resp.Body)
+		respBody, err := io.ReadAll(resp.Body)
 		resp.Body.Close()
 		if err != nil {
-			lastErr = fmt.Errorf("failed to read response: %v", err)
+			lastErr = fmt.Errorf("读取响应失败: %v", err)
 			continue
 		}
 
 		// 解析响应
-		var result struct {
-			ErrCode     int    `json:"errcode"`
-			ErrMsg      string `json:"errmsg"`
-			AccessToken string `json:"access_token"`
-			ExpiresIn   int    `json:"expires_in"`
-		}
-		if err := json.Unmarshal(body, &result); err != nil {
-			lastErr = fmt.Errorf("failed to parse response: %v", err)
+		status = dingTalkResult{}
+		if err := json.Unmarshal(respBody, &status); err != nil {
+			lastErr = fmt.Errorf("解析响应失败: %v", err)
 			continue
 		}
 
 		// 如果是QPS超限错误，进行重试
-		if result.ErrCode == 88 || result.ErrCode == -1 {
-			lastErr = fmt.Errorf("DingTalk API QPS limit: %s (code: %d)", result.ErrMsg, result.ErrCode)
+		if status.ErrCode == 88 || status.ErrCode == -1 {
+			lastErr = fmt.Errorf("DingTalk API QPS limit: %s (code: %d)", status.ErrMsg, status.ErrCode)
 			continue
 		}
 
-		// 检查响应是否成功
-		if result.ErrCode != 0 {
-			return "", fmt.Errorf("DingTalk API error: %s (code: %d)", result.ErrMsg, result.ErrCode)
-		}
-
-		// 保存令牌
-		dingTalkToken = &DingTalkToken{
-			AccessToken: result.AccessToken,
-			ExpiresIn:   result.ExpiresIn,
-			ExpiresAt:   time.Now().Add(time.Second * time.Duration(result.ExpiresIn-60)), // 提前60秒过期
+		if result != nil {
+			if err := json.Unmarshal(respBody, result); err != nil {
+				return status, fmt.Errorf("解析响应失败: %v", err)
+			}
 		}
 
-		return dingTalkToken.AccessToken, nil
+		return status, nil
 	}
 
-	return "", fmt.Errorf("获取钉钉访问令牌失败，已重试 %d 次: %v", maxRetries, lastErr)
+	return status, fmt.Errorf("%s失败，已重试 %d 次: %v", action, c.MaxRetries, lastErr)
 }
 
-// GetDingTalkUserInfo 获取钉钉用户信息
-func GetDingTalkUserInfo(code string) (*DingTalkUserInfo, error) {
-	// 最大重试次数
-	maxRetries := 3
-	var lastErr error
+// GetToken 获取钉钉访问令牌，令牌在有效期内复用
+func (c *DingTalkClient) GetToken() (string, error) {
+	// 获取配置
+	cfg := config.Get()
+	appKey := cfg.DingTalk.AppKey
+	appSecret := cfg.DingTalk.AppSecret
 
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		// 如果不是第一次尝试，等待一段时间再重试
-		// 等待时间随着重试次数增加而增加 (500ms, 1000ms, 2000ms)
-		if attempt > 0 {
-			backoffTime := time.Duration(500*1<<uint(attempt-1)) * time.Millisecond
-			time.Sleep(backoffTime)
-			log.Printf("重试获取钉钉用户信息，第 %d 次尝试, 等待时间: %v", attempt+1, backoffTime)
-		}
+	// 检查配置是否完整
+	if appKey == "" || appSecret == "" {
+		return "", fmt.Errorf("钉钉配置不完整")
+	}
 
-		// 获取访问令牌
-		accessToken, err := GetDingTalkToken()
-		if err != nil {
-			lastErr = err
-			continue
-		}
+	c.tokenMutex.Lock()
+	defer c.tokenMutex.Unlock()
 
-		// 请求URL
-		url := fmt.Sprintf("https://oapi.dingtalk.com/user/getuserinfo?access_token=%s&code=%s", accessToken, code)
+	// 检查令牌是否存在且有效
+	if c.token != nil && c.token.AppKey == appKey && time.Now().Before(c.token.ExpiresAt) {
+		return c.token.AccessToken, nil
+	}
 
-		// 发送请求
-		resp, err := http.Get(url)
-		if err != nil {
-			lastErr = fmt.Errorf("failed to request DingTalk user info: %v", err)
-			continue
-		}
+	var result struct {
+		dingTalkResult
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	query := url.Values{}
+	query.Set("appkey", appKey)
+	query.Set("appsecret", appSecret)
+	status, err := c.call(http.MethodGet, "/gettoken", query, nil, "获取钉钉访问令牌", &result)
+	if err != nil {
+		return "", err
+	}
 
-		// 读取响应
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			lastErr = fmt.Errorf("failed to read response: %v", err)
-			continue
-		}
+	// 检查响应是否成功
+	if status.ErrCode != 0 {
+		return "", fmt.Errorf("DingTalk API error: %s (code: %d)", status.ErrMsg, status.ErrCode)
+	}
 
-		// 解析响应
-		var result struct {
-			ErrCode  int    `json:"errcode"`
-			ErrMsg   string `json:"errmsg"`
-			UserID   string `json:"userid"`
-			Name     string `json:"name"`
-			DeviceID string `json:"deviceId"`
-		}
+	// 保存令牌
+	c.token = &DingTalkToken{
+		AccessToken: result.AccessToken,
+		ExpiresIn:   result.ExpiresIn,
+		ExpiresAt:   time.Now().Add(time.Second * time.Duration(result.ExpiresIn-60)), // 提前60秒过期
+		AppKey:      appKey,
+	}
 
-		if err := json.Unmarshal(body, &result); err != nil {
-			lastErr = fmt.Errorf("failed to parse response: %v", err)
-			continue
-		}
+	return c.token.AccessToken, nil
+}
 
-		// 如果是QPS超限错误，进行重试
-		if result.ErrCode == 88 || result.ErrCode == -1 {
-			lastErr = fmt.Errorf("DingTalk API QPS limit: %s (code: %d)", result.ErrMsg, result.ErrCode)
-			continue
-		}
+// InvalidateToken 清除缓存的访问令牌
+func (c *DingTalkClient) InvalidateToken() {
+	c.tokenMutex.Lock()
+	defer c.tokenMutex.Unlock()
+	c.token = nil
+}
 
-		// 检查响应是否成功
-		if result.ErrCode != 0 {
-			return nil, fmt.Errorf("DingTalk API error: %s (code: %d)", result.ErrMsg, result.ErrCode)
-		}
+// tokenQuery 构建带访问令牌的查询参数
+func (c *DingTalkClient) tokenQuery() (url.Values, error) {
+	accessToken, err := c.GetToken()
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	query.Set("access_token", accessToken)
+	return query, nil
+}
+
+// GetUserInfo 获取钉钉用户信息
+func (c *DingTalkClient) GetUserInfo(code string) (*DingTalkUserInfo, error) {
+	// 获取访问令牌
+	query, err := c.tokenQuery()
+	if err != nil {
+		return nil, err
+	}
+	query.Set("code", code)
+
+	// 请求用户信息
+	var result struct {
+		dingTalkResult
+		UserID   string `json:"userid"`
+		Name     string `json:"name"`
+		DeviceID string `json:"deviceId"`
+	}
+	status, err := c.call(http.MethodGet, "/user/getuserinfo", query, nil, "获取钉钉用户信息", &result)
+	if err != nil {
+		return nil, err
+	}
 
-		// 返回用户信息
-		return &DingTalkUserInfo{
-			UserID:   result.UserID,
-			Name:     result.Name,
-			DeviceID: result.DeviceID,
-		}, nil
+	// 检查响应是否成功
+	if status.ErrCode != 0 {
+		return nil, fmt.Errorf("DingTalk API error: %s (code: %d)", status.ErrMsg, status.ErrCode)
 	}
 
-	return nil, fmt.Errorf("获取钉钉用户信息失败，已重试 %d 次: %v", maxRetries, lastErr)
+	// 返回用户信息
+	return &DingTalkUserInfo{
+		UserID:   result.UserID,
+		Name:     result.Name,
+		DeviceID: result.DeviceID,
+	}, nil
 }
 
 // DingTalkUserInfo 钉钉用户信息结构
@@ -198,31 +327,55 @@ type DingTalkGuardianStudentRel struct {
 	StudentUserId  string `json:"student_userid"`
 }
 
+// DingTalkClass 钉钉家校通讯录中的班级
+type DingTalkClass struct {
+	ID   string `json:"id"`
+	Name string `json:"name"` // 班级名称，上级为年级时带上年级名称
+}
+
+// DingTalkStudent 钉钉家校通讯录中的学生
+type DingTalkStudent struct {
+	UserID  string `json:"userid"`
+	Name    string `json:"name"`
+	ClassID string `json:"class_id"`
+}
+
 // GetAllClassIDs 获取所有班级的ID
-func GetAllClassIDs(addMappingLog func(string)) ([]string, error) {
+func (c *DingTalkClient) GetAllClassIDs(addMappingLog func(string)) ([]string, error) {
+	classes, err := c.GetAllClasses(addMappingLog)
+	if err != nil {
+		return nil, err
+	}
+
+	classIDs := make([]string, 0, len(classes))
+	for _, class := range classes {
+		classIDs = append(classIDs, class.ID)
+	}
+	return classIDs, nil
+}
+
+// GetAllClasses 获取所有班级
+func (c *DingTalkClient) GetAllClasses(addLog func(string)) ([]DingTalkClass, error) {
 	// 获取访问令牌
-	accessToken, err := GetDingTalkToken()
+	query, err := c.tokenQuery()
 	if err != nil {
 		return nil, err
 	}
 
-	// 存储所有班级ID
-	var classIDs []string
+	// 存储所有班级
+	var classes []DingTalkClass
 
 	// 从根部门开始递归查找班级
-	err = findClassDepartments(accessToken, 0, &classIDs, addMappingLog)
+	err = c.findClassDepartments(query, 0, "", &classes, addLog)
 	if err != nil {
 		return nil, err
 	}
 
-	return classIDs, nil
+	return classes, nil
 }
 
-// findClassDepartments 递归查找班级部门
-func findClassDepartments(accessToken string, superID int, classIDs *[]string, addMappingLog func(string)) error {
-	// 请求URL
-	url := "https://oapi.dingtalk.com/topapi/edu/dept/list"
-
+// findClassDepartments 递归查找班级部门，gradeName 为上级年级的名称
+func (c *DingTalkClient) findClassDepartments(query url.Values, superID int, gradeName string, classes *[]DingTalkClass, addMappingLog func(string)) error {
 	// 构建请求数据
 	data := map[string]interface{}{
 		"page_size": 30,
@@ -240,18 +393,13 @@ func findClassDepartments(accessToken string, superID int, classIDs *[]string, a
 
 	for hasMore {
 		data["page_no"] = pageNo
-		jsonData, err := json.Marshal(data)
-		if err != nil {
-			return fmt.Errorf("编码请求失败: %v", err)
-		}
 
-		// 最大重试次数
-		maxRetries := 3
-		var lastErr error
+		// 每次请求前等待，避免QPS限制
+		time.Sleep(c.RequestInterval)
+
 		var result struct {
-			ErrCode int    `json:"errcode"`
-			ErrMsg  string `json:"errmsg"`
-			Success bool   `json:"success"`
+			dingTalkResult
+			Success bool `json:"success"`
 			Result  struct {
 				HasMore bool `json:"has_more"`
 				SuperID int  `json:"super_id"`
@@ -262,89 +410,40 @@ func findClassDepartments(accessToken string, superID int, classIDs *[]string, a
 				} `json:"details"`
 			} `json:"result"`
 		}
-
-		// 重试逻辑
-		for attempt := 0; attempt < maxRetries; attempt++ {
-			// 如果不是第一次尝试，等待一段时间再重试
-			if attempt > 0 {
-				backoffTime := time.Duration(500*1<<uint(attempt-1)) * time.Millisecond
-				time.Sleep(backoffTime)
-				log.Printf("重试获取部门列表，第 %d 次尝试, 等待时间: %v", attempt+1, backoffTime)
-			} else {
-				// 第一次请求也要有延迟，避免QPS限制
-				time.Sleep(500 * time.Millisecond)
-			}
-
-			// 发送请求
-			req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-			if err != nil {
-				lastErr = fmt.Errorf("创建请求失败: %v", err)
-				continue
-			}
-
-			req.Header.Set("Content-Type", "application/json")
-			q := req.URL.Query()
-			q.Add("access_token", accessToken)
-			req.URL.RawQuery = q.Encode()
-
-			client := &http.Client{}
-			resp, err := client.Do(req)
-			if err != nil {
-				lastErr = fmt.Errorf("发送请求失败: %v", err)
-				continue
-			}
-
-			// 读取响应
-			body, err := io.ReadAll(resp.Body)
-			resp.Body.Close()
-			if err != nil {
-				lastErr = fmt.Errorf("读取响应失败: %v", err)
-				continue
-			}
-
-			// 解析响应
-			if err := json.Unmarshal(body, &result); err != nil {
-				lastErr = fmt.Errorf("解析响应失败: %v", err)
-				continue
-			}
-
-			// 如果是QPS超限错误，进行重试
-			if result.ErrCode == 88 || result.ErrCode == -1 {
-				lastErr = fmt.Errorf("DingTalk API QPS limit: %s (code: %d)", result.ErrMsg, result.ErrCode)
-				continue
-			}
-
-			// 检查响应是否成功
-			if !result.Success || result.ErrCode != 0 {
-				// 如果是无数据，直接返回
-				if result.ErrCode == 60123 {
-					return nil
-				}
-				return fmt.Errorf("钉钉API错误: %s (代码: %d)", result.ErrMsg, result.ErrCode)
-			}
-
-			// 成功，跳出重试循环
-			break
+		status, err := c.call(http.MethodPost, "/topapi/edu/dept/list", query, data, "获取部门列表", &result)
+		if err != nil {
+			return err
 		}
 
-		// 如果重试后仍然失败
-		if result.ErrCode != 0 && result.ErrCode != 60123 {
-			return fmt.Errorf("获取部门列表失败，已重试 %d 次: %v", maxRetries, lastErr)
+		// 检查响应是否成功
+		if !result.Success || status.ErrCode != 0 {
+			// 如果是无数据，直接返回
+			if status.ErrCode == 60123 {
+				return nil
+			}
+			return fmt.Errorf("钉钉API错误: %s (代码: %d)", status.ErrMsg, status.ErrCode)
 		}
 
 		// 处理当前页的部门
 		for _, dept := range result.Result.Details {
 			if dept.DeptType == "class" {
 				// 如果是班级，添加到班级列表
-				*classIDs = append(*classIDs, strconv.Itoa(dept.DeptID))
+				*classes = append(*classes, DingTalkClass{
+					ID:   strconv.Itoa(dept.DeptID),
+					Name: gradeName + dept.Name,
+				})
 				addMappingLog(fmt.Sprintf("发现班级: ID=%d, 名称=%s", dept.DeptID, dept.Name))
 			} else {
 				// 如果不是班级，递归查找子部门
 				addMappingLog(fmt.Sprintf("发现部门: ID=%d, 名称=%s, 类型=%s", dept.DeptID, dept.Name, dept.DeptType))
-				err = findClassDepartments(accessToken, dept.DeptID, classIDs, addMappingLog)
+				childGradeName := ""
+				if dept.DeptType == "grade" {
+					childGradeName = dept.Name
+				}
+				err = c.findClassDepartments(query, dept.DeptID, childGradeName, classes, addMappingLog)
 				if err != nil {
-					addMappingLog(fmt.Sprintf("获取部门ID=%d的子部门失败: %v", dept.DeptID, err))
-					// 继续处理其他部门，不中断整个过程
+					// 子部门不完整时班级列表也不完整，中断查找，避免调用方把缺失的班级当作已删除
+					return fmt.Errorf("获取部门ID=%d的子部门失败: %v", dept.DeptID, err)
 				}
 			}
 		}
@@ -357,10 +456,82 @@ func findClassDepartments(accessToken string, superID int, classIDs *[]string, a
 	return nil
 }
 
+// GetClassStudents 获取指定班级的所有学生
+func (c *DingTalkClient) GetClassStudents(classID string) ([]DingTalkStudent, error) {
+	// 获取访问令牌
+	query, err := c.tokenQuery()
+	if err != nil {
+		return nil, err
+	}
+
+	// 存储所有学生
+	var students []DingTalkStudent
+
+	// 分页获取数据
+	pageNo := 1
+	hasMore := true
+
+	for hasMore {
+		// 构建请求数据
+		data := map[string]interface{}{
+			"class_id":  classID,
+			"role":      "student",
+			"page_size": 30,
+			"page_no":   pageNo,
+		}
+
+		// 每次请求前等待，避免QPS限制
+		time.Sleep(c.RequestInterval)
+
+		var result struct {
+			dingTalkResult
+			Success bool `json:"success"`
+			Result  struct {
+				HasMore bool `json:"has_more"`
+				Details []struct {
+					UserID  string `json:"userid"`
+					Name    string `json:"name"`
+					ClassID int    `json:"class_id"`
+				} `json:"details"`
+			} `json:"result"`
+		}
+		status, err := c.call(http.MethodPost, "/topapi/edu/user/list", query, data, "获取班级学生列表", &result)
+		if err != nil {
+			return nil, err
+		}
+
+		// 检查响应是否成功
+		if !result.Success || status.ErrCode != 0 {
+			// 如果是无数据，直接返回空结果
+			if status.ErrCode == 60123 {
+				return []DingTalkStudent{}, nil
+			}
+			return nil, fmt.Errorf("钉钉API错误: %s (代码: %d)", status.ErrMsg, status.ErrCode)
+		}
+
+		// 添加获取到的学生
+		for _, detail := range result.Result.Details {
+			students = append(students, DingTalkStudent{
+				UserID:  detail.UserID,
+				Name:    detail.Name,
+				ClassID: classID,
+			})
+		}
+
+		// 检查是否有更多数据
+		hasMore = result.Result.HasMore
+		if hasMore {
+			pageNo++
+		}
+	}
+
+	return students, nil
+}
+
 // GetClassParentStudentRelations 获取指定班级的所有家长-学生关系
-func GetClassParentStudentRelations(classID string) ([]DingTalkGuardianStudentRel, error) {
+func (c *DingTalkClient) GetClassParentStudentRelations(classID string) ([]DingTalkGuardianStudentRel, error) {
 	// 获取访问令牌
-	accessToken, err := GetDingTalkToken()
+	query, err := c.tokenQuery()
 	if err != nil {
 		return nil, err
 	}
@@ -373,9 +544,6 @@ func GetClassParentStudentRelations(classID string) ([]DingTalkGuardianStudentRe
 	hasMore := true
 
 	for hasMore {
-		// 请求URL
-		url := "https://oapi.dingtalk.com/topapi/edu/user/relation/list"
-
 		// 构建请求数据
 		data := map[string]interface{}{
 			"class_id":  classID,
@@ -383,18 +551,12 @@ func GetClassParentStudentRelations(classID string) ([]DingTalkGuardianStudentRe
 			"page_no":   pageNo,
 		}
 
-		jsonData, err := json.Marshal(data)
-		if err != nil {
-			return nil, fmt.Errorf("编码请求失败: %v", err)
-		}
+		// 每次请求前等待，避免QPS限制
+		time.Sleep(c.RequestInterval)
 
-		// 最大重试次数
-		maxRetries := 3
-		var lastErr error
 		var result struct {
-			ErrCode int    `json:"errcode"`
-			ErrMsg  string `json:"errmsg"`
-			Success bool   `json:"success"`
+			dingTalkResult
+			Success bool `json:"success"`
 			Result  struct {
 				HasMore   bool `json:"has_more"`
 				Relations []struct {
@@ -406,74 +568,18 @@ func GetClassParentStudentRelations(classID string) ([]DingTalkGuardianStudentRe
 				} `json:"relations"`
 			} `json:"result"`
 		}
-
-		// 重试逻辑
-		for attempt := 0; attempt < maxRetries; attempt++ {
-			// 如果不是第一次尝试，等待一段时间再重试
-			if attempt > 0 {
-				backoffTime := time.Duration(500*1<<uint(attempt-1)) * time.Millisecond
-				time.Sleep(backoffTime)
-				log.Printf("重试获取家长-学生关系，第 %d 次尝试, 等待时间: %v", attempt+1, backoffTime)
-			} else {
-				// 第一次请求也要有延迟，避免QPS限制
-				time.Sleep(500 * time.Millisecond)
-			}
-
-			// 发送请求
-			req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-			if err != nil {
-				lastErr = fmt.Errorf("创建请求失败: %v", err)
-				continue
-			}
-
-			req.Header.Set("Content-Type", "application/json")
-			q := req.URL.Query()
-			q.Add("access_token", accessToken)
-			req.URL.RawQuery = q.Encode()
-
-			client := &http.Client{}
-			resp, err := client.Do(req)
-			if err != nil {
-				lastErr = fmt.Errorf("发送请求失败: %v", err)
-				continue
-			}
-
-			// 读取响应
-			body, err := io.ReadAll(resp.Body)
-			resp.Body.Close()
-			if err != nil {
-				lastErr = fmt.Errorf("读取响应失败: %v", err)
-				continue
-			}
-
-			// 解析响应
-			if err := json.Unmarshal(body, &result); err != nil {
-				lastErr = fmt.Errorf("解析响应失败: %v", err)
-				continue
-			}
-
-			// 如果是QPS超限错误，进行重试
-			if result.ErrCode == 88 || result.ErrCode == -1 {
-				lastErr = fmt.Errorf("DingTalk API QPS limit: %s (code: %d)", result.ErrMsg, result.ErrCode)
-				continue
-			}
-
-			// 检查响应是否成功
-			if !result.Success || result.ErrCode != 0 {
-				// 如果是无数据，直接返回空结果
-				if result.ErrCode == 60123 {
-					return []DingTalkGuardianStudentRel{}, nil
-				}
-				return nil, fmt.Errorf("钉钉API错误: %s (代码: %d)", result.ErrMsg, result.ErrCode)
-			}
-
-			// 成功，跳出重试循环
-			break
+		status, err := c.call(http.MethodPost, "/topapi/edu/user/relation/list", query, data, "获取家长-学生关系", &result)
+		if err != nil {
+			return nil, err
 		}
 
-		// 如果重试后仍然失败
-		if result.ErrCode != 0 && result.ErrCode != 60123 {
-			return nil, fmt.Errorf("获取家长-学生关系失败，已重试 %d 次: %v", maxRetries, lastErr)
+		// 检查响应是否成功
+		if !result.Success || status.ErrCode != 0 {
+			// 如果是无数据，直接返回空结果
+			if status.ErrCode == 60123 {
+				return []DingTalkGuardianStudentRel{}, nil
+			}
+			return nil, fmt.Errorf("钉钉API错误: %s (代码: %d)", status.ErrMsg, status.ErrCode)
 		}
 
 		// 添加获取到的关系
@@ -504,10 +610,10 @@ type ActionCardMessage struct {
 	SingleURL   string `json:"single_url"`
 }
 
-// SendDingTalkActionCard 发送钉钉卡片消息
-func SendDingTalkActionCard(userIDs []string, card ActionCardMessage) error {
+// SendActionCard 发送钉钉卡片消息
+func (c *DingTalkClient) SendActionCard(userIDs []string, card ActionCardMessage) error {
 	// 获取访问令牌
-	accessToken, err := GetDingTalkToken()
+	query, err := c.tokenQuery()
 	if err != nil {
 		return err
 	}
@@ -529,21 +635,21 @@ func SendDingTalkActionCard(userIDs []string, card ActionCardMessage) error {
 
 		// 分批发送
 		for _, batch := range batches {
-			err := sendDingTalkActionCardBatch(accessToken, agentID, batch, card)
+			err := c.sendActionCardBatch(query, agentID, batch, card)
 			if err != nil {
 				return err
 			}
-			time.Sleep(1000 * time.Millisecond) // 避免触发QPS限制
+			time.Sleep(c.BatchInterval) // 避免触发QPS限制
 		}
 		return nil
 	}
 
 	// 单批发送
-	return sendDingTalkActionCardBatch(accessToken, agentID, userIDs, card)
+	return c.sendActionCardBatch(query, agentID, userIDs, card)
 }
 
-// sendDingTalkActionCardBatch 按批次发送钉钉卡片消息
-func sendDingTalkActionCardBatch(accessToken, agentID string, userIDs []string, card ActionCardMessage) error {
+// sendActionCardBatch 按批次发送钉钉卡片消息
+func (c *DingTalkClient) sendActionCardBatch(query url.Values, agentID string, userIDs []string, card ActionCardMessage) error {
 	// 构建请求数据
 	data := map[string]interface{}{
 		"agent_id":    agentID,
@@ -559,67 +665,17 @@ func sendDingTalkActionCardBatch(accessToken, agentID string, userIDs []string,
 		},
 	}
 
-	// 编码请求数据
-	jsonData, err := json.Marshal(data)
+	status, err := c.call(http.MethodPost, "/topapi/message/corpconversation/asyncsend_v2", query, data, "发送钉钉卡片消息", nil)
 	if err != nil {
-		return fmt.Errorf("failed to encode request: %v", err)
+		return err
 	}
 
-	// 请求URL
-	url := fmt.Sprintf("https://oapi.dingtalk.com/topapi/message/corpconversation/asyncsend_v2?access_token=%s", accessToken)
-
-	// 最大重试次数
-	maxRetries := 3
-	var lastErr error
-
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		// 如果不是第一次尝试，等待一段时间再重试
-		if attempt > 0 {
-			backoffTime := time.Duration(500*1<<uint(attempt-1)) * time.Millisecond
-			time.Sleep(backoffTime)
-			log.Printf("重试发送钉钉卡片消息，第 %d 次尝试, 等待时间: %v", attempt+1, backoffTime)
-		}
-
-		// 发送请求
-		resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-		if err != nil {
-			lastErr = fmt.Errorf("failed to send DingTalk action card: %v", err)
-			continue
-		}
-
-		// 读取响应
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			lastErr = fmt.Errorf("failed to read response: %v", err)
-			continue
-		}
-
-		// 解析响应
-		var result struct {
-			ErrCode int    `json:"errcode"`
-			ErrMsg  string `json:"errmsg"`
-		}
-		if err := json.Unmarshal(body, &result); err != nil {
-			lastErr = fmt.Errorf("failed to parse response: %v", err)
-			continue
-		}
-
-		// 如果是QPS超限错误，进行重试
-		if result.ErrCode == 88 || result.ErrCode == -1 {
-			lastErr = fmt.Errorf("DingTalk API QPS limit: %s (code: %d)", result.ErrMsg, result.ErrCode)
-			continue
-		}
-
-		// 检查响应是否成功
-		if result.ErrCode != 0 {
-			return fmt.Errorf("DingTalk API error: %s (code: %d)", result.ErrMsg, result.ErrCode)
-		}
-
-		return nil
+	// 检查响应是否成功
+	if status.ErrCode != 0 {
+		return fmt.Errorf("DingTalk API error: %s (code: %d)", status.ErrMsg, status.ErrCode)
 	}
 
-	return fmt.Errorf("发送钉钉卡片消息失败，已重试 %d 次: %v", maxRetries, lastErr)
+	return nil
 }
 
 // LogError 记录错误信息到日志
@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 钉钉事件订阅加解密使用的 PKCS#7 分块大小
+const dingTalkCallbackBlockSize = 32
+
+// DingTalkCallbackResponse 钉钉事件订阅的加密响应
+type DingTalkCallbackResponse struct {
+	MsgSignature string `json:"msg_signature"`
+	TimeStamp    string `json:"timeStamp"`
+	Nonce        string `json:"nonce"`
+	Encrypt      string `json:"encrypt"`
+}
+
+// DingTalkCallbackCrypto 钉钉事件订阅的签名校验与加解密
+type DingTalkCallbackCrypto struct {
+	token    string
+	aesKey   []byte
+	ownerKey string // 企业内部应用为 AppKey
+}
+
+// NewDingTalkCallbackCrypto 根据开发者后台配置的签名 Token 和 43 位加密 aes_key 创建加解密器
+func NewDingTalkCallbackCrypto(token, encodingAESKey, ownerKey string) (*DingTalkCallbackCrypto, error) {
+	if token == "" || encodingAESKey == "" {
+		return nil, errors.New("未配置钉钉事件订阅的签名Token或加密密钥")
+	}
+	if len(encodingAESKey) != 43 {
+		return nil, errors.New("钉钉事件订阅的加密密钥长度必须为43位")
+	}
+
+	// aes_key 为去掉末尾 "=" 的 base64 编码
+	aesKey, err := base64.StdEncoding.DecodeString(encodingAESKey + "=")
+	if err != nil {
+		return nil, fmt.Errorf("无效的钉钉事件订阅加密密钥: %v", err)
+	}
+
+	return &DingTalkCallbackCrypto{
+		token:    token,
+		aesKey:   aesKey,
+		ownerKey: ownerKey,
+	}, nil
+}
+
+// Signature 计算签名：将 token、timestamp、nonce、encrypt 字典序排序后拼接并做 SHA1
+func (c *DingTalkCallbackCrypto) Signature(timestamp, nonce, encrypt string) string {
+	parts := []string{c.token, timestamp, nonce, encrypt}
+	sort.Strings(parts)
+
+	sum := sha1.Sum([]byte(strings.Join(parts, "")))
+	return hex.EncodeToString(sum[:])
+}
+
+// DecryptMessage 校验签名并解密事件内容
+func (c *DingTalkCallbackCrypto) DecryptMessage(signature, timestamp, nonce, encrypt string) (string, error) {
+	// 校验签名
+	expected := c.Signature(timestamp, nonce, encrypt)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) != 1 {
+		return "", errors.New("签名校验失败")
+	}
+
+	// 解码密文
+	ciphertext, err := base64.StdEncoding.DecodeString(encrypt)
+	if err != nil {
+		return "", fmt.Errorf("密文解码失败: %v", err)
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return "", errors.New("密文长度无效")
+	}
+
+	// AES-CBC 解密，IV 为密钥前16字节
+	block, err := aes.NewCipher(c.aesKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, c.aesKey[:aes.BlockSize]).CryptBlocks(plaintext, ciphertext)
+
+	// 去除 PKCS#7 填充
+	padding := int(plaintext[len(plaintext)-1])
+	if padding < 1 || padding > dingTalkCallbackBlockSize || padding > len(plaintext) {
+		return "", errors.New("填充无效")
+	}
+	plaintext = plaintext[:len(plaintext)-padding]
+
+	// 明文格式：16字节随机串 + 4字节消息长度(大端) + 消息 + ownerKey
+	if len(plaintext) < 20 {
+		return "", errors.New("明文长度无效")
+	}
+	msgLen := int(binary.BigEndian.Uint32(plaintext[16:20]))
+	if msgLen > len(plaintext)-20 {
+		return "", errors.New("消息长度无效")
+	}
+	msg := plaintext[20 : 20+msgLen]
+	owner := string(plaintext[20+msgLen:])
+	if c.ownerKey != "" && owner != c.ownerKey {
+		return "", errors.New("消息接收方不匹配")
+	}
+
+	return string(msg), nil
+}
+
+// EncryptMessage 加密消息并生成签名，用于响应钉钉
+func (c *DingTalkCallbackCrypto) EncryptMessage(msg string) (*DingTalkCallbackResponse, error) {
+	// 生成随机串
+	random := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, random); err != nil {
+		return nil, err
+	}
+
+	// 拼接明文
+	var buf bytes.Buffer
+	buf.Write(random)
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(msg)))
+	buf.Write(length)
+	buf.WriteString(msg)
+	buf.WriteString(c.ownerKey)
+
+	// PKCS#7 填充
+	padding := dingTalkCallbackBlockSize - buf.Len()%dingTalkCallbackBlockSize
+	buf.Write(bytes.Repeat([]byte{byte(padding)}, padding))
+
+	// AES-CBC 加密
+	block, err := aes.NewCipher(c.aesKey)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := make([]byte, buf.Len())
+	cipher.NewCBCEncrypter(block, c.aesKey[:aes.BlockSize]).CryptBlocks(ciphertext, buf.Bytes())
+	encrypt := base64.StdEncoding.EncodeToString(ciphertext)
+
+	// 生成签名
+	timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	nonce := hex.EncodeToString(random[:4])
+
+	return &DingTalkCallbackResponse{
+		MsgSignature: c.Signature(timestamp, nonce, encrypt),
+		TimeStamp:    timestamp,
+		Nonce:        nonce,
+		Encrypt:      encrypt,
+	}, nil
+}
@@ -0,0 +1,42 @@
+package dingtalkfake
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+// NewCallbackRequest 构造一个与钉钉事件订阅推送相同格式的加密请求，target 为回调地址
+func NewCallbackRequest(target string, crypto *utils.DingTalkCallbackCrypto, event interface{}) (*http.Request, error) {
+	// 序列化并加密事件
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := crypto.EncryptMessage(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	// 签名参数放在查询字符串中，密文放在请求体中
+	query := url.Values{}
+	query.Set("msg_signature", encrypted.MsgSignature)
+	query.Set("timestamp", encrypted.TimeStamp)
+	query.Set("nonce", encrypted.Nonce)
+
+	body, err := json.Marshal(map[string]string{"encrypt": encrypted.Encrypt})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, target+"?"+query.Encode(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return req, nil
+}
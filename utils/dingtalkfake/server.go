@@ -0,0 +1,451 @@
+// Package dingtalkfake 提供一个模拟钉钉开放平台的本地HTTP服务，
+// 用于在不访问真实钉钉服务的情况下测试映射重建、登录和消息提醒等流程。
+package dingtalkfake
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/itsHenry35/canteen-management-system/utils"
+)
+
+// AccessToken 模拟服务签发的访问令牌
+const AccessToken = "fake-access-token"
+
+// Department 模拟的家校部门
+type Department struct {
+	ID       int
+	ParentID int    // 上级部门ID，0 表示根部门
+	Name     string // 部门名称
+	Type     string // 部门类型，班级为 "class"
+}
+
+// Relation 模拟的家长-学生关系
+type Relation struct {
+	ClassID        int
+	GuardianUserID string
+	StudentUserID  string
+	RelationName   string
+}
+
+// Student 模拟的班级学生
+type Student struct {
+	ClassID int
+	UserID  string
+	Name    string
+}
+
+// Message 模拟服务收到的工作通知
+type Message struct {
+	AgentID string
+	UserIDs []string
+	Title   string
+	Body    string
+	URL     string
+}
+
+// Server 模拟钉钉开放平台的HTTP服务
+type Server struct {
+	srv *httptest.Server
+
+	mu          sync.Mutex
+	departments []Department
+	relations   []Relation
+	students    []Student
+	users       map[string]utils.DingTalkUserInfo // 免登code -> 用户信息
+	messages    []Message
+	failures    map[string]int // 接口路径或 "路径#班级ID" -> 返回的错误码
+	requests    map[string]int // 接口路径 -> 收到的请求数
+	PageSize    int            // 分页接口每页返回的条数
+}
+
+// NewServer 启动模拟服务，使用完毕后需调用 Close
+func NewServer() *Server {
+	s := &Server{
+		users:    make(map[string]utils.DingTalkUserInfo),
+		failures: make(map[string]int),
+		requests: make(map[string]int),
+		PageSize: 30,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gettoken", s.handleGetToken)
+	mux.HandleFunc("/user/getuserinfo", s.withToken(s.handleGetUserInfo))
+	mux.HandleFunc("/topapi/edu/dept/list", s.withToken(s.handleDeptList))
+	mux.HandleFunc("/topapi/edu/user/relation/list", s.withToken(s.handleRelationList))
+	mux.HandleFunc("/topapi/edu/user/list", s.withToken(s.handleUserList))
+	mux.HandleFunc("/topapi/message/corpconversation/asyncsend_v2", s.withToken(s.handleSendMessage))
+	s.srv = httptest.NewServer(mux)
+
+	return s
+}
+
+// URL 返回模拟服务的地址
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// Close 关闭模拟服务
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Client 返回指向模拟服务且不做等待的钉钉客户端
+func (s *Server) Client() *utils.DingTalkClient {
+	client := utils.NewDingTalkClient(s.srv.URL, s.srv.Client())
+	client.RetryBackoff = 0
+	client.RequestInterval = 0
+	client.BatchInterval = 0
+	return client
+}
+
+// AddDepartment 添加部门
+func (s *Server) AddDepartment(dept Department) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.departments = append(s.departments, dept)
+}
+
+// AddRelation 添加家长-学生关系
+func (s *Server) AddRelation(rel Relation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.relations = append(s.relations, rel)
+}
+
+// RemoveRelation 删除家长-学生关系
+func (s *Server) RemoveRelation(guardianUserID, studentUserID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.relations[:0]
+	for _, rel := range s.relations {
+		if rel.GuardianUserID != guardianUserID || rel.StudentUserID != studentUserID {
+			kept = append(kept, rel)
+		}
+	}
+	s.relations = kept
+}
+
+// AddStudent 添加班级学生
+func (s *Server) AddStudent(student Student) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.students = append(s.students, student)
+}
+
+// RemoveStudent 将学生从所有班级中移除
+func (s *Server) RemoveStudent(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.students[:0]
+	for _, student := range s.students {
+		if student.UserID != userID {
+			kept = append(kept, student)
+		}
+	}
+	s.students = kept
+}
+
+// AddUser 注册免登code对应的用户
+func (s *Server) AddUser(code string, user utils.DingTalkUserInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[code] = user
+}
+
+// Fail 让指定接口返回错误码，key 为接口路径，或 "路径#班级ID"（部门列表为 "路径#上级部门ID"）只让某个班级或部门失败；errCode 为 0 时取消
+func (s *Server) Fail(key string, errCode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if errCode == 0 {
+		delete(s.failures, key)
+		return
+	}
+	s.failures[key] = errCode
+}
+
+// Messages 返回已收到的工作通知
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	messages := make([]Message, len(s.messages))
+	copy(messages, s.messages)
+	return messages
+}
+
+// Requests 返回指定接口收到的请求数
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// withToken 校验访问令牌并检查是否需要模拟失败
+func (s *Server) withToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("access_token") != AccessToken {
+			writeJSON(w, map[string]interface{}{"errcode": 40014, "errmsg": "不合法的access_token"})
+			return
+		}
+
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+		errCode, failed := s.failures[r.URL.Path]
+		s.mu.Unlock()
+		if failed {
+			writeJSON(w, map[string]interface{}{"errcode": errCode, "errmsg": "模拟错误", "success": false})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// handleGetToken 签发访问令牌
+func (s *Server) handleGetToken(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("appkey") == "" || r.URL.Query().Get("appsecret") == "" {
+		writeJSON(w, map[string]interface{}{"errcode": 40089, "errmsg": "不合法的corpid或corpsecret"})
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"errcode":      0,
+		"errmsg":       "ok",
+		"access_token": AccessToken,
+		"expires_in":   7200,
+	})
+}
+
+// handleGetUserInfo 根据免登code返回用户信息
+func (s *Server) handleGetUserInfo(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	user, ok := s.users[r.URL.Query().Get("code")]
+	s.mu.Unlock()
+
+	if !ok {
+		writeJSON(w, map[string]interface{}{"errcode": 40078, "errmsg": "不存在的临时授权码"})
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"errcode":  0,
+		"errmsg":   "ok",
+		"userid":   user.UserID,
+		"name":     user.Name,
+		"deviceId": user.DeviceID,
+	})
+}
+
+// handleDeptList 按上级部门分页返回子部门
+func (s *Server) handleDeptList(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		SuperID  int `json:"super_id"`
+		PageNo   int `json:"page_no"`
+		PageSize int `json:"page_size"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, map[string]interface{}{"errcode": 40035, "errmsg": "不合法的参数"})
+		return
+	}
+
+	s.mu.Lock()
+	errCode, failed := s.failures[r.URL.Path+"#"+strconv.Itoa(req.SuperID)]
+	var children []Department
+	for _, dept := range s.departments {
+		if dept.ParentID == req.SuperID {
+			children = append(children, dept)
+		}
+	}
+	s.mu.Unlock()
+	if failed {
+		writeJSON(w, map[string]interface{}{"errcode": errCode, "errmsg": "模拟错误", "success": false})
+		return
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].ID < children[j].ID })
+
+	page, hasMore := paginate(len(children), req.PageNo, s.PageSize)
+	details := make([]map[string]interface{}, 0)
+	for _, dept := range children[page[0]:page[1]] {
+		details = append(details, map[string]interface{}{
+			"dept_id":   dept.ID,
+			"dept_type": dept.Type,
+			"name":      dept.Name,
+		})
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"errcode": 0,
+		"errmsg":  "ok",
+		"success": true,
+		"result": map[string]interface{}{
+			"has_more": hasMore,
+			"super_id": req.SuperID,
+			"details":  details,
+		},
+	})
+}
+
+// handleRelationList 分页返回班级内的家长-学生关系
+func (s *Server) handleRelationList(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ClassID string `json:"class_id"`
+		PageNo  int    `json:"page_no"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, map[string]interface{}{"errcode": 40035, "errmsg": "不合法的参数"})
+		return
+	}
+	classID, _ := strconv.Atoi(req.ClassID)
+
+	s.mu.Lock()
+	errCode, failed := s.failures[r.URL.Path+"#"+req.ClassID]
+	var relations []Relation
+	for _, rel := range s.relations {
+		if rel.ClassID == classID {
+			relations = append(relations, rel)
+		}
+	}
+	s.mu.Unlock()
+
+	if failed {
+		writeJSON(w, map[string]interface{}{"errcode": errCode, "errmsg": "模拟错误", "success": false})
+		return
+	}
+	if len(relations) == 0 {
+		writeJSON(w, map[string]interface{}{"errcode": 60123, "errmsg": "无数据", "success": false})
+		return
+	}
+
+	page, hasMore := paginate(len(relations), req.PageNo, s.PageSize)
+	items := make([]map[string]interface{}, 0)
+	for _, rel := range relations[page[0]:page[1]] {
+		items = append(items, map[string]interface{}{
+			"class_id":      rel.ClassID,
+			"from_userid":   rel.GuardianUserID,
+			"relation_code": "",
+			"relation_name": rel.RelationName,
+			"to_userid":     rel.StudentUserID,
+		})
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"errcode": 0,
+		"errmsg":  "ok",
+		"success": true,
+		"result": map[string]interface{}{
+			"has_more":  hasMore,
+			"relations": items,
+		},
+	})
+}
+
+// handleUserList 分页返回班级内的学生
+func (s *Server) handleUserList(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ClassID string `json:"class_id"`
+		Role    string `json:"role"`
+		PageNo  int    `json:"page_no"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, map[string]interface{}{"errcode": 40035, "errmsg": "不合法的参数"})
+		return
+	}
+	classID, _ := strconv.Atoi(req.ClassID)
+
+	s.mu.Lock()
+	errCode, failed := s.failures[r.URL.Path+"#"+req.ClassID]
+	var students []Student
+	if req.Role == "student" {
+		for _, student := range s.students {
+			if student.ClassID == classID {
+				students = append(students, student)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	if failed {
+		writeJSON(w, map[string]interface{}{"errcode": errCode, "errmsg": "模拟错误", "success": false})
+		return
+	}
+
+	page, hasMore := paginate(len(students), req.PageNo, s.PageSize)
+	details := make([]map[string]interface{}, 0)
+	for _, student := range students[page[0]:page[1]] {
+		details = append(details, map[string]interface{}{
+			"userid":   student.UserID,
+			"name":     student.Name,
+			"class_id": student.ClassID,
+			"role":     "student",
+		})
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"errcode": 0,
+		"errmsg":  "ok",
+		"success": true,
+		"result": map[string]interface{}{
+			"has_more": hasMore,
+			"details":  details,
+		},
+	})
+}
+
+// handleSendMessage 记录收到的工作通知
+func (s *Server) handleSendMessage(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AgentID    string `json:"agent_id"`
+		UserIDList string `json:"userid_list"`
+		Msg        struct {
+			ActionCard struct {
+				Title     string `json:"title"`
+				Markdown  string `json:"markdown"`
+				SingleURL string `json:"single_url"`
+			} `json:"action_card"`
+		} `json:"msg"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, map[string]interface{}{"errcode": 40035, "errmsg": "不合法的参数"})
+		return
+	}
+
+	s.mu.Lock()
+	s.messages = append(s.messages, Message{
+		AgentID: req.AgentID,
+		UserIDs: strings.Split(req.UserIDList, ","),
+		Title:   req.Msg.ActionCard.Title,
+		Body:    req.Msg.ActionCard.Markdown,
+		URL:     req.Msg.ActionCard.SingleURL,
+	})
+	taskID := len(s.messages)
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{"errcode": 0, "errmsg": "ok", "task_id": taskID})
+}
+
+// paginate 计算分页区间，pageNo 从1开始
+func paginate(total, pageNo, pageSize int) ([2]int, bool) {
+	if pageNo < 1 {
+		pageNo = 1
+	}
+	start := (pageNo - 1) * pageSize
+	if start > total {
+		start = total
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+	return [2]int{start, end}, end < total
+}
+
+// writeJSON 输出JSON响应
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ICalEvent iCalendar 文件中的一个全天事件，日期为本地日期（YYYY-MM-DD，均含）
+type ICalEvent struct {
+	UID       string
+	Summary   string
+	Category  string // CATEGORIES 的第一个值
+	StartDate string
+	EndDate   string
+	Err       error // 日期无法解析等错误
+}
+
+// ReadICalEvents 读取 iCalendar（.ics）文件中的所有 VEVENT
+// 只使用 UID、SUMMARY、CATEGORIES、DTSTART 和 DTEND（或 DURATION 为整天时），不展开 RRULE；
+// 按日期表示的 DTEND 不含当天，带时间的事件按本地日期计算
+func ReadICalEvents(r io.Reader) ([]*ICalEvent, error) {
+	lines, err := unfoldICalLines(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, errors.New("不是有效的 iCalendar 文件")
+	}
+
+	var events []*ICalEvent
+	var event *ICalEvent
+	var endExclusive bool
+	for _, line := range lines {
+		name, params, value := splitICalLine(line)
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VCALENDAR"):
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			event = &ICalEvent{}
+			endExclusive = false
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if event == nil {
+				continue
+			}
+			if event.Err == nil {
+				event.Err = finishICalEvent(event, endExclusive)
+			}
+			events = append(events, event)
+			event = nil
+		case event == nil:
+			// 忽略 VEVENT 之外的属性
+		case name == "UID":
+			event.UID = value
+		case name == "SUMMARY":
+			event.Summary = unescapeICalText(value)
+		case name == "CATEGORIES":
+			event.Category = strings.TrimSpace(unescapeICalText(firstICalValue(value)))
+		case name == "DTSTART":
+			date, _, err := parseICalDate(params, value)
+			if err != nil {
+				event.Err = fmt.Errorf("无效的开始日期 %s", value)
+				continue
+			}
+			event.StartDate = date
+		case name == "DTEND":
+			date, dateOnly, err := parseICalDate(params, value)
+			if err != nil {
+				event.Err = fmt.Errorf("无效的结束日期 %s", value)
+				continue
+			}
+			event.EndDate = date
+			endExclusive = dateOnly
+		case name == "DURATION":
+			days, ok := parseICalDays(value)
+			if !ok {
+				event.Err = fmt.Errorf("不支持的持续时间 %s", value)
+				continue
+			}
+			event.EndDate = fmt.Sprintf("+%d", days)
+		}
+	}
+	return events, nil
+}
+
+// finishICalEvent 计算事件的结束日期（含）
+func finishICalEvent(event *ICalEvent, endExclusive bool) error {
+	if event.StartDate == "" {
+		return errors.New("缺少开始日期")
+	}
+	start, _ := time.ParseInLocation("2006-01-02", event.StartDate, time.Local)
+
+	switch {
+	case event.EndDate == "":
+		// 没有结束日期时为一天
+		event.EndDate = event.StartDate
+	case strings.HasPrefix(event.EndDate, "+"):
+		// DURATION 按整天计算，结束日期不含
+		var days int
+		fmt.Sscanf(event.EndDate, "+%d", &days)
+		if days < 1 {
+			days = 1
+		}
+		event.EndDate = start.AddDate(0, 0, days-1).Format("2006-01-02")
+	case endExclusive:
+		end, _ := time.ParseInLocation("2006-01-02", event.EndDate, time.Local)
+		event.EndDate = end.AddDate(0, 0, -1).Format("2006-01-02")
+		if event.EndDate < event.StartDate {
+			event.EndDate = event.StartDate
+		}
+	}
+	if event.EndDate < event.StartDate {
+		return errors.New("结束日期早于开始日期")
+	}
+	return nil
+}
+
+// unfoldICalLines 读取所有行并合并折行（以空格或制表符开头的行是上一行的延续）
+func unfoldICalLines(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) == 0 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// splitICalLine 拆分属性名、参数和值，如 DTSTART;VALUE=DATE:20250101
+func splitICalLine(line string) (string, map[string]string, string) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return strings.ToUpper(line), nil, ""
+	}
+	parts := strings.Split(line[:colon], ";")
+	params := make(map[string]string)
+	for _, param := range parts[1:] {
+		if kv := strings.SplitN(param, "=", 2); len(kv) == 2 {
+			params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, line[colon+1:]
+}
+
+// parseICalDate 解析 DATE 或 DATE-TIME，返回本地日期以及是否只有日期
+func parseICalDate(params map[string]string, value string) (string, bool, error) {
+	value = strings.TrimSpace(value)
+	if len(value) == 8 || params["VALUE"] == "DATE" {
+		day, err := time.ParseInLocation("20060102", value, time.Local)
+		if err != nil {
+			return "", false, err
+		}
+		return day.Format("2006-01-02"), true, nil
+	}
+
+	// 带时间的事件：UTC 时间转换为本地时间，带 TZID 时按该时区解析
+	loc := time.Local
+	if tzid := params["TZID"]; tzid != "" {
+		if tz, err := time.LoadLocation(tzid); err == nil {
+			loc = tz
+		}
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		if err != nil {
+			return "", false, err
+		}
+		return t.In(time.Local).Format("2006-01-02"), false, nil
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	if err != nil {
+		return "", false, err
+	}
+	return t.In(time.Local).Format("2006-01-02"), false, nil
+}
+
+// parseICalDays 解析按天或按周表示的持续时间，如 P1D、P2W
+func parseICalDays(value string) (int, bool) {
+	var n int
+	var unit string
+	if _, err := fmt.Sscanf(strings.TrimPrefix(value, "+"), "P%d%s", &n, &unit); err != nil {
+		return 0, false
+	}
+	switch unit {
+	case "D":
+		return n, true
+	case "W":
+		return n * 7, true
+	}
+	return 0, false
+}
+
+// firstICalValue 返回以逗号分隔的多个文本值中的第一个，转义的逗号（\,）不作为分隔符
+func firstICalValue(value string) string {
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case ',':
+			return value[:i]
+		}
+	}
+	return value
+}
+
+// unescapeICalText 还原文本值中的转义字符
+func unescapeICalText(value string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
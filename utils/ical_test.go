@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+// icalFile 将 VEVENT 的属性行包装为 iCalendar 文件，行以 CRLF 结尾
+func icalFile(lines ...string) string {
+	all := append([]string{"BEGIN:VCALENDAR", "VERSION:2.0", "BEGIN:VEVENT"}, lines...)
+	all = append(all, "END:VEVENT", "END:VCALENDAR")
+	return strings.Join(all, "\r\n") + "\r\n"
+}
+
+func TestReadICalEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		ics     string
+		want    ICalEvent
+		wantErr bool // 事件的 Err 不为空
+	}{
+		{
+			name: "folded lines",
+			ics:  icalFile("UID:1", "SUMMARY:国庆", " 节假期", "CATEGORIES:假", "\t期", "DTSTART;VALUE=DATE:20251001"),
+			want: ICalEvent{UID: "1", Summary: "国庆节假期", Category: "假期", StartDate: "2025-10-01", EndDate: "2025-10-01"},
+		},
+		{
+			name: "all-day end is exclusive",
+			ics:  icalFile("UID:2", "DTSTART;VALUE=DATE:20251001", "DTEND;VALUE=DATE:20251008"),
+			want: ICalEvent{UID: "2", StartDate: "2025-10-01", EndDate: "2025-10-07"},
+		},
+		{
+			name: "all-day end without value parameter",
+			ics:  icalFile("UID:3", "DTSTART:20251001", "DTEND:20251002"),
+			want: ICalEvent{UID: "3", StartDate: "2025-10-01", EndDate: "2025-10-01"},
+		},
+		{
+			name: "all-day end equal to start",
+			ics:  icalFile("UID:4", "DTSTART;VALUE=DATE:20251001", "DTEND;VALUE=DATE:20251001"),
+			want: ICalEvent{UID: "4", StartDate: "2025-10-01", EndDate: "2025-10-01"},
+		},
+		{
+			name: "all-day end across month",
+			ics:  icalFile("UID:5", "DTSTART;VALUE=DATE:20250228", "DTEND;VALUE=DATE:20250302"),
+			want: ICalEvent{UID: "5", StartDate: "2025-02-28", EndDate: "2025-03-01"},
+		},
+		{
+			name: "timed end is inclusive",
+			ics:  icalFile("UID:6", "DTSTART:20251001T080000", "DTEND:20251002T170000"),
+			want: ICalEvent{UID: "6", StartDate: "2025-10-01", EndDate: "2025-10-02"},
+		},
+		{
+			name: "duration in days",
+			ics:  icalFile("UID:7", "DTSTART;VALUE=DATE:20251001", "DURATION:P3D"),
+			want: ICalEvent{UID: "7", StartDate: "2025-10-01", EndDate: "2025-10-03"},
+		},
+		{
+			name: "duration in weeks",
+			ics:  icalFile("UID:8", "DTSTART;VALUE=DATE:20251001", "DURATION:P1W"),
+			want: ICalEvent{UID: "8", StartDate: "2025-10-01", EndDate: "2025-10-07"},
+		},
+		{
+			name: "escaped text",
+			ics:  icalFile("UID:9", `SUMMARY:春节\, 元宵\; 放假\\补课\n安排`, "DTSTART;VALUE=DATE:20250128"),
+			want: ICalEvent{UID: "9", Summary: `春节, 元宵; 放假\补课 安排`, StartDate: "2025-01-28", EndDate: "2025-01-28"},
+		},
+		{
+			name: "escaped comma in categories",
+			ics:  icalFile("UID:10", `CATEGORIES:调休\,上班,节假日`, "DTSTART;VALUE=DATE:20250208"),
+			want: ICalEvent{UID: "10", Category: "调休,上班", StartDate: "2025-02-08", EndDate: "2025-02-08"},
+		},
+		{
+			name:    "missing start",
+			ics:     icalFile("UID:11", "SUMMARY:无日期"),
+			want:    ICalEvent{UID: "11", Summary: "无日期"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid start",
+			ics:     icalFile("UID:12", "DTSTART;VALUE=DATE:2025-10-01"),
+			want:    ICalEvent{UID: "12"},
+			wantErr: true,
+		},
+		{
+			name:    "end before start",
+			ics:     icalFile("UID:13", "DTSTART:20251002T080000", "DTEND:20251001T080000"),
+			want:    ICalEvent{UID: "13", StartDate: "2025-10-02", EndDate: "2025-10-01"},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported duration",
+			ics:     icalFile("UID:14", "DTSTART;VALUE=DATE:20251001", "DURATION:PT8H"),
+			want:    ICalEvent{UID: "14", StartDate: "2025-10-01"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := ReadICalEvents(strings.NewReader(tt.ics))
+			if err != nil {
+				t.Fatalf("ReadICalEvents: %v", err)
+			}
+			if len(events) != 1 {
+				t.Fatalf("events = %d, want 1", len(events))
+			}
+			got := *events[0]
+			if (got.Err != nil) != tt.wantErr {
+				t.Errorf("event error = %v, want error %v", got.Err, tt.wantErr)
+			}
+			got.Err = nil
+			if got != tt.want {
+				t.Errorf("event = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadICalEventsFile(t *testing.T) {
+	// 带 BOM 的文件，包含多个事件和 VEVENT 之外的属性
+	ics := "\ufeffBEGIN:VCALENDAR\nX-WR-CALNAME:校历\nBEGIN:VEVENT\nUID:a\nDTSTART;VALUE=DATE:20250101\nEND:VEVENT\n\nBEGIN:VEVENT\nUID:b\nDTSTART;VALUE=DATE:20250501\nDTEND;VALUE=DATE:20250506\nEND:VEVENT\nEND:VCALENDAR\n"
+	events, err := ReadICalEvents(strings.NewReader(ics))
+	if err != nil {
+		t.Fatalf("ReadICalEvents: %v", err)
+	}
+	if len(events) != 2 || events[0].UID != "a" || events[1].EndDate != "2025-05-05" {
+		t.Errorf("events = %+v", events)
+	}
+
+	// 不是 iCalendar 文件
+	for _, invalid := range []string{"", "BEGIN:VEVENT\nEND:VEVENT\n", "日期,名称\n"} {
+		if _, err := ReadICalEvents(strings.NewReader(invalid)); err == nil {
+			t.Errorf("ReadICalEvents(%q): expected error", invalid)
+		}
+	}
+}
@@ -42,3 +42,20 @@ func SaveBase64Image(base64Data, directory, prefix string, timestamp interface{}
 
 	return fileName, nil
 }
+
+// CopyImage 将目录中的图片复制为新文件，返回新文件名
+func CopyImage(srcFileName, directory, prefix string, timestamp interface{}) (string, error) {
+	// 读取原图片
+	data, err := os.ReadFile(filepath.Join(directory, filepath.Base(srcFileName)))
+	if err != nil {
+		return "", err
+	}
+
+	// 保存为新文件
+	fileName := fmt.Sprintf("%s_%v.jpg", prefix, timestamp)
+	if err := os.WriteFile(filepath.Join(directory, fileName), data, 0644); err != nil {
+		return "", err
+	}
+
+	return fileName, nil
+}
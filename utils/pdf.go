@@ -0,0 +1,244 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PDF 页面布局（单位：点，A4 纵向）
+const (
+	pdfPageWidth  = 595.28
+	pdfPageHeight = 841.89
+	pdfMargin     = 40.0
+	pdfRowHeight  = 18.0
+	pdfFontSize   = 10.0
+)
+
+// PDFColumn 表格列，Width 为相对宽度，按比例占满页面宽度
+type PDFColumn struct {
+	Title      string
+	Width      float64
+	AlignRight bool
+}
+
+// PDFSection 文档中的一节：小标题、表格和表格下方的说明
+type PDFSection struct {
+	Heading string
+	Columns []PDFColumn
+	Rows    [][]string
+	Notes   []string
+}
+
+// PDFDocument 由标题、说明和若干表格组成的简单文档，用于生成账单等打印材料
+type PDFDocument struct {
+	Title    string
+	Lines    []string // 标题下方的说明
+	Sections []PDFSection
+	Footer   string // 每页底部的文字，页码会追加在后面
+}
+
+// WritePDF 将文档写入 PDF 文件，内容超出一页时自动分页并重复表头
+// 中文使用 PDF 阅读器内置的 STSong-Light 字体，不嵌入字体文件
+func WritePDF(w io.Writer, doc PDFDocument) error {
+	layout := &pdfLayout{}
+	layout.newPage()
+
+	// 标题和说明
+	layout.text(pdfMargin, layout.y-16, 16, true, doc.Title)
+	layout.y -= 28
+	for _, line := range doc.Lines {
+		layout.ensure(pdfRowHeight)
+		layout.text(pdfMargin, layout.y-pdfFontSize, pdfFontSize, false, line)
+		layout.y -= pdfRowHeight - 2
+	}
+
+	// 各节
+	for _, section := range doc.Sections {
+		layout.y -= 8
+		if section.Heading != "" {
+			layout.ensure(pdfRowHeight * 3)
+			layout.text(pdfMargin, layout.y-12, 12, true, section.Heading)
+			layout.y -= pdfRowHeight + 4
+		}
+		if len(section.Columns) > 0 {
+			layout.table(section.Columns, section.Rows)
+		}
+		for _, note := range section.Notes {
+			layout.ensure(pdfRowHeight)
+			layout.text(pdfMargin, layout.y-pdfFontSize-4, pdfFontSize, false, note)
+			layout.y -= pdfRowHeight
+		}
+	}
+
+	// 页脚和页码
+	for i, page := range layout.pages {
+		footer := strings.TrimSpace(fmt.Sprintf("%s  第 %d/%d 页", doc.Footer, i+1, len(layout.pages)))
+		writePDFText(page, pdfMargin, pdfMargin/2, 8, false, footer)
+	}
+
+	return layout.write(w)
+}
+
+// pdfLayout 按从上到下的顺序排版，记录每页的内容流
+type pdfLayout struct {
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	y     float64 // 当前位置距页面底部的高度
+}
+
+// newPage 开始新的一页
+func (l *pdfLayout) newPage() {
+	l.page = &bytes.Buffer{}
+	l.pages = append(l.pages, l.page)
+	l.y = pdfPageHeight - pdfMargin
+}
+
+// ensure 剩余空间不足 height 时换页，返回是否换页
+func (l *pdfLayout) ensure(height float64) bool {
+	if l.y-height < pdfMargin {
+		l.newPage()
+		return true
+	}
+	return false
+}
+
+// text 在当前页写入一行文字
+func (l *pdfLayout) text(x, y, size float64, bold bool, s string) {
+	writePDFText(l.page, x, y, size, bold, s)
+}
+
+// table 绘制表格，换页时重复表头
+func (l *pdfLayout) table(columns []PDFColumn, rows [][]string) {
+	// 按比例计算列宽
+	var total float64
+	for _, column := range columns {
+		total += column.Width
+	}
+	widths := make([]float64, len(columns))
+	for i, column := range columns {
+		widths[i] = column.Width / total * (pdfPageWidth - 2*pdfMargin)
+	}
+
+	header := func() {
+		fmt.Fprintf(l.page, "0.9 g %.2f %.2f %.2f %.2f re f 0 g\n", pdfMargin, l.y-pdfRowHeight, pdfPageWidth-2*pdfMargin, pdfRowHeight)
+		l.row(columns, widths, nil, true)
+	}
+	l.ensure(pdfRowHeight * 2)
+	header()
+	for _, row := range rows {
+		if l.ensure(pdfRowHeight) {
+			header()
+		}
+		l.row(columns, widths, row, false)
+	}
+}
+
+// row 绘制表格的一行及其下边框，cells 为空时绘制表头
+func (l *pdfLayout) row(columns []PDFColumn, widths []float64, cells []string, isHeader bool) {
+	x := pdfMargin
+	for i, column := range columns {
+		value := column.Title
+		if !isHeader {
+			value = ""
+			if i < len(cells) {
+				value = cells[i]
+			}
+		}
+		value = truncatePDFText(value, widths[i]-6, pdfFontSize)
+		textX := x + 3
+		if column.AlignRight {
+			textX = x + widths[i] - 3 - pdfTextWidth(value, pdfFontSize)
+		}
+		l.text(textX, l.y-pdfRowHeight+5, pdfFontSize, isHeader, value)
+		x += widths[i]
+	}
+	l.y -= pdfRowHeight
+	fmt.Fprintf(l.page, "0.5 w 0.6 G %.2f %.2f m %.2f %.2f l S 0 G\n", pdfMargin, l.y, pdfPageWidth-pdfMargin, l.y)
+}
+
+// write 输出 PDF 文件结构：目录、页面树、字体和每页的内容流
+func (l *pdfLayout) write(w io.Writer) error {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	// 对象编号：1 目录，2 页面树，3-5 字体，之后每页依次为页面和内容流
+	kids := make([]string, len(l.pages))
+	for i := range l.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(l.pages)))
+	object("<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light /Encoding /UniGB-UCS2-H /DescendantFonts [4 0 R] >>")
+	object("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light " +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> /FontDescriptor 5 0 R /DW 1000 /W [1 95 500] >>")
+	object("<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] " +
+		"/ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>")
+	for i, page := range l.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 7+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	// 交叉引用表
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// writePDFText 写入一段文字，文字按 UCS-2 编码；粗体通过描边模拟
+func writePDFText(buf *bytes.Buffer, x, y, size float64, bold bool, s string) {
+	if s == "" {
+		return
+	}
+	mode := 0
+	if bold {
+		mode = 2
+	}
+	fmt.Fprintf(buf, "BT /F1 %.1f Tf %d Tr 0.3 w %.2f %.2f Td <", size, mode, x, y)
+	for _, r := range s {
+		if r > 0xFFFF {
+			r = '?'
+		}
+		fmt.Fprintf(buf, "%04X", r)
+	}
+	buf.WriteString("> Tj ET\n")
+}
+
+// pdfTextWidth 估算文字宽度，ASCII 字符为半角，其他字符为全角
+func pdfTextWidth(s string, size float64) float64 {
+	var width float64
+	for _, r := range s {
+		if r < 0x80 {
+			width += size / 2
+		} else {
+			width += size
+		}
+	}
+	return width
+}
+
+// truncatePDFText 截断超出宽度的文字
+func truncatePDFText(s string, width, size float64) string {
+	if pdfTextWidth(s, size) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && pdfTextWidth(string(runes)+"…", size) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
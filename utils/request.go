@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/itsHenry35/canteen-management-system/config"
+)
+
+// ClientIP 获取请求的客户端IP
+// 只有请求来自 server.trusted_proxies 中的反向代理时，才使用代理设置的 X-Real-IP 或 X-Forwarded-For，
+// 否则这些请求头可以由客户端任意伪造，直接使用连接的对端地址
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrustedProxy(host) {
+		return host
+	}
+
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	// X-Forwarded-For 从右向左依次为离服务器最近的代理，跳过可信代理后的第一个地址为客户端
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		addrs := strings.Split(forwarded, ",")
+		for i := len(addrs) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(addrs[i])
+			if ip != "" && (i == 0 || !isTrustedProxy(ip)) {
+				return ip
+			}
+		}
+	}
+	return host
+}
+
+// isTrustedProxy 判断地址是否在 server.trusted_proxies 中
+func isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range config.Get().Server.TrustedProxies {
+		network, err := config.ParseTrustedProxy(proxy)
+		if err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
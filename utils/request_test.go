@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/itsHenry35/canteen-management-system/config"
+)
+
+// TestMain 在临时目录中使用默认配置运行测试，避免在源码目录中生成配置文件
+func TestMain(m *testing.M) {
+	os.Exit(runInTempDir(m))
+}
+
+func runInTempDir(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "canteen-utils-test")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chdir(dir); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if err := config.Load(); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return m.Run()
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trusted    []string
+		remoteAddr string
+		realIP     string
+		forwarded  string
+		want       string
+	}{
+		{"no proxy configured", nil, "203.0.113.5:1234", "1.2.3.4", "5.6.7.8", "203.0.113.5"},
+		{"untrusted remote", []string{"127.0.0.1"}, "203.0.113.5:1234", "1.2.3.4", "5.6.7.8", "203.0.113.5"},
+		{"trusted real ip", []string{"127.0.0.1"}, "127.0.0.1:1234", "1.2.3.4", "5.6.7.8", "1.2.3.4"},
+		{"trusted cidr", []string{"10.0.0.0/8"}, "10.1.2.3:1234", "", "1.2.3.4", "1.2.3.4"},
+		{"skip trusted hops", []string{"10.0.0.0/8"}, "10.1.2.3:1234", "", "9.9.9.9, 1.2.3.4, 10.0.0.7", "1.2.3.4"},
+		{"all hops trusted", []string{"10.0.0.0/8"}, "10.1.2.3:1234", "", "10.0.0.8, 10.0.0.7", "10.0.0.8"},
+		{"trusted without headers", []string{"127.0.0.1"}, "127.0.0.1:1234", "", "", "127.0.0.1"},
+		{"ipv6 remote", []string{"::1"}, "[::1]:1234", "1.2.3.4", "", "1.2.3.4"},
+	}
+	server := &config.Get().Server
+	saved := server.TrustedProxies
+	defer func() { server.TrustedProxies = saved }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.TrustedProxies = tt.trusted
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := ClientIP(req); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// ReadTable 读取上传的 CSV 或 XLSX 表格，按文件扩展名判断格式，XLSX 只读取第一个工作表
+// 返回的单元格已去除首尾空白，空行保留为空切片，以便行号与文件中一致
+func ReadTable(filename string, r io.Reader) ([][]string, error) {
+	var rows [][]string
+	var err error
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		rows, err = readCSV(r)
+	case ".xlsx":
+		rows, err = readXLSX(r)
+	default:
+		return nil, errors.New("只支持 CSV 或 XLSX 文件")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 去除单元格首尾空白
+	for _, row := range rows {
+		for i := range row {
+			row[i] = strings.TrimSpace(row[i])
+		}
+	}
+
+	return rows, nil
+}
+
+// readCSV 读取 CSV 文件，兼容 Excel 保存的带 BOM 的 UTF-8 和 GBK 编码
+func readCSV(r io.Reader) ([][]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// 去除 UTF-8 BOM，非 UTF-8 内容按 GB18030（兼容 GBK）解码
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		if data, err = simplifiedchinese.GB18030.NewDecoder().Bytes(data); err != nil {
+			return nil, errors.New("无法识别 CSV 文件的编码")
+		}
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.New("CSV 文件格式错误: " + err.Error())
+	}
+	return rows, nil
+}
+
+// readXLSX 读取 XLSX 文件的第一个工作表
+func readXLSX(r io.Reader) ([][]string, error) {
+	file, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, errors.New("无法读取 XLSX 文件: " + err.Error())
+	}
+	defer file.Close()
+
+	sheets := file.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, errors.New("XLSX 文件中没有工作表")
+	}
+	return file.GetRows(sheets[0])
+}
+
+// TableColumn 在表头中查找列，names 为该列可接受的名称（不区分大小写），未找到时返回 -1
+func TableColumn(header []string, names ...string) int {
+	for i, title := range header {
+		for _, name := range names {
+			if strings.EqualFold(strings.TrimSpace(title), name) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// TableCell 获取行中指定列的值，列不存在或超出该行时返回空字符串
+func TableCell(row []string, col int) string {
+	if col < 0 || col >= len(row) {
+		return ""
+	}
+	return row[col]
+}
+
+// IsEmptyRow 判断是否为空行
+func IsEmptyRow(row []string) bool {
+	for _, cell := range row {
+		if cell != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// TableSheet 导出表格中的一个工作表
+type TableSheet struct {
+	Name string
+	Rows [][]interface{} // 第一行为表头
+}
+
+// WriteXLSX 将工作表写入 XLSX 文件，表头加粗并冻结首行
+func WriteXLSX(w io.Writer, sheets []TableSheet) error {
+	file := excelize.NewFile()
+	defer file.Close()
+
+	headerStyle, err := file.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+
+	for i, sheet := range sheets {
+		// 第一个工作表重命名默认的 Sheet1
+		if i == 0 {
+			if err := file.SetSheetName("Sheet1", sheet.Name); err != nil {
+				return err
+			}
+		} else if _, err := file.NewSheet(sheet.Name); err != nil {
+			return err
+		}
+
+		// 写入数据
+		for r, row := range sheet.Rows {
+			cell, err := excelize.CoordinatesToCellName(1, r+1)
+			if err != nil {
+				return err
+			}
+			if err := file.SetSheetRow(sheet.Name, cell, &row); err != nil {
+				return err
+			}
+		}
+
+		// 表头样式
+		if len(sheet.Rows) > 0 && len(sheet.Rows[0]) > 0 {
+			lastCell, err := excelize.CoordinatesToCellName(len(sheet.Rows[0]), 1)
+			if err != nil {
+				return err
+			}
+			if err := file.SetCellStyle(sheet.Name, "A1", lastCell, headerStyle); err != nil {
+				return err
+			}
+			err = file.SetPanes(sheet.Name, &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return file.Write(w)
+}
+
+// WriteCSV 将工作表写入 CSV 文件，带 UTF-8 BOM 以便 Excel 正确识别中文
+// 文本单元格以 =、+、-、@ 开头时加上单引号前缀，防止 Excel 将其作为公式执行
+func WriteCSV(w io.Writer, sheet TableSheet) error {
+	if _, err := w.Write([]byte("\xef\xbb\xbf")); err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	for _, row := range sheet.Rows {
+		record := make([]string, len(row))
+		for i, value := range row {
+			switch v := value.(type) {
+			case nil:
+			case string:
+				record[i] = escapeCSVFormula(v)
+			case time.Time:
+				record[i] = v.Format("2006-01-02 15:04:05")
+			default:
+				record[i] = fmt.Sprint(v)
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// escapeCSVFormula 为可能被表格软件当作公式的文本加上单引号前缀
+func escapeCSVFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}